@@ -0,0 +1,190 @@
+// Package a11y finds common accessibility problems in a built site:
+// images without alt text, links without a name, pages without a
+// language and theme colors with too little contrast
+package a11y
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Issue is a problem found on a page, or in a stylesheet for contrast
+type Issue struct {
+	// The page's URL, or the stylesheet's path
+	Where   string
+	Problem string
+}
+
+// Check the HTML pages in dir, a built site, and the stylesheets in it
+// and in cssDirs, like the assets dir. Issues are sorted by where they
+// are, in document order
+func Check(dir string, cssDirs ...string) ([]Issue, error) {
+	var issues []Issue
+	sheets := &stylesheets{seen: make(map[[32]byte]bool)}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		rel = filepath.ToSlash(rel)
+		switch filepath.Ext(p) {
+		case ".css":
+			return sheets.addFile(p, rel)
+		case ".html":
+		default:
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		doc, err := html.Parse(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		url := "/" + strings.TrimSuffix(rel, ".html")
+		if url == "/index" {
+			url = "/"
+		}
+		for _, problem := range checkPage(doc, sheets, url) {
+			issues = append(issues, Issue{url, problem})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, cssDir := range cssDirs {
+		err := filepath.WalkDir(cssDir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || filepath.Ext(p) != ".css" {
+				return err
+			}
+			return sheets.addFile(p, filepath.ToSlash(p))
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	issues = append(issues, sheets.contrast()...)
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Where < issues[j].Where })
+	return issues, nil
+}
+
+func checkPage(doc *html.Node, sheets *stylesheets, url string) []string {
+	var problems []string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Html:
+				if strings.TrimSpace(attr(n, "lang")) == "" {
+					problems = append(problems, "no lang attribute on <html>, screen readers guess the language (give the layout <html lang=\"en\">)")
+				}
+			case atom.Img:
+				if _, ok := attrOK(n, "alt"); !ok && attr(n, "role") != "presentation" {
+					problems = append(problems, fmt.Sprintf("image without alt text: %s (use alt=\"\" for decorative images)", tag(n, "src")))
+				}
+			case atom.A:
+				if _, ok := attrOK(n, "href"); ok && !named(n) {
+					problems = append(problems, fmt.Sprintf("link without text: %s (add text, an image with alt text or aria-label)", tag(n, "href")))
+				}
+			case atom.Style:
+				if n.FirstChild != nil {
+					sheets.add(n.FirstChild.Data, url+" <style>")
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return problems
+}
+
+// Whether an element has an accessible name: text, an image with alt
+// text, or an aria-label, aria-labelledby or title
+func named(n *html.Node) bool {
+	if n.Type == html.TextNode {
+		return strings.TrimSpace(n.Data) != ""
+	}
+	if n.Type == html.ElementNode {
+		for _, key := range []string{"aria-label", "aria-labelledby", "title"} {
+			if strings.TrimSpace(attr(n, key)) != "" {
+				return true
+			}
+		}
+		if n.DataAtom == atom.Img && strings.TrimSpace(attr(n, "alt")) != "" {
+			return true
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if named(c) {
+			return true
+		}
+	}
+	return false
+}
+
+func attrOK(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func attr(n *html.Node, key string) string {
+	v, _ := attrOK(n, key)
+	return v
+}
+
+// The element's opening tag with just the attribute that identifies it
+func tag(n *html.Node, key string) string {
+	v, ok := attrOK(n, key)
+	if !ok {
+		return "<" + n.Data + ">"
+	}
+	if len(v) > 80 {
+		v = v[:77] + "..."
+	}
+	return fmt.Sprintf("<%s %s=%q>", n.Data, key, v)
+}
+
+// stylesheets collects CSS for the contrast check, each distinct sheet
+// once, since a layout's <style> is on every page
+type stylesheets struct {
+	seen  map[[32]byte]bool
+	rules []cssRule
+}
+
+func (s *stylesheets) addFile(path, name string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	s.add(string(data), name)
+	return nil
+}
+
+func (s *stylesheets) add(css, name string) {
+	sum := sha256.Sum256([]byte(css))
+	if s.seen[sum] {
+		return
+	}
+	s.seen[sum] = true
+	for _, r := range parseCSS(css) {
+		r.sheet = name
+		s.rules = append(s.rules, r)
+	}
+}
@@ -0,0 +1,278 @@
+package a11y
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// WCAG AA minimum for normal text
+const minContrast = 4.5
+
+// A CSS rule's declarations, by lower-cased property
+type cssRule struct {
+	sheet    string
+	selector string
+	decls    map[string]string
+}
+
+var cssCommentRe = regexp.MustCompile(`(?s)/\*.*?\*/`)
+
+// Rules with declarations, nested ones like those in @media get the
+// outer preludes in their selector: "@media (prefers-color-scheme: dark) :root"
+func parseCSS(css string) []cssRule {
+	css = cssCommentRe.ReplaceAllString(css, "")
+	var rules []cssRule
+	var stack []string
+	start := 0
+	for i := 0; i < len(css); i++ {
+		switch css[i] {
+		case '{':
+			prelude := css[start:i]
+			// Statements like @import end up in front
+			if j := strings.LastIndex(prelude, ";"); j >= 0 {
+				prelude = prelude[j+1:]
+			}
+			stack = append(stack, strings.Join(strings.Fields(prelude), " "))
+			start = i + 1
+		case '}':
+			if len(stack) == 0 {
+				start = i + 1
+				continue
+			}
+			if decls := parseDecls(css[start:i]); len(decls) > 0 {
+				rules = append(rules, cssRule{selector: strings.Join(stack, " "), decls: decls})
+			}
+			stack = stack[:len(stack)-1]
+			start = i + 1
+		}
+	}
+	return rules
+}
+
+func parseDecls(body string) map[string]string {
+	decls := make(map[string]string)
+	for _, d := range strings.Split(body, ";") {
+		prop, value, ok := strings.Cut(d, ":")
+		if !ok {
+			continue
+		}
+		prop = strings.TrimSpace(prop)
+		if !strings.HasPrefix(prop, "--") {
+			prop = strings.ToLower(prop)
+		}
+		value = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "!important"))
+		decls[prop] = value
+	}
+	return decls
+}
+
+// A set of theme variables: the ones of :root and html, or those with a
+// theme's own on top, like [data-theme=dark] or a dark mode media query
+type theme struct {
+	name string
+	vars map[string]string
+}
+
+func (s *stylesheets) themes() []theme {
+	base := theme{vars: make(map[string]string)}
+	var others []cssRule
+	for _, r := range s.rules {
+		if !hasVars(r) {
+			continue
+		}
+		if r.selector == ":root" || r.selector == "html" {
+			for k, v := range r.decls {
+				base.vars[k] = v
+			}
+			continue
+		}
+		others = append(others, r)
+	}
+	themes := []theme{base}
+	for _, r := range others {
+		t := theme{name: r.selector, vars: make(map[string]string)}
+		for k, v := range base.vars {
+			t.vars[k] = v
+		}
+		for k, v := range r.decls {
+			t.vars[k] = v
+		}
+		themes = append(themes, t)
+	}
+	return themes
+}
+
+func hasVars(r cssRule) bool {
+	for k := range r.decls {
+		if strings.HasPrefix(k, "--") {
+			return true
+		}
+	}
+	return false
+}
+
+// Rules setting both a text and a background color, checked with every
+// theme's variables
+func (s *stylesheets) contrast() []Issue {
+	var issues []Issue
+	seen := make(map[string]bool)
+	themes := s.themes()
+	for _, r := range s.rules {
+		fg, ok := r.decls["color"]
+		if !ok {
+			continue
+		}
+		bg, ok := r.decls["background-color"]
+		if !ok {
+			if bg, ok = r.decls["background"]; !ok {
+				continue
+			}
+		}
+		for _, t := range themes {
+			fgColor, ok1 := t.color(r, fg)
+			bgColor, ok2 := t.color(r, bg)
+			if !ok1 || !ok2 {
+				continue
+			}
+			ratio := contrastRatio(fgColor, bgColor)
+			key := fmt.Sprintf("%s|%s|%v|%v", r.sheet, r.selector, fgColor, bgColor)
+			if ratio >= minContrast || seen[key] {
+				continue
+			}
+			seen[key] = true
+			where := ""
+			if t.name != "" && (strings.Contains(fg, "var(") || strings.Contains(bg, "var(")) {
+				where = " with the variables of " + t.name
+			}
+			issues = append(issues, Issue{r.sheet, fmt.Sprintf("contrast %.2f:1 of %s (%s) on %s (%s) in %s%s, text needs %.1f:1",
+				ratio, fg, fgColor, bg, bgColor, r.selector, where, minContrast)})
+		}
+	}
+	return issues
+}
+
+var varRe = regexp.MustCompile(`var\(\s*(--[\w-]+)\s*(?:,\s*([^()]*(?:\([^()]*\))?[^()]*))?\)`)
+
+// Resolve the value's variables and read it as a color. For background
+// shorthands the first part that is a color counts
+func (t theme) color(r cssRule, value string) (rgb, bool) {
+	for i := 0; i < 10 && strings.Contains(value, "var("); i++ {
+		value = varRe.ReplaceAllStringFunc(value, func(m string) string {
+			sub := varRe.FindStringSubmatch(m)
+			if v, ok := r.decls[sub[1]]; ok {
+				return v
+			}
+			if v, ok := t.vars[sub[1]]; ok {
+				return v
+			}
+			return sub[2]
+		})
+	}
+	if c, ok := parseColor(value); ok {
+		return c, true
+	}
+	for _, part := range splitValue(value) {
+		if c, ok := parseColor(part); ok {
+			return c, true
+		}
+	}
+	return rgb{}, false
+}
+
+// Split a value on spaces outside parentheses
+func splitValue(value string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range value {
+		switch {
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ' ' && depth == 0:
+			parts = append(parts, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, value[start:])
+}
+
+type rgb [3]uint8
+
+func (c rgb) String() string {
+	return fmt.Sprintf("#%02x%02x%02x", c[0], c[1], c[2])
+}
+
+var namedColors = map[string]rgb{
+	"black": {0, 0, 0}, "white": {255, 255, 255}, "gray": {128, 128, 128}, "grey": {128, 128, 128},
+	"silver": {192, 192, 192}, "red": {255, 0, 0}, "green": {0, 128, 0}, "blue": {0, 0, 255},
+	"yellow": {255, 255, 0}, "orange": {255, 165, 0}, "navy": {0, 0, 128}, "maroon": {128, 0, 0},
+	"lightgray": {211, 211, 211}, "lightgrey": {211, 211, 211}, "darkgray": {169, 169, 169}, "darkgrey": {169, 169, 169},
+}
+
+var rgbFuncRe = regexp.MustCompile(`^rgba?\(\s*(\d+)[\s,]+(\d+)[\s,]+(\d+)\s*(?:[,/]\s*([\d.]+%?)\s*)?\)$`)
+
+// Opaque colors only, a translucent one depends on what's below it
+func parseColor(s string) (rgb, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if c, ok := namedColors[s]; ok {
+		return c, true
+	}
+	if hex, ok := strings.CutPrefix(s, "#"); ok {
+		if len(hex) == 3 || len(hex) == 4 {
+			var long []byte
+			for i := range hex {
+				long = append(long, hex[i], hex[i])
+			}
+			hex = string(long)
+		}
+		if len(hex) == 8 {
+			if hex[6:] != "ff" {
+				return rgb{}, false
+			}
+			hex = hex[:6]
+		}
+		v, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil || len(hex) != 6 {
+			return rgb{}, false
+		}
+		return rgb{uint8(v >> 16), uint8(v >> 8), uint8(v)}, true
+	}
+	if m := rgbFuncRe.FindStringSubmatch(s); m != nil {
+		if m[4] != "" && m[4] != "1" && m[4] != "100%" {
+			return rgb{}, false
+		}
+		var c rgb
+		for i := range c {
+			n, _ := strconv.Atoi(m[i+1])
+			c[i] = uint8(min(n, 255))
+		}
+		return c, true
+	}
+	return rgb{}, false
+}
+
+// WCAG contrast ratio, from 1 to 21
+func contrastRatio(a, b rgb) float64 {
+	la, lb := luminance(a), luminance(b)
+	if la < lb {
+		la, lb = lb, la
+	}
+	return (la + 0.05) / (lb + 0.05)
+}
+
+func luminance(c rgb) float64 {
+	var l [3]float64
+	for i, v := range c {
+		s := float64(v) / 255
+		if s <= 0.03928 {
+			l[i] = s / 12.92
+		} else {
+			l[i] = math.Pow((s+0.055)/1.055, 2.4)
+		}
+	}
+	return 0.2126*l[0] + 0.7152*l[1] + 0.0722*l[2]
+}
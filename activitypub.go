@@ -0,0 +1,55 @@
+package gomd
+
+import (
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/core6quad/GOMD/activitypub"
+	"github.com/core6quad/GOMD/compiler"
+	"github.com/core6quad/GOMD/server"
+)
+
+func (s *Site) enableActivityPub() {
+	actor, err := activitypub.Open(s.Config)
+	if err != nil {
+		slog.Error("failed to start activitypub", "err", err)
+		return
+	}
+	s.ActivityPub = actor
+	s.Server.Handle("/.well-known/webfinger", http.HandlerFunc(actor.ServeWebFinger))
+	// Every follow makes the server fetch the follower's key
+	s.Server.Handle("/activitypub/inbox", server.RateLimit(1, 10)(actor))
+	s.Server.Handle("/activitypub/", actor)
+}
+
+// Root-relative links and images in posts, made absolute for other servers
+var rootRelRe = regexp.MustCompile(`(href|src)="/([^/"])`)
+
+// Hand the published posts of a build to the fediverse actor, newest first
+func (s *Site) publishPosts(opts compiler.Options, pages []*compiler.Page) {
+	cfg := s.Config.ActivityPub
+	now := time.Now()
+	var posts []activitypub.Post
+	for _, p := range pages {
+		if p.Source == "" || p.Date == nil || p.Date.After(now) || !opts.Indexable(p) {
+			continue
+		}
+		if cfg.Section != "" && !strings.HasPrefix(p.URL, cfg.Section+"/") {
+			continue
+		}
+		posts = append(posts, activitypub.Post{
+			URL:       opts.AbsURL(p.URL),
+			Title:     p.Title,
+			Summary:   p.Description,
+			Content:   rootRelRe.ReplaceAllString(string(p.Content), `$1="`+s.Config.SiteURL+`/$2`),
+			Published: *p.Date,
+			Tags:      p.Tags,
+		})
+	}
+	sort.SliceStable(posts, func(i, j int) bool { return posts[i].Published.After(posts[j].Published) })
+	s.ActivityPub.SetPosts(posts)
+}
@@ -0,0 +1,340 @@
+// Package activitypub makes a site followable from Mastodon and the rest of
+// the fediverse: an actor found through WebFinger, with an outbox of the
+// latest posts, and an inbox accepting follows. New posts are delivered to
+// every follower.
+package activitypub
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/core6quad/GOMD/config"
+)
+
+// Posts listed in the outbox
+const outboxSize = 20
+
+const (
+	contentType = "application/activity+json"
+	public      = "https://www.w3.org/ns/activitystreams#Public"
+)
+
+// Post is a page published to followers
+type Post struct {
+	URL       string // absolute
+	Title     string
+	Summary   string
+	Content   string // HTML
+	Published time.Time
+	Tags      []string
+}
+
+// Follower is a remote account following the site
+type Follower struct {
+	ID          string `json:"id"`
+	Inbox       string `json:"inbox"`
+	SharedInbox string `json:"shared_inbox,omitempty"`
+}
+
+// Kept in data_dir/activitypub.json
+type state struct {
+	Followers []Follower `json:"followers"`
+	// Posts already sent to followers, by URL
+	Delivered []string `json:"delivered"`
+}
+
+// Actor is the site's fediverse account
+type Actor struct {
+	cfg  config.ActivityPubConfig
+	root string // SiteURL with the base path
+	host string
+	key  *rsa.PrivateKey
+
+	mu    sync.Mutex
+	path  string
+	state state
+	// A new state file marks the posts of the first build as delivered,
+	// so followers aren't flooded with the whole archive
+	fresh bool
+	posts []Post
+}
+
+// Open loads the actor's key and followers from the data dir, creating
+// the key the first time
+func Open(cfg config.Config) (*Actor, error) {
+	u, err := url.Parse(cfg.SiteURL)
+	if err != nil || u.Host == "" {
+		return nil, errors.New("activitypub needs site_url")
+	}
+	a := &Actor{
+		cfg:  cfg.ActivityPub,
+		root: cfg.SiteURL + cfg.BasePath,
+		host: u.Host,
+		path: filepath.Join(cfg.DataDir, "activitypub.json"),
+	}
+	if a.key, err = loadKey(filepath.Join(cfg.DataDir, "activitypub.key")); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(a.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		a.fresh = true
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &a.state); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func loadKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("invalid " + path)
+		}
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	data = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return key, os.WriteFile(path, data, 0600)
+}
+
+// Write the state atomically, the caller holds mu
+func (a *Actor) save() error {
+	data, err := json.MarshalIndent(a.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := a.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, a.path)
+}
+
+// Followers returns everyone following the site
+func (a *Actor) Followers() []Follower {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]Follower(nil), a.state.Followers...)
+}
+
+// SetPosts updates the outbox after a build, newest first, and sends
+// posts followers haven't seen yet
+func (a *Actor) SetPosts(posts []Post) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.posts = posts
+	delivered := make(map[string]bool, len(a.state.Delivered))
+	for _, url := range a.state.Delivered {
+		delivered[url] = true
+	}
+	var todo []Post
+	for _, p := range posts {
+		if !delivered[p.URL] {
+			a.state.Delivered = append(a.state.Delivered, p.URL)
+			if !a.fresh {
+				todo = append(todo, p)
+			}
+		}
+	}
+	if a.fresh || len(todo) > 0 {
+		a.fresh = false
+		if err := a.save(); err != nil {
+			slog.Error("failed to save activitypub state", "err", err)
+		}
+	}
+	inboxes := a.inboxes()
+	if len(todo) == 0 || len(inboxes) == 0 {
+		return
+	}
+	go func() {
+		// Oldest first, so timelines show them in order
+		for i := len(todo) - 1; i >= 0; i-- {
+			activity := a.create(todo[i])
+			for _, inbox := range inboxes {
+				if err := a.deliver(inbox, activity); err != nil {
+					slog.Warn("activitypub delivery failed", "inbox", inbox, "post", todo[i].URL, "err", err)
+				}
+			}
+		}
+		slog.Info("posts sent to followers", "posts", len(todo), "inboxes", len(inboxes))
+	}()
+}
+
+// Inboxes to deliver to, one per server when they share one. The caller
+// holds mu
+func (a *Actor) inboxes() []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, f := range a.state.Followers {
+		inbox := f.Inbox
+		if f.SharedInbox != "" {
+			inbox = f.SharedInbox
+		}
+		if !seen[inbox] {
+			seen[inbox] = true
+			out = append(out, inbox)
+		}
+	}
+	return out
+}
+
+func (a *Actor) id() string { return a.root + "/activitypub/actor" }
+
+func (a *Actor) name() string {
+	if a.cfg.Name != "" {
+		return a.cfg.Name
+	}
+	return a.cfg.User
+}
+
+func (a *Actor) actor() map[string]interface{} {
+	pub, _ := x509.MarshalPKIXPublicKey(&a.key.PublicKey)
+	return map[string]interface{}{
+		"@context":                  []string{"https://www.w3.org/ns/activitystreams", "https://w3id.org/security/v1"},
+		"id":                        a.id(),
+		"type":                      "Service",
+		"preferredUsername":         a.cfg.User,
+		"name":                      a.name(),
+		"summary":                   a.cfg.Summary,
+		"url":                       a.root + "/",
+		"inbox":                     a.root + "/activitypub/inbox",
+		"outbox":                    a.root + "/activitypub/outbox",
+		"followers":                 a.root + "/activitypub/followers",
+		"manuallyApprovesFollowers": false,
+		"discoverable":              true,
+		"publicKey": map[string]string{
+			"id":           a.id() + "#main-key",
+			"owner":        a.id(),
+			"publicKeyPem": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})),
+		},
+	}
+}
+
+// The Create activity announcing a post
+func (a *Actor) create(p Post) map[string]interface{} {
+	published := p.Published.UTC().Format(time.RFC3339)
+	followers := a.root + "/activitypub/followers"
+	var tags []map[string]string
+	for _, t := range p.Tags {
+		tags = append(tags, map[string]string{"type": "Hashtag", "name": "#" + strings.ReplaceAll(t, " ", "")})
+	}
+	return map[string]interface{}{
+		"@context":  "https://www.w3.org/ns/activitystreams",
+		"id":        p.URL + "#create",
+		"type":      "Create",
+		"actor":     a.id(),
+		"published": published,
+		"to":        []string{public},
+		"cc":        []string{followers},
+		"object": map[string]interface{}{
+			"id":           p.URL,
+			"type":         "Article",
+			"name":         p.Title,
+			"summary":      p.Summary,
+			"content":      p.Content,
+			"url":          p.URL,
+			"attributedTo": a.id(),
+			"published":    published,
+			"to":           []string{public},
+			"cc":           []string{followers},
+			"tag":          tags,
+		},
+	}
+}
+
+func writeJSON(w http.ResponseWriter, ctype string, v interface{}) {
+	w.Header().Set("Content-Type", ctype)
+	json.NewEncoder(w).Encode(v)
+}
+
+// ServeWebFinger answers /.well-known/webfinger?resource=acct:user@host,
+// how Mastodon finds the actor for @user@host
+func (a *Actor) ServeWebFinger(w http.ResponseWriter, r *http.Request) {
+	resource := r.URL.Query().Get("resource")
+	if !strings.EqualFold(resource, "acct:"+a.cfg.User+"@"+a.host) && resource != a.id() {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	writeJSON(w, "application/jrd+json", map[string]interface{}{
+		"subject": "acct:" + a.cfg.User + "@" + a.host,
+		"aliases": []string{a.id()},
+		"links": []map[string]string{
+			{"rel": "self", "type": contentType, "href": a.id()},
+			{"rel": "http://webfinger.net/rel/profile-page", "type": "text/html", "href": a.root + "/"},
+		},
+	})
+}
+
+// ServeHTTP handles the actor and its collections under /activitypub/
+func (a *Actor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/activitypub/inbox" {
+		a.serveInbox(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch r.URL.Path {
+	case "/activitypub/actor":
+		writeJSON(w, contentType, a.actor())
+	case "/activitypub/outbox":
+		a.mu.Lock()
+		posts := a.posts
+		a.mu.Unlock()
+		if len(posts) > outboxSize {
+			posts = posts[:outboxSize]
+		}
+		items := []interface{}{}
+		for _, p := range posts {
+			items = append(items, a.create(p))
+		}
+		writeJSON(w, contentType, map[string]interface{}{
+			"@context":     "https://www.w3.org/ns/activitystreams",
+			"id":           a.root + "/activitypub/outbox",
+			"type":         "OrderedCollection",
+			"totalItems":   len(items),
+			"orderedItems": items,
+		})
+	case "/activitypub/followers":
+		// Only the count, who follows the site is nobody else's business
+		writeJSON(w, contentType, map[string]interface{}{
+			"@context":   "https://www.w3.org/ns/activitystreams",
+			"id":         a.root + "/activitypub/followers",
+			"type":       "OrderedCollection",
+			"totalItems": len(a.Followers()),
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
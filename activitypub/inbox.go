@@ -0,0 +1,188 @@
+package activitypub
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+// An incoming activity, only the parts the inbox looks at
+type activity struct {
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	Actor  string          `json:"actor"`
+	Object json.RawMessage `json:"object"`
+}
+
+// A remote account, or the key document its keyId points to
+type remoteActor struct {
+	ID        string `json:"id"`
+	Inbox     string `json:"inbox"`
+	Endpoints struct {
+		SharedInbox string `json:"sharedInbox"`
+	} `json:"endpoints"`
+	PublicKey struct {
+		ID           string `json:"id"`
+		Owner        string `json:"owner"`
+		PublicKeyPem string `json:"publicKeyPem"`
+	} `json:"publicKey"`
+	// Set when keyId points to the key itself
+	Owner        string `json:"owner"`
+	PublicKeyPem string `json:"publicKeyPem"`
+}
+
+// The inbox takes signed follows and unfollows, anything else is accepted
+// and ignored
+func (a *Actor) serveInbox(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	var act activity
+	if err := json.Unmarshal(body, &act); err != nil {
+		http.Error(w, "invalid activity", http.StatusBadRequest)
+		return
+	}
+	switch act.Type {
+	case "Follow", "Undo":
+	default:
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	sender, err := a.verify(r, body)
+	if err != nil {
+		// Why stays in the log, it can tell what the server reached
+		slog.Info("activitypub signature refused", "actor", act.Actor, "err", err)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	if sender.ID != act.Actor {
+		http.Error(w, "signed by someone else", http.StatusForbidden)
+		return
+	}
+	switch act.Type {
+	case "Follow":
+		var object string
+		if json.Unmarshal(act.Object, &object) != nil || object != a.id() {
+			http.Error(w, "can only follow "+a.id(), http.StatusBadRequest)
+			return
+		}
+		if sender.Inbox == "" {
+			http.Error(w, "follower has no inbox", http.StatusBadRequest)
+			return
+		}
+		// Deliveries go to the inboxes, which have to be the follower's own
+		host := httpHost(sender.ID)
+		if httpHost(sender.Inbox) != host || sender.Endpoints.SharedInbox != "" && httpHost(sender.Endpoints.SharedInbox) != host {
+			http.Error(w, "follower's inbox is on another host", http.StatusBadRequest)
+			return
+		}
+		a.follow(Follower{ID: sender.ID, Inbox: sender.Inbox, SharedInbox: sender.Endpoints.SharedInbox})
+		accept := map[string]interface{}{
+			"@context": "https://www.w3.org/ns/activitystreams",
+			"id":       a.id() + "#accept-" + fmt.Sprintf("%x", sha256.Sum256([]byte(act.ID))),
+			"type":     "Accept",
+			"actor":    a.id(),
+			"object":   json.RawMessage(body),
+		}
+		go func() {
+			if err := a.deliver(sender.Inbox, accept); err != nil {
+				slog.Warn("activitypub accept failed", "follower", sender.ID, "err", err)
+			}
+		}()
+	case "Undo":
+		var undone activity
+		if json.Unmarshal(act.Object, &undone) == nil && undone.Type == "Follow" {
+			a.unfollow(sender.ID)
+		}
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (a *Actor) follow(f Follower) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, old := range a.state.Followers {
+		if old.ID == f.ID {
+			a.state.Followers = append(a.state.Followers[:i], a.state.Followers[i+1:]...)
+			break
+		}
+	}
+	a.state.Followers = append(a.state.Followers, f)
+	if err := a.save(); err != nil {
+		slog.Error("failed to save activitypub state", "err", err)
+	}
+	slog.Info("new fediverse follower", "follower", f.ID)
+}
+
+func (a *Actor) unfollow(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, f := range a.state.Followers {
+		if f.ID == id {
+			a.state.Followers = append(a.state.Followers[:i], a.state.Followers[i+1:]...)
+			if err := a.save(); err != nil {
+				slog.Error("failed to save activitypub state", "err", err)
+			}
+			return
+		}
+	}
+}
+
+// Fetch a remote actor or key, with a signed request for servers that
+// require one
+func (a *Actor) fetch(url string) (*remoteActor, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", contentType)
+	a.sign(req, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+	var actor remoteActor
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&actor); err != nil {
+		return nil, err
+	}
+	return &actor, nil
+}
+
+// Send a signed activity to an inbox
+func (a *Actor) deliver(inbox string, activity interface{}) error {
+	body, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, inbox, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	a.sign(req, body)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
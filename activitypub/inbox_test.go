@@ -0,0 +1,58 @@
+package activitypub
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInboxDoesNotFetchPrivateKeyIDs(t *testing.T) {
+	fetched := false
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched = true
+		http.Error(w, "secret upstream status", http.StatusTeapot)
+	}))
+	defer internal.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &Actor{root: "https://example.com", host: "example.com", key: key}
+	for _, keyID := range []string{internal.URL + "/key#main-key", "file:///etc/passwd", "gopher://example.com/key"} {
+		body := []byte(`{"type":"Follow","actor":"` + internal.URL + `/actor","object":"https://example.com/activitypub/actor"}`)
+		r := httptest.NewRequest(http.MethodPost, "/activitypub/inbox", bytes.NewReader(body))
+		a.sign(r, body)
+		sig := r.Header.Get("Signature")
+		r.Header.Set("Signature", strings.Replace(sig, a.id()+"#main-key", keyID, 1))
+		w := httptest.NewRecorder()
+		a.serveInbox(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: got status %d, want 401", keyID, w.Code)
+		}
+		if got := strings.TrimSpace(w.Body.String()); got != "invalid signature" {
+			t.Errorf("%s: 401 body tells why: %q", keyID, got)
+		}
+	}
+	if fetched {
+		t.Error("the inbox fetched a key from a loopback address")
+	}
+}
+
+func TestHTTPHost(t *testing.T) {
+	for raw, want := range map[string]string{
+		"https://Mastodon.Social/users/a#main-key": "mastodon.social",
+		"http://example.com:8080/inbox":            "example.com:8080",
+		"file:///etc/passwd":                       "",
+		"ftp://example.com/":                       "",
+		"not a url":                                "",
+	} {
+		if got := httpHost(raw); got != want {
+			t.Errorf("httpHost(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
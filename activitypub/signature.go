@@ -0,0 +1,190 @@
+package activitypub
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Anyone can post to the inbox and make the server fetch their key, so
+// private and loopback addresses are off limits
+var client = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		// Never through a proxy, which would dial the target itself
+		// and skip the address check below
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, _ := net.SplitHostPort(address)
+				if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+					return errors.New("refusing to connect to " + host)
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+}
+
+// Replaced when testing against local servers
+var publicIP = func(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast())
+}
+
+// The host of an http(s) URL, "" for anything else
+func httpHost(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
+
+// Requests signed more than this long ago, or ahead, are refused
+const maxClockSkew = time.Hour
+
+func digest(body []byte) string {
+	h := sha256.Sum256(body)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(h[:])
+}
+
+// The string a signature covers: each header as "name: value" on its own
+// line, the pseudo header (request-target) being "post /inbox"
+func signingString(r *http.Request, headers []string) (string, error) {
+	lines := make([]string, len(headers))
+	for i, h := range headers {
+		var v string
+		switch h {
+		case "(request-target)":
+			// As received, before the base path was stripped
+			target := r.RequestURI
+			if target == "" {
+				target = r.URL.RequestURI()
+			}
+			v = strings.ToLower(r.Method) + " " + target
+		case "host":
+			v = r.Host
+			if v == "" {
+				v = r.URL.Host
+			}
+		default:
+			v = r.Header.Get(h)
+			if v == "" {
+				return "", errors.New("missing signed header " + h)
+			}
+		}
+		lines[i] = h + ": " + v
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// Sign a request with the actor's key, the way Mastodon expects: HTTP
+// Signatures over the target, host, date and, with a body, its digest
+func (a *Actor) sign(r *http.Request, body []byte) {
+	r.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	headers := []string{"(request-target)", "host", "date"}
+	if body != nil {
+		r.Header.Set("Digest", digest(body))
+		headers = append(headers, "digest")
+	}
+	s, _ := signingString(r, headers)
+	h := sha256.Sum256([]byte(s))
+	sig, _ := rsa.SignPKCS1v15(nil, a.key, crypto.SHA256, h[:])
+	r.Header.Set("Signature", `keyId="`+a.id()+`#main-key",algorithm="rsa-sha256",headers="`+strings.Join(headers, " ")+`",signature="`+base64.StdEncoding.EncodeToString(sig)+`"`)
+}
+
+// Check a request's signature against its sender's public key and return
+// the sender, who has to be on the host of the key
+func (a *Actor) verify(r *http.Request, body []byte) (*remoteActor, error) {
+	params := make(map[string]string)
+	for _, part := range strings.Split(r.Header.Get("Signature"), ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok {
+			params[k] = strings.Trim(v, `"`)
+		}
+	}
+	keyID, headers := params["keyId"], strings.Fields(params["headers"])
+	if keyID == "" || params["signature"] == "" {
+		return nil, errors.New("no signature")
+	}
+	if len(headers) == 0 {
+		headers = []string{"date"}
+	}
+	signed := make(map[string]bool)
+	for _, h := range headers {
+		signed[h] = true
+	}
+	if !signed["(request-target)"] || !signed["digest"] || !signed["date"] {
+		return nil, errors.New("signature must cover (request-target), date and digest")
+	}
+	if r.Header.Get("Digest") != digest(body) {
+		return nil, errors.New("digest does not match the body")
+	}
+	if date, err := http.ParseTime(r.Header.Get("Date")); err != nil || time.Since(date).Abs() > maxClockSkew {
+		return nil, errors.New("date missing or too far off")
+	}
+	s, err := signingString(r, headers)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.StdEncoding.DecodeString(params["signature"])
+	if err != nil {
+		return nil, err
+	}
+	keyURL, _, _ := strings.Cut(keyID, "#")
+	host := httpHost(keyURL)
+	if host == "" {
+		return nil, errors.New("keyId is not an http(s) URL")
+	}
+	doc, err := a.fetch(keyURL)
+	if err != nil {
+		return nil, err
+	}
+	if httpHost(doc.ID) != host {
+		return nil, errors.New("key document is from another host")
+	}
+	pemData, owner := doc.PublicKey.PublicKeyPem, doc.PublicKey.Owner
+	if pemData == "" {
+		pemData, owner = doc.PublicKeyPem, doc.Owner
+	}
+	block, _ := pem.Decode([]byte(pemData))
+	if block == nil {
+		return nil, errors.New("sender has no public key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("only RSA keys are supported")
+	}
+	h := sha256.Sum256([]byte(s))
+	if err := rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, h[:], sig); err != nil {
+		return nil, errors.New("signature does not match")
+	}
+	// The key may live in a document of its own, the inbox is the owner's
+	if owner != "" && owner != doc.ID {
+		if httpHost(owner) != host {
+			return nil, errors.New("key owner is on another host")
+		}
+		if doc, err = a.fetch(owner); err != nil {
+			return nil, err
+		}
+		if doc.PublicKey.PublicKeyPem != pemData || httpHost(doc.ID) != host {
+			return nil, errors.New("key not owned by its sender")
+		}
+	}
+	return doc, nil
+}
@@ -0,0 +1,144 @@
+// Package admin is the site owner's web UI under /admin. Other packages
+// add their own sections to it.
+package admin
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/core6quad/GOMD/auth"
+)
+
+// Admin routes /admin requests to its sections
+type Admin struct {
+	mu       sync.RWMutex
+	mux      *http.ServeMux
+	sections []Section
+	// BasePath the site is served under, for links between sections
+	BasePath string
+}
+
+// Section is a page of the admin UI, listed in its navigation
+type Section struct {
+	Title string
+	Path  string
+	// Role needed to open the section
+	Role auth.Role
+}
+
+// New creates an admin UI with just its index page
+func New() *Admin {
+	a := &Admin{mux: http.NewServeMux()}
+	a.mux.HandleFunc("/admin", a.serveIndex)
+	a.mux.HandleFunc("/admin/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/admin/" {
+			http.Redirect(w, r, a.BasePath+"/admin", http.StatusFound)
+			return
+		}
+		http.NotFound(w, r)
+	})
+	return a
+}
+
+// Add registers a section handler at path (and everything below it) for
+// accounts with at least role, and links it from their navigation
+func (a *Admin) Add(title, path string, role auth.Role, h http.Handler) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sections = append(a.sections, Section{Title: title, Path: path, Role: role})
+	h = requireRole(role, h)
+	a.mux.Handle(path, h)
+	a.mux.Handle(strings.TrimSuffix(path, "/")+"/", h)
+}
+
+// Sections lists the registered sections in order
+func (a *Admin) Sections() []Section {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return append([]Section(nil), a.sections...)
+}
+
+// Sections the signed in user of r may open
+func (a *Admin) allowedSections(r *http.Request) []Section {
+	user, _ := auth.FromContext(r.Context())
+	var allowed []Section
+	for _, sec := range a.Sections() {
+		if user.Role.Allows(sec.Role) {
+			allowed = append(allowed, sec)
+		}
+	}
+	return allowed
+}
+
+// The admin UI is mounted behind auth.Require, this refuses users whose
+// role is too low for a section
+func requireRole(role auth.Role, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := auth.FromContext(r.Context())
+		if !user.Role.Allows(role) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (a *Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mux.ServeHTTP(w, r)
+}
+
+func (a *Admin) serveIndex(w http.ResponseWriter, r *http.Request) {
+	a.Render(w, r, "Admin", template.HTML(`<p>Manage your site from the sections above, or see the <a href="`+template.HTMLEscapeString(a.BasePath)+`/analytics">analytics dashboard</a>.</p>`))
+}
+
+var page = template.Must(template.New("admin").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>{{.Title}} - GOMD Admin</title>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<style>
+	body { font-family: sans-serif; background: #181c20; color: #eee; margin: 0; padding: 0; }
+	.container { max-width: 1000px; margin: 40px auto; background: #23272b; border-radius: 10px; padding: 32px; box-shadow: 0 2px 16px #0004; }
+	nav a { color: #8ab4f8; margin-right: 16px; }
+	a { color: #8ab4f8; }
+	table { width: 100%; border-collapse: collapse; }
+	th, td { text-align: left; padding: 8px; border-bottom: 1px solid #333; vertical-align: top; }
+	button { background: #2d6cdf; color: #fff; border: 0; border-radius: 4px; padding: 4px 10px; cursor: pointer; }
+	button.danger { background: #c0392b; }
+	form.inline { display: inline; }
+	.empty { color: #888; }
+</style>
+</head>
+<body>
+<div class="container">
+	<nav><a href="{{.Base}}/admin">Admin</a>{{range .Sections}}<a href="{{$.Base}}{{.Path}}">{{.Title}}</a>{{end}}
+	{{if .CSRF}}<form class="inline" method="post" action="{{.Base}}/admin/logout" style="float:right">{{.CSRF}}{{.User}} <button>Sign out</button></form>{{end}}</nav>
+	<h1>{{.Title}}</h1>
+	{{.Body}}
+</div>
+</body>
+</html>
+`))
+
+// Render writes body inside the admin page layout, with navigation for
+// the sections the user of r may open
+func (a *Admin) Render(w http.ResponseWriter, r *http.Request, title string, body template.HTML) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	user, _ := auth.FromContext(r.Context())
+	// Signing out only applies to sessions, not basic auth
+	var csrf template.HTML
+	if auth.CSRFToken(r.Context()) != "" {
+		csrf = auth.CSRFField(r)
+	}
+	page.Execute(w, map[string]interface{}{
+		"Title":    title,
+		"Sections": a.allowedSections(r),
+		"User":     user.Name,
+		"CSRF":     csrf,
+		"Body":     body,
+		"Base":     a.BasePath,
+	})
+}
@@ -0,0 +1,180 @@
+// Package analytics counts page views and renders the analytics dashboard.
+package analytics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/core6quad/GOMD/config"
+	"github.com/core6quad/GOMD/webhook"
+)
+
+// Only count a view per IP+page every 10s
+const viewCooldown = 10 * time.Second
+
+// Analytics holds all counters. It is persisted as JSON.
+type Analytics struct {
+	mu sync.Mutex
+
+	TotalViews       int
+	PageViews        map[string]int
+	BrowserEngines   map[string]int
+	Countries        map[string]int
+	OperatingSystems map[string]int
+	DeviceTypes      map[string]int
+	ScreenSizes      map[string]int
+	Languages        map[string]int
+	DailyViews       map[string]int
+	// Views of A/B tested pages per variant
+	VariantViews map[string]map[string]int
+
+	// Track recent views per IP+page to avoid counting rapid reloads as new views
+	lastView *lru[string, struct{}]
+	// Country lookup cache to avoid repeated API calls
+	countries *countryCache
+
+	// Notifier receives "new_country" and "views_today" events, may be nil
+	Notifier *webhook.Notifier `json:"-"`
+
+	// The <script> loading Chart.js into the dashboard
+	chartScript string
+}
+
+// ChartJS is where the dashboard loads Chart.js from by default
+const ChartJS = "https://cdn.jsdelivr.net/npm/chart.js@4.4.1/dist/chart.umd.js"
+
+// SetChartScript replaces the <script> loading Chart.js, e.g. to add its
+// integrity or load a local copy. Empty leaves the dashboard without charts
+func (a *Analytics) SetChartScript(tag string) {
+	a.mu.Lock()
+	a.chartScript = tag
+	a.mu.Unlock()
+}
+
+// New returns empty analytics with caches sized by cfg
+func New(cfg config.CacheConfig) *Analytics {
+	countryTTL, err := time.ParseDuration(cfg.CountryTTL)
+	if err != nil {
+		countryTTL = 24 * time.Hour
+	}
+	return &Analytics{
+		PageViews:        make(map[string]int),
+		BrowserEngines:   make(map[string]int),
+		Countries:        make(map[string]int),
+		OperatingSystems: make(map[string]int),
+		DeviceTypes:      make(map[string]int),
+		ScreenSizes:      make(map[string]int),
+		Languages:        make(map[string]int),
+		DailyViews:       make(map[string]int),
+		VariantViews:     make(map[string]map[string]int),
+		chartScript:      `<script src="` + ChartJS + `"></script>`,
+		lastView:         newLRU[string, struct{}](cfg.MaxViewEntries, viewCooldown),
+		countries:        newCountryCache(cfg.MaxCountryEntries, countryTTL),
+	}
+}
+
+// Load reads counters saved by Save, a missing file is not an error
+func (a *Analytics) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return json.Unmarshal(data, a)
+}
+
+// Save writes all counters to path
+func (a *Analytics) Save(path string) error {
+	a.mu.Lock()
+	data, err := json.MarshalIndent(a, "", "  ")
+	a.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// CacheStats reports the size of the in-memory caches, for /status
+func (a *Analytics) CacheStats() map[string]int {
+	views, viewEvictions := a.lastView.Stats()
+	countries, countryEvictions := a.countries.entries.Stats()
+	return map[string]int{
+		"view_entries":      views,
+		"view_evictions":    viewEvictions,
+		"country_entries":   countries,
+		"country_evictions": countryEvictions,
+	}
+}
+
+// ServeJSON writes all counters as JSON
+func (a *Analytics) ServeJSON(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a)
+}
+
+// RecordView counts a page view, with cooldown per IP+page
+func (a *Analytics) RecordView(r *http.Request, path string) {
+	a.recordView(r, path, "")
+}
+
+// RecordVariantView counts a view of an A/B tested page, for the page and
+// for the variant served
+func (a *Analytics) RecordVariantView(r *http.Request, path, variant string) {
+	a.recordView(r, path, variant)
+}
+
+func (a *Analytics) recordView(r *http.Request, path, variant string) {
+	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+	key := ip + "|" + path
+	now := time.Now()
+
+	// Entries expire after the cooldown, so any hit is a recent view
+	if _, ok := a.lastView.Get(key); ok {
+		return
+	}
+	a.lastView.Set(key, struct{}{})
+
+	// Country detection may hit the network, so do it outside the lock
+	country := a.countries.lookup(ip)
+	ua := r.UserAgent()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.TotalViews++
+	a.PageViews[path]++
+	if variant != "" {
+		if a.VariantViews[path] == nil {
+			a.VariantViews[path] = make(map[string]int)
+		}
+		a.VariantViews[path][variant]++
+	}
+	// Browser engine, OS and device type detection
+	a.BrowserEngines[detectBrowserEngine(ua)]++
+	a.OperatingSystems[detectOS(ua)]++
+	a.DeviceTypes[detectDeviceType(ua)]++
+	a.Countries[country]++
+	if a.Countries[country] == 1 && country != "Unknown" {
+		a.Notifier.Notify("new_country", fmt.Sprintf("New visitor country: %s", country), map[string]interface{}{"country": country})
+	}
+	// Daily views, webhooks fire when a threshold is crossed
+	today := now.Format("2006-01-02")
+	a.DailyViews[today]++
+	if a.Notifier != nil {
+		for _, hook := range a.Notifier.Hooks {
+			if hook.Threshold > 0 && a.DailyViews[today] == hook.Threshold {
+				a.Notifier.Send(hook, "views_today", fmt.Sprintf("Views today crossed %d", hook.Threshold), map[string]interface{}{"views": hook.Threshold, "date": today})
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package analytics
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// BeaconScript returns a tiny first-party beacon appended to every page
+// when enabled in config. It reports viewport size and language to
+// basePath+"/collect", unless Do Not Track is set.
+func BeaconScript(basePath string) string {
+	return strings.ReplaceAll(beaconScript, "{{collect}}", basePath+"/collect")
+}
+
+const beaconScript = `
+<script>(function(){if(navigator.doNotTrack==="1"||window.doNotTrack==="1")return;var d=JSON.stringify({w:window.innerWidth,h:window.innerHeight,l:navigator.language});if(navigator.sendBeacon){navigator.sendBeacon("{{collect}}",d)}else{fetch("{{collect}}",{method:"POST",body:d,keepalive:true})}})();</script>
+`
+
+var languageTagRe = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{1,8})*$`)
+
+// ServeCollect records viewport size and language reported by BeaconScript
+func (a *Analytics) ServeCollect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// Respect Do Not Track even if the script was bypassed
+	if r.Header.Get("DNT") == "1" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	var data struct {
+		Width    int    `json:"w"`
+		Height   int    `json:"h"`
+		Language string `json:"l"`
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 1024)
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	a.mu.Lock()
+	if data.Width > 0 {
+		a.ScreenSizes[screenSizeBucket(data.Width)]++
+	}
+	if languageTagRe.MatchString(data.Language) {
+		// Only keep the primary language subtag, "en-US" -> "en"
+		lang := strings.ToLower(strings.SplitN(data.Language, "-", 2)[0])
+		a.Languages[lang]++
+	}
+	a.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Group viewport widths into common breakpoints
+func screenSizeBucket(width int) string {
+	switch {
+	case width < 576:
+		return "XS (<576px)"
+	case width < 768:
+		return "S (576-767px)"
+	case width < 992:
+		return "M (768-991px)"
+	case width < 1200:
+		return "L (992-1199px)"
+	default:
+		return "XL (1200px+)"
+	}
+}
@@ -0,0 +1,48 @@
+package analytics
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+)
+
+var geoClient = &http.Client{Timeout: 3 * time.Second}
+
+// countryCache remembers the country of each IP to avoid repeated API calls
+type countryCache struct {
+	entries *lru[string, string]
+}
+
+func newCountryCache(max int, ttl time.Duration) *countryCache {
+	return &countryCache{entries: newLRU[string, string](max, ttl)}
+}
+
+func (c *countryCache) lookup(ip string) string {
+	if ip == "" {
+		return "Unknown"
+	}
+	if country, ok := c.entries.Get(ip); ok {
+		return country
+	}
+	country := fetchCountry(ip)
+	c.entries.Set(ip, country)
+	return country
+}
+
+// Use ip-api.com for free IP geolocation
+func fetchCountry(ip string) string {
+	resp, err := geoClient.Get("http://ip-api.com/json/" + ip + "?fields=countryCode")
+	if err != nil {
+		return "Unknown"
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	var result struct {
+		CountryCode string `json:"countryCode"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || result.CountryCode == "" {
+		return "Unknown"
+	}
+	return result.CountryCode
+}
@@ -0,0 +1,389 @@
+package analytics
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// ServeDashboard serves the analytics dashboard with charts and server stats
+func (a *Analytics) ServeDashboard(w http.ResponseWriter, r *http.Request) {
+	// Get memory stats
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	memMB := float64(m.Alloc) / 1024.0 / 1024.0
+	// Get CPU count
+	cpuCount := runtime.NumCPU()
+
+	a.mu.Lock()
+	totalViews := a.TotalViews
+	// Prepare page view data for chart
+	pageLabels, pageViews := chartData(a.PageViews)
+	// Prepare browser engine data for chart
+	engineLabels, engineCounts := chartData(a.BrowserEngines)
+	// Prepare country data for chart
+	countryLabels, countryCounts := countryChartData(a.Countries)
+	// Prepare OS and device type data for charts
+	osLabels, osCounts := chartData(a.OperatingSystems)
+	deviceLabels, deviceCounts := chartData(a.DeviceTypes)
+	// Prepare beacon data for charts
+	screenLabels, screenCounts := chartData(a.ScreenSizes)
+	languageLabels, languageCounts := chartData(a.Languages)
+	variants := variantSummary(a.VariantViews)
+	chartScript := a.chartScript
+	a.mu.Unlock()
+
+	// Serve a styled HTML analytics dashboard with charts and server stats
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(`
+<!DOCTYPE html>
+<html>
+<head>
+<title>GOMD Analytics</title>
+` + chartScript + `
+<style>
+	body { font-family: sans-serif; background: #181c20; color: #eee; margin: 0; padding: 0; }
+	.container { max-width: 1200px; margin: 40px auto; background: #23272b; border-radius: 10px; padding: 32px; box-shadow: 0 2px 16px #0004; }
+	h1 { text-align: center; }
+	.stats { margin: 24px 0; font-size: 1.2em; }
+	canvas { background: #fff; border-radius: 8px; margin-bottom: 32px; }
+	.footer { text-align: center; margin-top: 32px; color: #888; font-size: 0.9em; }
+	.charts { display: flex; flex-wrap: wrap; gap: 24px; justify-content: center; }
+	.chart-block { flex: 1 1 30%; min-width: 0; }
+	@media (max-width: 1000px) {
+		.chart-block { min-width: 320px; }
+	}
+</style>
+</head>
+<body>
+<div class="container">
+	<h1>GOMD Analytics</h1>
+	<div class="stats">
+		<b>Total Views:</b> ` + itoa(totalViews) + `<br>
+		<b>CPU Cores:</b> ` + itoa(cpuCount) + `<br>
+		<b>Memory Usage:</b> ` + formatFloat(memMB) + ` MB
+		` + variants + `
+	</div>
+	<div class="charts">
+		<div class="chart-block">
+			<canvas id="viewsChart" width="400" height="250"></canvas>
+		</div>
+		<div class="chart-block">
+			<canvas id="browserChart" width="400" height="250"></canvas>
+		</div>
+		<div class="chart-block">
+			<canvas id="countryChart" width="400" height="250"></canvas>
+		</div>
+		<div class="chart-block">
+			<canvas id="osChart" width="400" height="250"></canvas>
+		</div>
+		<div class="chart-block">
+			<canvas id="deviceChart" width="400" height="250"></canvas>
+		</div>
+		<div class="chart-block">
+			<canvas id="screenChart" width="400" height="250"></canvas>
+		</div>
+		<div class="chart-block">
+			<canvas id="languageChart" width="400" height="250"></canvas>
+		</div>
+	</div>
+	<div class="footer">GOMD Analytics &mdash; Live stats</div>
+</div>
+<script>
+	const viewsCtx = document.getElementById('viewsChart').getContext('2d');
+	const viewsData = {
+		labels: ` + pageLabels + `,
+		datasets: [{
+			label: 'Page Views',
+			data: ` + pageViews + `,
+			backgroundColor: 'rgba(54, 162, 235, 0.5)',
+			borderColor: 'rgba(54, 162, 235, 1)',
+			borderWidth: 2
+		}]
+	};
+	new Chart(viewsCtx, {
+		type: 'bar',
+		data: viewsData,
+		options: {
+			scales: { y: { beginAtZero: true } },
+			responsive: true,
+			maintainAspectRatio: false,
+			plugins: {
+				title: {
+					display: true,
+					text: 'Most Viewed Pages'
+				}
+			}
+		}
+	});
+
+	const browserCtx = document.getElementById('browserChart').getContext('2d');
+	const browserData = {
+		labels: ` + engineLabels + `,
+		datasets: [{
+			label: 'Browser Engines',
+			data: ` + engineCounts + `,
+			backgroundColor: [
+				'rgba(255, 99, 132, 0.5)',
+				'rgba(255, 205, 86, 0.5)',
+				'rgba(75, 192, 192, 0.5)',
+				'rgba(54, 162, 235, 0.5)',
+				'rgba(153, 102, 255, 0.5)'
+			],
+			borderColor: [
+				'rgba(255, 99, 132, 1)',
+				'rgba(255, 205, 86, 1)',
+				'rgba(75, 192, 192, 1)',
+				'rgba(54, 162, 235, 1)',
+				'rgba(153, 102, 255, 1)'
+			],
+			borderWidth: 2
+		}]
+	};
+	new Chart(browserCtx, {
+		type: 'pie',
+		data: browserData,
+		options: {
+			plugins: {
+				legend: { position: 'bottom' },
+				title: {
+					display: true,
+					text: 'Most Popular Browser Engines'
+				}
+			},
+			responsive: true,
+			maintainAspectRatio: false
+		}
+	});
+
+	const countryCtx = document.getElementById('countryChart').getContext('2d');
+	const countryData = {
+		labels: ` + countryLabels + `,
+		datasets: [{
+			label: 'Countries',
+			data: ` + countryCounts + `,
+			backgroundColor: [
+				'rgba(255, 99, 132, 0.5)',
+				'rgba(255, 205, 86, 0.5)',
+				'rgba(75, 192, 192, 0.5)',
+				'rgba(54, 162, 235, 0.5)',
+				'rgba(153, 102, 255, 0.5)',
+				'rgba(201, 203, 207, 0.5)'
+			],
+			borderColor: [
+				'rgba(255, 99, 132, 1)',
+				'rgba(255, 205, 86, 1)',
+				'rgba(75, 192, 192, 1)',
+				'rgba(54, 162, 235, 1)',
+				'rgba(153, 102, 255, 1)',
+				'rgba(201, 203, 207, 1)'
+			],
+			borderWidth: 2
+		}]
+	};
+	new Chart(countryCtx, {
+		type: 'doughnut',
+		data: countryData,
+		options: {
+			plugins: {
+				legend: { position: 'bottom' },
+				title: {
+					display: true,
+					text: 'Visitor Countries'
+				}
+			},
+			responsive: true,
+			maintainAspectRatio: false
+		}
+	});
+
+	const osCtx = document.getElementById('osChart').getContext('2d');
+	new Chart(osCtx, {
+		type: 'pie',
+		data: {
+			labels: ` + osLabels + `,
+			datasets: [{
+				label: 'Operating Systems',
+				data: ` + osCounts + `,
+				backgroundColor: [
+					'rgba(54, 162, 235, 0.5)',
+					'rgba(201, 203, 207, 0.5)',
+					'rgba(255, 205, 86, 0.5)',
+					'rgba(75, 192, 192, 0.5)',
+					'rgba(255, 99, 132, 0.5)',
+					'rgba(153, 102, 255, 0.5)'
+				],
+				borderWidth: 2
+			}]
+		},
+		options: {
+			plugins: {
+				legend: { position: 'bottom' },
+				title: {
+					display: true,
+					text: 'Operating Systems'
+				}
+			},
+			responsive: true,
+			maintainAspectRatio: false
+		}
+	});
+
+	const deviceCtx = document.getElementById('deviceChart').getContext('2d');
+	new Chart(deviceCtx, {
+		type: 'doughnut',
+		data: {
+			labels: ` + deviceLabels + `,
+			datasets: [{
+				label: 'Device Types',
+				data: ` + deviceCounts + `,
+				backgroundColor: [
+					'rgba(153, 102, 255, 0.5)',
+					'rgba(54, 162, 235, 0.5)',
+					'rgba(255, 99, 132, 0.5)',
+					'rgba(75, 192, 192, 0.5)'
+				],
+				borderWidth: 2
+			}]
+		},
+		options: {
+			plugins: {
+				legend: { position: 'bottom' },
+				title: {
+					display: true,
+					text: 'Device Types'
+				}
+			},
+			responsive: true,
+			maintainAspectRatio: false
+		}
+	});
+
+	const screenCtx = document.getElementById('screenChart').getContext('2d');
+	new Chart(screenCtx, {
+		type: 'bar',
+		data: {
+			labels: ` + screenLabels + `,
+			datasets: [{
+				label: 'Screen Sizes',
+				data: ` + screenCounts + `,
+				backgroundColor: 'rgba(75, 192, 192, 0.5)',
+				borderColor: 'rgba(75, 192, 192, 1)',
+				borderWidth: 2
+			}]
+		},
+		options: {
+			scales: { y: { beginAtZero: true } },
+			responsive: true,
+			maintainAspectRatio: false,
+			plugins: {
+				title: {
+					display: true,
+					text: 'Screen Sizes (beacon)'
+				}
+			}
+		}
+	});
+
+	const languageCtx = document.getElementById('languageChart').getContext('2d');
+	new Chart(languageCtx, {
+		type: 'bar',
+		data: {
+			labels: ` + languageLabels + `,
+			datasets: [{
+				label: 'Languages',
+				data: ` + languageCounts + `,
+				backgroundColor: 'rgba(255, 159, 64, 0.5)',
+				borderColor: 'rgba(255, 159, 64, 1)',
+				borderWidth: 2
+			}]
+		},
+		options: {
+			scales: { y: { beginAtZero: true } },
+			responsive: true,
+			maintainAspectRatio: false,
+			plugins: {
+				title: {
+					display: true,
+					text: 'Languages (beacon)'
+				}
+			}
+		}
+	});
+</script>
+</body>
+</html>
+`))
+}
+
+// Helper to list views per A/B variant, one line per page
+func variantSummary(pages map[string]map[string]int) string {
+	var b strings.Builder
+	for _, page := range sortedKeys(pages) {
+		fmt.Fprintf(&b, "<br><b>Variants of %s:</b>", html.EscapeString(page))
+		for i, v := range sortedKeys(pages[page]) {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			fmt.Fprintf(&b, " %s %d", html.EscapeString(v), pages[page][v])
+		}
+	}
+	return b.String()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Helper to convert int to string
+func itoa(i int) string {
+	return fmt.Sprintf("%d", i)
+}
+
+// Helper to format float with 1 decimal
+func formatFloat(f float64) string {
+	return fmt.Sprintf("%.1f", f)
+}
+
+// Helper to turn a counter map into sorted JSON label and count arrays
+func chartData(m map[string]int) (string, string) {
+	type kv struct {
+		Key   string
+		Value int
+	}
+	var sorted []kv
+	for k, v := range m {
+		sorted = append(sorted, kv{k, v})
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Key < sorted[j].Key })
+	labels := []string{}
+	counts := []int{}
+	for _, kv := range sorted {
+		labels = append(labels, kv.Key)
+		counts = append(counts, kv.Value)
+	}
+	lb, _ := json.Marshal(labels)
+	cb, _ := json.Marshal(counts)
+	return string(lb), string(cb)
+}
+
+// For country chart, an empty country code is shown as "Unknown"
+func countryChartData(countries map[string]int) (string, string) {
+	m := make(map[string]int, len(countries))
+	for k, v := range countries {
+		if k == "" {
+			k = "Unknown"
+		}
+		m[k] += v
+	}
+	return chartData(m)
+}
@@ -0,0 +1,77 @@
+package analytics
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lru is a size-capped cache whose entries also expire after a fixed TTL.
+// When full, the least recently set entry is evicted.
+type lru[K comparable, V any] struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	max       int
+	items     map[K]*list.Element
+	order     *list.List // front is most recently set
+	evictions int
+}
+
+type lruEntry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+func newLRU[K comparable, V any](max int, ttl time.Duration) *lru[K, V] {
+	return &lru[K, V]{ttl: ttl, max: max, items: make(map[K]*list.Element), order: list.New()}
+}
+
+func (c *lru[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var zero V
+	el, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+	e := el.Value.(*lruEntry[K, V])
+	if time.Now().After(e.expires) {
+		c.remove(el)
+		return zero, false
+	}
+	return e.value, true
+}
+
+func (c *lru[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*lruEntry[K, V])
+		e.value, e.expires = value, now.Add(c.ttl)
+		c.order.MoveToFront(el)
+	} else {
+		c.items[key] = c.order.PushFront(&lruEntry[K, V]{key: key, value: value, expires: now.Add(c.ttl)})
+	}
+	// With a fixed TTL the oldest entries are at the back, drop expired ones
+	for el := c.order.Back(); el != nil && now.After(el.Value.(*lruEntry[K, V]).expires); el = c.order.Back() {
+		c.remove(el)
+	}
+	for c.max > 0 && c.order.Len() > c.max {
+		c.remove(c.order.Back())
+		c.evictions++
+	}
+}
+
+func (c *lru[K, V]) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.items, el.Value.(*lruEntry[K, V]).key)
+}
+
+// Stats returns the current size and number of entries evicted for space
+func (c *lru[K, V]) Stats() (size, evictions int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len(), c.evictions
+}
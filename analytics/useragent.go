@@ -0,0 +1,56 @@
+package analytics
+
+import "strings"
+
+// Browser engine detection (very basic)
+func detectBrowserEngine(ua string) string {
+	ua = strings.ToLower(ua)
+	switch {
+	case strings.Contains(ua, "webkit") && strings.Contains(ua, "chrome"):
+		return "Blink"
+	case strings.Contains(ua, "webkit"):
+		return "WebKit"
+	case strings.Contains(ua, "gecko") && strings.Contains(ua, "firefox"):
+		return "Gecko"
+	case strings.Contains(ua, "trident") || strings.Contains(ua, "msie"):
+		return "Trident"
+	default:
+		return "Other"
+	}
+}
+
+// OS detection (very basic)
+func detectOS(ua string) string {
+	ua = strings.ToLower(ua)
+	switch {
+	case strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad") || strings.Contains(ua, "ipod"):
+		return "iOS"
+	case strings.Contains(ua, "android"):
+		return "Android"
+	case strings.Contains(ua, "windows"):
+		return "Windows"
+	case strings.Contains(ua, "mac os x") || strings.Contains(ua, "macintosh"):
+		return "macOS"
+	case strings.Contains(ua, "linux") || strings.Contains(ua, "x11"):
+		return "Linux"
+	default:
+		return "Other"
+	}
+}
+
+// Device type detection (very basic), bots are checked first
+func detectDeviceType(ua string) string {
+	ua = strings.ToLower(ua)
+	switch {
+	case ua == "" || strings.Contains(ua, "bot") || strings.Contains(ua, "crawl") ||
+		strings.Contains(ua, "spider") || strings.Contains(ua, "curl") || strings.Contains(ua, "wget"):
+		return "Bot"
+	case strings.Contains(ua, "ipad") || strings.Contains(ua, "tablet") ||
+		(strings.Contains(ua, "android") && !strings.Contains(ua, "mobile")):
+		return "Tablet"
+	case strings.Contains(ua, "mobi") || strings.Contains(ua, "iphone") || strings.Contains(ua, "ipod"):
+		return "Mobile"
+	default:
+		return "Desktop"
+	}
+}
@@ -0,0 +1,128 @@
+package gomd
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/core6quad/GOMD/compiler"
+	"github.com/core6quad/GOMD/search"
+)
+
+// Content API: /api/pages lists every page with its metadata,
+// /api/pages/docs/a returns the page at /docs/a
+func (s *Site) servePages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// Restricted pages are only listed for those who may see them,
+	// password protected ones not at all
+	var pages []*compiler.Page
+	for _, p := range s.Pages() {
+		if p.Password != "" {
+			continue
+		}
+		if a := s.pageAccess(p.URL); a != nil {
+			if ok, _ := s.Users.Permits(r, a); !ok {
+				continue
+			}
+		}
+		pages = append(pages, p)
+	}
+	var v interface{} = pages
+	if url := strings.TrimPrefix(r.URL.Path, "/api/pages"); url != "" && url != "/" {
+		v = nil
+		for _, p := range pages {
+			if p.URL == url {
+				v = p
+				break
+			}
+		}
+		if v == nil {
+			http.NotFound(w, r)
+			return
+		}
+	} else if pages == nil {
+		v = []*compiler.Page{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// Search API: /api/search?q=words returns the best matching public pages,
+// at most limit (default 10, up to 50). version picks the docs version
+func (s *Site) serveSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	limit, err := strconv.Atoi(r.FormValue("limit"))
+	if err != nil || limit <= 0 {
+		limit = 10
+	}
+	s.buildMu.RLock()
+	index := s.search
+	s.buildMu.RUnlock()
+	results := index.Search(r.FormValue("q"), r.FormValue("version"), min(limit, 50))
+	if results == nil {
+		results = []search.Result{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// Search results as a page at /search?q=words, the search engine browsers
+// offer for the site. A page of the same name takes its place
+func (s *Site) serveSearchPage(w http.ResponseWriter, r *http.Request) {
+	if s.page("/search") != nil {
+		s.Server.ServePage(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.buildMu.RLock()
+	index := s.search
+	s.buildMu.RUnlock()
+	data := search.PageData{
+		Name:    s.siteName(r.Host),
+		Query:   strings.TrimSpace(r.FormValue("q")),
+		Version: r.FormValue("version"),
+		Base:    s.Config.BasePath,
+	}
+	data.Results = index.Search(data.Query, data.Version, 50)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	search.WritePage(w, data)
+}
+
+// OpenSearch description at /opensearch.xml, linked from every page
+func (s *Site) serveOpenSearch(w http.ResponseWriter, r *http.Request) {
+	root := s.Config.SiteURL
+	if root == "" {
+		scheme := "http"
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		root = scheme + "://" + r.Host
+	}
+	w.Header().Set("Content-Type", "application/opensearchdescription+xml")
+	search.WriteDescriptor(w, s.siteName(r.Host), root+s.Config.BasePath)
+}
+
+// site_name, or the host the site is served from
+func (s *Site) siteName(host string) string {
+	if s.Config.SiteName != "" {
+		return s.Config.SiteName
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return host
+}
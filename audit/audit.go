@@ -0,0 +1,143 @@
+// Package audit keeps an append-only log of changes made through the
+// admin UI and the gomd command, viewable and exportable in the admin UI.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/core6quad/GOMD/admin"
+	"github.com/core6quad/GOMD/auth"
+)
+
+// Entry is one recorded action
+type Entry struct {
+	Time   time.Time `json:"time"`
+	User   string    `json:"user"`
+	Action string    `json:"action"`
+	Target string    `json:"target,omitempty"`
+	IP     string    `json:"ip,omitempty"`
+}
+
+// Log appends entries to a JSON lines file, one object per line
+type Log struct {
+	mu   sync.Mutex
+	path string
+}
+
+// Open returns the audit log in dataDir, created on the first entry
+func Open(dataDir string) *Log {
+	return &Log{path: filepath.Join(dataDir, "audit.jsonl")}
+}
+
+// Record appends an entry, stamped with the current time
+func (l *Log) Record(user, action, target string) {
+	l.append(Entry{Time: time.Now().UTC(), User: user, Action: action, Target: target})
+}
+
+// RecordRequest records an action by the signed in user of r
+func (l *Log) RecordRequest(r *http.Request, action, target string) {
+	user, _ := auth.FromContext(r.Context())
+	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+	l.append(Entry{Time: time.Now().UTC(), User: user.Name, Action: action, Target: target, IP: ip})
+}
+
+func (l *Log) append(e Entry) {
+	line, _ := json.Marshal(e)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err := os.MkdirAll(filepath.Dir(l.path), 0755)
+	if err == nil {
+		var f *os.File
+		f, err = os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err == nil {
+			_, err = f.Write(append(line, '\n'))
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+	}
+	// Losing an entry shouldn't undo the action, but it must not go unnoticed
+	if err != nil {
+		slog.Error("failed to write audit log", "err", err, "action", e.Action, "user", e.User)
+	}
+}
+
+// Entries reads the whole log, oldest first
+func (l *Log) Entries() ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	data, err := os.ReadFile(l.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var e Entry
+		if json.Unmarshal(sc.Bytes(), &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries, sc.Err()
+}
+
+// Entries shown in the admin UI, the export has all of them
+const shown = 500
+
+var table = template.Must(template.New("audit").Parse(`
+<p>Newest first{{if .More}}, the last {{len .Entries}} of {{.Total}}{{end}}. <a href="{{.Base}}/admin/audit/export.json">Export as JSON</a></p>
+{{if .Entries}}<table>
+<tr><th>Time</th><th>User</th><th>Action</th><th>Target</th><th>IP</th></tr>
+{{range .Entries}}<tr><td>{{.Time.Local.Format "2006-01-02 15:04:05"}}</td><td>{{.User}}</td><td>{{.Action}}</td><td>{{.Target}}</td><td>{{.IP}}</td></tr>
+{{end}}</table>{{else}}<p class="empty">Nothing recorded yet.</p>{{end}}
+`))
+
+// Admin is the admin section listing the log, with the whole log as JSON
+// at /admin/audit/export.json
+func (l *Log) Admin(a *admin.Admin) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entries, err := l.Entries()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if r.URL.Path == "/admin/audit/export.json" {
+			if entries == nil {
+				entries = []Entry{}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Disposition", `attachment; filename="audit.json"`)
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			enc.Encode(entries)
+			return
+		}
+		total := len(entries)
+		if total > shown {
+			entries = entries[total-shown:]
+		}
+		newest := make([]Entry, len(entries))
+		for i, e := range entries {
+			newest[len(entries)-1-i] = e
+		}
+		var buf bytes.Buffer
+		table.Execute(&buf, map[string]interface{}{"Entries": newest, "Total": total, "More": total > shown, "Base": a.BasePath})
+		a.Render(w, r, "Audit log", template.HTML(buf.String()))
+	})
+}
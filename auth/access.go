@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Access is a page's allow list. A request gets in when it matches any
+// entry: "role:editor" (that role or higher), "user:ann", or an IP or CIDR
+// range like "10.0.0.0/8"
+type Access struct {
+	roles []Role
+	users []string
+	nets  []*net.IPNet
+}
+
+// ParseAccess checks and parses an allow list
+func ParseAccess(rules []string) (*Access, error) {
+	a := &Access{}
+	for _, rule := range rules {
+		switch {
+		case strings.HasPrefix(rule, "role:"):
+			role, err := ParseRole(strings.TrimPrefix(rule, "role:"))
+			if err != nil {
+				return nil, err
+			}
+			a.roles = append(a.roles, role)
+		case strings.HasPrefix(rule, "user:"):
+			a.users = append(a.users, strings.TrimPrefix(rule, "user:"))
+		default:
+			n, err := parseNetwork(rule)
+			if err != nil {
+				return nil, fmt.Errorf("invalid allow entry %q, use role:<role>, user:<name> or an IP or CIDR range", rule)
+			}
+			a.nets = append(a.nets, n)
+		}
+	}
+	return a, nil
+}
+
+// A CIDR range, or a single IP as a /32 or /128
+func parseNetwork(s string) (*net.IPNet, error) {
+	if ip := net.ParseIP(s); ip != nil {
+		if v4 := ip.To4(); v4 != nil {
+			return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	_, n, err := net.ParseCIDR(s)
+	return n, err
+}
+
+// Permits checks a request against an allow list. When it is refused,
+// login reports whether signing in could change that
+func (u *Users) Permits(r *http.Request, a *Access) (ok, login bool) {
+	host, _, _ := net.SplitHostPort(r.RemoteAddr)
+	if ip := net.ParseIP(host); ip != nil {
+		for _, n := range a.nets {
+			if n.Contains(ip) {
+				return true, false
+			}
+		}
+	}
+	if len(a.roles) == 0 && len(a.users) == 0 {
+		return false, false
+	}
+	user, signedIn := u.SignedIn(r)
+	if !signedIn {
+		if name, pass, basic := r.BasicAuth(); basic {
+			user, signedIn = u.Authenticate(name, pass)
+			signedIn = signedIn && !user.TwoFactor()
+		}
+	}
+	if !signedIn {
+		return false, true
+	}
+	for _, role := range a.roles {
+		if user.Role.Allows(role) {
+			return true, false
+		}
+	}
+	for _, name := range a.users {
+		if user.Name == name {
+			return true, false
+		}
+	}
+	return false, false
+}
+
+// Deny answers a request Permits refused: browsers are sent to the login
+// page when signing in could help, everything else is forbidden
+func (u *Users) Deny(w http.ResponseWriter, r *http.Request, login bool) {
+	if login {
+		u.redirectToLogin(w, r)
+		return
+	}
+	http.Error(w, "forbidden", http.StatusForbidden)
+}
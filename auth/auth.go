@@ -0,0 +1,216 @@
+// Package auth manages the accounts that can sign in to the admin UI and
+// the analytics dashboard. Accounts live in a JSON users file with bcrypt
+// hashed passwords, each with a role.
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Role decides what an account can do, each role includes the ones below
+type Role string
+
+const (
+	// Viewer can see analytics
+	Viewer Role = "viewer"
+	// Editor can also edit content and moderate comments
+	Editor Role = "editor"
+	// Admin can do everything, including exporting subscribers
+	Admin Role = "admin"
+)
+
+func (r Role) level() int {
+	switch r {
+	case Admin:
+		return 3
+	case Editor:
+		return 2
+	case Viewer:
+		return 1
+	}
+	return 0
+}
+
+// Allows reports whether r includes the permissions of want
+func (r Role) Allows(want Role) bool {
+	return r.level() >= want.level()
+}
+
+// ParseRole checks a role name
+func ParseRole(s string) (Role, error) {
+	r := Role(s)
+	if r.level() == 0 {
+		return "", fmt.Errorf("unknown role %q, use admin, editor or viewer", s)
+	}
+	return r, nil
+}
+
+// User is an account
+type User struct {
+	Name         string `json:"name"`
+	PasswordHash string `json:"password_hash"`
+	Role         Role   `json:"role"`
+	// Base32 TOTP secret, set once two-factor authentication is enabled
+	TOTPSecret string `json:"totp_secret,omitempty"`
+	// SHA-256 hashes of the unused recovery codes
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// TwoFactor reports whether the account signs in with a one-time code
+func (user User) TwoFactor() bool {
+	return user.TOTPSecret != ""
+}
+
+// Users is the set of accounts from the users file, plus the legacy
+// analytics_user from config as an admin
+type Users struct {
+	mu    sync.RWMutex
+	path  string
+	users map[string]User
+
+	legacyUser, legacyPass string
+
+	// How long a login lasts, 12 hours when zero
+	SessionLifetime time.Duration
+	sessions        sessions
+	// Last TOTP time step used by each user, so a code works only once
+	lastStep map[string]int64
+
+	// Audit records changes users make to their own account
+	Audit func(r *http.Request, action, target string)
+	// BasePath the site is served under, for links to the login page
+	BasePath string
+}
+
+// Load reads the users file, a missing file means no accounts yet
+func Load(path, legacyUser, legacyPass string) (*Users, error) {
+	u := &Users{path: path, users: make(map[string]User), legacyUser: legacyUser, legacyPass: legacyPass}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return u, nil
+	}
+	if err != nil {
+		return u, err
+	}
+	var list []User
+	if err := json.Unmarshal(data, &list); err != nil {
+		return u, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, user := range list {
+		u.users[user.Name] = user
+	}
+	return u, nil
+}
+
+// Empty reports whether nobody can sign in
+func (u *Users) Empty() bool {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return len(u.users) == 0 && u.legacyUser == ""
+}
+
+// List returns the accounts from the users file, sorted by name
+func (u *Users) List() []User {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	list := make([]User, 0, len(u.users))
+	for _, user := range u.users {
+		list = append(list, user)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Set adds or updates an account and saves the users file, keeping its
+// two-factor setup
+func (u *Users) Set(name, password string, role Role) error {
+	if name == "" || password == "" {
+		return errors.New("name and password are required")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	user := u.users[name]
+	user.Name, user.PasswordHash, user.Role = name, string(hash), role
+	u.users[name] = user
+	return u.save()
+}
+
+// Remove deletes an account and saves the users file
+func (u *Users) Remove(name string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if _, ok := u.users[name]; !ok {
+		return fmt.Errorf("no user %q", name)
+	}
+	delete(u.users, name)
+	return u.save()
+}
+
+// Write the users file, the caller holds mu
+func (u *Users) save() error {
+	list := make([]User, 0, len(u.users))
+	for _, user := range u.users {
+		list = append(list, user)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(u.path), 0755); err != nil {
+		return err
+	}
+	tmp := u.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, u.path)
+}
+
+// Used for unknown names, so a login takes as long whether or not the
+// account exists
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("gomd"), bcrypt.DefaultCost)
+
+// Lookup finds an account by name
+func (u *Users) Lookup(name string) (User, bool) {
+	u.mu.RLock()
+	user, ok := u.users[name]
+	u.mu.RUnlock()
+	if !ok && u.legacyUser != "" && name == u.legacyUser {
+		return User{Name: name, Role: Admin}, true
+	}
+	return user, ok
+}
+
+// Authenticate checks a name and password
+func (u *Users) Authenticate(name, password string) (User, bool) {
+	u.mu.RLock()
+	user, ok := u.users[name]
+	u.mu.RUnlock()
+	if ok {
+		err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+		return user, err == nil
+	}
+	if u.legacyUser != "" && subtle.ConstantTimeCompare([]byte(name), []byte(u.legacyUser)) == 1 {
+		ok := subtle.ConstantTimeCompare([]byte(password), []byte(u.legacyPass)) == 1
+		return User{Name: name, Role: Admin}, ok
+	}
+	bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+	return User{}, false
+}
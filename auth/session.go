@@ -0,0 +1,350 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// CookieName is the session cookie set on login
+const CookieName = "gomd_session"
+
+// A signed in browser. The CSRF token must accompany every state-changing
+// request made with the session cookie
+type session struct {
+	user    string
+	csrf    string
+	expires time.Time
+}
+
+type sessions struct {
+	mu sync.Mutex
+	m  map[string]*session
+	// Logins with the right password, waiting for the one-time code
+	pending map[string]*pendingLogin
+}
+
+type pendingLogin struct {
+	user     string
+	expires  time.Time
+	attempts int
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (u *Users) lifetime() time.Duration {
+	if u.SessionLifetime > 0 {
+		return u.SessionLifetime
+	}
+	return 12 * time.Hour
+}
+
+// Start a session for name and return its ID
+func (u *Users) startSession(name string) (string, *session) {
+	s := &session{user: name, csrf: randomToken(), expires: time.Now().Add(u.lifetime())}
+	id := randomToken()
+	u.sessions.mu.Lock()
+	defer u.sessions.mu.Unlock()
+	if u.sessions.m == nil {
+		u.sessions.m = make(map[string]*session)
+	}
+	now := time.Now()
+	for k, v := range u.sessions.m {
+		if now.After(v.expires) {
+			delete(u.sessions.m, k)
+		}
+	}
+	u.sessions.m[id] = s
+	return id, s
+}
+
+// The session of a request's cookie, if it is still valid
+func (u *Users) session(r *http.Request) (string, *session) {
+	c, err := r.Cookie(CookieName)
+	if err != nil {
+		return "", nil
+	}
+	u.sessions.mu.Lock()
+	defer u.sessions.mu.Unlock()
+	s := u.sessions.m[c.Value]
+	if s == nil {
+		return "", nil
+	}
+	if time.Now().After(s.expires) {
+		delete(u.sessions.m, c.Value)
+		return "", nil
+	}
+	return c.Value, s
+}
+
+// SignedIn returns the account of a request's session cookie, for public
+// routes that treat signed in users differently
+func (u *Users) SignedIn(r *http.Request) (User, bool) {
+	_, s := u.session(r)
+	if s == nil {
+		return User{}, false
+	}
+	return u.Lookup(s.user)
+}
+
+func (u *Users) endSession(id string) {
+	u.sessions.mu.Lock()
+	defer u.sessions.mu.Unlock()
+	delete(u.sessions.m, id)
+}
+
+type contextKey struct{}
+
+type requestAuth struct {
+	user User
+	csrf string
+}
+
+// FromContext returns the signed in user of a request handled behind
+// Require
+func FromContext(ctx context.Context) (User, bool) {
+	a, ok := ctx.Value(contextKey{}).(requestAuth)
+	return a.user, ok
+}
+
+// CSRFToken returns the token state-changing requests of the signed in
+// session must send, as a csrf_token form field or X-CSRF-Token header
+func CSRFToken(ctx context.Context) string {
+	a, _ := ctx.Value(contextKey{}).(requestAuth)
+	return a.csrf
+}
+
+// CSRFField is CSRFToken as a hidden form field
+func CSRFField(r *http.Request) template.HTML {
+	return template.HTML(`<input type="hidden" name="csrf_token" value="` + template.HTMLEscapeString(CSRFToken(r.Context())) + `">`)
+}
+
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// Browsers send basic auth credentials along with cross-site requests too,
+// without a token to check only the request's origin can be
+func sameOrigin(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site == "same-origin" || site == "none"
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	o, err := url.Parse(origin)
+	return err == nil && o.Host == r.Host
+}
+
+// Require lets through requests from accounts with at least the given
+// role, signed in with the session cookie or HTTP basic auth. Browsers
+// without either are sent to the login page. Nobody gets in without
+// accounts
+func (u *Users) Require(role Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if u.Empty() {
+				http.Error(w, "no accounts yet, add one with `gomd user add` or set analytics_user and analytics_pass in config.json", http.StatusForbidden)
+				return
+			}
+			var auth requestAuth
+			if name, pass, ok := r.BasicAuth(); ok {
+				user, valid := u.Authenticate(name, pass)
+				if !valid {
+					w.Header().Set("WWW-Authenticate", `Basic realm="GOMD", charset="UTF-8"`)
+					http.Error(w, "unauthorized", http.StatusUnauthorized)
+					return
+				}
+				// Basic auth has nowhere to put a one-time code
+				if user.TwoFactor() {
+					http.Error(w, "this account uses two-factor authentication, sign in at "+u.BasePath+"/admin/login", http.StatusUnauthorized)
+					return
+				}
+				if !safeMethod(r.Method) && !sameOrigin(r) {
+					http.Error(w, "cross-site request refused", http.StatusForbidden)
+					return
+				}
+				auth.user = user
+			} else if _, s := u.session(r); s != nil {
+				user, ok := u.Lookup(s.user)
+				if !ok {
+					u.redirectToLogin(w, r)
+					return
+				}
+				if !safeMethod(r.Method) && !validCSRF(r, s.csrf) {
+					http.Error(w, "invalid or missing CSRF token, reload the page and try again", http.StatusForbidden)
+					return
+				}
+				auth = requestAuth{user: user, csrf: s.csrf}
+			} else {
+				u.redirectToLogin(w, r)
+				return
+			}
+			if !auth.user.Role.Allows(role) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, auth)))
+		})
+	}
+}
+
+func validCSRF(r *http.Request, want string) bool {
+	got := r.Header.Get("X-CSRF-Token")
+	if got == "" {
+		got = r.PostFormValue("csrf_token")
+	}
+	return got != "" && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// Page loads from browsers go to the login page, anything else gets a 401
+// so scripts can retry with basic auth
+func (u *Users) redirectToLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Redirect(w, r, u.BasePath+"/admin/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+		return
+	}
+	w.Header().Set("WWW-Authenticate", `Basic realm="GOMD", charset="UTF-8"`)
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>Sign in - GOMD Admin</title>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<style>
+	body { font-family: sans-serif; background: #181c20; color: #eee; margin: 0; padding: 0; }
+	.container { max-width: 360px; margin: 80px auto; background: #23272b; border-radius: 10px; padding: 32px; box-shadow: 0 2px 16px #0004; }
+	input { display: block; width: 100%; box-sizing: border-box; margin: 4px 0 16px; padding: 8px; }
+	button { background: #2d6cdf; color: #fff; border: 0; border-radius: 4px; padding: 8px 16px; cursor: pointer; }
+	.error { color: #ff7b72; }
+</style>
+</head>
+<body>
+<div class="container">
+	<h1>Sign in</h1>
+	{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+	{{if .Pending}}<form method="post" action="{{.Base}}/admin/login">
+		<input type="hidden" name="next" value="{{.Next}}">
+		<input type="hidden" name="pending" value="{{.Pending}}">
+		<label>Code from your authenticator app, or a recovery code <input name="code" autocomplete="one-time-code" inputmode="numeric" required autofocus></label>
+		<button>Verify</button>
+	</form>{{else}}<form method="post" action="{{.Base}}/admin/login">
+		<input type="hidden" name="next" value="{{.Next}}">
+		<label>Name <input name="name" value="{{.Name}}" autocomplete="username" required autofocus></label>
+		<label>Password <input name="password" type="password" autocomplete="current-password" required></label>
+		<button>Sign in</button>
+	</form>{{end}}
+</div>
+</body>
+</html>
+`))
+
+// Only redirect back to paths on this site after login, without the base
+// path
+func safeNext(next string) string {
+	// Browsers drop tabs and newlines from URLs, making "/\t/evil.com"
+	// protocol relative
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") ||
+		strings.IndexFunc(next, unicode.IsControl) >= 0 {
+		return "/admin"
+	}
+	if u, err := url.Parse(next); err != nil || u.Scheme != "" || u.Host != "" {
+		return "/admin"
+	}
+	return next
+}
+
+// ServeLogin shows the login form at /admin/login and starts a session
+// for valid credentials
+func (u *Users) ServeLogin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	next := safeNext(r.FormValue("next"))
+	data := map[string]string{"Next": next, "Base": u.BasePath}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPost:
+		// A login form posted from another site could sign the browser in to
+		// the attacker's account
+		if !sameOrigin(r) {
+			http.Error(w, "cross-site request refused", http.StatusForbidden)
+			return
+		}
+		var user User
+		var ok bool
+		if pending := r.PostFormValue("pending"); pending != "" {
+			user, ok = u.verifyPending(pending, r.PostFormValue("code"))
+			if !ok {
+				data["Pending"] = pending
+				data["Error"] = "Wrong code."
+				if !u.pendingValid(pending) {
+					data["Pending"] = ""
+					data["Error"] = "Too many attempts or too slow, sign in again."
+				}
+			}
+		} else {
+			name := r.PostFormValue("name")
+			user, ok = u.Authenticate(name, r.PostFormValue("password"))
+			if ok && user.TwoFactor() {
+				data["Pending"] = u.startPending(user.Name)
+				ok = false
+			} else if !ok {
+				data["Name"] = name
+				data["Error"] = "Wrong name or password."
+			}
+		}
+		if ok {
+			id, s := u.startSession(user.Name)
+			http.SetCookie(w, &http.Cookie{
+				Name:     CookieName,
+				Value:    id,
+				Path:     "/",
+				Expires:  s.expires,
+				HttpOnly: true,
+				Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+				SameSite: http.SameSiteLaxMode,
+			})
+			http.Redirect(w, r, u.BasePath+next, http.StatusSeeOther)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if data["Error"] != "" {
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	loginPage.Execute(w, data)
+}
+
+// ServeLogout ends the session at /admin/logout, a POST with the CSRF token
+func (u *Users) ServeLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if id, s := u.session(r); s != nil {
+		if !validCSRF(r, s.csrf) {
+			http.Error(w, "invalid or missing CSRF token", http.StatusForbidden)
+			return
+		}
+		u.endSession(id)
+	}
+	http.SetCookie(w, &http.Cookie{Name: CookieName, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+	http.Redirect(w, r, u.BasePath+"/admin/login", http.StatusSeeOther)
+}
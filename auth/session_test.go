@@ -0,0 +1,32 @@
+package auth
+
+import "testing"
+
+func TestSafeNext(t *testing.T) {
+	for next, want := range map[string]string{
+		"/admin/comments":      "/admin/comments",
+		"/docs/intro?x=1#top":  "/docs/intro?x=1#top",
+		"/team/":               "/team/",
+		"":                     "/admin",
+		"admin":                "/admin",
+		"https://evil.com/":    "/admin",
+		"//evil.com/":          "/admin",
+		"/\\evil.com/":         "/admin",
+		"\\\\evil.com/":        "/admin",
+		"/\t/evil.com/":        "/admin",
+		"/\r\n/evil.com/":      "/admin",
+		"/\n/evil.com/":        "/admin",
+		"/%0a":                 "/%0a",
+		"/\x00":                "/admin",
+		"/\x7f":                "/admin",
+		"javascript:alert(1)":  "/admin",
+		" /admin":              "/admin",
+		"/a%zz":                "/admin",
+		"/path:with-colon":     "/path:with-colon",
+		"/ok?next=//evil.com/": "/ok?next=//evil.com/",
+	} {
+		if got := safeNext(next); got != want {
+			t.Errorf("safeNext(%q) = %q, want %q", next, got, want)
+		}
+	}
+}
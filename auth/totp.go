@@ -0,0 +1,286 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"rsc.io/qr"
+)
+
+// TOTP as in RFC 6238, with the defaults every authenticator app
+// understands: SHA-1, 6 digits, 30 second steps
+const (
+	totpStep   = 30
+	totpDigits = 6
+	// Codes stay valid one step either side, for clock drift
+	totpSkew = 1
+
+	recoveryCodeCount = 10
+	// Time to enter the code after the password
+	pendingLifetime = 5 * time.Minute
+	pendingAttempts = 5
+)
+
+var base32NoPad = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret returns a random base32 secret
+func NewTOTPSecret() string {
+	b := make([]byte, 20)
+	rand.Read(b)
+	return base32NoPad.EncodeToString(b)
+}
+
+func totpCode(secret string, counter uint64) (string, error) {
+	key, err := base32NoPad.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", err
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0xf
+	n := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, n%1000000), nil
+}
+
+// Find the time step code is valid for, or -1
+func totpMatch(secret, code string, now time.Time) int64 {
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != totpDigits {
+		return -1
+	}
+	counter := now.Unix() / totpStep
+	for i := -totpSkew; i <= totpSkew; i++ {
+		want, err := totpCode(secret, uint64(counter+int64(i)))
+		if err == nil && subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 {
+			return counter + int64(i)
+		}
+	}
+	return -1
+}
+
+// TOTPURL is the otpauth:// URL authenticator apps scan from the QR code
+func TOTPURL(issuer, name, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+name) + "?" + v.Encode()
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func newRecoveryCodes() (codes, hashes []string) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		rand.Read(b)
+		c := hex.EncodeToString(b)
+		codes = append(codes, c[:5]+"-"+c[5:])
+		hashes = append(hashes, hashRecoveryCode(c))
+	}
+	return codes, hashes
+}
+
+// Check a TOTP or recovery code for a user, using up recovery codes and
+// refusing a TOTP code seen before
+func (u *Users) verifyCode(name, code string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	user, ok := u.users[name]
+	if !ok || !user.TwoFactor() {
+		return false
+	}
+	if step := totpMatch(user.TOTPSecret, code, time.Now()); step >= 0 {
+		if u.lastStep == nil {
+			u.lastStep = make(map[string]int64)
+		}
+		if step <= u.lastStep[name] {
+			return false
+		}
+		u.lastStep[name] = step
+		return true
+	}
+	hash := hashRecoveryCode(code)
+	for i, h := range user.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+			user.RecoveryCodes = append(user.RecoveryCodes[:i:i], user.RecoveryCodes[i+1:]...)
+			u.users[name] = user
+			u.save()
+			return true
+		}
+	}
+	return false
+}
+
+// EnableTwoFactor turns on two-factor authentication with secret once
+// code shows the authenticator app has it, and returns new recovery codes
+func (u *Users) EnableTwoFactor(name, secret, code string) ([]string, error) {
+	if totpMatch(secret, code, time.Now()) < 0 {
+		return nil, errors.New("wrong code, check your device's clock and try again")
+	}
+	codes, hashes := newRecoveryCodes()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	user, ok := u.users[name]
+	if !ok {
+		return nil, fmt.Errorf("no user %q", name)
+	}
+	user.TOTPSecret, user.RecoveryCodes = secret, hashes
+	u.users[name] = user
+	return codes, u.save()
+}
+
+// DisableTwoFactor turns off two-factor authentication, for a user who
+// lost their device and recovery codes
+func (u *Users) DisableTwoFactor(name string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	user, ok := u.users[name]
+	if !ok {
+		return fmt.Errorf("no user %q", name)
+	}
+	user.TOTPSecret, user.RecoveryCodes = "", nil
+	u.users[name] = user
+	return u.save()
+}
+
+func (u *Users) startPending(name string) string {
+	id := randomToken()
+	u.sessions.mu.Lock()
+	defer u.sessions.mu.Unlock()
+	if u.sessions.pending == nil {
+		u.sessions.pending = make(map[string]*pendingLogin)
+	}
+	now := time.Now()
+	for k, v := range u.sessions.pending {
+		if now.After(v.expires) {
+			delete(u.sessions.pending, k)
+		}
+	}
+	u.sessions.pending[id] = &pendingLogin{user: name, expires: now.Add(pendingLifetime)}
+	return id
+}
+
+func (u *Users) pendingValid(id string) bool {
+	u.sessions.mu.Lock()
+	defer u.sessions.mu.Unlock()
+	p := u.sessions.pending[id]
+	return p != nil && time.Now().Before(p.expires) && p.attempts < pendingAttempts
+}
+
+// Finish a login waiting for its one-time code
+func (u *Users) verifyPending(id, code string) (User, bool) {
+	u.sessions.mu.Lock()
+	p := u.sessions.pending[id]
+	if p == nil || time.Now().After(p.expires) || p.attempts >= pendingAttempts {
+		u.sessions.mu.Unlock()
+		return User{}, false
+	}
+	p.attempts++
+	name := p.user
+	u.sessions.mu.Unlock()
+	if !u.verifyCode(name, code) {
+		return User{}, false
+	}
+	u.sessions.mu.Lock()
+	delete(u.sessions.pending, id)
+	u.sessions.mu.Unlock()
+	return u.Lookup(name)
+}
+
+func (u *Users) audit(r *http.Request, action, target string) {
+	if u.Audit != nil {
+		u.Audit(r, action, target)
+	}
+}
+
+var accountPage = template.Must(template.New("account").Parse(`
+<p>Signed in as <b>{{.User.Name}}</b> ({{.User.Role}}).</p>
+<h2>Two-factor authentication</h2>
+{{if .Error}}<p style="color:#ff7b72">{{.Error}}</p>{{end}}
+{{if .Legacy}}<p class="empty">This account is analytics_user from config.json. Add an account with <code>gomd user add</code> to use two-factor authentication.</p>
+{{else if .RecoveryCodes}}<p>Two-factor authentication is on. Keep these recovery codes somewhere safe, each one signs you in once without your device. They won't be shown again.</p>
+<pre>{{range .RecoveryCodes}}{{.}}
+{{end}}</pre>
+<p><a href="{{.Base}}/admin/account">Done</a></p>
+{{else if .Secret}}<p>Scan this code with your authenticator app, or enter the key <code>{{.Secret}}</code> by hand, then type the code it shows.</p>
+<p><img src="{{.QR}}" alt="QR code" style="background:#fff; padding:8px"></p>
+<form method="post">{{.CSRF}}<input type="hidden" name="secret" value="{{.Secret}}"><input name="code" autocomplete="one-time-code" inputmode="numeric" required autofocus> <button name="action" value="enable">Turn on</button></form>
+{{else if .User.TwoFactor}}<p>Two-factor authentication is on, {{len .User.RecoveryCodes}} recovery codes left.</p>
+<form method="post">{{.CSRF}}<input name="code" placeholder="Current code" autocomplete="one-time-code" required> <button class="danger" name="action" value="disable">Turn off</button></form>
+{{else}}<p>Two-factor authentication is off. Turn it on to ask for a code from an authenticator app when signing in.</p>
+<form method="post">{{.CSRF}}<button name="action" value="setup">Set up</button></form>
+{{end}}`))
+
+// Account is the admin section at /admin/account where users turn
+// two-factor authentication on and off. render draws the admin layout
+func (u *Users) Account(render func(w http.ResponseWriter, r *http.Request, title string, body template.HTML)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current, _ := FromContext(r.Context())
+		u.mu.RLock()
+		user, ok := u.users[current.Name]
+		u.mu.RUnlock()
+		data := map[string]interface{}{"User": current, "Legacy": !ok, "CSRF": CSRFField(r), "Base": u.BasePath}
+		if ok {
+			data["User"] = user
+		}
+		if r.Method == http.MethodPost && ok {
+			switch r.PostFormValue("action") {
+			case "setup":
+				data["Secret"] = NewTOTPSecret()
+			case "enable":
+				secret := r.PostFormValue("secret")
+				codes, err := u.EnableTwoFactor(user.Name, secret, r.PostFormValue("code"))
+				if err != nil {
+					data["Secret"], data["Error"] = secret, err.Error()
+					break
+				}
+				data["RecoveryCodes"] = codes
+				u.audit(r, "enable two-factor", user.Name)
+			case "disable":
+				if !u.verifyCode(user.Name, r.PostFormValue("code")) {
+					data["Error"] = "Wrong code."
+					break
+				}
+				if err := u.DisableTwoFactor(user.Name); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				u.audit(r, "disable two-factor", user.Name)
+				http.Redirect(w, r, u.BasePath+r.URL.Path, http.StatusSeeOther)
+				return
+			}
+		}
+		if secret, _ := data["Secret"].(string); secret != "" {
+			code, err := qr.Encode(TOTPURL("GOMD", user.Name, secret), qr.M)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			code.Scale = 4
+			data["QR"] = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(code.PNG()))
+		}
+		var buf strings.Builder
+		accountPage.Execute(&buf, data)
+		render(w, r, "Account", template.HTML(buf.String()))
+	})
+}
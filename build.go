@@ -0,0 +1,214 @@
+package gomd
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/core6quad/GOMD/a11y"
+	"github.com/core6quad/GOMD/compiler"
+)
+
+// BuildReport is what BuildTo did, for `gomd build --verbose`
+type BuildReport struct {
+	*compiler.Result
+	// Every source file and what the build did with it, in walk order
+	Sources []FileAction
+	// URLs of the files the build made itself, like feeds and the
+	// sitemap, sorted
+	Generated []string
+	// Things that build fine but are likely mistakes
+	Warnings []string
+}
+
+// FileAction is what a build did with a source file
+type FileAction struct {
+	Source string
+	Action string
+}
+
+// Left in every dir BuildTo builds into, so it only ever empties dirs it
+// made itself
+const buildMarker = ".gomd-build"
+
+// BuildTo compiles the site into dir as a static site. Unlike Build
+// nothing is served, no webhooks fire and the build cache isn't used.
+// dir is emptied first, so it must be empty, missing or an earlier build.
+// Restricted and password protected pages are left out, a static host
+// would show them to anyone
+func (s *Site) BuildTo(dir string) (*BuildReport, error) {
+	opts, err := s.compilerOptions()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkOutDir(dir); err != nil {
+		return nil, err
+	}
+	opts.BuildDir = dir
+	opts.Static = true
+	if err := removeAll(dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, buildMarker), nil, 0644); err != nil {
+		return nil, err
+	}
+	report := &BuildReport{}
+	opts.Trace = func(rel, action string) {
+		if w, ok := strings.CutPrefix(action, "warning: "); ok {
+			report.Warnings = append(report.Warnings, rel+": "+w)
+			return
+		}
+		if action == "skipped, restricted" {
+			report.Warnings = append(report.Warnings, rel+": not built, a static site can't keep restricted or password protected pages private")
+		}
+		report.Sources = append(report.Sources, FileAction{rel, action})
+	}
+	res, err := compiler.Compile(opts)
+	if err != nil {
+		return nil, err
+	}
+	report.Result = res
+
+	// Whatever isn't a page or a copy of a source file was generated
+	fromSource := make(map[string]bool)
+	for _, f := range report.Sources {
+		switch {
+		case strings.HasPrefix(f.Action, "page "):
+			fromSource[strings.TrimSuffix(f.Source, path.Ext(f.Source))+".html"] = true
+		case f.Action == "copied" || f.Action == "minified":
+			fromSource[f.Source] = true
+		case strings.HasPrefix(f.Action, "compiled to "):
+			fromSource[strings.TrimPrefix(f.Action, "compiled to ")] = true
+		}
+	}
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		rel = filepath.ToSlash(rel)
+		if !fromSource[rel] && rel != buildMarker {
+			report.Generated = append(report.Generated, "/"+strings.TrimSuffix(rel, ".html"))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(report.Generated)
+	return report, nil
+}
+
+// Refuse to build into a dir holding the site itself, or with files gomd
+// didn't put there, since building empties it
+func (s *Site) checkOutDir(dir string) error {
+	out, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	for _, keep := range []string{cwd, s.Config.SrcDir, s.Config.AssetsDir} {
+		keep, err := filepath.Abs(keep)
+		if err != nil {
+			return err
+		}
+		if rel, err := filepath.Rel(out, keep); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("won't build into %s, building empties it and it holds %s", dir, keep)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(dir, buildMarker)); err != nil {
+		return fmt.Errorf("won't build into %s, building empties it and it has files gomd didn't build, pick an empty or new dir", dir)
+	}
+	return nil
+}
+
+// SiteRoute is a URL the server answers, see Routes
+type SiteRoute struct {
+	URL string
+	// "page", "file", "generated", "assets" or "endpoint"
+	Kind string
+	// The source file, the assets dir, or who may use an endpoint
+	Source string
+}
+
+// Routes builds the site into a temporary directory and lists every URL
+// the server answers, sorted: pages and files with their source, what the
+// build generates and the server's own endpoints
+func (s *Site) Routes() ([]SiteRoute, error) {
+	dir, err := os.MkdirTemp("", "gomd-routes-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	report, err := s.BuildTo(dir)
+	if err != nil {
+		return nil, err
+	}
+	var routes []SiteRoute
+	for _, f := range report.Sources {
+		switch {
+		case strings.HasPrefix(f.Action, "page "):
+			url := strings.TrimPrefix(f.Action, "page ")
+			if url == "/index" {
+				url = "/"
+			}
+			routes = append(routes, SiteRoute{url, "page", f.Source})
+		case f.Action == "copied" || f.Action == "minified":
+			routes = append(routes, SiteRoute{"/" + f.Source, "file", f.Source})
+		case strings.HasPrefix(f.Action, "compiled to "):
+			routes = append(routes, SiteRoute{"/" + strings.TrimPrefix(f.Action, "compiled to "), "file", f.Source})
+		}
+	}
+	for _, url := range report.Generated {
+		routes = append(routes, SiteRoute{url, "generated", ""})
+	}
+	for _, r := range s.Server.Routes() {
+		switch {
+		case r.Pattern == "/":
+			// The pages and files above
+		case r.Pattern == "/assets/":
+			routes = append(routes, SiteRoute{r.Pattern, "assets", s.Config.AssetsDir + "/"})
+		case r.Role != "":
+			routes = append(routes, SiteRoute{r.Pattern, "endpoint", "role:" + string(r.Role)})
+		default:
+			routes = append(routes, SiteRoute{r.Pattern, "endpoint", "everyone"})
+		}
+	}
+	sort.SliceStable(routes, func(i, j int) bool { return routes[i].URL < routes[j].URL })
+	return routes, nil
+}
+
+// A11y builds the site into a temporary directory and checks its pages,
+// and its stylesheets along with those in the assets dir, for common
+// accessibility problems
+func (s *Site) A11y() ([]a11y.Issue, error) {
+	dir, err := os.MkdirTemp("", "gomd-a11y-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	if _, err := s.BuildTo(dir); err != nil {
+		return nil, err
+	}
+	return a11y.Check(dir, s.Config.AssetsDir)
+}
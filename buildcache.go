@@ -0,0 +1,54 @@
+package gomd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/core6quad/GOMD/compiler"
+)
+
+// The persistent cache of compiled pages, nil when it is off
+func (s *Site) buildCache() *compiler.Cache {
+	if !s.Config.BuildCache {
+		return nil
+	}
+	return compiler.OpenCache(filepath.Join(s.Config.DataDir, "build-cache"), s.buildFingerprint())
+}
+
+// A hash of everything besides a page's source that can change how it
+// compiles: the config, the rules file, templates, plugins, assets
+// (shortcodes look for files in them) and the gomd binary itself.
+// Files are compared by name, size and time
+func (s *Site) buildFingerprint() string {
+	h := sha256.New()
+	cfg, _ := json.Marshal(s.Config)
+	h.Write(cfg)
+	if s.Config.RulesFile != "" {
+		rules, _ := os.ReadFile(s.Config.RulesFile)
+		h.Write(rules)
+	}
+	stat := func(p string, fi fs.FileInfo) {
+		fmt.Fprintf(h, "%s %d %d\n", p, fi.Size(), fi.ModTime().UnixNano())
+	}
+	for _, dir := range []string{s.Config.TemplatesDir, s.Config.PluginsDir, s.Config.AssetsDir} {
+		filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				if fi, err := d.Info(); err == nil {
+					stat(p, fi)
+				}
+			}
+			return nil
+		})
+	}
+	if exe, err := os.Executable(); err == nil {
+		if fi, err := os.Stat(exe); err == nil {
+			stat(exe, fi)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
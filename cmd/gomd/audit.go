@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	gomd "github.com/core6quad/GOMD"
+	"github.com/core6quad/GOMD/config"
+)
+
+// gomd audit a11y [-fail] lists accessibility problems of the built site
+// by page, -fail exits with 1 when there are any, for CI
+func auditSite(args []string) {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	fail := fs.Bool("fail", false, "exit with status 1 when problems are found")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: gomd audit a11y [-fail]")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 || args[0] != "a11y" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	fs.Parse(args[1:])
+	cfg := config.Load(configFile)
+	setupLogger(cfg)
+	site := gomd.New(cfg)
+	defer site.Close()
+	if err := site.Check(); err != nil {
+		site.Close()
+		fatal(err.Error())
+	}
+	issues, err := site.A11y()
+	if err != nil {
+		site.Close()
+		fatal("compile error", "err", err)
+	}
+	where := ""
+	places := 0
+	for _, issue := range issues {
+		if issue.Where != where {
+			where = issue.Where
+			places++
+			fmt.Println(where)
+		}
+		fmt.Printf("  %s\n", issue.Problem)
+	}
+	if len(issues) == 0 {
+		fmt.Println("no accessibility problems found")
+		return
+	}
+	fmt.Printf("%d problems in %d places\n", len(issues), places)
+	if *fail {
+		site.Close()
+		os.Exit(1)
+	}
+}
+
+// gomd lint [file.gmd...] runs the content checks on every page, or the
+// files given, and prints file:line: problems. It exits with 1 when there
+// are any
+func lintSite(args []string) {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: gomd lint [file.gmd...]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	cfg := config.Load(configFile)
+	setupLogger(cfg)
+	site := gomd.New(cfg)
+	defer site.Close()
+	problems, err := site.Lint(fs.Args()...)
+	if err != nil {
+		site.Close()
+		fatal("lint failed", "err", err)
+	}
+	files := make(map[string]bool)
+	for _, p := range problems {
+		fmt.Println(p)
+		files[p.File] = true
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "%d problems in %d files\n", len(problems), len(files))
+		site.Close()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	gomd "github.com/core6quad/GOMD"
+	"github.com/core6quad/GOMD/config"
+)
+
+// Latencies of one path under load
+type benchPath struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	errors    int
+}
+
+// gomd bench builds the site, serves it on a local port and loads it with
+// concurrent requests, then reports throughput, latency percentiles and
+// allocations per path
+func bench(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	concurrency := fs.Int("c", 16, "concurrent connections")
+	duration := fs.Duration("d", 10*time.Second, "how long to send requests")
+	paths := fs.String("paths", "", "comma-separated paths to request, every page by default")
+	allocRuns := fs.Int("alloc-runs", 200, "requests per path when counting allocations, 0 skips it")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: gomd bench [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	cfg := config.Load(configFile)
+	// Request logs and rate limits would measure themselves
+	cfg.Quiet = true
+	cfg.RateLimit = 0
+	setupLogger(cfg)
+
+	privateBuildDir(&cfg)
+	site := gomd.New(cfg)
+	defer site.Close()
+	if err := site.Check(); err != nil {
+		site.Close()
+		fatal(err.Error())
+	}
+	if err := site.Build(); err != nil {
+		site.Close()
+		fatal("compile error", "err", err)
+	}
+	var targets []string
+	if *paths != "" {
+		targets = strings.Split(*paths, ",")
+	} else {
+		for _, p := range site.Pages() {
+			targets = append(targets, p.URL)
+		}
+	}
+	if len(targets) == 0 {
+		site.Close()
+		fatal("nothing to request, add pages or pass -paths")
+	}
+	handler := site.Handler()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		site.Close()
+		fatal("listen failed", "err", err)
+	}
+	srv := &http.Server{Handler: handler}
+	go srv.Serve(ln)
+	defer srv.Close()
+	base := "http://" + ln.Addr().String() + cfg.BasePath
+	client := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: *concurrency}}
+
+	results := make([]*benchPath, len(targets))
+	for i := range results {
+		results[i] = &benchPath{}
+	}
+	fmt.Fprintf(os.Stderr, "benchmarking %d paths with %d connections for %s\n", len(targets), *concurrency, *duration)
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	start := time.Now()
+	deadline := start.Add(*duration)
+	for w := 0; w < *concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				i := int(next.Add(1)-1) % len(targets)
+				t := time.Now()
+				resp, err := client.Get(base + targets[i])
+				failed := err != nil
+				if err == nil {
+					io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+					failed = resp.StatusCode >= 400
+				}
+				took := time.Since(t)
+				r := results[i]
+				r.mu.Lock()
+				r.latencies = append(r.latencies, took)
+				if failed {
+					r.errors++
+				}
+				r.mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	var all []time.Duration
+	errors := 0
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "path\treqs\treq/s\tp50\tp90\tp99\tmax\terrors\tallocs/req\tbytes/req\t")
+	for i, r := range results {
+		all = append(all, r.latencies...)
+		errors += r.errors
+		allocs, bytes := "-", "-"
+		if *allocRuns > 0 {
+			a, b := allocsPerRequest(handler, cfg.BasePath+targets[i], *allocRuns)
+			allocs, bytes = fmt.Sprint(a), fmt.Sprint(b)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%.0f\t%s\t%d\t%s\t%s\t\n", targets[i], len(r.latencies),
+			float64(len(r.latencies))/elapsed.Seconds(), percentiles(r.latencies, 0.5, 0.9, 0.99, 1), r.errors, allocs, bytes)
+	}
+	fmt.Fprintf(tw, "total\t%d\t%.0f\t%s\t%d\t\t\t\n", len(all), float64(len(all))/elapsed.Seconds(), percentiles(all, 0.5, 0.9, 0.99, 1), errors)
+	tw.Flush()
+}
+
+// Latency percentiles as tab-separated columns
+func percentiles(latencies []time.Duration, ps ...float64) string {
+	if len(latencies) == 0 {
+		return strings.Repeat("-\t", len(ps)-1) + "-"
+	}
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	cols := make([]string, len(ps))
+	for i, p := range ps {
+		d := sorted[min(int(p*float64(len(sorted))), len(sorted)-1)]
+		cols[i] = d.Round(time.Microsecond).String()
+	}
+	return strings.Join(cols, "\t")
+}
+
+// Heap allocations and bytes of one request through the handler, without
+// the network, averaged over runs made one at a time
+func allocsPerRequest(h http.Handler, path string, runs int) (uint64, uint64) {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = "127.0.0.1:1"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	for i := 0; i < runs; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), req.Clone(req.Context()))
+	}
+	runtime.ReadMemStats(&after)
+	n := uint64(runs)
+	return (after.Mallocs - before.Mallocs) / n, (after.TotalAlloc - before.TotalAlloc) / n
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	gomd "github.com/core6quad/GOMD"
+	"github.com/core6quad/GOMD/compiler"
+	"github.com/core6quad/GOMD/config"
+)
+
+// gomd build [-out dir] [-dry-run] [-verbose] builds the static site, or
+// with -dry-run only shows what building it would do
+func buildSite(args []string) {
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	out := fs.String("out", "public", "directory to write the site into")
+	dryRun := fs.Bool("dry-run", false, "build into a temporary directory and remove it afterwards")
+	verbose := fs.Bool("verbose", false, "list every source file, page with its front matter and generated file")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: gomd build [-out dir] [-dry-run] [-verbose]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	cfg := config.Load(configFile)
+	setupLogger(cfg)
+	site := gomd.New(cfg)
+	defer site.Close()
+	if err := site.Check(); err != nil {
+		site.Close()
+		fatal(err.Error())
+	}
+	dir := *out
+	if *dryRun {
+		tmp, err := os.MkdirTemp("", "gomd-build-")
+		if err != nil {
+			site.Close()
+			fatal("failed to create a temporary directory", "err", err)
+		}
+		defer os.RemoveAll(tmp)
+		dir = tmp
+	}
+	start := time.Now()
+	report, err := site.BuildTo(dir)
+	if err != nil {
+		site.Close()
+		fatal("compile error", "err", err)
+	}
+	if *verbose {
+		fmt.Println("files:")
+		for _, f := range report.Sources {
+			fmt.Printf("  %-40s %s\n", f.Source, f.Action)
+		}
+		fmt.Println("pages:")
+		for _, p := range report.Index {
+			source := p.Source
+			if source == "" {
+				source = "generated"
+			}
+			fmt.Printf("  %s (%s)\n", p.URL, source)
+			fm, _ := json.Marshal(frontMatter(p))
+			fmt.Printf("    %s\n", fm)
+		}
+		fmt.Println("generated:")
+		for _, url := range report.Generated {
+			fmt.Printf("  %s\n", url)
+		}
+	}
+	for _, w := range report.Warnings {
+		fmt.Fprintln(os.Stderr, "warning:", w)
+	}
+	took := time.Since(start).Round(time.Millisecond)
+	if *dryRun {
+		fmt.Printf("would build %d pages and %d files, nothing written (%s)\n", report.Pages, report.Files, took)
+		return
+	}
+	fmt.Printf("built %d pages and %d files into %s (%s)\n", report.Pages, report.Files, dir, took)
+}
+
+// A page's front matter as the build resolved it, only what is set
+func frontMatter(p *compiler.Page) map[string]interface{} {
+	fm := map[string]interface{}{"title": p.Title, "type": p.Type}
+	set := func(key string, v interface{}, ok bool) {
+		if ok {
+			fm[key] = v
+		}
+	}
+	set("description", p.Description, p.Description != "")
+	set("author", p.Author, p.Author != "")
+	set("date", p.Date, p.Date != nil)
+	set("last_modified", p.LastModified, p.LastModified != nil)
+	set("tags", p.Tags, len(p.Tags) > 0)
+	set("canonical", p.Canonical, p.Canonical != "")
+	set("noindex", true, p.NoIndex)
+	set("allow", p.Allow, len(p.Allow) > 0)
+	set("password", "set", p.Password != "")
+	set("variant", p.Variant, p.Variant != "")
+	set("version", p.Version, p.Version != "")
+	for k, v := range p.Params {
+		fm[k] = v
+	}
+	return fm
+}
+
+// gomd routes prints every URL the server answers, with its source
+func listRoutes(args []string) {
+	fs := flag.NewFlagSet("routes", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: gomd routes")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	cfg := config.Load(configFile)
+	setupLogger(cfg)
+	site := gomd.New(cfg)
+	defer site.Close()
+	if err := site.Check(); err != nil {
+		site.Close()
+		fatal(err.Error())
+	}
+	routes, err := site.Routes()
+	if err != nil {
+		site.Close()
+		fatal("compile error", "err", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, r := range routes {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.URL, r.Kind, r.Source)
+	}
+	w.Flush()
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	gomd "github.com/core6quad/GOMD"
+	"github.com/core6quad/GOMD/config"
+)
+
+const configFile = "config.json"
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "preprocess" {
+		preprocess(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "build" {
+		buildSite(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "routes" {
+		listRoutes(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		auditSite(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		lintSite(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "publish" {
+		publishSite(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "user" {
+		user(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "share" {
+		shareLink(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		bench(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		exportSite(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		importSite(os.Args[2:])
+		return
+	}
+	followSymlinks := flag.Bool("follow-symlinks", false, "include symlinked files and directories from the source dir")
+	flag.Parse()
+
+	cfg := config.Load(configFile)
+	if *followSymlinks {
+		cfg.FollowSymlinks = true
+	}
+	setupLogger(cfg)
+
+	// Reset DB if requested
+	if cfg.ResetDB {
+		os.Remove(cfg.AnalyticsDB)
+		// Set resetdb to false in config.json
+		cfg.ResetDB = false
+		_ = cfg.Save(configFile)
+	}
+
+	site := gomd.New(cfg)
+	defer site.Close()
+
+	// Handle Ctrl+C and SIGTERM for cleanup
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		site.Close()
+		os.Exit(0)
+	}()
+
+	// Rebuild the site on SIGHUP
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			site.Audit.Record("signal", "rebuild", "SIGHUP")
+			if err := site.Build(); err != nil {
+				slog.Error("rebuild failed", "err", err)
+			}
+		}
+	}()
+
+	if err := site.ListenAndServe(); err != nil {
+		site.Close()
+		fatal("server stopped", "err", err)
+	}
+}
+
+// gomd preprocess <file.gmd>... prints the markdown each file turns into
+// before rendering, to debug preprocessing rules without building
+func preprocess(args []string) {
+	fs := flag.NewFlagSet("preprocess", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: gomd preprocess <file.gmd>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	cfg := config.Load(configFile)
+	setupLogger(cfg)
+	site := gomd.New(cfg)
+	defer site.Close()
+	for _, path := range fs.Args() {
+		out, err := site.Preprocess(path)
+		if err != nil {
+			site.Close()
+			fatal("preprocess failed", "file", path, "err", err)
+		}
+		os.Stdout.Write(out)
+	}
+}
+
+// Point cfg at a build dir of its own, for commands that build like the
+// server does, so a server running from the same config keeps its pages
+func privateBuildDir(cfg *config.Config) {
+	dir, err := os.MkdirTemp("", "gomd-build-")
+	if err != nil {
+		fatal("failed to create a temporary directory", "err", err)
+	}
+	cfg.BuildDir = dir
+}
+
+// Configure the default slog logger from the config
+func setupLogger(cfg config.Config) {
+	level := slog.LevelInfo
+	switch strings.ToLower(cfg.LogLevel) {
+	case "debug":
+		level = slog.LevelDebug
+	case "warn", "warning":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	}
+	if cfg.Quiet {
+		level = slog.LevelError
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	if strings.ToLower(cfg.LogFormat) == "json" {
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	} else {
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// Log an error and exit
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	gomd "github.com/core6quad/GOMD"
+	"github.com/core6quad/GOMD/config"
+	"github.com/core6quad/GOMD/migrate"
+)
+
+// gomd import --from hugo|jekyll <site dir> converts another generator's
+// site into the source dir
+func importSite(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	from := fs.String("from", "", "the site's generator, hugo or jekyll")
+	out := fs.String("out", "", "where to write the pages (default the source dir)")
+	force := fs.Bool("force", false, "overwrite files that are already there")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: gomd import --from hugo|jekyll [-out dir] [-force] <site dir>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *from == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	cfg := config.Load(configFile)
+	setupLogger(cfg)
+	if *out == "" {
+		*out = cfg.SrcDir
+	}
+	report, err := migrate.Import(*from, fs.Arg(0), *out, *force)
+	if report != nil {
+		for _, w := range report.Warnings {
+			fmt.Println("warning:", w)
+		}
+	}
+	if err != nil {
+		fatal("import failed", "err", err)
+	}
+	fmt.Printf("imported %d pages and %d files into %s\n", report.Pages, report.Files, *out)
+	if len(report.Config) > 0 {
+		b, _ := json.MarshalIndent(report.Config, "", "  ")
+		fmt.Printf("settings from the site's config, for %s:\n%s\n", configFile, b)
+	}
+}
+
+// gomd export [-out dir] writes the site as plain CommonMark files, for
+// moving to another tool
+func exportSite(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	out := fs.String("out", "export", "directory to write the markdown into")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: gomd export [-out dir]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	cfg := config.Load(configFile)
+	setupLogger(cfg)
+	site := gomd.New(cfg)
+	defer site.Close()
+	res, err := site.Export(*out)
+	if err != nil {
+		site.Close()
+		fatal("export failed", "err", err)
+	}
+	fmt.Printf("exported %d pages and %d files to %s\n", res.Pages, res.Files, *out)
+}
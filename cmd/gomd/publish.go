@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	gomd "github.com/core6quad/GOMD"
+	"github.com/core6quad/GOMD/config"
+	"github.com/core6quad/GOMD/publish"
+)
+
+// gomd publish [target...] builds the site and uploads it to the targets
+// in config.json, all of them by default
+func publishSite(args []string) {
+	fs := flag.NewFlagSet("publish", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: gomd publish [target...]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	cfg := config.Load(configFile)
+	setupLogger(cfg)
+	targets := cfg.Publish
+	if fs.NArg() > 0 {
+		targets = nil
+		for _, name := range fs.Args() {
+			found := false
+			for _, t := range cfg.Publish {
+				if t.Name == name {
+					targets = append(targets, t)
+					found = true
+				}
+			}
+			if !found {
+				fatal("no such publish target in config.json", "name", name)
+			}
+		}
+	}
+	if len(targets) == 0 {
+		fatal("add a target to \"publish\" in config.json first")
+	}
+
+	site := gomd.New(cfg)
+	defer site.Close()
+	ctx := context.Background()
+	if err := site.SyncContent(ctx); err != nil {
+		site.Close()
+		fatal("content sync failed", "err", err)
+	}
+	if err := site.Check(); err != nil {
+		site.Close()
+		fatal(err.Error())
+	}
+	dir, err := os.MkdirTemp("", "gomd-publish-")
+	if err != nil {
+		site.Close()
+		fatal("failed to create a temporary directory", "err", err)
+	}
+	defer os.RemoveAll(dir)
+	// A static build, without the pages only the server can keep private
+	report, err := site.BuildTo(dir)
+	if err != nil {
+		site.Close()
+		os.RemoveAll(dir)
+		fatal("compile error", "err", err)
+	}
+	for _, w := range report.Warnings {
+		fmt.Fprintln(os.Stderr, "warning:", w)
+	}
+	cfg.BuildDir = dir
+	files, err := publish.Collect(cfg)
+	if err != nil {
+		site.Close()
+		os.RemoveAll(dir)
+		fatal("failed to collect files", "err", err)
+	}
+	failed := false
+	for _, t := range targets {
+		if err := publish.Run(ctx, cfg, t, files); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+			continue
+		}
+		site.Audit.Record(cliUser(), "publish", t.Name)
+	}
+	if failed {
+		site.Close()
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/core6quad/GOMD/audit"
+	"github.com/core6quad/GOMD/config"
+	"github.com/core6quad/GOMD/share"
+)
+
+// gomd share <url> [duration] prints a link opening a page until it
+// expires, 7 days by default
+func shareLink(args []string) {
+	if len(args) < 1 || len(args) > 2 || !strings.HasPrefix(args[0], "/") {
+		fmt.Fprintln(os.Stderr, "usage: gomd share </page/url> [duration, e.g. 3d or 12h]")
+		os.Exit(2)
+	}
+	valid := 7 * 24 * time.Hour
+	if len(args) == 2 {
+		var err error
+		if days, ok := strings.CutSuffix(args[1], "d"); ok {
+			var n int
+			n, err = strconv.Atoi(days)
+			valid = time.Duration(n) * 24 * time.Hour
+		} else {
+			valid, err = time.ParseDuration(args[1])
+		}
+		if err != nil || valid <= 0 {
+			fatal("invalid duration, use e.g. 3d or 12h", "duration", args[1])
+		}
+	}
+	cfg := config.Load(configFile)
+	keys, err := share.Open(cfg.DataDir)
+	if err != nil {
+		fatal("failed to load share key", "err", err)
+	}
+	expires := time.Now().Add(valid)
+	audit.Open(cfg.DataDir).Record(cliUser(), "share page", args[0]+" until "+expires.UTC().Format(time.RFC3339))
+	fmt.Println(cfg.SiteURL + cfg.BasePath + keys.Link(args[0], expires))
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	osuser "os/user"
+	"strings"
+
+	"github.com/core6quad/GOMD/audit"
+	"github.com/core6quad/GOMD/auth"
+	"github.com/core6quad/GOMD/config"
+	"golang.org/x/term"
+)
+
+const userUsage = `usage:
+  gomd user add <name> <admin|editor|viewer>   add or update an account, asks for the password
+  gomd user remove <name>
+  gomd user reset-2fa <name>                     turn off two-factor authentication, for a lost device
+  gomd user list`
+
+// gomd user manages the accounts in the users file
+func user(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, userUsage)
+		os.Exit(2)
+	}
+	cfg := config.Load(configFile)
+	users, err := auth.Load(cfg.UsersFile, "", "")
+	if err != nil {
+		fatal("failed to load users", "err", err)
+	}
+	log := audit.Open(cfg.DataDir)
+	switch {
+	case args[0] == "add" && len(args) == 3:
+		role, err := auth.ParseRole(args[2])
+		if err != nil {
+			fatal(err.Error())
+		}
+		password, err := readPassword()
+		if err != nil {
+			fatal("failed to read password", "err", err)
+		}
+		if err := users.Set(args[1], password, role); err != nil {
+			fatal("failed to save user", "err", err)
+		}
+		log.Record(cliUser(), "save user", args[1]+" ("+string(role)+")")
+		fmt.Printf("saved %s (%s) to %s, restart gomd to pick it up\n", args[1], role, cfg.UsersFile)
+	case args[0] == "remove" && len(args) == 2:
+		if err := users.Remove(args[1]); err != nil {
+			fatal("failed to remove user", "err", err)
+		}
+		log.Record(cliUser(), "remove user", args[1])
+	case args[0] == "reset-2fa" && len(args) == 2:
+		if err := users.DisableTwoFactor(args[1]); err != nil {
+			fatal("failed to reset two-factor authentication", "err", err)
+		}
+		log.Record(cliUser(), "reset two-factor", args[1])
+		fmt.Printf("turned off two-factor authentication for %s, restart gomd to pick it up\n", args[1])
+	case args[0] == "list" && len(args) == 1:
+		for _, u := range users.List() {
+			twoFactor := ""
+			if u.TwoFactor() {
+				twoFactor = "\t2fa"
+			}
+			fmt.Printf("%s\t%s%s\n", u.Name, u.Role, twoFactor)
+		}
+		if cfg.AnalyticsUser != "" {
+			fmt.Printf("%s\tadmin (analytics_user in %s)\n", cfg.AnalyticsUser, configFile)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, userUsage)
+		os.Exit(2)
+	}
+}
+
+// Who ran the command, for the audit log
+func cliUser() string {
+	if u, err := osuser.Current(); err == nil {
+		return "cli:" + u.Username
+	}
+	return "cli"
+}
+
+// Prompt for a password on a terminal, or read one line from stdin
+func readPassword() (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	p1, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprint(os.Stderr, "Repeat password: ")
+	p2, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if string(p1) != string(p2) {
+		return "", fmt.Errorf("passwords don't match")
+	}
+	return string(p1), nil
+}
@@ -0,0 +1,356 @@
+// Package comments is GOMD's self-hosted comment system. Comments are
+// posted to /comments/<page>, held for moderation in the admin UI and
+// stored as JSON in the data dir.
+package comments
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/core6quad/GOMD/admin"
+	"github.com/core6quad/GOMD/auth"
+	"github.com/core6quad/GOMD/spam"
+)
+
+// Limits for a single comment
+const (
+	maxName = 100
+	maxText = 5000
+)
+
+// Comment is a single comment on a page
+type Comment struct {
+	ID       string    `json:"id"`
+	Page     string    `json:"page"`
+	Name     string    `json:"name"`
+	Text     string    `json:"text"`
+	Time     time.Time `json:"time"`
+	Approved bool      `json:"approved"`
+	// Set for signed in commenters, their website or profile and how
+	// they signed in
+	URL      string `json:"url,omitempty"`
+	Provider string `json:"provider,omitempty"`
+}
+
+// Store keeps all comments in memory and in a JSON file
+type Store struct {
+	mu       sync.Mutex
+	path     string
+	comments []Comment
+
+	// BasePath the site is served under, for redirects back to pages
+	BasePath string
+	// PageExists reports whether comments can be posted to a page URL
+	PageExists func(url string) bool
+	// Visible reports whether a request may see a page, and so read and
+	// post its comments. Everyone may when nil
+	Visible func(r *http.Request, url string) bool
+	// OnChange runs after a comment is approved or deleted, to rebuild
+	// pages showing the thread
+	OnChange func()
+	// Audit records who moderated which comment
+	Audit func(r *http.Request, action, target string)
+	// SignIn, when enabled, is required to post and names the commenter
+	SignIn *SignIn
+	// Spam drops comments before they are queued, and learns from
+	// moderation
+	Spam *spam.Filter
+}
+
+// Open loads the comments file from the data dir, creating it on the
+// first comment
+func Open(dataDir string) (*Store, error) {
+	s := &Store{path: filepath.Join(dataDir, "comments.json")}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.comments); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Approved returns the published comments on a page, oldest first
+func (s *Store) Approved(page string) []Comment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Comment
+	for _, c := range s.comments {
+		if c.Page == page && c.Approved {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Pending returns comments waiting for moderation, oldest first
+func (s *Store) Pending() []Comment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Comment
+	for _, c := range s.comments {
+		if !c.Approved {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Add queues a new comment for moderation
+func (s *Store) Add(page, name, text string) (Comment, error) {
+	return s.add(Comment{Page: page, Name: name, Text: text})
+}
+
+func (s *Store) add(c Comment) (Comment, error) {
+	c.Name, c.Text = strings.TrimSpace(c.Name), strings.TrimSpace(c.Text)
+	switch {
+	case c.Name == "" || c.Text == "":
+		return Comment{}, errors.New("name and text are required")
+	case utf8.RuneCountInString(c.Name) > maxName || utf8.RuneCountInString(c.Text) > maxText:
+		return Comment{}, errors.New("comment too long")
+	case s.PageExists != nil && !s.PageExists(c.Page):
+		return Comment{}, errors.New("no such page")
+	}
+	c.ID, c.Time = newID(), time.Now().UTC()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.comments = append(s.comments, c)
+	return c, s.save()
+}
+
+// Approve publishes a pending comment
+func (s *Store) Approve(id string) error {
+	return s.update(id, func(i int) {
+		s.comments[i].Approved = true
+	})
+}
+
+// Delete removes a comment, pending or published
+func (s *Store) Delete(id string) error {
+	return s.update(id, func(i int) {
+		s.comments = append(s.comments[:i], s.comments[i+1:]...)
+	})
+}
+
+func (s *Store) update(id string, fn func(i int)) error {
+	s.mu.Lock()
+	i := 0
+	for i < len(s.comments) && s.comments[i].ID != id {
+		i++
+	}
+	if i == len(s.comments) {
+		s.mu.Unlock()
+		return errors.New("no such comment")
+	}
+	fn(i)
+	err := s.save()
+	s.mu.Unlock()
+	if err == nil && s.OnChange != nil {
+		s.OnChange()
+	}
+	return err
+}
+
+// Write the comments file atomically, the caller holds mu
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.comments, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ServeHTTP handles /comments/<page>: GET lists the published comments as
+// JSON, POST adds one from a form or a JSON body
+func (s *Store) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	page := strings.TrimPrefix(r.URL.Path, "/comments")
+	if page == "" || page == "/" {
+		http.NotFound(w, r)
+		return
+	}
+	// Comments on a restricted page are as hidden as the page
+	if s.Visible != nil && !s.Visible(r, page) {
+		w.Header().Set("Cache-Control", "private")
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		comments := s.Approved(page)
+		if comments == nil {
+			comments = []Comment{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(comments)
+	case http.MethodPost:
+		r.Body = http.MaxBytesReader(w, r.Body, 16<<10)
+		var in struct{ Name, Text string }
+		isJSON := strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+		if isJSON {
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				http.Error(w, "invalid JSON", http.StatusBadRequest)
+				return
+			}
+		} else {
+			in.Name, in.Text = r.PostFormValue("name"), r.PostFormValue("text")
+		}
+		c := Comment{Page: page, Name: in.Name, Text: in.Text}
+		if s.SignIn.Enabled() {
+			commenter, ok := s.SignIn.Commenter(r)
+			if !ok {
+				if !isJSON {
+					http.Redirect(w, r, s.BasePath+page+"?comment=signin#comments", http.StatusSeeOther)
+					return
+				}
+				http.Error(w, "sign in to comment", http.StatusUnauthorized)
+				return
+			}
+			c.Name, c.URL, c.Provider = commenter.Name, commenter.URL, commenter.Provider
+		}
+		if s.Spam.Check(r, submission(c)) {
+			// Spammers see the same answer as everyone else
+			s.accepted(w, r, c, isJSON)
+			return
+		}
+		c, err := s.add(c)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.accepted(w, r, c, isJSON)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Store) accepted(w http.ResponseWriter, r *http.Request, c Comment, isJSON bool) {
+	if !isJSON {
+		// Plain HTML forms go back to the page
+		http.Redirect(w, r, s.BasePath+c.Page+"?comment=pending#comments", http.StatusSeeOther)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(c)
+}
+
+func submission(c Comment) spam.Submission {
+	return spam.Submission{Kind: "comment", Author: c.Name, URL: c.URL, Text: c.Text}
+}
+
+var moderation = template.Must(template.New("moderation").Parse(`
+{{if .Comments}}
+<table>
+<tr><th>Page</th><th>Name</th><th>Comment</th><th>Posted</th><th></th></tr>
+{{range .Comments}}<tr>
+	<td><a href="{{.Page}}">{{.Page}}</a></td>
+	<td>{{if .URL}}<a href="{{.URL}}" rel="nofollow noopener">{{.Name}}</a>{{else}}{{.Name}}{{end}}{{with .Provider}} ({{.}}){{end}}</td>
+	<td>{{.Text}}</td>
+	<td>{{.Time.Format "2006-01-02 15:04"}}</td>
+	<td>
+		<form class="inline" method="post">{{$.CSRF}}<input type="hidden" name="id" value="{{.ID}}"><button name="action" value="approve">Approve</button></form>
+		<form class="inline" method="post">{{$.CSRF}}<input type="hidden" name="id" value="{{.ID}}"><button class="danger" name="action" value="delete">Delete</button></form>
+		<form class="inline" method="post">{{$.CSRF}}<input type="hidden" name="id" value="{{.ID}}"><button class="danger" name="action" value="spam">Spam</button></form>
+	</td>
+</tr>{{end}}
+</table>
+{{else}}<p class="empty">No comments waiting for moderation.</p>{{end}}
+`))
+
+// Moderation is the admin section approving or deleting pending comments
+func (s *Store) Moderation(a *admin.Admin) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var err error
+			id := r.PostFormValue("id")
+			action := r.PostFormValue("action")
+			target := id
+			var comment Comment
+			for _, c := range s.Pending() {
+				if c.ID == id {
+					target = c.Page + " #" + id
+					comment = c
+				}
+			}
+			switch action {
+			case "approve":
+				err = s.Approve(id)
+			case "delete", "spam":
+				err = s.Delete(id)
+			default:
+				err = errors.New("unknown action")
+			}
+			// Approving and marking as spam teach the filter
+			if err == nil && comment.ID != "" && action != "delete" {
+				s.Spam.Train(submission(comment), action == "spam")
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if s.Audit != nil {
+				s.Audit(r, action+" comment", target)
+			}
+			http.Redirect(w, r, s.BasePath+r.URL.Path, http.StatusSeeOther)
+			return
+		}
+		var buf bytes.Buffer
+		moderation.Execute(&buf, map[string]interface{}{"Comments": s.Pending(), "CSRF": auth.CSRFField(r)})
+		a.Render(w, r, "Comments", template.HTML(buf.String()))
+	})
+}
+
+// Partial defines the "comments" template for page layouts, showing the
+// published thread and a form for new comments:
+//
+//	{{template "comments" .}}
+const Partial = `{{define "comments"}}<section class="comments" id="comments">
+<h2>Comments</h2>
+` + thread + `<form method="post" action="{{url "/comments"}}{{.Page.URL}}">
+<input name="name" placeholder="Name" maxlength="100" required>
+<textarea name="text" placeholder="Comment" maxlength="5000" required></textarea>
+<button>Post comment</button>
+</form>
+</section>{{end}}`
+
+// The published comments of a page, signed in commenters linked to their
+// site
+const thread = `{{range comments .Page.URL}}<article class="comment">
+<p><strong>{{if .URL}}<a href="{{.URL}}" rel="nofollow noopener">{{.Name}}</a>{{else}}{{.Name}}{{end}}</strong> <time datetime="{{.Time.Format "2006-01-02T15:04:05Z07:00"}}">{{.Time.Format "January 2, 2006"}}</time></p>
+<p>{{.Text}}</p>
+</article>
+{{else}}<p>No comments yet.</p>
+{{end}}`
+
+// DisabledPartial keeps layouts using the partial working with comments off
+const DisabledPartial = `{{define "comments"}}{{end}}`
@@ -0,0 +1,64 @@
+package comments
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRestrictedPageComments(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.PageExists = func(url string) bool { return url == "/team" || url == "/public" }
+	s.Visible = func(r *http.Request, url string) bool { return url != "/team" }
+	for _, page := range []string{"/team", "/public"} {
+		c, err := s.Add(page, "Ann", "Hello")
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Approved = true
+		s.comments[len(s.comments)-1] = c
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/comments/team", nil))
+	if w.Code != http.StatusNotFound || strings.Contains(w.Body.String(), "Hello") {
+		t.Errorf("GET /comments/team = %d %q, want 404", w.Code, w.Body)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/comments/team", strings.NewReader("name=Bob&text=Hi"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound || len(s.Pending()) != 0 {
+		t.Errorf("POST /comments/team = %d with %d pending, want 404 and none", w.Code, len(s.Pending()))
+	}
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/comments/public", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Hello") {
+		t.Errorf("GET /comments/public = %d %q, want the thread", w.Code, w.Body)
+	}
+}
+
+func TestModerationRedirectKeepsBasePath(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.BasePath = "/docs"
+	c, err := s.Add("/intro", "Ann", "Hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The base path is already stripped when the request gets here
+	r := httptest.NewRequest(http.MethodPost, "/admin/comments", strings.NewReader("action=approve&id="+c.ID))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	s.Moderation(nil).ServeHTTP(w, r)
+	if loc := w.Header().Get("Location"); w.Code != http.StatusSeeOther || loc != "/docs/admin/comments" {
+		t.Errorf("approving = %d to %q, want a redirect to /docs/admin/comments", w.Code, loc)
+	}
+}
@@ -0,0 +1,580 @@
+package comments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// Cookies holding a signed in commenter: the signed identity, and its name
+// for the comment form's script to show
+const (
+	commenterCookie = "gomd_commenter"
+	nameCookie      = "gomd_commenter_name"
+	stateCookie     = "gomd_commenter_state"
+)
+
+// How long a commenter stays signed in, and a sign in may take
+const (
+	commenterLifetime = 30 * 24 * time.Hour
+	pendingLifetime   = 10 * time.Minute
+	maxPending        = 10000
+)
+
+// GitHub's OAuth and API endpoints
+var (
+	gitHubAuthorize = "https://github.com/login/oauth/authorize"
+	gitHubToken     = "https://github.com/login/oauth/access_token"
+	gitHubUser      = "https://api.github.com/user"
+)
+
+// Sign-in fetches whatever website a commenter enters, so private and
+// loopback addresses are off limits
+var client = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		// Never through a proxy, which would dial the target itself
+		// and skip the address check below
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, _ := net.SplitHostPort(address)
+				if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+					return errors.New("refusing to connect to " + host)
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+}
+
+// Replaced when testing against local servers
+var publicIP = func(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast())
+}
+
+// Commenter is who a signed in comment is from. URL is their website or
+// GitHub profile
+type Commenter struct {
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Provider string `json:"provider"` // "indieauth" or "github"
+	Expires  int64  `json:"exp"`
+}
+
+// SignIn lets commenters sign in with their own website (IndieAuth) or
+// GitHub, instead of posting under any name. Identities live in a signed
+// cookie, only sign ins in progress are kept in memory
+type SignIn struct {
+	key []byte
+
+	mu      sync.Mutex
+	pending map[string]pendingSignIn
+
+	IndieAuth          bool
+	GitHubClientID     string
+	GitHubClientSecret string
+	// Where the site is served, for the client ID and callback URL.
+	// Without SiteURL, the host requests come in on
+	SiteURL  string
+	BasePath string
+}
+
+type pendingSignIn struct {
+	provider string
+	// IndieAuth: the website entered, its authorization endpoint and
+	// issuer, and the PKCE verifier
+	me, endpoint, issuer, verifier string
+	// Page to go back to
+	back    string
+	expires time.Time
+}
+
+// OpenSignIn loads the cookie signing key from the data dir, creating it
+// the first time
+func OpenSignIn(dataDir string) (*SignIn, error) {
+	path := filepath.Join(dataDir, "commenters.key")
+	key, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		key = []byte(randomToken() + randomToken())
+		if err = os.MkdirAll(dataDir, 0755); err == nil {
+			err = os.WriteFile(path, key, 0600)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &SignIn{key: key, pending: make(map[string]pendingSignIn)}, nil
+}
+
+// Enabled reports whether any provider is configured
+func (si *SignIn) Enabled() bool {
+	return si != nil && (si.IndieAuth || si.GitHubClientID != "")
+}
+
+func randomToken() string {
+	return newID() + newID()
+}
+
+func (si *SignIn) mac(data string) string {
+	h := hmac.New(sha256.New, si.key)
+	h.Write([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// Commenter returns who is signed in on a request
+func (si *SignIn) Commenter(r *http.Request) (Commenter, bool) {
+	var c Commenter
+	cookie, err := r.Cookie(commenterCookie)
+	if err != nil {
+		return c, false
+	}
+	data, sig, ok := strings.Cut(cookie.Value, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(si.mac(data))) {
+		return c, false
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil || json.Unmarshal(raw, &c) != nil || time.Now().Unix() > c.Expires {
+		return c, false
+	}
+	return c, true
+}
+
+func secure(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+func (si *SignIn) setCookies(w http.ResponseWriter, r *http.Request, c Commenter) {
+	expires := time.Now().Add(commenterLifetime)
+	c.Expires = expires.Unix()
+	raw, _ := json.Marshal(c)
+	data := base64.RawURLEncoding.EncodeToString(raw)
+	http.SetCookie(w, &http.Cookie{
+		Name: commenterCookie, Value: data + "." + si.mac(data), Path: "/", Expires: expires,
+		HttpOnly: true, Secure: secure(r), SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name: nameCookie, Value: url.QueryEscape(c.Name), Path: "/", Expires: expires,
+		Secure: secure(r), SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Absolute URL of a route, from site_url or the request itself
+func (si *SignIn) link(r *http.Request, path string) string {
+	origin := si.SiteURL
+	if origin == "" {
+		scheme := "http"
+		if secure(r) {
+			scheme = "https"
+		}
+		origin = scheme + "://" + r.Host
+	}
+	return origin + si.BasePath + path
+}
+
+// Only pages of this site are gone back to
+func safeBack(back string) string {
+	if !strings.HasPrefix(back, "/") || strings.HasPrefix(back, "//") || strings.Contains(back, `\`) {
+		return "/"
+	}
+	return back
+}
+
+// ServeHTTP handles /commenter/signin?provider=&return= (and me= for
+// IndieAuth), the providers' redirect back to /commenter/callback, and a
+// POST to /commenter/signout
+func (si *SignIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/commenter/signin":
+		si.start(w, r)
+	case "/commenter/callback":
+		si.callback(w, r)
+	case "/commenter/signout":
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		for _, name := range []string{commenterCookie, nameCookie} {
+			http.SetCookie(w, &http.Cookie{Name: name, Value: "", Path: "/", MaxAge: -1})
+		}
+		http.Redirect(w, r, si.BasePath+safeBack(r.FormValue("return"))+"#comments", http.StatusSeeOther)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (si *SignIn) start(w http.ResponseWriter, r *http.Request) {
+	p := pendingSignIn{provider: r.FormValue("provider"), back: safeBack(r.FormValue("return")), expires: time.Now().Add(pendingLifetime)}
+	state := randomToken()
+	callback := si.link(r, "/commenter/callback")
+	var target string
+	switch {
+	case p.provider == "github" && si.GitHubClientID != "":
+		target = gitHubAuthorize + "?" + url.Values{
+			"client_id":    {si.GitHubClientID},
+			"redirect_uri": {callback},
+			"state":        {state},
+		}.Encode()
+	case p.provider == "indieauth" && si.IndieAuth:
+		me, err := canonicalMe(r.FormValue("me"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		endpoint, issuer, err := discoverIndieAuth(me)
+		if err != nil {
+			http.Error(w, "no IndieAuth server found for "+me+": "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		p.me, p.endpoint, p.issuer, p.verifier = me, endpoint, issuer, randomToken()
+		challenge := sha256.Sum256([]byte(p.verifier))
+		target = endpoint + sep(endpoint) + url.Values{
+			"response_type":         {"code"},
+			"client_id":             {si.link(r, "/")},
+			"redirect_uri":          {callback},
+			"state":                 {state},
+			"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+			"code_challenge_method": {"S256"},
+			"scope":                 {"profile"},
+			"me":                    {me},
+		}.Encode()
+	default:
+		http.Error(w, "unknown sign in provider", http.StatusBadRequest)
+		return
+	}
+	si.mu.Lock()
+	now := time.Now()
+	for k, old := range si.pending {
+		if now.After(old.expires) {
+			delete(si.pending, k)
+		}
+	}
+	full := len(si.pending) >= maxPending
+	if !full {
+		si.pending[state] = p
+	}
+	si.mu.Unlock()
+	if full {
+		http.Error(w, "too many sign ins in progress, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	// Ties the callback to the browser that started the sign in
+	http.SetCookie(w, &http.Cookie{
+		Name: stateCookie, Value: state, Path: "/", MaxAge: int(pendingLifetime.Seconds()),
+		HttpOnly: true, Secure: secure(r), SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+func sep(endpoint string) string {
+	if strings.Contains(endpoint, "?") {
+		return "&"
+	}
+	return "?"
+}
+
+func (si *SignIn) callback(w http.ResponseWriter, r *http.Request) {
+	state := r.FormValue("state")
+	si.mu.Lock()
+	p, ok := si.pending[state]
+	delete(si.pending, state)
+	si.mu.Unlock()
+	cookie, err := r.Cookie(stateCookie)
+	if !ok || err != nil || cookie.Value != state || time.Now().After(p.expires) {
+		http.Error(w, "sign in expired or started elsewhere, try again", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: stateCookie, Value: "", Path: "/", MaxAge: -1})
+	code := r.FormValue("code")
+	if code == "" {
+		http.Redirect(w, r, si.BasePath+p.back+"?comment=signin#comments", http.StatusSeeOther)
+		return
+	}
+	var c Commenter
+	switch p.provider {
+	case "github":
+		c, err = si.redeemGitHub(r, code)
+	case "indieauth":
+		if p.issuer != "" && r.FormValue("iss") != p.issuer {
+			err = errors.New("response from the wrong issuer")
+			break
+		}
+		c, err = si.redeemIndieAuth(r, p, code)
+	}
+	if err != nil {
+		slog.Info("commenter sign in failed", "provider", p.provider, "me", p.me, "err", err)
+		http.Error(w, "sign in failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	si.setCookies(w, r, c)
+	http.Redirect(w, r, si.BasePath+p.back+"#comments", http.StatusSeeOther)
+}
+
+// A profile URL the way IndieAuth wants it: http(s), a path, no fragment
+func canonicalMe(me string) (string, error) {
+	me = strings.TrimSpace(me)
+	if !strings.Contains(me, "://") {
+		me = "https://" + me
+	}
+	u, err := url.Parse(me)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" || u.User != nil {
+		return "", errors.New("enter the address of your website")
+	}
+	u.Host, u.Fragment = strings.ToLower(u.Host), ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String(), nil
+}
+
+// Find a website's authorization endpoint: its IndieAuth metadata, or an
+// authorization_endpoint link from before metadata existed
+func discoverIndieAuth(me string) (endpoint, issuer string, err error) {
+	links, err := relLinks(me, "indieauth-metadata", "authorization_endpoint")
+	if err != nil {
+		return "", "", err
+	}
+	if meta := links["indieauth-metadata"]; meta != "" {
+		resp, err := client.Get(meta)
+		if err != nil {
+			return "", "", err
+		}
+		defer resp.Body.Close()
+		var m struct {
+			Issuer                string `json:"issuer"`
+			AuthorizationEndpoint string `json:"authorization_endpoint"`
+		}
+		if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&m); err != nil {
+			return "", "", err
+		}
+		endpoint, issuer = m.AuthorizationEndpoint, m.Issuer
+	} else {
+		endpoint = links["authorization_endpoint"]
+	}
+	if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return "", "", errors.New("no authorization endpoint")
+	}
+	return endpoint, issuer, nil
+}
+
+// The first link for each rel, from the Link header or the page's <link>
+// and <a> tags, resolved against the page URL
+func relLinks(page string, rels ...string) (map[string]string, error) {
+	resp, err := client.Get(page)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+	base := resp.Request.URL
+	found := make(map[string]string)
+	add := func(rel, ref string) {
+		for _, r := range strings.Fields(rel) {
+			for _, want := range rels {
+				if r == want && found[r] == "" {
+					if u, err := base.Parse(ref); err == nil {
+						found[r] = u.String()
+					}
+				}
+			}
+		}
+	}
+	for _, link := range resp.Header.Values("Link") {
+		for _, part := range strings.Split(link, ",") {
+			ref, params, _ := strings.Cut(part, ";")
+			for _, p := range strings.Split(params, ";") {
+				if k, v, _ := strings.Cut(strings.TrimSpace(p), "="); k == "rel" {
+					add(strings.Trim(v, `"`), strings.Trim(strings.TrimSpace(ref), "<>"))
+				}
+			}
+		}
+	}
+	z := html.NewTokenizer(io.LimitReader(resp.Body, 1<<20))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		t := z.Token()
+		if t.Data != "link" && t.Data != "a" {
+			continue
+		}
+		var rel, href string
+		for _, a := range t.Attr {
+			switch a.Key {
+			case "rel":
+				rel = a.Val
+			case "href":
+				href = a.Val
+			}
+		}
+		add(rel, href)
+	}
+	return found, nil
+}
+
+// Exchange an IndieAuth code for the commenter's profile URL, and check
+// the server that vouched for it is the one their website names
+func (si *SignIn) redeemIndieAuth(r *http.Request, p pendingSignIn, code string) (Commenter, error) {
+	var c Commenter
+	req, err := http.NewRequest(http.MethodPost, p.endpoint, strings.NewReader(url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"client_id":     {si.link(r, "/")},
+		"redirect_uri":  {si.link(r, "/commenter/callback")},
+		"code_verifier": {p.verifier},
+	}.Encode()))
+	if err != nil {
+		return c, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	var res struct {
+		Me      string `json:"me"`
+		Profile struct {
+			Name string `json:"name"`
+		} `json:"profile"`
+	}
+	if err := fetchJSON(req, &res); err != nil {
+		return c, err
+	}
+	me, err := canonicalMe(res.Me)
+	if err != nil {
+		return c, errors.New("no profile URL in the response")
+	}
+	if me != p.me {
+		endpoint, _, err := discoverIndieAuth(me)
+		if err != nil || endpoint != p.endpoint {
+			return c, fmt.Errorf("%s does not use %s", me, p.endpoint)
+		}
+	}
+	c = Commenter{Name: res.Profile.Name, URL: me, Provider: "indieauth"}
+	if c.Name == "" {
+		u, _ := url.Parse(me)
+		c.Name = strings.TrimSuffix(u.Host+u.Path, "/")
+	}
+	c.Name = truncate(c.Name, maxName)
+	return c, nil
+}
+
+// Exchange a GitHub code for a token, and the token for the account
+func (si *SignIn) redeemGitHub(r *http.Request, code string) (Commenter, error) {
+	var c Commenter
+	req, err := http.NewRequest(http.MethodPost, gitHubToken, strings.NewReader(url.Values{
+		"client_id":     {si.GitHubClientID},
+		"client_secret": {si.GitHubClientSecret},
+		"code":          {code},
+		"redirect_uri":  {si.link(r, "/commenter/callback")},
+	}.Encode()))
+	if err != nil {
+		return c, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	var token struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error_description"`
+	}
+	if err := fetchJSON(req, &token); err != nil {
+		return c, err
+	}
+	if token.AccessToken == "" {
+		return c, errors.New("no access token: " + token.Error)
+	}
+	req, _ = http.NewRequest(http.MethodGet, gitHubUser, nil)
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	var user struct {
+		Login   string `json:"login"`
+		Name    string `json:"name"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err := fetchJSON(req, &user); err != nil {
+		return c, err
+	}
+	if user.Login == "" {
+		return c, errors.New("no GitHub account in the response")
+	}
+	c = Commenter{Name: user.Name, URL: user.HTMLURL, Provider: "github"}
+	if c.Name == "" {
+		c.Name = user.Login
+	}
+	c.Name = truncate(c.Name, maxName)
+	return c, nil
+}
+
+func fetchJSON(req *http.Request, v interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(v)
+}
+
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
+
+// SignInPartial defines the "comments" template for sites where
+// commenters sign in: the comment form shows once they are, the sign in
+// options until then
+func SignInPartial(indieAuth, gitHub bool) string {
+	var signIn strings.Builder
+	if indieAuth {
+		signIn.WriteString(`<form method="get" action="{{url "/commenter/signin"}}">
+<input type="hidden" name="provider" value="indieauth"><input type="hidden" name="return" value="{{.Page.URL}}">
+<input name="me" type="text" inputmode="url" placeholder="yoursite.com" required>
+<button>Sign in with your site</button>
+</form>
+`)
+	}
+	if gitHub {
+		signIn.WriteString(`<p><a href="{{url "/commenter/signin"}}?provider=github&amp;return={{.Page.URL}}">Sign in with GitHub</a></p>
+`)
+	}
+	return `{{define "comments"}}<section class="comments" id="comments">
+<h2>Comments</h2>
+` + thread + `<form class="comment-form" method="post" action="{{url "/comments"}}{{.Page.URL}}">
+<p>Commenting as <strong class="commenter-name"></strong></p>
+<textarea name="text" placeholder="Comment" maxlength="5000" required></textarea>
+<button>Post comment</button>
+</form>
+<form class="comment-signout" method="post" action="{{url "/commenter/signout"}}"><input type="hidden" name="return" value="{{.Page.URL}}"><button>Sign out</button></form>
+<div class="comment-signin">
+` + signIn.String() + `</div>
+<script>(function(){var s=document.currentScript.parentNode,m=document.cookie.match(/(?:^|; )gomd_commenter_name=([^;]*)/);
+s.querySelector(".comment-form").hidden=s.querySelector(".comment-signout").hidden=!m;s.querySelector(".comment-signin").hidden=!!m;
+if(m)s.querySelector(".commenter-name").textContent=decodeURIComponent(m[1].replace(/\+/g," "))})()</script>
+</section>{{end}}`
+}
@@ -0,0 +1,120 @@
+package compiler
+
+import (
+	"bytes"
+	"html"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Types of the output formats, for the alternate links in the head
+var outputTypes = map[string]string{
+	"md":  "text/markdown",
+	"txt": "text/plain",
+}
+
+func (opts Options) hasOutput(ext string) bool {
+	for _, f := range opts.OutputFormats {
+		if f == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// Restricted and password protected pages get no alternates, the server
+// only guards their HTML. Neither do generated pages and A/B variants
+func hasAlternates(p *Page) bool {
+	return p.Source != "" && p.Variant == "" && len(p.Allow) == 0 && p.Password == ""
+}
+
+// Write the page's other formats next to its HTML, named after its URL:
+// /docs/intro.md and /docs/intro.txt
+func writeAlternates(opts Options, p *Page) error {
+	if !hasAlternates(p) {
+		return nil
+	}
+	name := filepath.Join(opts.BuildDir, filepath.FromSlash(strings.TrimPrefix(p.URL, "/")))
+	for _, ext := range opts.OutputFormats {
+		var data []byte
+		switch ext {
+		case "md":
+			data = pageMarkdown(p)
+		case "txt":
+			data = plainText(p)
+		default:
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(name+"."+ext, data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The page's markdown, starting with its title
+func pageMarkdown(p *Page) []byte {
+	data := p.Markdown
+	if data == nil {
+		// Converted formats have HTML, which markdown allows
+		data = []byte(p.Content)
+	}
+	if !headingRe.Match(data) {
+		data = append([]byte("# "+p.Title+"\n\n"), data...)
+	}
+	return data
+}
+
+func alternateLinks(p *Page, opts Options) template.HTML {
+	if !hasAlternates(p) {
+		return ""
+	}
+	var head template.HTML
+	for _, ext := range opts.OutputFormats {
+		if typ, ok := outputTypes[ext]; ok {
+			href := WithBase(opts.BasePath, p.URL+"."+ext)
+			head += template.HTML(`<link rel="alternate" type="` + typ + `" href="` + template.HTMLEscapeString(href) + "\">\n")
+		}
+	}
+	return head
+}
+
+var (
+	blockEndRe = regexp.MustCompile(`(?i)</(p|h[1-6]|li|div|pre|tr|blockquote|table|ul|ol|dl|dd|dt|figure|section)>|<br\s*/?>|<hr\s*/?>`)
+	preRe      = regexp.MustCompile(`(?is)<pre[^>]*>.*?</pre>`)
+	blankRe    = regexp.MustCompile(`\n{3,}`)
+)
+
+// The page as plain text: its title, then its content with paragraphs
+// and list items on their own lines and code blocks as they are
+func plainText(p *Page) []byte {
+	content := string(p.Content)
+	// Code keeps its whitespace, everything else is collapsed
+	var pres []string
+	content = preRe.ReplaceAllStringFunc(content, func(m string) string {
+		pres = append(pres, html.UnescapeString(strings.Trim(tagRe.ReplaceAllString(m, ""), "\n")))
+		return "\x01\x00" + strconv.Itoa(len(pres)-1) + "\x01"
+	})
+	content = blockEndRe.ReplaceAllString(content, "\x01")
+	content = tagRe.ReplaceAllString(content, "")
+	var b bytes.Buffer
+	b.WriteString(p.Title + "\n" + strings.Repeat("=", len([]rune(p.Title))) + "\n\n")
+	for _, block := range strings.Split(content, "\x01") {
+		if i, err := strconv.Atoi(strings.TrimPrefix(block, "\x00")); err == nil && strings.HasPrefix(block, "\x00") {
+			b.WriteString(pres[i] + "\n\n")
+			continue
+		}
+		text := strings.TrimSpace(spaceRe.ReplaceAllString(html.UnescapeString(block), " "))
+		if text != "" && text != p.Title {
+			b.WriteString(text + "\n\n")
+		}
+	}
+	return append(blankRe.ReplaceAll(bytes.TrimRight(b.Bytes(), "\n"), []byte("\n\n")), '\n')
+}
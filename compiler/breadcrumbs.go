@@ -0,0 +1,87 @@
+package compiler
+
+import (
+	"encoding/json"
+	"html/template"
+	"path"
+	"strings"
+)
+
+// Crumb is one step of a page's breadcrumb trail. URL is empty for
+// sections without an index page
+type Crumb struct {
+	Title string `json:"title"`
+	URL   string `json:"url,omitempty"`
+}
+
+// Fill in Page.Breadcrumbs from the URL path: Home, then every section
+// named after its index page when it has one, then the page itself
+func breadcrumbPages(pages []*Page) {
+	byURL := make(map[string]*Page, len(pages))
+	for _, p := range pages {
+		byURL[p.URL] = p
+	}
+	for _, p := range pages {
+		crumbs := []Crumb{{Title: "Home", URL: "/"}}
+		if home, ok := byURL["/index"]; ok && home.Title != "" {
+			crumbs[0].Title = home.Title
+		}
+		// A section's index page is the last crumb of its own section
+		dir := path.Dir(p.URL)
+		if path.Base(p.URL) == "index" {
+			dir = path.Dir(dir)
+		}
+		dirs := strings.Split(strings.Trim(dir, "/"), "/")
+		for i := range dirs {
+			if dirs[i] == "" {
+				continue
+			}
+			section := "/" + strings.Join(dirs[:i+1], "/")
+			c := Crumb{Title: dirs[i]}
+			if idx, ok := byURL[section+"/index"]; ok {
+				c = Crumb{Title: idx.Title, URL: idx.URL}
+			}
+			crumbs = append(crumbs, c)
+		}
+		if p.URL != "/index" {
+			crumbs = append(crumbs, Crumb{Title: p.Title, URL: p.URL})
+		}
+		p.Breadcrumbs = crumbs
+	}
+}
+
+// schema.org BreadcrumbList for the page head, URLs are made absolute
+// with the site URL when one is set
+func breadcrumbJSONLD(crumbs []Crumb, siteURL, basePath string) template.HTML {
+	type listItem struct {
+		Type     string `json:"@type"`
+		Position int    `json:"position"`
+		Name     string `json:"name"`
+		Item     string `json:"item"`
+	}
+	var items []listItem
+	for _, c := range crumbs {
+		if c.URL == "" {
+			continue
+		}
+		items = append(items, listItem{"ListItem", len(items) + 1, c.Title, siteURL + WithBase(basePath, c.URL)})
+	}
+	if len(items) < 2 {
+		return ""
+	}
+	return jsonLD(map[string]interface{}{
+		"@context":        "https://schema.org",
+		"@type":           "BreadcrumbList",
+		"itemListElement": items,
+	})
+}
+
+// Wrap structured data in a script tag. encoding/json escapes <, > and &,
+// so the data can't close the tag early
+func jsonLD(v interface{}) template.HTML {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return template.HTML(`<script type="application/ld+json">` + string(b) + "</script>\n")
+}
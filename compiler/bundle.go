@@ -0,0 +1,117 @@
+package compiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// Where bundles go in the build dir, cleared on every build so old hashes
+// don't pile up
+const bundleDir = "bundles"
+
+var bundleTargets = map[string]api.Target{
+	"":       api.ES2020,
+	"es2015": api.ES2015,
+	"es2016": api.ES2016,
+	"es2017": api.ES2017,
+	"es2018": api.ES2018,
+	"es2019": api.ES2019,
+	"es2020": api.ES2020,
+	"es2021": api.ES2021,
+	"es2022": api.ES2022,
+	"es2023": api.ES2023,
+	"es2024": api.ES2024,
+	"esnext": api.ESNext,
+}
+
+// The URLs of a bundled entry point
+type bundle struct {
+	JS, CSS string
+}
+
+// Bundle the JS/TS entry points of the config with esbuild, into hashed
+// files under bundles/ in the build dir. Returns their URLs by entry
+func writeBundles(opts Options) (map[string]bundle, error) {
+	out := filepath.Join(opts.BuildDir, bundleDir)
+	if err := os.RemoveAll(out); err != nil {
+		return nil, err
+	}
+	if len(opts.Bundle.Entries) == 0 {
+		return nil, nil
+	}
+	target, ok := bundleTargets[strings.ToLower(opts.Bundle.Target)]
+	if !ok {
+		return nil, fmt.Errorf("bundle: unknown target %q", opts.Bundle.Target)
+	}
+	sourcemap := api.SourceMapNone
+	if opts.Bundle.Sourcemap {
+		sourcemap = api.SourceMapLinked
+	}
+	res := api.Build(api.BuildOptions{
+		EntryPoints:       opts.Bundle.Entries,
+		Bundle:            true,
+		Outdir:            out,
+		EntryNames:        "[name]-[hash]",
+		AssetNames:        "[name]-[hash]",
+		Format:            api.FormatIIFE,
+		Target:            target,
+		MinifyWhitespace:  opts.Bundle.Minify,
+		MinifyIdentifiers: opts.Bundle.Minify,
+		MinifySyntax:      opts.Bundle.Minify,
+		Sourcemap:         sourcemap,
+		Metafile:          true,
+		Write:             true,
+		LogLevel:          api.LogLevelSilent,
+	})
+	if len(res.Errors) > 0 {
+		e := res.Errors[0]
+		if e.Location != nil {
+			return nil, fmt.Errorf("bundle: %s:%d: %s", e.Location.File, e.Location.Line, e.Text)
+		}
+		return nil, fmt.Errorf("bundle: %s", e.Text)
+	}
+	var meta struct {
+		Outputs map[string]struct {
+			EntryPoint string `json:"entryPoint"`
+			CSSBundle  string `json:"cssBundle"`
+		} `json:"outputs"`
+	}
+	if err := json.Unmarshal([]byte(res.Metafile), &meta); err != nil {
+		return nil, err
+	}
+	// Output paths are relative to the working directory, like the entries
+	url := func(file string) string {
+		rel, err := filepath.Rel(opts.BuildDir, filepath.FromSlash(file))
+		if err != nil {
+			return ""
+		}
+		return WithBase(opts.BasePath, "/"+filepath.ToSlash(rel))
+	}
+	bundles := make(map[string]bundle)
+	for file, o := range meta.Outputs {
+		if o.EntryPoint == "" {
+			continue
+		}
+		b := bundle{JS: url(file)}
+		if o.CSSBundle != "" {
+			b.CSS = url(o.CSSBundle)
+		}
+		bundles[path.Clean(o.EntryPoint)] = b
+	}
+	return bundles, nil
+}
+
+// The bundle of an entry point as the config names it
+func bundleOf(bundles map[string]bundle, entry string) (bundle, error) {
+	b, ok := bundles[path.Clean(filepath.ToSlash(entry))]
+	if !ok {
+		return b, fmt.Errorf("%s is not a bundle entry point in config.json", entry)
+	}
+	return b, nil
+}
@@ -0,0 +1,97 @@
+package compiler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func init() {
+	// Types front matter params decode into
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+	gob.Register(time.Time{})
+}
+
+// Cache keeps compiled pages in a directory across builds and restarts,
+// keyed by their source and a fingerprint of everything else rendering
+// depends on: config, templates, plugins and the binary. A nil Cache
+// compiles everything
+type Cache struct {
+	dir         string
+	fingerprint string
+	used        map[string]bool
+}
+
+// OpenCache returns the cache in dir for builds with the fingerprint
+func OpenCache(dir, fingerprint string) *Cache {
+	return &Cache{dir: dir, fingerprint: fingerprint, used: make(map[string]bool)}
+}
+
+func (c *Cache) file(rel string, input []byte) string {
+	h := sha256.New()
+	h.Write([]byte(c.fingerprint))
+	h.Write([]byte{0})
+	h.Write([]byte(rel))
+	h.Write([]byte{0})
+	h.Write(input)
+	name := hex.EncodeToString(h.Sum(nil)) + ".gob"
+	c.used[name] = true
+	return filepath.Join(c.dir, name)
+}
+
+// The page compiled from the same input last time, if any
+func (c *Cache) get(rel string, input []byte) (*Page, bool) {
+	if c == nil {
+		return nil, false
+	}
+	data, err := os.ReadFile(c.file(rel, input))
+	if err != nil {
+		return nil, false
+	}
+	var p Page
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&p); err != nil {
+		return nil, false
+	}
+	return &p, true
+}
+
+// Save a freshly compiled page, before it is linked to the others
+func (c *Cache) put(rel string, input []byte, p *Page) {
+	if c == nil {
+		return
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(p); err != nil {
+		slog.Warn("build cache: can't store page", "page", p.Source, "err", err)
+		return
+	}
+	file := c.file(rel, input)
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err == nil {
+		os.Rename(tmp, file)
+	}
+}
+
+// Remove the entries this build didn't use, for deleted pages, old
+// versions and old fingerprints
+func (c *Cache) prune() {
+	if c == nil {
+		return
+	}
+	entries, _ := os.ReadDir(c.dir)
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".gob") && !c.used[e.Name()] {
+			os.Remove(filepath.Join(c.dir, e.Name()))
+		}
+	}
+}
@@ -0,0 +1,674 @@
+// Package compiler turns .gmd sources into HTML pages.
+package compiler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/core6quad/GOMD/auth"
+	"github.com/core6quad/GOMD/config"
+	"github.com/core6quad/GOMD/minify"
+	"github.com/core6quad/GOMD/plugin"
+	"github.com/core6quad/GOMD/sass"
+	"github.com/core6quad/GOMD/sri"
+)
+
+// Options controls a compile run
+type Options struct {
+	SrcDir   string
+	BuildDir string
+	// Inject is raw HTML appended to every compiled page
+	Inject string
+	// Head is raw HTML added to the head of pages rendered into a layout
+	Head string
+	// Plugins run their PreProcess and PostRender hooks on every page
+	Plugins []plugin.Plugin
+	// Exclude lists glob patterns of source files and directories that are
+	// neither compiled nor copied, matched against the slash-separated path
+	// relative to SrcDir and against the base name. IgnoreFile in SrcDir
+	// adds more
+	Exclude []string
+	// FollowSymlinks includes symlinked files and directories, which are
+	// skipped with a warning otherwise
+	FollowSymlinks bool
+	// Rules are applied in order after the built-in GMD syntax
+	Rules []Rule
+	// BasePath is prepended to root-relative link and image URLs
+	BasePath string
+	// Emoji converts :rocket: style shortcodes to Unicode emoji
+	Emoji bool
+	// Markdown toggles extensions, nil toggles keep blackfriday's defaults
+	Markdown config.MarkdownConfig
+	// Headings moves page headings down and checks them
+	Headings config.HeadingsConfig
+	// ValidateHTML fails the build for pages with broken HTML
+	ValidateHTML bool
+	// SiteURL is the public origin, e.g. "https://example.com", used for
+	// absolute URLs in structured data and the sitemap, which is only
+	// written when it is set
+	SiteURL string
+	// StructuredData maps page types to the schema.org type of their JSON-LD,
+	// an empty type turns it off
+	StructuredData map[string]string
+	// GitDir is the repository of SrcDir when it is kept outside of it, for
+	// Page.LastModified and Page.Authors from git history
+	GitDir string
+	// Versions lists the version directories of versioned docs
+	Versions config.VersionsConfig
+	// Recent generates a "Recently updated" page and JSON Feed when its
+	// Limit is set
+	Recent config.RecentConfig
+	// LLMs writes llms.txt and llms-full.txt when enabled
+	LLMs config.LLMsConfig
+	// Feeds of the site, tags and sections, with Limit entries each
+	Feeds config.FeedsConfig
+	// SiteName titles the site's feed
+	SiteName string
+	// EditURL is prepended to a page's source path for Page.EditURL, e.g.
+	// "https://github.com/you/site/edit/main/web/"
+	EditURL string
+	// TemplatesDir holds page.html, the html/template layout pages are
+	// rendered into. Without it pages are written as HTML fragments
+	TemplatesDir string
+	// Favicon is the image the favicon set is made from, when set
+	Favicon string
+	// PWA makes the site an installable web app
+	PWA config.PWAConfig
+	// OGImages renders social preview cards for og:image when enabled
+	OGImages config.OGImagesConfig
+	// AssetsDir is where /assets/ URLs in the video and audio shortcodes
+	// point to
+	AssetsDir string
+	// Media commands creating other formats of embedded video and audio
+	Media config.MediaConfig
+	// Minify shrinks pages and static files, nil leaves them as they are
+	Minify *minify.Minifier
+	// Sass compiles .scss files, nil copies them as they are
+	Sass *sass.Compiler
+	// Formats are the other page formats to compile, like "adoc" and
+	// "rst", mapped to their converter command ("" for the default)
+	Formats map[string]string
+	// Bundle lists JS/TS entry points bundled with esbuild
+	Bundle config.BundleConfig
+	// CriticalCSS inlines the CSS used at the top of pages
+	CriticalCSS config.CriticalCSSConfig
+	// SRI adds integrity to external scripts and stylesheets, nil leaves
+	// them as they are
+	SRI *sri.Pins
+	// Cache reuses pages compiled by earlier builds, nil compiles all
+	Cache *Cache
+	// Static leaves out restricted and password protected pages, for
+	// builds served without gomd, where nothing would keep them private
+	Static bool
+	// Remote fetches JSON for getJSON and the remote shortcode
+	Remote *RemoteData
+	// Funcs and Partials (sources of {{define}} blocks) extend the layout
+	Funcs    template.FuncMap
+	Partials []string
+	// OutputFormats are written next to every public page's HTML: "md"
+	// for its markdown, "txt" for plain text
+	OutputFormats []string
+	// Trace, when set, is told what happens to every source file, like
+	// "copied" or "skipped, excluded", and of likely mistakes in pages as
+	// "warning: ..."
+	Trace func(rel, action string)
+}
+
+func (opts Options) trace(rel, format string, args ...interface{}) {
+	if opts.Trace != nil {
+		opts.Trace(rel, fmt.Sprintf(format, args...))
+	}
+}
+
+// Result describes a finished compile run
+type Result struct {
+	Pages int // .gmd files compiled
+	Files int // static files copied
+	// Index lists every compiled page, sorted by URL
+	Index []*Page
+	// Scheduled lists pages left out until their PublishAt time
+	Scheduled []*Page
+	// Feeds has the content hash of every feed written, by URL
+	Feeds map[string][32]byte
+}
+
+var fastlinkRe = regexp.MustCompile(`\(([^)\s]+)\)\[([^\]\r\n]+)\]`)
+
+// Preprocess applies GMD syntax on top of markdown, then any extra rules:
+// (abc)[clickme] becomes [clickme](/abc)
+func Preprocess(input []byte, rules ...Rule) []byte {
+	input = normalizeNewlines(input)
+	input = fastlinkRe.ReplaceAllFunc(input, func(match []byte) []byte {
+		submatches := fastlinkRe.FindSubmatch(match)
+		if len(submatches) == 3 {
+			return []byte("[" + string(submatches[2]) + "](/" + string(submatches[1]) + ")")
+		}
+		return match
+	})
+	return applyRules(input, rules)
+}
+
+// Files saved on Windows use CRLF, everything downstream expects LF
+func normalizeNewlines(b []byte) []byte {
+	return bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+}
+
+// Render converts GMD source into an HTML fragment with the default
+// markdown extensions
+func Render(input []byte, rules ...Rule) []byte {
+	return renderHTML(Preprocess(input, rules...), Options{})
+}
+
+// Compile renders every .gmd file under SrcDir into BuildDir, keeping
+// the directory layout: web/docs/a.gmd becomes .built/docs/a.html.
+// Other files are copied as they are, unless they match Exclude.
+func Compile(opts Options) (*Result, error) {
+	res := &Result{}
+	if err := os.MkdirAll(opts.BuildDir, 0755); err != nil {
+		return nil, err
+	}
+	bundles, err := writeBundles(opts)
+	if err != nil {
+		return nil, err
+	}
+	layout, err := loadLayout(opts, bundles)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.Sass.Dir(opts.AssetsDir); err != nil {
+		return nil, err
+	}
+	scssChanged := sass.Changed(opts.SrcDir)
+	shortcodes := collectShortcodes(opts)
+	history := loadHistory(opts)
+	now := time.Now()
+	ignore, err := loadIgnore(opts)
+	if err != nil {
+		return nil, err
+	}
+	sidebars := make(map[string]string)
+	outs := make(outputs)
+	var collisions []error
+	claim := func(out, source string) bool {
+		if err := outs.claim(out, source); err != nil {
+			collisions = append(collisions, err)
+			return false
+		}
+		return true
+	}
+	err = walkSource(opts.SrcDir, opts.FollowSymlinks, func(path, rel string, isDir bool) error {
+		if ignore.match(rel, isDir) {
+			if isDir {
+				opts.trace(rel+"/", "skipped, excluded")
+				return filepath.SkipDir
+			}
+			opts.trace(rel, "skipped, excluded")
+			return nil
+		}
+		if isDir {
+			return nil
+		}
+		if isSidebar(rel) {
+			opts.trace(rel, "sidebar of %s/", sectionDir(rel))
+			sidebars[sectionDir(rel)] = path
+			return nil
+		}
+		if !isPage(opts, rel) {
+			res.Files++
+			dst := filepath.Join(opts.BuildDir, filepath.FromSlash(rel))
+			if opts.Sass != nil && strings.HasSuffix(rel, ".scss") {
+				if sass.Partial(rel) {
+					opts.trace(rel, "skipped, sass partial")
+					return nil
+				}
+				if !claim(strings.TrimSuffix(rel, ".scss")+".css", rel) {
+					return nil
+				}
+				dst = strings.TrimSuffix(dst, ".scss") + ".css"
+				opts.trace(rel, "compiled to %s", strings.TrimSuffix(rel, ".scss")+".css")
+				if err := opts.Sass.File(path, dst, scssChanged); err != nil {
+					return err
+				}
+				if css := strings.TrimSuffix(rel, ".scss") + ".css"; opts.Minify.Handles(css) {
+					return minifyFile(opts.Minify, css, dst, dst)
+				}
+				return nil
+			}
+			if !claim(rel, rel) {
+				return nil
+			}
+			if opts.Minify.Handles(rel) {
+				opts.trace(rel, "minified")
+				return minifyFile(opts.Minify, rel, path, dst)
+			}
+			opts.trace(rel, "copied")
+			return copyFile(path, dst)
+		}
+		if !claim(trimPageExt(rel)+".html", rel) {
+			return nil
+		}
+		p, err := compilePage(opts, path, filepath.FromSlash(rel), shortcodes)
+		if err != nil {
+			return err
+		}
+		if hasAlternates(p) {
+			for _, ext := range opts.OutputFormats {
+				claim(strings.TrimPrefix(p.URL, "/")+"."+ext, rel)
+			}
+		}
+		if ogCard(opts, p) {
+			claim(strings.TrimPrefix(ogCardURL(p), "/"), rel)
+		}
+		if h := history[rel]; h != nil {
+			p.LastModified, p.Authors = &h.modified, h.authors
+		}
+		if p.PublishAt != nil && p.PublishAt.After(now) {
+			opts.trace(rel, "skipped, scheduled for %s", p.PublishAt.Format(time.RFC3339))
+			res.Scheduled = append(res.Scheduled, p)
+			return nil
+		}
+		if opts.Static && (len(p.Allow) > 0 || p.Password != "") {
+			opts.trace(rel, "skipped, restricted")
+			return nil
+		}
+		opts.trace(rel, "page %s", p.URL)
+		res.Pages++
+		res.Index = append(res.Index, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := errors.Join(collisions...); err != nil {
+		return nil, err
+	}
+	opts.Cache.prune()
+	sort.Slice(res.Index, func(i, j int) bool {
+		a, b := res.Index[i], res.Index[j]
+		return a.URL < b.URL || a.URL == b.URL && a.Source < b.Source
+	})
+	index, variants, err := foldVariants(res.Index)
+	if err != nil {
+		return nil, err
+	}
+	res.Index = index
+	versionPages(opts, res.Index)
+	relatePages(res.Index)
+	if opts.Recent.Limit > 0 {
+		if p := recentPage(opts, res.Index); p != nil {
+			i := sort.Search(len(res.Index), func(i int) bool { return res.Index[i].URL >= p.URL })
+			res.Index = append(res.Index[:i], append([]*Page{p}, res.Index[i:]...)...)
+		}
+	}
+	breadcrumbPages(res.Index)
+	if err := sidebarPages(res.Index, sidebars); err != nil {
+		return nil, err
+	}
+	prevNextPages(res.Index)
+	for _, v := range variants {
+		first := res.Index[sort.Search(len(res.Index), func(i int) bool { return res.Index[i].URL >= v.URL })]
+		v.Variants, v.Related, v.Breadcrumbs = first.Variants, first.Related, first.Breadcrumbs
+		v.Version, v.Versions, v.Sidebar = first.Version, first.Versions, first.Sidebar
+		v.Prev, v.Next = first.Prev, first.Next
+		if v.Canonical == "" {
+			v.Canonical = first.Canonical
+		}
+	}
+	// Pages are written once all of them are known, so the layout can
+	// list and link to the others
+	var errs []error
+	for _, p := range append(res.Index[:len(res.Index):len(res.Index)], variants...) {
+		if err := writePage(opts, layout, p, res.Index); err != nil {
+			errs = append(errs, &FileError{Path: p.Source, Err: err})
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	for _, p := range res.Index {
+		if err := writeAlternates(opts, p); err != nil {
+			return nil, &FileError{Path: p.Source, Err: err}
+		}
+	}
+	if err := writeLLMs(opts, res.Index); err != nil {
+		return nil, err
+	}
+	if err := writeSitemap(opts, res.Index); err != nil {
+		return nil, err
+	}
+	if err := writeVersionSearch(opts, res.Index); err != nil {
+		return nil, err
+	}
+	if err := writeFavicons(opts); err != nil {
+		return nil, err
+	}
+	if err := writePWA(opts, res.Index); err != nil {
+		return nil, err
+	}
+	if err := writeOGImages(opts, res.Index); err != nil {
+		return nil, err
+	}
+	res.Feeds = make(map[string][32]byte)
+	for _, f := range collectFeeds(opts, res.Index) {
+		if err := writeFeed(opts, f, res.Feeds); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Recent.Limit > 0 {
+		if err := writeRecentFeed(opts, res.Index, res.Feeds); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// Output files by lower-cased path, so two sources never silently
+// overwrite each other's output, even on case-insensitive file systems
+type outputs map[string][2]string
+
+func (o outputs) claim(out, source string) error {
+	key := strings.ToLower(out)
+	if other, ok := o[key]; ok {
+		if other[0] != out {
+			return fmt.Errorf("%s and %s build to %s and %s, one file on case-insensitive file systems like macOS's and Windows'", other[1], source, other[0], out)
+		}
+		return fmt.Errorf("%s and %s both build to %s, rename or exclude one of them", other[1], source, out)
+	}
+	o[key] = [2]string{out, source}
+	return nil
+}
+
+func collectShortcodes(opts Options) map[string]plugin.Shortcode {
+	shortcodes := builtinShortcodes(opts)
+	for _, p := range opts.Plugins {
+		if h, ok := p.(plugin.ShortcodeHook); ok {
+			for name, fn := range h.Shortcodes() {
+				shortcodes[name] = fn
+			}
+		}
+	}
+	return shortcodes
+}
+
+// PreprocessFile runs a source file through every step before rendering
+// (PreProcess hooks, shortcodes, emoji, GMD syntax, rules and tables) and returns the
+// resulting markdown, for debugging rules
+func PreprocessFile(opts Options, path string) ([]byte, error) {
+	rel, err := filepath.Rel(opts.SrcDir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = filepath.Base(path)
+	}
+	input, err := readSource(path)
+	if err != nil {
+		return nil, err
+	}
+	_, markdown, err := preprocessPage(opts, newPage(rel), input, collectShortcodes(opts))
+	return markdown, err
+}
+
+// Variants of an A/B test are named like pricing.a.gmd and pricing.b.gmd
+var variantRe = regexp.MustCompile(`^(.+)\.([a-z])\.gmd$`)
+
+func newPage(rel string) *plugin.Page {
+	rel = filepath.ToSlash(rel)
+	url := trimPageExt(rel)
+	if m := variantRe.FindStringSubmatch(rel); m != nil {
+		url = m[1]
+	}
+	return &plugin.Page{Source: rel, URL: "/" + url}
+}
+
+// Keep the first variant of each page in the index and return the others,
+// which are still written out
+func foldVariants(pages []*Page) ([]*Page, []*Page, error) {
+	index := pages[:0]
+	var rest []*Page
+	for _, p := range pages {
+		if n := len(index); n > 0 && index[n-1].URL == p.URL {
+			first := index[n-1]
+			if first.Variant == "" || p.Variant == "" {
+				return nil, nil, fmt.Errorf("%s and %s are both %s", first.Source, p.Source, p.URL)
+			}
+			first.Variants = append(first.Variants, p.Variant)
+			rest = append(rest, p)
+			continue
+		}
+		if p.Variant != "" {
+			p.Variants = []string{p.Variant}
+		}
+		index = append(index, p)
+	}
+	return index, rest, nil
+}
+
+// Split off the front matter and run the markdown through every step
+// before rendering
+func preprocessPage(opts Options, page *plugin.Page, input []byte, shortcodes map[string]plugin.Shortcode) (FrontMatter, []byte, error) {
+	fm, input, err := splitFrontMatter(normalizeNewlines(input))
+	if err != nil {
+		return fm, nil, fmt.Errorf("%s: %w", page.Source, err)
+	}
+	for _, p := range opts.Plugins {
+		if h, ok := p.(plugin.PreProcessHook); ok {
+			if input, err = h.PreProcess(page, input); err != nil {
+				return fm, nil, fmt.Errorf("plugin %s: %s: %w", p.Name(), page.Source, err)
+			}
+		}
+	}
+	if input, err = expandShortcodes(page, input, shortcodes); err != nil {
+		return fm, nil, fmt.Errorf("%s: %w", page.Source, err)
+	}
+	if opts.Emoji {
+		input = expandEmoji(input)
+	}
+	input, err = expandTables(opts, page, Preprocess(input, opts.Rules...))
+	if err != nil {
+		return fm, nil, fmt.Errorf("%s: %w", page.Source, err)
+	}
+	return fm, input, nil
+}
+
+// Render a single page source through the plugin hooks
+func compilePage(opts Options, path, rel string, shortcodes map[string]plugin.Shortcode) (*Page, error) {
+	input, err := readSource(path)
+	if err != nil {
+		return nil, err
+	}
+	if p, ok := opts.Cache.get(rel, input); ok {
+		return p, nil
+	}
+	remoteReads := opts.Remote.readCount()
+	page := newPage(rel)
+	var fm FrontMatter
+	var markdown, html []byte
+	if _, ok := commandFormats[filepath.Ext(path)]; ok {
+		if fm, html, err = convertPage(opts, path, input); err != nil {
+			return nil, fmt.Errorf("%s: %w", page.Source, err)
+		}
+	} else {
+		if fm, markdown, err = preprocessPage(opts, page, input, shortcodes); err != nil {
+			return nil, err
+		}
+		html = renderHTML(markdown, opts)
+	}
+	title := fm.Title
+	if fm.OpenAPI != "" {
+		apiTitle, docs, err := openapiDocs(opts, page, fm.OpenAPI)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", page.Source, err)
+		}
+		html = append(html, docs...)
+		if title == "" && !headingRe.Match(markdown) {
+			title = apiTitle
+		}
+	}
+	for _, p := range opts.Plugins {
+		if h, ok := p.(plugin.PostRenderHook); ok {
+			if html, err = h.PostRender(page, html); err != nil {
+				return nil, fmt.Errorf("plugin %s: %s: %w", p.Name(), page.Source, err)
+			}
+		}
+	}
+	if opts.ValidateHTML {
+		if problems := validateHTML(html, input); len(problems) > 0 {
+			return nil, fmt.Errorf("%s: broken HTML: %s", page.Source, strings.Join(problems, "; "))
+		}
+	}
+	if opts.Headings.Offset != 0 {
+		html = offsetHeadings(html, opts.Headings.Offset)
+	}
+	words := wordCount(html)
+	if title == "" {
+		if !headingRe.Match(markdown) {
+			opts.trace(page.Source, "warning: no title, give it a # heading or a title in its front matter")
+		}
+		title = pageTitle(markdown, page.URL)
+	}
+	typ := fm.Type
+	if typ == "" {
+		typ = "page"
+	}
+	date, _ := parseDate(fm.Date)
+	var authors []string
+	if fm.Author != "" {
+		authors = []string{fm.Author}
+	}
+	allow := fm.Allow
+	if fm.Private && len(allow) == 0 {
+		allow = []string{"role:viewer"}
+	}
+	if _, err := auth.ParseAccess(allow); err != nil {
+		return nil, fmt.Errorf("%s: %w", page.Source, err)
+	}
+	var variant string
+	if m := variantRe.FindStringSubmatch(page.Source); m != nil {
+		variant = m[2]
+	}
+	publishAt, _ := parseDate(fm.PublishAt)
+	p := &Page{
+		URL:          page.URL,
+		Source:       page.Source,
+		Title:        title,
+		Tags:         fm.Tags,
+		Description:  fm.Description,
+		Author:       fm.Author,
+		Date:         date,
+		LastModified: date,
+		Authors:      authors,
+		PublishAt:    publishAt,
+		Type:         typ,
+		Canonical:    fm.Canonical,
+		NoIndex:      fm.NoIndex,
+		Allow:        allow,
+		Password:     fm.Password,
+		EditURL:      editURL(opts, page.Source),
+		Variant:      variant,
+		Params:       fm.Params,
+		WordCount:    words,
+		ReadingTime:  readingTime(words),
+		Content:      template.HTML(html),
+	}
+	if opts.hasOutput("md") || opts.LLMs.Enabled && opts.LLMs.Full {
+		p.Markdown = markdown
+	}
+	// Pages showing remote data or data files are compiled every time
+	if opts.Remote.readCount() == remoteReads && !tableRe.Match(input) && fm.OpenAPI == "" {
+		opts.Cache.put(rel, input, p)
+	}
+	return p, nil
+}
+
+func editURL(opts Options, source string) string {
+	if opts.EditURL == "" {
+		return ""
+	}
+	return opts.EditURL + source
+}
+
+// Write a compiled page into BuildDir through the layout
+func writePage(opts Options, layout *template.Template, p *Page, pages []*Page) error {
+	html, err := applyLayout(layout, p, pages)
+	if err != nil {
+		return err
+	}
+	if layout != nil {
+		html = insertBefore(html, "</head>", string(headTags(p, opts)))
+	}
+	html = injectHTML(html, opts.Inject)
+	if layout != nil && opts.CriticalCSS.Enabled {
+		html = inlineCriticalCSS(opts, p, html)
+	}
+	html, err = opts.SRI.Rewrite(html)
+	if err != nil {
+		return err
+	}
+	if err := checkHeadings(opts, p, html); err != nil {
+		return err
+	}
+	name := trimPageExt(p.Source)
+	if p.Source == "" {
+		// Generated pages have no source file
+		name = strings.TrimPrefix(p.URL, "/")
+	}
+	outPath := filepath.Join(opts.BuildDir, filepath.FromSlash(name)+".html")
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(outPath, opts.Minify.Bytes(name+".html", html), 0644)
+}
+
+// Write a static file minified into the build dir
+func minifyFile(m *minify.Minifier, rel, src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, m.Bytes(rel, data), 0644)
+}
+
+// Copy a static file from the source dir into the build dir
+func copyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Report whether a slash-separated relative path matches any exclude
+// pattern, either as a whole or by its base name. ** matches any number
+// of directories
+func excluded(rel string, patterns []string) bool {
+	base := path.Base(rel)
+	for _, p := range patterns {
+		if globMatch(p, rel) || globMatch(p, base) {
+			return true
+		}
+	}
+	return false
+}
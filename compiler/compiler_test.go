@@ -0,0 +1,114 @@
+package compiler
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestStaticLeavesOutProtectedPages(t *testing.T) {
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"index.gmd":  "# Home\n",
+		"team.gmd":   "---\nallow: [role:editor]\n---\n# Team\n",
+		"draft.gmd":  "---\npassword: hunter2\n---\n# Draft\n",
+		"secret.gmd": "---\nprivate: true\n---\n# Secret\n",
+	})
+	for _, static := range []bool{false, true} {
+		build := t.TempDir()
+		res, err := Compile(Options{SrcDir: src, BuildDir: build, Static: static})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"team", "draft", "secret"} {
+			_, err := os.Stat(filepath.Join(build, name+".html"))
+			if static && err == nil {
+				t.Errorf("static build wrote the protected page %s", name)
+			}
+			if !static && err != nil {
+				t.Errorf("served build is missing %s: %v", name, err)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(build, "index.html")); err != nil {
+			t.Errorf("static=%v: public page missing: %v", static, err)
+		}
+		for _, p := range res.Index {
+			if static && (len(p.Allow) > 0 || p.Password != "") {
+				t.Errorf("static build indexed the protected page %s", p.URL)
+			}
+		}
+	}
+}
+
+func TestNormalizeNewlines(t *testing.T) {
+	for in, want := range map[string]string{
+		"a\r\nb\r\n":   "a\nb\n",
+		"a\nb":         "a\nb",
+		"a\r\n\r\nb":   "a\n\nb",
+		"lone\rcr\r\n": "lone\rcr\n",
+		"":             "",
+	} {
+		if got := string(normalizeNewlines([]byte(in))); got != want {
+			t.Errorf("normalizeNewlines(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestPreprocessCRLF(t *testing.T) {
+	rule := Rule{Name: "note", Pattern: regexp.MustCompile(`(?m)^!note (.*)$`), Replace: "> **Note:** $1"}
+	got := string(Preprocess([]byte("See (docs/intro)[the intro]\r\n!note read it first\r\n"), rule))
+	want := "See [the intro](/docs/intro)\n> **Note:** read it first\n"
+	if got != want {
+		t.Errorf("Preprocess = %q, want %q", got, want)
+	}
+}
+
+func TestFrontMatterCRLF(t *testing.T) {
+	src := "---\r\ntitle: Saved on Windows\r\ntags: [a, b]\r\n---\r\n# Heading\r\n\r\nText\r\n"
+	fm, body, err := preprocessPage(Options{}, newPage("win.gmd"), []byte(src), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fm.Title != "Saved on Windows" || len(fm.Tags) != 2 || fm.Tags[1] != "b" {
+		t.Errorf("front matter = %+v", fm)
+	}
+	if bytes.ContainsRune(body, '\r') || !bytes.HasPrefix(body, []byte("# Heading\n")) {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestCompileCRLF(t *testing.T) {
+	src, build := t.TempDir(), t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"win.gmd": "---\r\ntitle: Windows\r\n---\r\n# Heading\r\n\r\n```\r\ncode\r\n```\r\n",
+	})
+	res, err := Compile(Options{SrcDir: src, BuildDir: build})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Index) != 1 || res.Index[0].Title != "Windows" {
+		t.Fatalf("index = %+v", res.Index)
+	}
+	html, err := os.ReadFile(filepath.Join(build, "win.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.ContainsRune(html, '\r') || bytes.Contains(html, []byte("title:")) {
+		t.Errorf("win.html = %q", html)
+	}
+}
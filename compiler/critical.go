@@ -0,0 +1,226 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	nethtml "golang.org/x/net/html"
+)
+
+// How many elements from the top of the body count as above the fold,
+// without a number in the config
+const defaultFoldElements = 40
+
+var (
+	linkTag = regexp.MustCompile(`(?i)<link\b[^>]*>`)
+	// Parts of a selector that don't change which elements it can match
+	selectorNoise = regexp.MustCompile(`::?[a-zA-Z-]+(\([^)]*\))?|\[[^\]]*\]`)
+	combinators   = regexp.MustCompile(`[\s>+~]+`)
+	simpleParts   = regexp.MustCompile(`[.#]?[a-zA-Z0-9_-]+|\*`)
+	cssComment    = regexp.MustCompile(`/\*[\s\S]*?\*/`)
+)
+
+// Inline the rules of the page's local stylesheets that apply to the
+// first elements of the body, and load the full stylesheets without
+// blocking rendering. Pages opt out with critical_css: false
+func inlineCriticalCSS(opts Options, p *Page, page []byte) []byte {
+	if v, ok := p.Params["critical_css"].(bool); ok && !v || excluded(p.URL, opts.CriticalCSS.Exclude) {
+		return page
+	}
+	fold := aboveTheFold(page, opts.CriticalCSS.Elements)
+	return linkTag.ReplaceAllFunc(page, func(tag []byte) []byte {
+		href, ok := stylesheetHref(tag)
+		if !ok {
+			return tag
+		}
+		css, err := os.ReadFile(stylesheetFile(opts, href))
+		if err != nil {
+			return tag
+		}
+		critical := criticalRules(css, fold)
+		if critical == "" {
+			return tag
+		}
+		// </style> can't appear in CSS rules, but keep a stray one from
+		// ending the element early
+		critical = strings.ReplaceAll(critical, "</", `<\/`)
+		h := html.EscapeString(href)
+		return []byte(fmt.Sprintf(`<style>%s</style><link rel="preload" href="%s" as="style" onload="this.onload=null;this.rel='stylesheet'"><noscript>%s</noscript>`, critical, h, tag))
+	})
+}
+
+// The href of a <link rel=stylesheet> to a file of this site, for all
+// media
+func stylesheetHref(tag []byte) (string, bool) {
+	z := nethtml.NewTokenizer(bytes.NewReader(tag))
+	z.Next()
+	t := z.Token()
+	var rel, href, media string
+	for _, a := range t.Attr {
+		switch a.Key {
+		case "rel":
+			rel = strings.ToLower(a.Val)
+		case "href":
+			href = a.Val
+		case "media":
+			media = strings.ToLower(strings.TrimSpace(a.Val))
+		}
+	}
+	// Print and other media specific stylesheets don't block rendering
+	if media != "" && media != "all" && media != "screen" {
+		return "", false
+	}
+	if rel != "stylesheet" || !strings.HasPrefix(href, "/") || strings.HasPrefix(href, "//") {
+		return "", false
+	}
+	return href, true
+}
+
+// Where a stylesheet URL is: /assets/ in the assets dir, the rest in the
+// build dir
+func stylesheetFile(opts Options, href string) string {
+	href, _, _ = strings.Cut(href, "?")
+	href = strings.TrimPrefix(href, opts.BasePath)
+	if rest, ok := strings.CutPrefix(href, "/assets/"); ok && opts.AssetsDir != "" {
+		return filepath.Join(opts.AssetsDir, filepath.FromSlash(rest))
+	}
+	return filepath.Join(opts.BuildDir, filepath.FromSlash(href))
+}
+
+// The tag names, #ids and .classes of the first elements of the body,
+// and of html and body themselves
+func aboveTheFold(page []byte, limit int) map[string]bool {
+	if limit <= 0 {
+		limit = defaultFoldElements
+	}
+	fold := map[string]bool{"html": true, "body": true}
+	doc, err := nethtml.Parse(bytes.NewReader(page))
+	if err != nil {
+		return fold
+	}
+	n, inBody := 0, false
+	var walk func(*nethtml.Node)
+	walk = func(node *nethtml.Node) {
+		if n >= limit {
+			return
+		}
+		if node.Type == nethtml.ElementNode {
+			if inBody {
+				n++
+			}
+			fold[node.Data] = true
+			for _, a := range node.Attr {
+				switch a.Key {
+				case "id":
+					fold["#"+a.Val] = true
+				case "class":
+					for _, c := range strings.Fields(a.Val) {
+						fold["."+c] = true
+					}
+				}
+			}
+			if node.Data == "body" {
+				inBody = true
+			}
+		}
+		for c := node.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return fold
+}
+
+// The rules of a stylesheet with a selector matching what's above the
+// fold, in @media and @supports blocks too. Fonts are kept, @import and
+// animations are left to the full stylesheet
+func criticalRules(css []byte, fold map[string]bool) string {
+	var out strings.Builder
+	for _, r := range cssRules(string(css)) {
+		prelude := strings.TrimSpace(r.prelude)
+		switch {
+		case r.block == "":
+			continue
+		case strings.HasPrefix(prelude, "@font-face"):
+			out.WriteString(prelude + "{" + r.block + "}")
+		case strings.HasPrefix(prelude, "@media"), strings.HasPrefix(prelude, "@supports"), strings.HasPrefix(prelude, "@layer"):
+			if inner := criticalRules([]byte(r.block), fold); inner != "" {
+				out.WriteString(prelude + "{" + inner + "}")
+			}
+		case strings.HasPrefix(prelude, "@"):
+			continue
+		default:
+			var keep []string
+			for _, sel := range strings.Split(prelude, ",") {
+				if selectorMatches(sel, fold) {
+					keep = append(keep, strings.TrimSpace(sel))
+				}
+			}
+			if len(keep) > 0 {
+				out.WriteString(strings.Join(keep, ",") + "{" + strings.TrimSpace(r.block) + "}")
+			}
+		}
+	}
+	return out.String()
+}
+
+// Whether every element a selector names appears above the fold
+func selectorMatches(sel string, fold map[string]bool) bool {
+	sel = selectorNoise.ReplaceAllString(sel, "")
+	for _, compound := range combinators.Split(strings.TrimSpace(sel), -1) {
+		for _, part := range simpleParts.FindAllString(compound, -1) {
+			if part == "*" {
+				continue
+			}
+			if !fold[strings.ToLower(part)] && !fold[part] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+type cssRule struct {
+	prelude, block string
+}
+
+// Split a stylesheet into its top level rules, keeping strings intact.
+// Statements like @import have no block
+func cssRules(css string) []cssRule {
+	css = cssComment.ReplaceAllString(css, "")
+	var rules []cssRule
+	start, depth, open := 0, 0, 0
+	for i := 0; i < len(css); i++ {
+		switch c := css[i]; {
+		case c == '"' || c == '\'':
+			for i++; i < len(css) && css[i] != c; i++ {
+				if css[i] == '\\' {
+					i++
+				}
+			}
+		case c == '{':
+			if depth == 0 {
+				open = i
+			}
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				rules = append(rules, cssRule{prelude: css[start:open], block: css[open+1 : i]})
+				start = i + 1
+			}
+			if depth < 0 {
+				depth = 0
+			}
+		case c == ';' && depth == 0:
+			rules = append(rules, cssRule{prelude: css[start:i]})
+			start = i + 1
+		}
+	}
+	return rules
+}
@@ -0,0 +1,28 @@
+package compiler
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/kyokomi/emoji/v2"
+)
+
+// Inline code spans are matched too, so they can be left alone
+var emojiRe = regexp.MustCompile("`+[^`\n]*`+|:[a-z0-9_+\\-]+:")
+
+// Replace GitHub-style :rocket: shortcodes with Unicode emoji outside of
+// code, unknown names are left as they are
+func expandEmoji(input []byte) []byte {
+	codes := emoji.CodeMap()
+	return outsideCode(input, func(chunk []byte) []byte {
+		return emojiRe.ReplaceAllFunc(chunk, func(m []byte) []byte {
+			if bytes.HasPrefix(m, []byte("`")) {
+				return m
+			}
+			if e, ok := codes[string(m)]; ok {
+				return []byte(e)
+			}
+			return m
+		})
+	})
+}
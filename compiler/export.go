@@ -0,0 +1,66 @@
+package compiler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExportResult counts what Export wrote
+type ExportResult struct {
+	Pages int // .md files
+	Files int // static files copied along
+}
+
+// Export writes every page as a plain CommonMark .md file into dst, after
+// plugins, shortcodes, GMD syntax and rules, keeping its front matter.
+// Static files are copied along so the bundle is complete. Pages in the
+// command formats (AsciiDoc, reStructuredText) are exported as their HTML
+func Export(opts Options, dst string) (*ExportResult, error) {
+	res := &ExportResult{}
+	shortcodes := collectShortcodes(opts)
+	ignore, err := loadIgnore(opts)
+	if err != nil {
+		return nil, err
+	}
+	err = walkSource(opts.SrcDir, opts.FollowSymlinks, func(path, rel string, isDir bool) error {
+		if ignore.match(rel, isDir) {
+			if isDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isDir {
+			return nil
+		}
+		out := filepath.Join(dst, filepath.FromSlash(rel))
+		if !isPage(opts, rel) {
+			res.Files++
+			return copyFile(path, out)
+		}
+		input, err := readSource(path)
+		if err != nil {
+			return err
+		}
+		input = normalizeNewlines(input)
+		var body []byte
+		if _, ok := commandFormats[filepath.Ext(path)]; ok {
+			_, body, err = convertPage(opts, path, input)
+		} else {
+			_, body, err = preprocessPage(opts, newPage(rel), input, shortcodes)
+		}
+		if err != nil {
+			return err
+		}
+		// The front matter exactly as it was written
+		_, rest, _ := splitFrontMatter(input)
+		md := append(input[:len(input)-len(rest):len(input)-len(rest)], body...)
+		out = strings.TrimSuffix(out, filepath.Ext(out)) + ".md"
+		if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+			return err
+		}
+		res.Pages++
+		return os.WriteFile(out, md, 0644)
+	})
+	return res, err
+}
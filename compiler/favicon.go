@@ -0,0 +1,133 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Icons written from the favicon image, by file name and size
+var faviconFiles = []struct {
+	name string
+	size int
+}{
+	{"favicon-16x16.png", 16},
+	{"favicon-32x32.png", 32},
+	{"apple-touch-icon.png", 180},
+	{"icon-192.png", 192},
+	{"icon-512.png", 512},
+}
+
+// Sizes packed into favicon.ico, for browsers and tools that ask for it
+var icoSizes = []int{16, 32, 48}
+
+const faviconLinks = `<link rel="icon" href="%[1]s/favicon.ico" sizes="48x48">
+<link rel="icon" type="image/png" sizes="32x32" href="%[1]s/favicon-32x32.png">
+<link rel="icon" type="image/png" sizes="16x16" href="%[1]s/favicon-16x16.png">
+<link rel="apple-touch-icon" href="%[1]s/apple-touch-icon.png">
+`
+
+// Write the favicon set made from opts.Favicon into the build dir:
+// favicon.ico and PNG icons for browsers, iOS and Android. Skipped while
+// they are newer than the image
+func writeFavicons(opts Options) error {
+	if opts.Favicon == "" {
+		return nil
+	}
+	src, err := os.Stat(opts.Favicon)
+	if err != nil {
+		return fmt.Errorf("favicon: %w", err)
+	}
+	if fi, err := os.Stat(filepath.Join(opts.BuildDir, "favicon.ico")); err == nil && fi.ModTime().After(src.ModTime()) {
+		return nil
+	}
+	f, err := os.Open(opts.Favicon)
+	if err != nil {
+		return fmt.Errorf("favicon: %w", err)
+	}
+	img, _, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("favicon %s: %w (use a PNG, JPEG, GIF or WebP image)", opts.Favicon, err)
+	}
+	img = squareCrop(img)
+	for _, icon := range faviconFiles {
+		data, err := encodePNG(resize(img, icon.size))
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(opts.BuildDir, icon.name), data, 0644); err != nil {
+			return err
+		}
+	}
+	ico, err := encodeICO(img, icoSizes)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(opts.BuildDir, "favicon.ico"), ico, 0644)
+}
+
+// The centered square of an image, icons are square
+func squareCrop(img image.Image) image.Image {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	x, y := b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2
+	out := image.NewNRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(out, out.Bounds(), img, image.Pt(x, y), draw.Src)
+	return out
+}
+
+func resize(img image.Image, size int) image.Image {
+	out := image.NewNRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(out, out.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return out
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	return buf.Bytes(), err
+}
+
+// An ICO file holding PNG images, which every browser since IE 9 reads
+func encodeICO(img image.Image, sizes []int) ([]byte, error) {
+	var images [][]byte
+	for _, size := range sizes {
+		data, err := encodePNG(resize(img, size))
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, data)
+	}
+	if len(images) > 255 {
+		return nil, errors.New("too many icon sizes")
+	}
+	var buf bytes.Buffer
+	// Header: reserved, type 1 (icon), image count
+	binary.Write(&buf, binary.LittleEndian, [3]uint16{0, 1, uint16(len(images))})
+	offset := 6 + 16*len(images)
+	for i, size := range sizes {
+		// A size of 256 is written as 0
+		dim := uint8(size)
+		binary.Write(&buf, binary.LittleEndian, struct {
+			Width, Height, Colors, Reserved uint8
+			Planes, BitCount                uint16
+			Size, Offset                    uint32
+		}{dim, dim, 0, 0, 1, 32, uint32(len(images[i])), uint32(offset)})
+		offset += len(images[i])
+	}
+	for _, data := range images {
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
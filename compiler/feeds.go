@@ -0,0 +1,288 @@
+package compiler
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// A feed of dated pages, written as feed.xml (RSS), atom.xml and
+// feed.json into the directory at URL
+type feed struct {
+	URL   string
+	Title string
+	// Where readers go for the feed's pages, e.g. the section index
+	Home  string
+	Pages []*Page
+}
+
+// When a page came out, for feed entries: its date, or the last commit
+func published(p *Page) *time.Time {
+	if p.Date != nil {
+		return p.Date
+	}
+	return p.LastModified
+}
+
+// TagSlug is a tag as used in URLs: "Go Modules" becomes "go-modules"
+func TagSlug(tag string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(tag) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// Feeds of the whole site, every tag at /tags/<tag>/ and every section
+// (directory), each with the newest pages first
+func collectFeeds(opts Options, pages []*Page) []*feed {
+	cfg := opts.Feeds
+	byURL := make(map[string]*feed)
+	var feeds []*feed
+	add := func(url, title, home string, p *Page) {
+		f := byURL[url]
+		if f == nil {
+			f = &feed{URL: url, Title: title, Home: home}
+			byURL[url] = f
+			feeds = append(feeds, f)
+		}
+		f.Pages = append(f.Pages, p)
+	}
+	index := make(map[string]*Page)
+	for _, p := range pages {
+		if path.Base(p.URL) == "index" {
+			index[path.Dir(p.URL)] = p
+		}
+	}
+	for _, p := range pages {
+		// Generated pages have no date of their own
+		if p.Source == "" || published(p) == nil || !opts.Indexable(p) {
+			continue
+		}
+		if cfg.Site {
+			add("", siteTitle(opts, index["/"]), "", p)
+		}
+		if cfg.Tags {
+			for _, tag := range p.Tags {
+				if slug := TagSlug(tag); slug != "" {
+					add("/tags/"+slug, tag, "", p)
+				}
+			}
+		}
+		if cfg.Sections {
+			for dir := path.Dir(p.URL); dir != "/"; dir = path.Dir(dir) {
+				title, home := path.Base(dir), ""
+				if idx := index[dir]; idx != nil {
+					title, home = idx.Title, idx.URL
+				}
+				add(dir, title, home, p)
+			}
+		}
+	}
+	for _, f := range feeds {
+		sort.SliceStable(f.Pages, func(i, j int) bool {
+			return published(f.Pages[i]).After(*published(f.Pages[j]))
+		})
+		if len(f.Pages) > cfg.Limit {
+			f.Pages = f.Pages[:cfg.Limit]
+		}
+	}
+	return feeds
+}
+
+// The site feed is named after the site, or its home page
+func siteTitle(opts Options, home *Page) string {
+	if opts.SiteName != "" {
+		return opts.SiteName
+	}
+	if home != nil && home.Title != "" {
+		return home.Title
+	}
+	return "Feed"
+}
+
+// Feed discovery links for the head of every page
+const siteFeedLinks = `<link rel="alternate" type="application/rss+xml" href="%[1]s/feed.xml">
+<link rel="alternate" type="application/atom+xml" href="%[1]s/atom.xml">
+<link rel="alternate" type="application/feed+json" href="%[1]s/feed.json">
+`
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	DC      string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string     `xml:"title"`
+	Link        string     `xml:"link"`
+	Links       []atomLink `xml:"atom:link"`
+	Description string     `xml:"description"`
+	LastBuild   string     `xml:"lastBuildDate"`
+	Items       []rssItem  `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        string   `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Author      string   `xml:"dc:creator,omitempty"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title     string       `xml:"title"`
+	ID        string       `xml:"id"`
+	Link      atomLink     `xml:"link"`
+	Published string       `xml:"published"`
+	Updated   string       `xml:"updated"`
+	Authors   []atomAuthor `xml:"author"`
+	Summary   string       `xml:"summary,omitempty"`
+	Content   atomContent  `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// Write a feed file to its URL in BuildDir and note its hash
+func writeFeedFile(opts Options, url string, data []byte, hashes map[string][32]byte) error {
+	path := filepath.Join(opts.BuildDir, filepath.FromSlash(strings.TrimPrefix(url, "/")))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	hashes[url] = sha256.Sum256(data)
+	return os.WriteFile(path, data, 0644)
+}
+
+// Write a feed in all three formats
+func writeFeed(opts Options, f *feed, hashes map[string][32]byte) error {
+	home := opts.AbsURL("/index")
+	if f.Home != "" {
+		home = opts.AbsURL(f.Home)
+	}
+	// Feeds always have at least one page
+	updated := *published(f.Pages[0])
+
+	rss := rssFeed{Version: "2.0", Atom: "http://www.w3.org/2005/Atom", DC: "http://purl.org/dc/elements/1.1/", Channel: rssChannel{
+		Title:       f.Title,
+		Link:        home,
+		Links:       []atomLink{{Href: opts.AbsURL(f.URL + "/feed.xml"), Rel: "self", Type: "application/rss+xml"}},
+		Description: f.Title,
+		LastBuild:   updated.Format(time.RFC1123Z),
+	}}
+	atom := atomFeed{
+		Title:   f.Title,
+		ID:      opts.AbsURL(f.URL + "/atom.xml"),
+		Updated: updated.Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: home, Rel: "alternate", Type: "text/html"},
+			{Href: opts.AbsURL(f.URL + "/atom.xml"), Rel: "self", Type: "application/atom+xml"},
+		},
+	}
+	jf := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       f.Title,
+		HomePageURL: home,
+		FeedURL:     opts.AbsURL(f.URL + "/feed.json"),
+		Items:       []jsonFeedItem{},
+	}
+	// WebSub subscribers learn of updates from these hubs
+	for _, hub := range opts.Feeds.Hubs {
+		rss.Channel.Links = append(rss.Channel.Links, atomLink{Href: hub, Rel: "hub"})
+		atom.Links = append(atom.Links, atomLink{Href: hub, Rel: "hub"})
+		jf.Hubs = append(jf.Hubs, jsonFeedHub{Type: "WebSub", URL: hub})
+	}
+	for _, p := range f.Pages {
+		url, date := opts.AbsURL(p.URL), *published(p)
+		modified := date
+		if p.LastModified != nil {
+			modified = *p.LastModified
+		}
+		item := rssItem{
+			Title:       p.Title,
+			Link:        url,
+			GUID:        url,
+			PubDate:     date.Format(time.RFC1123Z),
+			Categories:  p.Tags,
+			Description: string(p.Content),
+		}
+		entry := atomEntry{
+			Title:     p.Title,
+			ID:        url,
+			Link:      atomLink{Href: url, Rel: "alternate", Type: "text/html"},
+			Published: date.Format(time.RFC3339),
+			Updated:   modified.Format(time.RFC3339),
+			Summary:   p.Description,
+			Content:   atomContent{Type: "html", Body: string(p.Content)},
+		}
+		for _, a := range p.Authors {
+			entry.Authors = append(entry.Authors, atomAuthor{a})
+		}
+		if len(p.Authors) > 0 {
+			item.Author = strings.Join(p.Authors, ", ")
+		}
+		rss.Channel.Items = append(rss.Channel.Items, item)
+		atom.Entries = append(atom.Entries, entry)
+		it := jsonItem(opts, p)
+		it.ContentHTML = string(p.Content)
+		jf.Items = append(jf.Items, it)
+	}
+	out, err := xml.MarshalIndent(rss, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFeedFile(opts, f.URL+"/feed.xml", append(append([]byte(xml.Header), out...), '\n'), hashes); err != nil {
+		return err
+	}
+	if out, err = xml.MarshalIndent(atom, "", "  "); err != nil {
+		return err
+	}
+	if err := writeFeedFile(opts, f.URL+"/atom.xml", append(append([]byte(xml.Header), out...), '\n'), hashes); err != nil {
+		return err
+	}
+	if out, err = json.MarshalIndent(jf, "", "  "); err != nil {
+		return err
+	}
+	return writeFeedFile(opts, f.URL+"/feed.json", append(out, '\n'), hashes)
+}
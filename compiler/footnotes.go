@@ -0,0 +1,72 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+// Footnote styles besides the default list at the end of the page
+const (
+	FootnotePopover  = "popover"
+	FootnoteSidenote = "sidenote"
+)
+
+// Styles for the footnote markup, added to the head of pages using it.
+// Layouts can override them, they only use classes
+var footnoteCSS = map[string]string{
+	FootnotePopover: `<style>.footnote-ref button{font:inherit;color:inherit;background:none;border:0;padding:0 .1em;cursor:pointer;text-decoration:underline}` +
+		`.footnote-popover{max-width:min(32rem,90vw);padding:.75rem 1rem;border:1px solid #ccc;border-radius:.5rem;font-size:.9em;line-height:1.5}</style>` + "\n",
+	FootnoteSidenote: `<style>.sidenote-toggle{position:absolute;opacity:0;width:1px;height:1px}` +
+		`.sidenote-ref{cursor:pointer;font-size:.75em;vertical-align:super;line-height:0;text-decoration:underline}` +
+		`.sidenote-ref:has(+.sidenote-toggle:focus-visible){outline:2px solid currentColor}` +
+		`.sidenote{display:none;font-size:.85em;line-height:1.4}` +
+		`.sidenote-toggle:checked+.sidenote{display:block;margin:.5rem 0;padding-left:.75rem;border-left:2px solid #ccc}` +
+		`@media (min-width:72rem){.sidenote,.sidenote-toggle:checked+.sidenote{display:block;float:right;clear:right;width:14rem;margin:0 -16rem 1rem 0;padding:0;border:0}}</style>` + "\n",
+}
+
+func footnoteHead(opts Options) template.HTML {
+	return template.HTML(footnoteCSS[opts.Markdown.FootnoteStyle])
+}
+
+// Render a footnote reference with its note right there, as a popover
+// opened by the number or as a sidenote in the margin, which small
+// screens show below the line when the number is tapped. Both work
+// without scripts
+func (r *htmlRenderer) renderNote(w io.Writer, link *blackfriday.Node) {
+	r.notes++
+	id := fmt.Sprintf("fn-%d", r.notes)
+	num := link.NoteID
+	var note bytes.Buffer
+	render := func(n *blackfriday.Node) {
+		n.Walk(func(n *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+			return r.RenderNode(&note, n, entering)
+		})
+	}
+	if item := link.Footnote; item != nil {
+		for block := item.FirstChild; block != nil; block = block.Next {
+			if block.Type != blackfriday.Paragraph {
+				render(block)
+				continue
+			}
+			// Paragraphs lose their <p>, the note sits inside one
+			if block != item.FirstChild {
+				note.WriteString("<br>")
+			}
+			for n := block.FirstChild; n != nil; n = n.Next {
+				render(n)
+			}
+		}
+	}
+	if r.footnotes == FootnotePopover {
+		fmt.Fprintf(w, `<sup class="footnote-ref"><button type="button" popovertarget="%[1]s" aria-label="Footnote %[2]d">%[2]d</button></sup>`+
+			`<span class="footnote-popover" id="%[1]s" popover role="note">%[3]s</span>`, id, num, note.String())
+		return
+	}
+	fmt.Fprintf(w, `<label for="%[1]s" class="sidenote-ref" aria-label="Footnote %[2]d">%[2]d</label>`+
+		`<input type="checkbox" id="%[1]s" class="sidenote-toggle">`+
+		`<span class="sidenote" role="note"><sup>%[2]d</sup> %[3]s</span>`, id, num, note.String())
+}
@@ -0,0 +1,131 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Source formats besides .gmd, by extension. Each converts a file to GMD,
+// which then goes through the same pipeline as any page
+var sourceFormats = map[string]func([]byte) ([]byte, error){
+	".ipynb": notebookToGMD,
+	".org":   orgToGMD,
+}
+
+// Formats converted to HTML by a command, which gets the page (without
+// its front matter) on stdin and runs in the page's directory. They're
+// only pages when listed in Options.Formats, these are the default commands
+var commandFormats = map[string]string{
+	".adoc": "asciidoctor --embedded --attribute showtitle --out-file - -",
+	".rst":  "pandoc --from rst --to html5 --standalone",
+}
+
+// The extension of a page source, "" for static files
+func pageExt(rel string) string {
+	ext := path.Ext(rel)
+	if _, ok := sourceFormats[ext]; ok || ext == ".gmd" {
+		return ext
+	}
+	if _, ok := commandFormats[ext]; ok {
+		return ext
+	}
+	return ""
+}
+
+// Whether a source file is compiled into a page
+func isPage(opts Options, rel string) bool {
+	ext := pageExt(rel)
+	if _, ok := commandFormats[ext]; ok {
+		_, on := opts.Formats[ext[1:]]
+		return on
+	}
+	return ext != ""
+}
+
+// PageSources lists the .gmd pages a build compiles, as slash-separated
+// paths relative to SrcDir, leaving out ignored and excluded ones
+func PageSources(opts Options) ([]string, error) {
+	ignore, err := loadIgnore(opts)
+	if err != nil {
+		return nil, err
+	}
+	var pages []string
+	err = walkSource(opts.SrcDir, opts.FollowSymlinks, func(path, rel string, isDir bool) error {
+		if ignore.match(rel, isDir) {
+			if isDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isDir && pageExt(rel) == ".gmd" {
+			pages = append(pages, rel)
+		}
+		return nil
+	})
+	return pages, err
+}
+
+// A page's source path without its extension
+func trimPageExt(rel string) string {
+	return strings.TrimSuffix(rel, pageExt(rel))
+}
+
+// Read a page source as GMD
+func readSource(file string) ([]byte, error) {
+	input, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if convert := sourceFormats[filepath.Ext(file)]; convert != nil {
+		if input, err = convert(input); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return input, nil
+}
+
+var (
+	bodyRe = regexp.MustCompile(`(?is)<body[^>]*>(.*)</body>`)
+	h1Re   = regexp.MustCompile(`(?is)<h1[^>]*>(.*?)</h1>`)
+)
+
+// Convert a page in one of the command formats to HTML. Only the <body> of
+// a whole document is kept, and its first <h1> is the default title
+func convertPage(opts Options, file string, input []byte) (FrontMatter, []byte, error) {
+	fm, body, err := splitFrontMatter(normalizeNewlines(input))
+	if err != nil {
+		return fm, nil, err
+	}
+	ext := filepath.Ext(file)
+	command := opts.Formats[ext[1:]]
+	if command == "" {
+		command = commandFormats[ext]
+	}
+	args := strings.Fields(command)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = filepath.Dir(file)
+	cmd.Stdin = bytes.NewReader(body)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fm, nil, fmt.Errorf("%s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	if m := bodyRe.FindSubmatch(out); m != nil {
+		out = m[1]
+	}
+	out = bytes.TrimSpace(out)
+	if fm.Title == "" {
+		if m := h1Re.FindSubmatch(out); m != nil {
+			fm.Title = strings.TrimSpace(html.UnescapeString(tagRe.ReplaceAllString(string(m[1]), "")))
+		}
+	}
+	return fm, append(out, '\n'), nil
+}
@@ -0,0 +1,89 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FrontMatter is the optional YAML block at the top of a page:
+//
+//	---
+//	title: Getting started
+//	tags: [docs, intro]
+//	---
+type FrontMatter struct {
+	Title       string `yaml:"title"`
+	Description string `yaml:"description"`
+	Author      string `yaml:"author"`
+	Date        string `yaml:"date"` // 2006-01-02 or RFC 3339
+	// The page is left out of builds until then, same formats as Date
+	PublishAt string   `yaml:"publish_at"`
+	Type      string   `yaml:"type"` // picks the structured data type
+	Tags      []string `yaml:"tags"`
+	// Canonical URL for syndicated content, noindex keeps the page out
+	// of search engines and the sitemap
+	Canonical string `yaml:"canonical"`
+	NoIndex   bool   `yaml:"noindex"`
+	// Only signed in accounts may see a private page. Allow lists who may
+	// see it instead, by role, user or IP range: [role:editor, 10.0.0.0/8]
+	Private bool     `yaml:"private"`
+	Allow   []string `yaml:"allow"`
+	// Visitors have to enter this password first, e.g. for drafts
+	Password string `yaml:"password"`
+	// An OpenAPI or Swagger file rendered as API docs after the content
+	OpenAPI string `yaml:"openapi"`
+	// Any other keys, available to templates as .Page.Params
+	Params map[string]interface{} `yaml:",inline"`
+}
+
+var fmDelim = []byte("---\n")
+
+// Split a page into its front matter and markdown body. Pages without a
+// closing --- keep their content untouched
+func splitFrontMatter(input []byte) (FrontMatter, []byte, error) {
+	var fm FrontMatter
+	if !bytes.HasPrefix(input, fmDelim) {
+		return fm, input, nil
+	}
+	rest := input[len(fmDelim):]
+	end := bytes.Index(rest, []byte("\n---\n"))
+	block, body := []byte(nil), []byte(nil)
+	switch {
+	case bytes.HasPrefix(rest, fmDelim):
+		body = rest[len(fmDelim):]
+	case end >= 0:
+		block, body = rest[:end+1], rest[end+len("\n---\n"):]
+	case bytes.HasSuffix(rest, []byte("\n---")):
+		block = rest[:len(rest)-len("---")]
+	default:
+		return fm, input, nil
+	}
+	if err := yaml.Unmarshal(block, &fm); err != nil {
+		return fm, nil, fmt.Errorf("front matter: %w", err)
+	}
+	for _, d := range []string{fm.Date, fm.PublishAt} {
+		if _, err := parseDate(d); err != nil {
+			return fm, nil, fmt.Errorf("front matter: %w", err)
+		}
+	}
+	return fm, body, nil
+}
+
+// Parse a front matter date, in the server's time zone unless it has one
+func parseDate(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return &t, nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid date %q, use YYYY-MM-DD or YYYY-MM-DD HH:MM", s)
+}
@@ -0,0 +1,241 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Functions layouts get besides url and bundle, for listings and cards,
+// and remote data:
+//
+//	{{range where .Pages "Type" "post" | sortBy "Date" "desc"}}
+//	<a href="{{url .URL}}">{{.Title}}</a> {{dateFormat "Jan 2, 2006" .Date}}
+//	<p>{{truncate 160 .Description}}</p>{{end}}
+func templateFuncs(opts Options) template.FuncMap {
+	return template.FuncMap{
+		"dateFormat": dateFormat,
+		"markdownify": func(s string) template.HTML {
+			out := bytes.TrimSpace(renderHTML([]byte(s), opts))
+			// A single paragraph is inlined, like a title or description
+			if bytes.HasPrefix(out, []byte("<p>")) && bytes.HasSuffix(out, []byte("</p>")) && bytes.Count(out, []byte("<p>")) == 1 {
+				out = out[3 : len(out)-4]
+			}
+			return template.HTML(out)
+		},
+		"getJSON":  opts.Remote.Get,
+		"where":    where,
+		"sortBy":   sortBy,
+		"truncate": truncate,
+		"absURL":   opts.AbsURL,
+		"jsonify": func(v interface{}) (template.JS, error) {
+			b, err := json.Marshal(v)
+			return template.JS(b), err
+		},
+	}
+}
+
+// Format a time.Time, a front matter date or a date string, "" for none
+func dateFormat(layout string, v interface{}) (string, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t.Format(layout), nil
+	case *time.Time:
+		if t == nil {
+			return "", nil
+		}
+		return t.Format(layout), nil
+	case string:
+		d, err := parseDate(t)
+		if d == nil {
+			return "", err
+		}
+		return d.Format(layout), nil
+	case nil:
+		return "", nil
+	}
+	return "", fmt.Errorf("dateFormat: can't format %T", v)
+}
+
+// The value of a page field, "Params.key" for a front matter key. Field
+// names are case insensitive
+func pageField(p *Page, key string) interface{} {
+	if k, ok := strings.CutPrefix(key, "Params."); ok {
+		return p.Params[k]
+	}
+	f := reflect.ValueOf(p).Elem().FieldByNameFunc(func(name string) bool {
+		return strings.EqualFold(name, key)
+	})
+	if !f.IsValid() || f.Kind() == reflect.Pointer && f.IsNil() {
+		return nil
+	}
+	return reflect.Indirect(f).Interface()
+}
+
+// Pages whose field matches a value: where pages "Type" "post", or with an
+// operator: where pages "WordCount" ">" 500. Operators are = (the
+// default), !=, <, <=, > and >=. For lists like Tags, = and != check
+// whether the value is in it
+func where(pages []*Page, key string, args ...interface{}) ([]*Page, error) {
+	op, value := "=", interface{}(nil)
+	switch len(args) {
+	case 1:
+		value = args[0]
+	case 2:
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("where: operator must be a string")
+		}
+		op, value = s, args[1]
+	default:
+		return nil, fmt.Errorf("where: want a value, or an operator and a value")
+	}
+	var out []*Page
+	for _, p := range pages {
+		field := pageField(p, key)
+		var ok bool
+		switch op {
+		case "=", "==", "eq":
+			ok = matches(field, value)
+		case "!=", "ne":
+			ok = !matches(field, value)
+		case "<", "lt":
+			ok = field != nil && compare(field, value) < 0
+		case "<=", "le":
+			ok = field != nil && compare(field, value) <= 0
+		case ">", "gt":
+			ok = field != nil && compare(field, value) > 0
+		case ">=", "ge":
+			ok = field != nil && compare(field, value) >= 0
+		default:
+			return nil, fmt.Errorf("where: unknown operator %q", op)
+		}
+		if ok {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+// Whether a field equals a value, or holds it when it is a list
+func matches(field, value interface{}) bool {
+	if field == nil {
+		return value == nil
+	}
+	f := reflect.ValueOf(field)
+	if f.Kind() == reflect.Slice {
+		for i := 0; i < f.Len(); i++ {
+			if compare(f.Index(i).Interface(), value) == 0 {
+				return true
+			}
+		}
+		return false
+	}
+	return compare(field, value) == 0
+}
+
+// Order two values of a field: numbers by value, times and dates by time,
+// anything else as text
+func compare(a, b interface{}) int {
+	if x, ok := number(a); ok {
+		if y, ok := number(b); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	if x, ok := toTime(a); ok {
+		if y, ok := toTime(b); ok {
+			return x.Compare(y)
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func number(v interface{}) (float64, bool) {
+	r := reflect.ValueOf(v)
+	switch r.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(r.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(r.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return r.Float(), true
+	}
+	return 0, false
+}
+
+func toTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case *time.Time:
+		if t != nil {
+			return *t, true
+		}
+	case string:
+		if d, err := parseDate(t); err == nil && d != nil {
+			return *d, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// A sorted copy of pages, by a field like "Date", "Title" or
+// "Params.weight", "asc" unless order is "desc". Pages without the field
+// go last
+func sortBy(key string, args ...interface{}) ([]*Page, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("sortBy: want a field, an optional order and pages")
+	}
+	pages, ok := args[len(args)-1].([]*Page)
+	if !ok {
+		return nil, fmt.Errorf("sortBy: can't sort %T", args[len(args)-1])
+	}
+	desc := len(args) > 1 && args[0] == "desc"
+	out := append([]*Page(nil), pages...)
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := pageField(out[i], key), pageField(out[j], key)
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		if desc {
+			return compare(a, b) > 0
+		}
+		return compare(a, b) < 0
+	})
+	return out, nil
+}
+
+// Shorten text to at most n characters, at a word boundary, adding an
+// ellipsis. HTML like .Content is turned into plain text first
+func truncate(n int, v interface{}) string {
+	var s string
+	switch t := v.(type) {
+	case template.HTML:
+		s = (&Page{Content: t}).Text()
+	case string:
+		s = t
+	default:
+		s = fmt.Sprint(v)
+	}
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)[:n]
+	cut := string(r)
+	if i := strings.LastIndexAny(cut, " \t\n"); i > len(cut)/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,;:.-") + "…"
+}
@@ -0,0 +1,51 @@
+package compiler
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Opening and closing heading tags, markdown ones and raw HTML alike.
+// Headings in code are escaped, so they never match
+var headingTagRe = regexp.MustCompile(`(?i)<(/?)h([1-6])\b`)
+
+// Move every heading down by offset levels, <h6> at most
+func offsetHeadings(html []byte, offset int) []byte {
+	return headingTagRe.ReplaceAllFunc(html, func(tag []byte) []byte {
+		m := headingTagRe.FindSubmatch(tag)
+		level, _ := strconv.Atoi(string(m[2]))
+		level = min(max(level+offset, 1), 6)
+		return []byte("<" + string(m[1]) + "h" + strconv.Itoa(level))
+	})
+}
+
+// Check the headings of a finished page, layout included: strict pages
+// need exactly one <h1>, and a heading more than one level below the one
+// before it is a warning, screen reader users navigate by them
+func checkHeadings(opts Options, p *Page, html []byte) error {
+	if p.Source == "" {
+		return nil
+	}
+	h1s, prev := 0, 0
+	for _, m := range headingTagRe.FindAllSubmatch(html, -1) {
+		if len(m[1]) > 0 {
+			continue
+		}
+		level, _ := strconv.Atoi(string(m[2]))
+		if level == 1 {
+			h1s++
+		}
+		switch {
+		case prev == 0 && level > 1:
+			opts.trace(p.Source, "warning: <h%d> comes before any <h1>", level)
+		case prev > 0 && level > prev+1:
+			opts.trace(p.Source, "warning: <h%d> follows <h%d>, skipping a level", level, prev)
+		}
+		prev = level
+	}
+	if opts.Headings.Strict && h1s != 1 {
+		return fmt.Errorf("has %d <h1> headings, pages need exactly one (a # heading, or a title the layout shows)", h1s)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package compiler
+
+import (
+	"bytes"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Last commit and authors of a source file
+type fileHistory struct {
+	modified time.Time
+	authors  []string
+}
+
+// Read the git history of every file below SrcDir in one git log run,
+// keyed by slash-separated path relative to SrcDir. Nil when SrcDir isn't
+// in a repository or git isn't installed
+func loadHistory(opts Options) map[string]*fileHistory {
+	args := []string{"-c", "core.quotepath=off"}
+	if opts.GitDir != "" {
+		args = append(args, "--git-dir="+opts.GitDir, "--work-tree="+opts.SrcDir)
+	}
+	args = append(args, "log", "--format=%x1e%cI%x1f%an", "--name-only", "--relative", "--", ".")
+	cmd := exec.Command("git", args...)
+	cmd.Dir = opts.SrcDir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		slog.Debug("no git history for the source dir", "err", err, "stderr", strings.TrimSpace(stderr.String()))
+		return nil
+	}
+	history := make(map[string]*fileHistory)
+	// Commits come newest first
+	for _, commit := range strings.Split(string(out), "\x1e") {
+		header, files, _ := strings.Cut(commit, "\n")
+		date, author, ok := strings.Cut(header, "\x1f")
+		if !ok {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, date)
+		if err != nil {
+			continue
+		}
+		for _, f := range strings.Split(files, "\n") {
+			if f == "" {
+				continue
+			}
+			h := history[f]
+			if h == nil {
+				h = &fileHistory{modified: t}
+				history[f] = h
+			}
+			if !contains(h.authors, author) {
+				h.authors = append(h.authors, author)
+			}
+		}
+	}
+	return history
+}
@@ -0,0 +1,136 @@
+package compiler
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFile lists files of the source dir that are neither compiled nor
+// copied, in .gitignore syntax
+const IgnoreFile = ".gomdignore"
+
+// Editor swap and backup files, ignored unless the ignore file takes them
+// back with !. They are in the ignore file's syntax, so # is escaped
+var defaultIgnore = []string{"*.swp", "*.swo", "*~", ".#*", `\#*#`, ".DS_Store", "Thumbs.db"}
+
+type ignoreRule struct {
+	pattern string
+	negate  bool
+	// Only matches directories, the pattern ended in /
+	dirOnly bool
+	// Matched against the whole path rather than the base name, the
+	// pattern had a / before its end
+	anchored bool
+}
+
+// ignorer decides which source files are skipped: Options.Exclude, the
+// defaults and the ignore file, where the last matching rule wins
+type ignorer struct {
+	exclude []string
+	rules   []ignoreRule
+}
+
+func loadIgnore(opts Options) (*ignorer, error) {
+	ig := &ignorer{exclude: opts.Exclude}
+	lines := append([]string(nil), defaultIgnore...)
+	data, err := os.ReadFile(filepath.Join(opts.SrcDir, IgnoreFile))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, &FileError{Path: IgnoreFile, Err: err}
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	for _, line := range lines {
+		if r, ok := parseIgnoreRule(line); ok {
+			ig.rules = append(ig.rules, r)
+		}
+	}
+	return ig, nil
+}
+
+func parseIgnoreRule(line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+	var r ignoreRule
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		r.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	r.pattern = line
+	return r, true
+}
+
+// Whether the slash-separated path rel is skipped. Files in a skipped
+// directory are never looked at, like git does
+func (ig *ignorer) match(rel string, isDir bool) bool {
+	if rel == IgnoreFile || excluded(rel, ig.exclude) {
+		return true
+	}
+	ignored := false
+	for _, r := range ig.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		name := path.Base(rel)
+		if r.anchored {
+			name = rel
+		}
+		if globMatch(r.pattern, name) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// path.Match, where a ** path segment also matches any number of
+// directories
+func globMatch(pattern, name string) bool {
+	if !strings.Contains(pattern, "**") {
+		ok, _ := path.Match(pattern, name)
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
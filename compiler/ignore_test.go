@@ -0,0 +1,62 @@
+package compiler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDefaultIgnore(t *testing.T) {
+	ig, err := loadIgnore(Options{SrcDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rel, want := range map[string]bool{
+		"#index.gmd#":          true,
+		"docs/#intro.gmd#":     true,
+		".#index.gmd":          true,
+		"index.gmd~":           true,
+		"docs/.intro.gmd.swp":  true,
+		".DS_Store":            true,
+		"index.gmd":            false,
+		"docs/intro.gmd":       false,
+		"#hashtag.gmd":         false,
+		"issue-#42.gmd":        false,
+		"docs/notes#draft.gmd": false,
+	} {
+		if got := ig.match(rel, false); got != want {
+			t.Errorf("match(%q) = %v, want %v", rel, got, want)
+		}
+	}
+}
+
+func TestIgnoreFileRules(t *testing.T) {
+	src := t.TempDir()
+	rules := "# a comment\n\\#literal.gmd\ndrafts/\n/top.gmd\n!keep~\n"
+	if err := os.WriteFile(filepath.Join(src, IgnoreFile), []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ig, err := loadIgnore(Options{SrcDir: src})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"#literal.gmd", false, true},
+		{"# a comment", false, false},
+		{"drafts", true, true},
+		{"docs/drafts", true, true},
+		{"drafts", false, false},
+		{"top.gmd", false, true},
+		{"docs/top.gmd", false, false},
+		{"keep~", false, false},
+		{"other~", false, true},
+	} {
+		if got := ig.match(tc.rel, tc.isDir); got != tc.want {
+			t.Errorf("match(%q, dir=%v) = %v, want %v", tc.rel, tc.isDir, got, tc.want)
+		}
+	}
+}
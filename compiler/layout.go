@@ -0,0 +1,85 @@
+package compiler
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Name of the layout every page is rendered into, inside TemplatesDir
+const layoutFile = "page.html"
+
+// layoutData is what the layout template gets as its dot
+type layoutData struct {
+	Page    *Page
+	Pages   []*Page
+	Content template.HTML
+}
+
+// Load the page layout, nil means pages are written as plain fragments.
+// {{url "/page"}} adds the base path to a root-relative URL
+func loadLayout(opts Options, bundles map[string]bundle) (*template.Template, error) {
+	if opts.TemplatesDir == "" {
+		return nil, nil
+	}
+	file := filepath.Join(opts.TemplatesDir, layoutFile)
+	if _, err := os.Stat(file); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	t := template.New(layoutFile).Funcs(template.FuncMap{
+		"url": func(u string) string { return WithBase(opts.BasePath, u) },
+		"bundle": func(entry string) (string, error) {
+			b, err := bundleOf(bundles, entry)
+			return b.JS, err
+		},
+		"bundleCSS": func(entry string) (string, error) {
+			b, err := bundleOf(bundles, entry)
+			return b.CSS, err
+		},
+	}).Funcs(templateFuncs(opts)).Funcs(opts.Funcs)
+	for _, p := range append([]string{VersionsPartial, SidebarPartial, PagerPartial}, opts.Partials...) {
+		if _, err := t.Parse(p); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := t.ParseFiles(file); err != nil {
+		return nil, &FileError{Path: file, Err: err}
+	}
+	return t, nil
+}
+
+// Render a page into the layout, or return its content when there is none
+func applyLayout(layout *template.Template, p *Page, pages []*Page) ([]byte, error) {
+	if layout == nil {
+		return []byte(p.Content), nil
+	}
+	var buf bytes.Buffer
+	err := layout.Execute(&buf, layoutData{Page: p, Pages: pages, Content: p.Content})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Add injected HTML before </body>, or at the end of a fragment
+func injectHTML(html []byte, inject string) []byte {
+	if bytes.Contains(html, []byte("</body>")) {
+		return insertBefore(html, "</body>", inject)
+	}
+	return append(html, inject...)
+}
+
+// Insert s before the last occurrence of tag, if there is one
+func insertBefore(html []byte, tag, s string) []byte {
+	i := bytes.LastIndex(html, []byte(tag))
+	if s == "" || i < 0 {
+		return html
+	}
+	out := make([]byte, 0, len(html)+len(s))
+	out = append(out, html[:i]...)
+	out = append(out, s...)
+	return append(out, html[i:]...)
+}
@@ -0,0 +1,104 @@
+package compiler
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Write llms.txt, the site's title, description and pages by section as
+// llmstxt.org describes, and with Full llms-full.txt, every page's
+// markdown in one file
+func writeLLMs(opts Options, pages []*Page) error {
+	cfg := opts.LLMs
+	if !cfg.Enabled {
+		return nil
+	}
+	var included []*Page
+	var home *Page
+	titles := make(map[string]string)
+	for _, p := range pages {
+		if p.Source == "" || !opts.Indexable(p) {
+			continue
+		}
+		if len(cfg.Include) > 0 && !excluded(p.URL, cfg.Include) || excluded(p.URL, cfg.Exclude) {
+			continue
+		}
+		if p.URL == "/index" {
+			home = p
+		}
+		if dir, ok := strings.CutSuffix(p.URL, "/index"); ok {
+			titles[dir] = p.Title
+		}
+		included = append(included, p)
+	}
+
+	var b bytes.Buffer
+	title, description := opts.SiteName, cfg.Description
+	if home != nil {
+		if title == "" {
+			title = home.Title
+		}
+		if description == "" {
+			description = home.Description
+		}
+	}
+	b.WriteString("# " + title + "\n")
+	if description != "" {
+		b.WriteString("\n> " + strings.ReplaceAll(description, "\n", " ") + "\n")
+	}
+	// Top-level pages first, then one section per top-level directory
+	var sections []string
+	bySection := make(map[string][]*Page)
+	for _, p := range included {
+		section := ""
+		if i := strings.Index(p.URL[1:], "/"); i >= 0 {
+			section = p.URL[:i+1]
+		}
+		if _, ok := bySection[section]; !ok {
+			sections = append(sections, section)
+		}
+		bySection[section] = append(bySection[section], p)
+	}
+	sort.SliceStable(sections, func(i, j int) bool { return sections[i] == "" && sections[j] != "" })
+	for _, section := range sections {
+		heading := "Pages"
+		if section != "" {
+			heading = titles[section]
+			if heading == "" {
+				name := strings.ReplaceAll(strings.TrimPrefix(section, "/"), "-", " ")
+				heading = strings.ToUpper(name[:1]) + name[1:]
+			}
+		}
+		b.WriteString("\n## " + heading + "\n\n")
+		for _, p := range bySection[section] {
+			link := opts.AbsURL(p.URL)
+			if opts.hasOutput("md") && hasAlternates(p) {
+				link = opts.SiteURL + WithBase(opts.BasePath, p.URL+".md")
+			}
+			b.WriteString("- [" + p.Title + "](" + link + ")")
+			if p.Description != "" {
+				b.WriteString(": " + strings.ReplaceAll(p.Description, "\n", " "))
+			}
+			b.WriteString("\n")
+		}
+	}
+	if err := os.WriteFile(filepath.Join(opts.BuildDir, "llms.txt"), b.Bytes(), 0644); err != nil {
+		return err
+	}
+	if !cfg.Full {
+		return nil
+	}
+	b.Reset()
+	for i, p := range included {
+		if i > 0 {
+			b.WriteString("\n---\n\n")
+		}
+		b.WriteString("<!-- " + opts.AbsURL(p.URL) + " -->\n\n")
+		b.Write(bytes.TrimSpace(pageMarkdown(p)))
+		b.WriteString("\n")
+	}
+	return os.WriteFile(filepath.Join(opts.BuildDir, "llms-full.txt"), b.Bytes(), 0644)
+}
@@ -0,0 +1,208 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/core6quad/GOMD/plugin"
+)
+
+// Media formats by extension, in the order browsers are offered them
+var mediaTypes = map[string][]struct{ ext, mime string }{
+	"video": {
+		{".webm", "video/webm"},
+		{".mp4", "video/mp4"},
+		{".m4v", "video/mp4"},
+		{".ogv", "video/ogg"},
+		{".mov", "video/quicktime"},
+	},
+	"audio": {
+		{".opus", "audio/ogg"},
+		{".ogg", "audio/ogg"},
+		{".m4a", "audio/mp4"},
+		{".mp3", "audio/mpeg"},
+		{".aac", "audio/aac"},
+		{".flac", "audio/flac"},
+		{".wav", "audio/wav"},
+	},
+}
+
+// Poster images looked for next to a video
+var posterExts = []string{".jpg", ".jpeg", ".png", ".webp", ".avif"}
+
+// The shortcodes GOMD comes with, plugins can replace them
+func builtinShortcodes(opts Options) map[string]plugin.Shortcode {
+	return map[string]plugin.Shortcode{
+		"video": func(page *plugin.Page, args []string) (string, error) {
+			return mediaTag(opts, page, "video", args)
+		},
+		"audio": func(page *plugin.Page, args []string) (string, error) {
+			return mediaTag(opts, page, "audio", args)
+		},
+		"remote": remoteShortcode(opts),
+		"qr":     qrShortcode(opts),
+	}
+}
+
+// Split shortcode args into flags and key=value options
+func mediaArgs(args []string) map[string]string {
+	opts := make(map[string]string)
+	for _, a := range args {
+		k, v, ok := strings.Cut(a, "=")
+		if !ok {
+			v = "true"
+		}
+		opts[k] = v
+	}
+	return opts
+}
+
+// Where a media URL's file is: /assets/... in the assets dir, anything
+// else in the source dir, relative to the page unless root-relative. ""
+// for remote URLs
+func mediaFile(opts Options, page *plugin.Page, src string) string {
+	switch {
+	case strings.Contains(src, "://") || strings.HasPrefix(src, "//"):
+		return ""
+	case strings.HasPrefix(src, "/assets/") && opts.AssetsDir != "":
+		return filepath.Join(opts.AssetsDir, filepath.FromSlash(strings.TrimPrefix(src, "/assets/")))
+	case strings.HasPrefix(src, "/"):
+		return filepath.Join(opts.SrcDir, filepath.FromSlash(src))
+	}
+	return filepath.Join(opts.SrcDir, filepath.FromSlash(path.Join(path.Dir(page.Source), src)))
+}
+
+func exists(file string) bool {
+	fi, err := os.Stat(file)
+	return err == nil && !fi.IsDir()
+}
+
+// {{video "/assets/clip.mp4" poster=/assets/still.jpg caption="..."}}
+// becomes a figure with a <video> with a source for every format of the file found next
+// to it, and the same for {{audio}}. Flags: autoplay (muted, as browsers
+// require), loop, muted, nocontrols. Options: poster, width, height,
+// preload, caption. A .vtt file next to it becomes a captions track
+func mediaTag(opts Options, page *plugin.Page, kind string, args []string) (string, error) {
+	if len(args) == 0 || strings.Contains(args[0], "=") {
+		return "", errors.New("the first argument must be the file")
+	}
+	src, o := args[0], mediaArgs(args[1:])
+	file := mediaFile(opts, page, src)
+	ext := strings.ToLower(path.Ext(src))
+	stem := strings.TrimSuffix(src, path.Ext(src))
+	fileStem := strings.TrimSuffix(file, filepath.Ext(file))
+	known := false
+	for _, t := range mediaTypes[kind] {
+		known = known || t.ext == ext
+	}
+	if !known {
+		return "", fmt.Errorf("%s is not a known %s format", src, kind)
+	}
+	if file != "" {
+		if !exists(file) {
+			return "", fmt.Errorf("%s not found", src)
+		}
+		transcode(opts, kind, file)
+	}
+
+	attr := func(name, value string) string {
+		return fmt.Sprintf(` %s="%s"`, name, html.EscapeString(value))
+	}
+	var b strings.Builder
+	b.WriteString("<" + kind)
+	if o["nocontrols"] == "" {
+		b.WriteString(" controls")
+	}
+	for _, flag := range []string{"autoplay", "loop", "muted"} {
+		if o[flag] != "" || (flag == "muted" && o["autoplay"] != "") {
+			b.WriteString(" " + flag)
+		}
+	}
+	preload := o["preload"]
+	if preload == "" {
+		preload = "metadata"
+	}
+	b.WriteString(attr("preload", preload))
+	if kind == "video" {
+		b.WriteString(" playsinline")
+		poster := o["poster"]
+		for _, e := range posterExts {
+			if poster == "" && file != "" && exists(fileStem+e) {
+				poster = stem + e
+			}
+		}
+		if poster != "" {
+			b.WriteString(attr("poster", WithBase(opts.BasePath, poster)))
+		}
+		for _, dim := range []string{"width", "height"} {
+			if o[dim] != "" {
+				b.WriteString(attr(dim, o[dim]))
+			}
+		}
+	}
+	b.WriteString(">\n")
+	for _, t := range mediaTypes[kind] {
+		if t.ext == ext || (file != "" && exists(fileStem+t.ext)) {
+			b.WriteString("<source" + attr("src", WithBase(opts.BasePath, stem+t.ext)) + attr("type", t.mime) + ">\n")
+		}
+	}
+	if file != "" && exists(fileStem+".vtt") {
+		b.WriteString(`<track kind="captions"` + attr("src", WithBase(opts.BasePath, stem+".vtt")) + " default>\n")
+	}
+	// Shown by browsers that play neither
+	b.WriteString(`<a` + attr("href", WithBase(opts.BasePath, src)) + ">Download the " + kind + "</a>\n</" + kind + ">\n")
+	if caption := o["caption"]; caption != "" {
+		b.WriteString("<figcaption>" + html.EscapeString(caption) + "</figcaption>\n")
+	}
+	// A figure keeps markdown from wrapping it in a paragraph
+	return "\n<figure class=\"" + kind + "\">\n" + b.String() + "</figure>\n", nil
+}
+
+// Create the configured formats of a media file that are missing or
+// older than it, with commands like "ffmpeg -i {in} {out}". Failures are
+// logged, the page then offers the formats there are
+func transcode(opts Options, kind, file string) {
+	src, err := os.Stat(file)
+	if err != nil {
+		return
+	}
+	for _, t := range mediaTypes[kind] {
+		command := opts.Media.Transcode[strings.TrimPrefix(t.ext, ".")]
+		if command == "" || strings.EqualFold(filepath.Ext(file), t.ext) {
+			continue
+		}
+		out := strings.TrimSuffix(file, filepath.Ext(file)) + t.ext
+		if fi, err := os.Stat(out); err == nil && !fi.ModTime().Before(src.ModTime()) {
+			continue
+		}
+		// Written under another name first, keeping the extension tools
+		// pick the format by
+		tmp := strings.TrimSuffix(out, t.ext) + ".transcoding" + t.ext
+		args := strings.Fields(command)
+		for i, a := range args {
+			a = strings.ReplaceAll(a, "{in}", file)
+			args[i] = strings.ReplaceAll(a, "{out}", tmp)
+		}
+		slog.Info("transcoding", "file", file, "to", t.ext)
+		if output, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+			os.Remove(tmp)
+			slog.Error("transcoding failed", "file", file, "to", t.ext, "err", err, "output", lastLine(output))
+			continue
+		}
+		if err := os.Rename(tmp, out); err != nil {
+			slog.Error("transcoding failed", "file", file, "to", t.ext, "err", err)
+		}
+	}
+}
+
+func lastLine(b []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	return lines[len(lines)-1]
+}
@@ -0,0 +1,160 @@
+package compiler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A Jupyter notebook, as far as pages need it
+type notebook struct {
+	Metadata struct {
+		Kernelspec struct {
+			Language string `json:"language"`
+		} `json:"kernelspec"`
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+	} `json:"metadata"`
+	Cells []struct {
+		CellType string           `json:"cell_type"`
+		Source   notebookText     `json:"source"`
+		Outputs  []notebookOutput `json:"outputs"`
+	} `json:"cells"`
+}
+
+type notebookOutput struct {
+	OutputType string                  `json:"output_type"`
+	Name       string                  `json:"name"` // stdout or stderr
+	Text       notebookText            `json:"text"`
+	Data       map[string]notebookText `json:"data"`
+	Ename      string                  `json:"ename"`
+	Evalue     string                  `json:"evalue"`
+	Traceback  []string                `json:"traceback"`
+}
+
+// Notebooks store text as a string or a list of lines
+type notebookText string
+
+func (t *notebookText) UnmarshalJSON(b []byte) error {
+	var lines []string
+	if err := json.Unmarshal(b, &lines); err == nil {
+		*t = notebookText(strings.Join(lines, ""))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		// JSON outputs like application/json are left out
+		return nil
+	}
+	*t = notebookText(s)
+	return nil
+}
+
+// Convert a .ipynb to GMD: markdown cells as they are, code cells as fenced
+// blocks in the notebook's language and their outputs as HTML after them.
+// Front matter goes at the top of the first markdown cell
+func notebookToGMD(input []byte) ([]byte, error) {
+	var nb notebook
+	if err := json.Unmarshal(input, &nb); err != nil {
+		return nil, fmt.Errorf("notebook: %w", err)
+	}
+	if nb.Cells == nil {
+		return nil, errors.New("notebook: no cells, only nbformat 4 notebooks are supported")
+	}
+	lang := nb.Metadata.LanguageInfo.Name
+	if lang == "" {
+		lang = nb.Metadata.Kernelspec.Language
+	}
+	var b strings.Builder
+	for _, cell := range nb.Cells {
+		src := strings.TrimRight(string(cell.Source), "\n")
+		switch cell.CellType {
+		case "markdown":
+			b.WriteString(src + "\n\n")
+		case "code":
+			if strings.TrimSpace(src) != "" {
+				fence := codeFence(src)
+				b.WriteString(fence + lang + "\n" + src + "\n" + fence + "\n\n")
+			}
+			for _, out := range cell.Outputs {
+				if h := notebookOutputHTML(out); h != "" {
+					b.WriteString("<div class=\"nb-output\">\n" + h + "</div>\n\n")
+				}
+			}
+		}
+	}
+	return []byte(b.String()), nil
+}
+
+var backtickRunRe = regexp.MustCompile("`{3,}")
+
+// A fence longer than any run of backticks in the code
+func codeFence(code string) string {
+	n := 3
+	for _, run := range backtickRunRe.FindAllString(code, -1) {
+		if len(run) >= n {
+			n = len(run) + 1
+		}
+	}
+	return strings.Repeat("`", n)
+}
+
+// Rich outputs in the order notebook viewers prefer them
+var notebookMimeTypes = []string{"text/html", "image/svg+xml", "image/png", "image/jpeg", "image/gif", "text/markdown", "text/plain"}
+
+var ansiRe = regexp.MustCompile("\x1b\\[[0-9;]*[A-Za-z]")
+
+func notebookOutputHTML(out notebookOutput) string {
+	switch out.OutputType {
+	case "stream":
+		class := "nb-stream"
+		if out.Name == "stderr" {
+			class += " nb-stderr"
+		}
+		return preText(class, string(out.Text))
+	case "error":
+		text := strings.Join(out.Traceback, "\n")
+		if text == "" {
+			text = out.Ename + ": " + out.Evalue
+		}
+		return preText("nb-error", ansiRe.ReplaceAllString(text, ""))
+	case "execute_result", "display_data":
+		for _, mime := range notebookMimeTypes {
+			data, ok := out.Data[mime]
+			if !ok {
+				continue
+			}
+			s := string(data)
+			switch mime {
+			case "text/html", "image/svg+xml":
+				return s + "\n"
+			case "text/markdown":
+				return string(renderHTML([]byte(s), Options{}))
+			case "text/plain":
+				return preText("nb-text", s)
+			}
+			return fmt.Sprintf("<img src=\"data:%s;base64,%s\" alt=\"\">\n", mime, strings.Join(strings.Fields(s), ""))
+		}
+		if len(out.Data) > 0 {
+			types := make([]string, 0, len(out.Data))
+			for t := range out.Data {
+				types = append(types, t)
+			}
+			sort.Strings(types)
+			return preText("nb-text", "["+strings.Join(types, ", ")+"]")
+		}
+	}
+	return ""
+}
+
+// Escaped so neither HTML nor GMD syntax in the output is applied
+func preText(class, s string) string {
+	s = html.EscapeString(strings.TrimRight(s, "\n"))
+	s = strings.NewReplacer("[", "&#91;", "{", "&#123;", ":", "&#58;", "\n\n", "\n&#10;").Replace(s)
+	return "<pre class=\"" + class + "\">" + s + "</pre>\n"
+}
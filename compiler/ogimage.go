@@ -0,0 +1,282 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Size of the cards, what Facebook, LinkedIn and X show in full
+const ogWidth, ogHeight = 1200, 630
+
+// Space around the text and logo
+const ogMargin = 80
+
+// Title sizes tried in turn until it fits in ogLines lines
+var ogTitleSizes = []float64{72, 60, 48}
+
+const ogLines = 4
+
+// Whether a card is rendered for the page. Like the alternates only
+// public pages get one, so restricted titles don't leak
+func ogCard(opts Options, p *Page) bool {
+	return opts.OGImages.Enabled && hasAlternates(p) && p.Params["image"] == nil
+}
+
+// URL of the page's card, /og/docs/intro.png
+func ogCardURL(p *Page) string {
+	return "/og" + p.URL + ".png"
+}
+
+// The page's og:image, its front matter image or its card, "" for none
+func ogImage(opts Options, p *Page) string {
+	if img, ok := p.Params["image"].(string); ok && img != "" {
+		return img
+	}
+	if ogCard(opts, p) {
+		return ogCardURL(p)
+	}
+	return ""
+}
+
+// Open Graph and Twitter card tags for the page head
+func openGraph(p *Page, opts Options) template.HTML {
+	if !opts.OGImages.Enabled {
+		return ""
+	}
+	var head strings.Builder
+	meta := func(attr, key, value string) {
+		if value != "" {
+			fmt.Fprintf(&head, "<meta %s=\"%s\" content=\"%s\">\n", attr, key, template.HTMLEscapeString(value))
+		}
+	}
+	kind := "website"
+	if p.Date != nil {
+		kind = "article"
+	}
+	meta("property", "og:type", kind)
+	meta("property", "og:title", p.Title)
+	meta("property", "og:description", p.Description)
+	meta("property", "og:site_name", opts.SiteName)
+	if opts.SiteURL != "" {
+		meta("property", "og:url", opts.AbsURL(p.URL))
+	}
+	if img := ogImage(opts, p); img != "" {
+		// Crawlers want absolute URLs, which needs SiteURL
+		if strings.HasPrefix(img, "/") && !strings.HasPrefix(img, "//") {
+			img = opts.SiteURL + WithBase(opts.BasePath, img)
+		}
+		meta("property", "og:image", img)
+		if ogCard(opts, p) {
+			meta("property", "og:image:width", strconv.Itoa(ogWidth))
+			meta("property", "og:image:height", strconv.Itoa(ogHeight))
+		}
+		meta("name", "twitter:card", "summary_large_image")
+	}
+	return template.HTML(head.String())
+}
+
+// The parts every card shares
+type ogTemplate struct {
+	background image.Image
+	logo       image.Image
+	font       *opentype.Font
+	color      color.Color
+}
+
+func loadOGTemplate(opts Options) (*ogTemplate, error) {
+	c := opts.OGImages
+	t := &ogTemplate{}
+	bg, err := parseHexColor(c.Background)
+	if err != nil {
+		return nil, fmt.Errorf("og_images background: %w", err)
+	}
+	if t.color, err = parseHexColor(c.Color); err != nil {
+		return nil, fmt.Errorf("og_images color: %w", err)
+	}
+	card := image.NewNRGBA(image.Rect(0, 0, ogWidth, ogHeight))
+	draw.Draw(card, card.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	if c.Template != "" {
+		img, err := decodeImage(c.Template)
+		if err != nil {
+			return nil, fmt.Errorf("og_images template: %w", err)
+		}
+		draw.CatmullRom.Scale(card, card.Bounds(), img, coverCrop(img.Bounds(), ogWidth, ogHeight), draw.Over, nil)
+	}
+	t.background = card
+	if c.Logo != "" {
+		img, err := decodeImage(c.Logo)
+		if err != nil {
+			return nil, fmt.Errorf("og_images logo: %w", err)
+		}
+		// 96px high, keeping its aspect ratio
+		b := img.Bounds()
+		w := b.Dx() * 96 / max(b.Dy(), 1)
+		logo := image.NewNRGBA(image.Rect(0, 0, w, 96))
+		draw.CatmullRom.Scale(logo, logo.Bounds(), img, b, draw.Src, nil)
+		t.logo = logo
+	}
+	data := gobold.TTF
+	if c.Font != "" {
+		if data, err = os.ReadFile(c.Font); err != nil {
+			return nil, fmt.Errorf("og_images font: %w", err)
+		}
+	}
+	if t.font, err = opentype.Parse(data); err != nil {
+		return nil, fmt.Errorf("og_images font %s: %w", c.Font, err)
+	}
+	return t, nil
+}
+
+// Render a card for every public page into BuildDir/og
+func writeOGImages(opts Options, pages []*Page) error {
+	if !opts.OGImages.Enabled {
+		return nil
+	}
+	t, err := loadOGTemplate(opts)
+	if err != nil {
+		return err
+	}
+	for _, p := range pages {
+		if !ogCard(opts, p) {
+			continue
+		}
+		data, err := t.render(p.Title, opts.SiteName)
+		if err != nil {
+			return &FileError{Path: p.Source, Err: err}
+		}
+		name := filepath.Join(opts.BuildDir, filepath.FromSlash(strings.TrimPrefix(ogCardURL(p), "/")))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(name, data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *ogTemplate) render(title, siteName string) ([]byte, error) {
+	card := image.NewNRGBA(image.Rect(0, 0, ogWidth, ogHeight))
+	draw.Draw(card, card.Bounds(), t.background, image.Point{}, draw.Src)
+	ink := image.NewUniform(t.color)
+
+	var face font.Face
+	var lines []string
+	for _, size := range ogTitleSizes {
+		f, err := opentype.NewFace(t.font, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+		if err != nil {
+			return nil, err
+		}
+		face, lines = f, wrapText(f, title, ogWidth-2*ogMargin)
+		if len(lines) <= ogLines {
+			break
+		}
+	}
+	if len(lines) > ogLines {
+		lines = lines[:ogLines]
+		lines[ogLines-1] = strings.TrimRight(lines[ogLines-1], " .,;:") + "…"
+	}
+	d := &font.Drawer{Dst: card, Src: ink, Face: face}
+	lineHeight := face.Metrics().Height * 6 / 5
+	y := fixed.I(ogMargin) + face.Metrics().Ascent
+	for _, line := range lines {
+		d.Dot = fixed.Point26_6{X: fixed.I(ogMargin), Y: y}
+		d.DrawString(line)
+		y += lineHeight
+	}
+
+	if siteName != "" {
+		small, err := opentype.NewFace(t.font, &opentype.FaceOptions{Size: 36, DPI: 72, Hinting: font.HintingFull})
+		if err != nil {
+			return nil, err
+		}
+		d = &font.Drawer{Dst: card, Src: ink, Face: small}
+		d.Dot = fixed.P(ogMargin, ogHeight-ogMargin)
+		d.DrawString(siteName)
+	}
+	if t.logo != nil {
+		b := t.logo.Bounds()
+		at := image.Pt(ogWidth-ogMargin-b.Dx(), ogHeight-ogMargin-b.Dy()+12)
+		draw.Draw(card, b.Add(at), t.logo, image.Point{}, draw.Over)
+	}
+
+	var buf bytes.Buffer
+	enc := png.Encoder{CompressionLevel: png.BestSpeed}
+	err := enc.Encode(&buf, card)
+	return buf.Bytes(), err
+}
+
+// Split text into lines no wider than width, breaking between words.
+// A word wider than a line gets a line of its own
+func wrapText(face font.Face, text string, width int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		next := word
+		if line != "" {
+			next = line + " " + word
+		}
+		if line != "" && font.MeasureString(face, next).Ceil() > width {
+			lines = append(lines, line)
+			next = word
+		}
+		line = next
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// The part of an image of size b with the aspect ratio of w by h,
+// centered, for scaling it to cover w by h
+func coverCrop(b image.Rectangle, w, h int) image.Rectangle {
+	if b.Dx()*h > b.Dy()*w {
+		cw := b.Dy() * w / h
+		x := b.Min.X + (b.Dx()-cw)/2
+		return image.Rect(x, b.Min.Y, x+cw, b.Max.Y)
+	}
+	ch := b.Dx() * h / w
+	y := b.Min.Y + (b.Dy()-ch)/2
+	return image.Rect(b.Min.X, y, b.Max.X, y+ch)
+}
+
+func decodeImage(name string) (image.Image, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w (use a PNG, JPEG, GIF or WebP image)", name, err)
+	}
+	return img, nil
+}
+
+// "#rgb" or "#rrggbb"
+func parseHexColor(s string) (color.Color, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 6 {
+		return nil, fmt.Errorf("%q is not a color like #1f2937", s)
+	}
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 255}, nil
+}
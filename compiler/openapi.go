@@ -0,0 +1,442 @@
+package compiler
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/core6quad/GOMD/plugin"
+	"gopkg.in/yaml.v3"
+)
+
+// Operations are listed in this order under each path
+var openapiMethods = []string{"get", "put", "post", "patch", "delete", "head", "options", "trace"}
+
+// An OpenAPI 3 or Swagger 2 document, YAML or JSON
+type openapiSpec struct {
+	doc map[string]interface{}
+	// Paths in the order of the file, which the map loses
+	paths []string
+}
+
+// Render the spec named by a page's openapi front matter as API docs:
+// every operation grouped by tag, with its parameters, request body and
+// responses, and the schemas they use. Operations and schemas are
+// <details>, so they open and close without any script
+func openapiDocs(opts Options, page *plugin.Page, src string) (title string, out []byte, err error) {
+	file := mediaFile(opts, page, src)
+	if file == "" {
+		return "", nil, fmt.Errorf("openapi: %s: only local files are supported", src)
+	}
+	spec, err := loadOpenAPI(file)
+	if err != nil {
+		return "", nil, fmt.Errorf("openapi: %s: %w", src, err)
+	}
+	var b strings.Builder
+	md := func(s string) {
+		if s != "" {
+			b.Write(renderHTML([]byte(s), opts))
+		}
+	}
+	info := mapOf(spec.doc["info"])
+	title = str(info["title"])
+	b.WriteString("<section class=\"openapi\">\n")
+	if v := str(info["version"]); v != "" {
+		fmt.Fprintf(&b, "<p class=\"openapi-version\">Version %s</p>\n", html.EscapeString(v))
+	}
+	md(str(info["description"]))
+	if servers := spec.servers(); len(servers) > 0 {
+		b.WriteString("<ul class=\"openapi-servers\">\n")
+		for _, s := range servers {
+			fmt.Fprintf(&b, "<li><code>%s</code></li>\n", html.EscapeString(s))
+		}
+		b.WriteString("</ul>\n")
+	}
+
+	tags, byTag := spec.operations()
+	for _, tag := range tags {
+		if tag.name != "" {
+			fmt.Fprintf(&b, "<h2 id=\"tag-%s\">%s</h2>\n", anchor(tag.name), html.EscapeString(tag.name))
+			md(tag.description)
+		}
+		for _, op := range byTag[tag.name] {
+			spec.writeOperation(&b, op, md)
+		}
+	}
+
+	schemas := spec.schemas()
+	if len(schemas) > 0 {
+		b.WriteString("<h2 id=\"schemas\">Schemas</h2>\n")
+		names := make([]string, 0, len(schemas))
+		for name := range schemas {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			s := mapOf(schemas[name])
+			fmt.Fprintf(&b, "<details class=\"openapi-schema\" id=\"schema-%s\">\n<summary>%s</summary>\n", anchor(name), html.EscapeString(name))
+			md(str(s["description"]))
+			spec.writeSchema(&b, s)
+			b.WriteString("</details>\n")
+		}
+	}
+	b.WriteString("</section>\n")
+	return title, []byte(b.String()), nil
+}
+
+func loadOpenAPI(file string) (*openapiSpec, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	spec := &openapiSpec{}
+	if err := root.Decode(&spec.doc); err != nil {
+		return nil, err
+	}
+	if spec.doc["openapi"] == nil && spec.doc["swagger"] == nil {
+		return nil, fmt.Errorf("not an OpenAPI or Swagger document")
+	}
+	if len(root.Content) > 0 {
+		top := root.Content[0]
+		for i := 0; i+1 < len(top.Content); i += 2 {
+			if top.Content[i].Value == "paths" {
+				paths := top.Content[i+1]
+				for j := 0; j+1 < len(paths.Content); j += 2 {
+					spec.paths = append(spec.paths, paths.Content[j].Value)
+				}
+			}
+		}
+	}
+	return spec, nil
+}
+
+func (s *openapiSpec) servers() []string {
+	var out []string
+	for _, v := range listOf(s.doc["servers"]) {
+		if u := str(mapOf(v)["url"]); u != "" {
+			out = append(out, u)
+		}
+	}
+	// Swagger 2 has a host, base path and schemes instead
+	if host := str(s.doc["host"]); host != "" {
+		scheme := "https"
+		if schemes := listOf(s.doc["schemes"]); len(schemes) > 0 {
+			scheme = str(schemes[0])
+		}
+		out = append(out, scheme+"://"+host+str(s.doc["basePath"]))
+	}
+	return out
+}
+
+type openapiTag struct{ name, description string }
+
+type openapiOperation struct {
+	method, path string
+	op, item     map[string]interface{}
+}
+
+// Tags in the order the spec declares them, then in the order operations
+// use them. Untagged operations come first
+func (s *openapiSpec) operations() ([]openapiTag, map[string][]openapiOperation) {
+	var tags []openapiTag
+	known := make(map[string]bool)
+	addTag := func(name, description string) {
+		if !known[name] {
+			known[name] = true
+			tags = append(tags, openapiTag{name, description})
+		}
+	}
+	for _, t := range listOf(s.doc["tags"]) {
+		t := mapOf(t)
+		addTag(str(t["name"]), str(t["description"]))
+	}
+	byTag := make(map[string][]openapiOperation)
+	untagged := false
+	paths := mapOf(s.doc["paths"])
+	for _, p := range s.paths {
+		item := mapOf(paths[p])
+		for _, method := range openapiMethods {
+			op := mapOf(item[method])
+			if op == nil {
+				continue
+			}
+			o := openapiOperation{method, p, op, item}
+			opTags := listOf(op["tags"])
+			if len(opTags) == 0 {
+				untagged = true
+				byTag[""] = append(byTag[""], o)
+			}
+			for _, t := range opTags {
+				addTag(str(t), "")
+				byTag[str(t)] = append(byTag[str(t)], o)
+			}
+		}
+	}
+	if untagged {
+		tags = append([]openapiTag{{}}, tags...)
+	}
+	var used []openapiTag
+	for _, t := range tags {
+		if len(byTag[t.name]) > 0 {
+			used = append(used, t)
+		}
+	}
+	return used, byTag
+}
+
+func (s *openapiSpec) writeOperation(b *strings.Builder, o openapiOperation, md func(string)) {
+	id := str(o.op["operationId"])
+	if id == "" {
+		id = o.method + "-" + o.path
+	}
+	class := "openapi-operation method-" + o.method
+	if o.op["deprecated"] == true {
+		class += " deprecated"
+	}
+	fmt.Fprintf(b, "<details class=\"%s\" id=\"op-%s\">\n<summary><span class=\"method\">%s</span> <code>%s</code>",
+		class, anchor(id), strings.ToUpper(o.method), html.EscapeString(o.path))
+	if sum := str(o.op["summary"]); sum != "" {
+		fmt.Fprintf(b, " %s", html.EscapeString(sum))
+	}
+	b.WriteString("</summary>\n")
+	if o.op["deprecated"] == true {
+		b.WriteString("<p><strong>Deprecated</strong></p>\n")
+	}
+	md(str(o.op["description"]))
+
+	// Path level parameters apply unless the operation overrides them
+	var params []map[string]interface{}
+	seen := make(map[string]bool)
+	for _, list := range []interface{}{o.op["parameters"], o.item["parameters"]} {
+		for _, p := range listOf(list) {
+			p := s.resolve(mapOf(p))
+			key := str(p["in"]) + " " + str(p["name"])
+			if !seen[key] {
+				seen[key] = true
+				params = append(params, p)
+			}
+		}
+	}
+	var body map[string]interface{}
+	if len(params) > 0 {
+		rows := 0
+		for _, p := range params {
+			if str(p["in"]) == "body" {
+				body = p
+				continue
+			}
+			if rows == 0 {
+				b.WriteString("<h4>Parameters</h4>\n<table>\n<thead>\n<tr><th>Name</th><th>In</th><th>Type</th><th>Description</th></tr>\n</thead>\n<tbody>\n")
+			}
+			rows++
+			schema := mapOf(p["schema"])
+			if schema == nil {
+				// Swagger 2 puts the type on the parameter itself
+				schema = p
+			}
+			fmt.Fprintf(b, "<tr><td><code>%s</code>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>\n",
+				html.EscapeString(str(p["name"])), requiredMark(p["required"] == true),
+				html.EscapeString(str(p["in"])), s.typeName(schema), inlineText(str(p["description"])))
+		}
+		if rows > 0 {
+			b.WriteString("</tbody>\n</table>\n")
+		}
+	}
+
+	if rb := s.resolve(mapOf(o.op["requestBody"])); rb != nil {
+		b.WriteString("<h4>Request body</h4>\n")
+		md(str(rb["description"]))
+		s.writeContent(b, mapOf(rb["content"]))
+	} else if body != nil {
+		b.WriteString("<h4>Request body</h4>\n")
+		md(str(body["description"]))
+		s.writeSchema(b, mapOf(body["schema"]))
+	}
+
+	if responses := mapOf(o.op["responses"]); len(responses) > 0 {
+		codes := make([]string, 0, len(responses))
+		for code := range responses {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		b.WriteString("<h4>Responses</h4>\n<table>\n<thead>\n<tr><th>Status</th><th>Description</th><th>Body</th></tr>\n</thead>\n<tbody>\n")
+		for _, code := range codes {
+			r := s.resolve(mapOf(responses[code]))
+			var bodies []string
+			if schema := mapOf(r["schema"]); schema != nil {
+				bodies = append(bodies, s.typeName(schema))
+			}
+			content := mapOf(r["content"])
+			for _, ct := range sortedKeys(content) {
+				schema := mapOf(mapOf(content[ct])["schema"])
+				bodies = append(bodies, "<code>"+html.EscapeString(ct)+"</code> "+s.typeName(schema))
+			}
+			fmt.Fprintf(b, "<tr><td>%s</td><td>%s</td><td>%s</td></tr>\n",
+				html.EscapeString(code), inlineText(str(r["description"])), strings.Join(bodies, "<br>"))
+		}
+		b.WriteString("</tbody>\n</table>\n")
+	}
+	b.WriteString("</details>\n")
+}
+
+// Request bodies by media type
+func (s *openapiSpec) writeContent(b *strings.Builder, content map[string]interface{}) {
+	for _, ct := range sortedKeys(content) {
+		fmt.Fprintf(b, "<p><code>%s</code></p>\n", html.EscapeString(ct))
+		s.writeSchema(b, mapOf(mapOf(content[ct])["schema"]))
+	}
+}
+
+// A table of an object's properties, or just the type of anything else
+func (s *openapiSpec) writeSchema(b *strings.Builder, schema map[string]interface{}) {
+	if schema == nil {
+		return
+	}
+	if ref := str(schema["$ref"]); ref != "" {
+		fmt.Fprintf(b, "<p>%s</p>\n", s.typeName(schema))
+		return
+	}
+	if enum := listOf(schema["enum"]); len(enum) > 0 {
+		values := make([]string, len(enum))
+		for i, v := range enum {
+			values[i] = "<code>" + html.EscapeString(fmt.Sprint(v)) + "</code>"
+		}
+		fmt.Fprintf(b, "<p>%s, one of %s</p>\n", s.typeName(schema), strings.Join(values, ", "))
+		return
+	}
+	props := mapOf(schema["properties"])
+	if len(props) == 0 {
+		fmt.Fprintf(b, "<p>%s</p>\n", s.typeName(schema))
+		return
+	}
+	required := make(map[string]bool)
+	for _, r := range listOf(schema["required"]) {
+		required[str(r)] = true
+	}
+	b.WriteString("<table>\n<thead>\n<tr><th>Property</th><th>Type</th><th>Description</th></tr>\n</thead>\n<tbody>\n")
+	for _, name := range sortedKeys(props) {
+		p := mapOf(props[name])
+		fmt.Fprintf(b, "<tr><td><code>%s</code>%s</td><td>%s</td><td>%s</td></tr>\n",
+			html.EscapeString(name), requiredMark(required[name]), s.typeName(p), inlineText(str(p["description"])))
+	}
+	b.WriteString("</tbody>\n</table>\n")
+}
+
+// A short HTML description of a schema's type, linking to named schemas
+func (s *openapiSpec) typeName(schema map[string]interface{}) string {
+	if schema == nil {
+		return ""
+	}
+	if ref := str(schema["$ref"]); ref != "" {
+		name := path.Base(ref)
+		return fmt.Sprintf("<a href=\"#schema-%s\">%s</a>", anchor(name), html.EscapeString(name))
+	}
+	for _, key := range []string{"oneOf", "anyOf", "allOf"} {
+		if list := listOf(schema[key]); len(list) > 0 {
+			names := make([]string, len(list))
+			for i, v := range list {
+				names[i] = s.typeName(mapOf(v))
+			}
+			sep := " or "
+			if key == "allOf" {
+				sep = " and "
+			}
+			return strings.Join(names, sep)
+		}
+	}
+	t := str(schema["type"])
+	if t == "array" {
+		return "array of " + s.typeName(mapOf(schema["items"]))
+	}
+	if t == "" {
+		t = "object"
+	}
+	if f := str(schema["format"]); f != "" {
+		t += " (" + f + ")"
+	}
+	return html.EscapeString(t)
+}
+
+// Named schemas, from components or Swagger 2 definitions
+func (s *openapiSpec) schemas() map[string]interface{} {
+	if c := mapOf(mapOf(s.doc["components"])["schemas"]); c != nil {
+		return c
+	}
+	return mapOf(s.doc["definitions"])
+}
+
+// Follow a local $ref like #/components/parameters/limit
+func (s *openapiSpec) resolve(v map[string]interface{}) map[string]interface{} {
+	for i := 0; i < 10; i++ {
+		ref := str(v["$ref"])
+		if !strings.HasPrefix(ref, "#/") {
+			return v
+		}
+		var cur interface{} = s.doc
+		for _, part := range strings.Split(ref[2:], "/") {
+			part = strings.NewReplacer("~1", "/", "~0", "~").Replace(part)
+			cur = mapOf(cur)[part]
+		}
+		v = mapOf(cur)
+	}
+	return v
+}
+
+func requiredMark(required bool) string {
+	if required {
+		return ` <abbr title="required">*</abbr>`
+	}
+	return ""
+}
+
+// Descriptions in table cells, as plain text
+func inlineText(s string) string {
+	return html.EscapeString(strings.TrimSpace(s))
+}
+
+// Ids from names, keeping letters, digits, - and _
+func anchor(s string) string {
+	return strings.Trim(strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '-'
+	}, s), "-")
+}
+
+func mapOf(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
+
+func listOf(v interface{}) []interface{} {
+	l, _ := v.([]interface{})
+	return l
+}
+
+func str(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
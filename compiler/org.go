@@ -0,0 +1,269 @@
+package compiler
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Org keywords that become front matter
+var orgKeywords = map[string]string{
+	"title":       "title",
+	"author":      "author",
+	"date":        "date",
+	"description": "description",
+	"filetags":    "tags",
+}
+
+var (
+	orgKeywordRe  = regexp.MustCompile(`^#\+([A-Za-z_]+):\s*(.*)$`)
+	orgHeadlineRe = regexp.MustCompile(`^(\*+)\s+(.*?)(?:\s+(:[\w@#%:]+:))?\s*$`)
+	orgBlockRe    = regexp.MustCompile(`(?i)^\s*#\+begin_(\w+)\s*(\S*)`)
+	orgListRe     = regexp.MustCompile(`^(\s*)([-+]|\d+[.)])\s+(.*)$`)
+	orgDescRe     = regexp.MustCompile(`^(.*?)\s+::\s+(.*)$`)
+	orgRuleRe     = regexp.MustCompile(`^\s*-{5,}\s*$`)
+	orgTableSepRe = regexp.MustCompile(`^\s*\|[-+]+\|?\s*$`)
+	orgLinkRe     = regexp.MustCompile(`\[\[([^\]]+)\](?:\[([^\]]+)\])?\]`)
+	orgDateRe     = regexp.MustCompile(`(\d{4}-\d\d-\d\d)(?: \w+)?( \d\d:\d\d)?`)
+	orgCodeRe     = regexp.MustCompile(`=(?:\S|\S.*?\S)=|~(?:\S|\S.*?\S)~`)
+)
+
+// Convert an org-mode file to GMD: keywords like #+TITLE become front
+// matter, then headlines, lists, tables, links, emphasis and src, example
+// and quote blocks are turned into their markdown. Drawers, comments and
+// other keywords are left out
+func orgToGMD(input []byte) ([]byte, error) {
+	lines := strings.Split(string(normalizeNewlines(input)), "\n")
+	fm := make(map[string]interface{})
+	var out []string
+	block := ""
+	drawer := false
+	// Markdown wants blank lines between lists, tables, code and text
+	prev := ""
+	emit := func(kind string, lines ...string) {
+		if kind != prev && len(out) > 0 && out[len(out)-1] != "" {
+			out = append(out, "")
+		}
+		out = append(out, lines...)
+		prev = kind
+	}
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if block != "" {
+			if strings.EqualFold(trimmed, "#+end_"+strings.Fields(block)[0]) {
+				if !orgRawBlock(block) {
+					out = append(out, "```")
+				}
+				out = append(out, "")
+				block, prev = "", ""
+				continue
+			}
+			switch block {
+			case "quote":
+				out = append(out, "> "+orgInline(trimmed))
+			case "export html":
+				out = append(out, line)
+			case "export":
+			default:
+				out = append(out, strings.TrimPrefix(line, ","))
+			}
+			continue
+		}
+		if drawer {
+			drawer = !strings.EqualFold(trimmed, ":end:")
+			continue
+		}
+		switch {
+		case trimmed == "":
+			out = append(out, "")
+			prev = ""
+		case orgBlockRe.MatchString(line):
+			m := orgBlockRe.FindStringSubmatch(line)
+			block = strings.ToLower(m[1])
+			switch block {
+			case "src":
+				emit("block", "```"+m[2])
+			case "export":
+				// Only HTML exports are kept, as they are
+				if strings.EqualFold(m[2], "html") {
+					block = "export html"
+				}
+			case "quote":
+				emit("block")
+			default:
+				emit("block", "```")
+			}
+		case orgKeywordRe.MatchString(trimmed):
+			m := orgKeywordRe.FindStringSubmatch(trimmed)
+			key, ok := orgKeywords[strings.ToLower(m[1])]
+			if !ok {
+				continue
+			}
+			switch key {
+			case "tags":
+				fm[key] = strings.FieldsFunc(m[2], func(r rune) bool { return r == ':' || r == ' ' })
+			case "date":
+				// <2024-05-01 Wed 10:00> is 2024-05-01 10:00
+				if d := orgDateRe.FindStringSubmatch(m[2]); d != nil {
+					fm[key] = d[1] + d[2]
+				}
+			default:
+				fm[key] = m[2]
+			}
+		case strings.HasPrefix(trimmed, "# ") || trimmed == "#":
+			// A comment
+		case strings.HasPrefix(trimmed, ":") && strings.HasSuffix(trimmed, ":") && len(trimmed) > 2 && !strings.Contains(trimmed, " "):
+			drawer = true
+		case orgHeadlineRe.MatchString(line):
+			m := orgHeadlineRe.FindStringSubmatch(line)
+			level := len(m[1])
+			if level > 6 {
+				level = 6
+			}
+			emit("headline", strings.Repeat("#", level)+" "+orgInline(m[2]), "")
+			prev = ""
+		case orgRuleRe.MatchString(line):
+			emit("rule", "---", "")
+			prev = ""
+		case strings.HasPrefix(trimmed, ": ") || trimmed == ":":
+			// Fixed width lines
+			emit("fixed", "    "+strings.TrimPrefix(strings.TrimPrefix(trimmed, ":"), " "))
+		case strings.HasPrefix(trimmed, "|"):
+			if orgTableSepRe.MatchString(trimmed) {
+				if prev == "table" {
+					cols := strings.Count(strings.ReplaceAll(trimmed, "+", "|"), "|") - 1
+					out = append(out, "|"+strings.Repeat("---|", cols))
+				}
+				continue
+			}
+			emit("table", orgInline(trimmed))
+		case orgListRe.MatchString(line):
+			m := orgListRe.FindStringSubmatch(line)
+			bullet := m[2]
+			if bullet == "+" {
+				bullet = "-"
+			}
+			bullet = strings.Replace(bullet, ")", ".", 1)
+			item := m[3]
+			if d := orgDescRe.FindStringSubmatch(item); d != nil && !strings.HasPrefix(bullet, "1") {
+				item = "**" + d[1] + "**: " + d[2]
+			}
+			emit("list", m[1]+bullet+" "+orgInline(item))
+		default:
+			if prev == "list" && strings.HasPrefix(line, " ") {
+				// Continues the item above
+				out = append(out, orgInline(line))
+				continue
+			}
+			emit("text", orgInline(line))
+		}
+	}
+	if block != "" && !orgRawBlock(block) {
+		out = append(out, "```")
+	}
+	body := strings.Join(out, "\n") + "\n"
+	if len(fm) == 0 {
+		return []byte(body), nil
+	}
+	head, err := yaml.Marshal(fm)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	b.WriteString("---\n")
+	b.Write(head)
+	b.WriteString("---\n")
+	b.WriteString(body)
+	return b.Bytes(), nil
+}
+
+// Blocks that aren't fenced code
+func orgRawBlock(block string) bool {
+	return block == "quote" || strings.HasPrefix(block, "export")
+}
+
+// Org emphasis markers and what they become
+var orgEmphasis = []struct {
+	re  *regexp.Regexp
+	rep string
+}{
+	{orgMarkupRe(`\*`), "$1**$2**$3"},
+	{orgMarkupRe(`/`), "$1*$2*$3"},
+	{orgMarkupRe(`\+`), "$1~~$2~~$3"},
+	{orgMarkupRe(`_`), "$1<u>$2</u>$3"},
+}
+
+// Markup has to follow whitespace or opening punctuation and be followed
+// by whitespace or punctuation, so 2*3*4 and paths stay as they are
+func orgMarkupRe(marker string) *regexp.Regexp {
+	return regexp.MustCompile(`(^|[\s('"{])` + marker + `([^\s` + marker + `]|[^\s` + marker + `].*?[^\s])` + marker + `($|[\s)'".,;:!?}-])`)
+}
+
+// Links, code and emphasis in a line of text. Code and links are
+// converted first and emphasis only applies to the text around them
+func orgInline(s string) string {
+	var b strings.Builder
+	for s != "" {
+		link := orgLinkRe.FindStringSubmatchIndex(s)
+		code := orgCode(s)
+		if link == nil && code == nil {
+			break
+		}
+		if link != nil && (code == nil || link[0] < code[0]) {
+			b.WriteString(orgEmphasize(s[:link[0]]))
+			target := s[link[2]:link[3]]
+			desc := target
+			if link[4] >= 0 {
+				desc = s[link[4]:link[5]]
+			}
+			b.WriteString("[" + desc + "](" + orgLinkTarget(target) + ")")
+			s = s[link[1]:]
+			continue
+		}
+		b.WriteString(orgEmphasize(s[:code[0]]))
+		inner := s[code[0]+1 : code[1]-1]
+		if strings.Contains(inner, "`") {
+			b.WriteString("`` " + inner + " ``")
+		} else {
+			b.WriteString("`" + inner + "`")
+		}
+		s = s[code[1]:]
+	}
+	b.WriteString(orgEmphasize(s))
+	return b.String()
+}
+
+// The first =verbatim= or ~code~ in s that follows whitespace or
+// punctuation
+func orgCode(s string) []int {
+	for offset := 0; offset < len(s); {
+		m := orgCodeRe.FindStringIndex(s[offset:])
+		if m == nil {
+			return nil
+		}
+		start, end := offset+m[0], offset+m[1]
+		if start == 0 || strings.ContainsRune(" \t('\"{", rune(s[start-1])) {
+			return []int{start, end}
+		}
+		offset = start + 1
+	}
+	return nil
+}
+
+func orgEmphasize(s string) string {
+	for _, e := range orgEmphasis {
+		// Twice, neighbours share the space between them
+		s = e.re.ReplaceAllString(e.re.ReplaceAllString(s, e.rep), e.rep)
+	}
+	return s
+}
+
+// file:notes.org links point at the page, other links stay as they are
+func orgLinkTarget(target string) string {
+	if strings.HasPrefix(target, "file:") {
+		target = strings.TrimSuffix(strings.TrimPrefix(target, "file:"), ".org")
+	}
+	return strings.ReplaceAll(target, " ", "%20")
+}
@@ -0,0 +1,119 @@
+package compiler
+
+import (
+	"html"
+	"html/template"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Average adult reading speed used for Page.ReadingTime
+const wordsPerMinute = 200
+
+// Page is a compiled page, as seen by templates and the content API
+type Page struct {
+	URL    string   `json:"url"`
+	Source string   `json:"source"`
+	Title  string   `json:"title"`
+	Tags   []string `json:"tags,omitempty"`
+	// From front matter, Type defaults to "page"
+	Description string     `json:"description,omitempty"`
+	Author      string     `json:"author,omitempty"`
+	Date        *time.Time `json:"date,omitempty"`
+	PublishAt   *time.Time `json:"publish_at,omitempty"`
+	// Last commit touching the source and its authors, newest first, from
+	// git history. Without it, Date and Author
+	LastModified *time.Time `json:"last_modified,omitempty"`
+	Authors      []string   `json:"authors,omitempty"`
+	Type         string     `json:"type"`
+	Canonical    string     `json:"canonical,omitempty"`
+	NoIndex      bool       `json:"noindex,omitempty"`
+	// Who may see the page, everyone when empty. See auth.ParseAccess
+	Allow []string `json:"allow,omitempty"`
+	// Asked for before the page is shown, never exposed
+	Password string `json:"-"`
+	// A/B variant letter of pricing.a.gmd style sources. The first variant
+	// stands for the page in the index and lists all of them
+	Variant  string   `json:"variant,omitempty"`
+	Variants []string `json:"variants,omitempty"`
+	// Version directory of versioned docs, and the page in every version
+	Version  string        `json:"version,omitempty"`
+	Versions []VersionLink `json:"versions,omitempty"`
+	// Link to the source file in the repository's web editor, when
+	// Options.EditURL is set
+	EditURL string `json:"edit_url,omitempty"`
+	// Extra front matter keys
+	Params map[string]interface{} `json:"params,omitempty"`
+	// Words in the rendered text, code included
+	WordCount int `json:"word_count"`
+	// Estimated minutes to read, at least 1 for any non-empty page
+	ReadingTime int `json:"reading_time"`
+
+	Content template.HTML `json:"-"`
+	// The markdown Content was rendered from, kept when the site has .md
+	// output, see Options.OutputFormats
+	Markdown []byte `json:"-"`
+	// Similar pages, most related first
+	Related     []*Page `json:"-"`
+	Breadcrumbs []Crumb `json:"breadcrumbs"`
+	// From the section's sidebar.yaml or _sidebar.gmd, or the closest
+	// one above it
+	Sidebar []NavItem `json:"sidebar,omitempty"`
+	// Previous and next page in sidebar or section order
+	Prev *NavItem `json:"prev,omitempty"`
+	Next *NavItem `json:"next,omitempty"`
+}
+
+var (
+	headingRe = regexp.MustCompile(`(?m)^#[ \t]+(.+?)[ \t#]*$`)
+	tagRe     = regexp.MustCompile(`<[^>]*>`)
+)
+
+var spaceRe = regexp.MustCompile(`\s+`)
+
+// Text is the page's content as plain text, without tags
+func (p *Page) Text() string {
+	text := tagRe.ReplaceAllString(string(p.Content), " ")
+	return strings.TrimSpace(spaceRe.ReplaceAllString(html.UnescapeString(text), " "))
+}
+
+// Searchable reports whether a page belongs in search results: anyone
+// can see it and it isn't noindex. Older versions of docs are included
+func (p *Page) Searchable() bool {
+	return !p.NoIndex && len(p.Allow) == 0 && p.Password == ""
+}
+
+// Use the first top-level heading as the title, or the file name
+func pageTitle(markdown []byte, url string) string {
+	if m := headingRe.FindSubmatch(markdown); m != nil {
+		return string(m[1])
+	}
+	name := path.Base(url)
+	if name == "/" || name == "index" {
+		return "Home"
+	}
+	return name
+}
+
+// Count words in rendered HTML, ignoring tags
+func wordCount(html []byte) int {
+	text := tagRe.ReplaceAll(html, []byte(" "))
+	return len(strings.Fields(string(text)))
+}
+
+// The home page is served at / rather than /index
+func canonicalPath(url string) string {
+	if url == "/index" {
+		return "/"
+	}
+	return url
+}
+
+func readingTime(words int) int {
+	if words == 0 {
+		return 0
+	}
+	return (words + wordsPerMinute - 1) / wordsPerMinute
+}
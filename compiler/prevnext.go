@@ -0,0 +1,79 @@
+package compiler
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// PagerPartial defines the "pager" template, links to the previous and
+// next page:
+//
+//	{{template "pager" .}}
+const PagerPartial = `{{define "pager"}}{{if or .Page.Prev .Page.Next}}<nav class="pager">
+{{with .Page.Prev}}<a class="prev" rel="prev" href="{{url .URL}}">&larr; {{.Title}}</a>{{end}}
+{{with .Page.Next}}<a class="next" rel="next" href="{{url .URL}}">{{.Title}} &rarr;</a>{{end}}
+</nav>{{end}}{{end}}`
+
+// Pages of a sidebar in reading order, external links left out
+func flattenSidebar(items []NavItem, out []NavItem) []NavItem {
+	for _, item := range items {
+		if strings.HasPrefix(item.URL, "/") {
+			out = append(out, NavItem{Title: item.Title, URL: item.URL})
+		}
+		out = flattenSidebar(item.Items, out)
+	}
+	return out
+}
+
+// Fill in Page.Prev and Page.Next, in sidebar order when the page is in
+// its sidebar. Otherwise in the order of its section: the index page, then
+// the others by URL
+func prevNextPages(pages []*Page) {
+	sections := make(map[string][]NavItem)
+	for _, p := range pages {
+		if p.Source == "" {
+			continue
+		}
+		dir := path.Dir(p.URL)
+		sections[dir] = append(sections[dir], NavItem{Title: p.Title, URL: canonicalPath(p.URL)})
+	}
+	for _, items := range sections {
+		sort.SliceStable(items, func(i, j int) bool {
+			return isIndex(items[i].URL) && !isIndex(items[j].URL)
+		})
+	}
+	for _, p := range pages {
+		url := canonicalPath(p.URL)
+		order := flattenSidebar(p.Sidebar, nil)
+		i := navIndex(order, url)
+		if i < 0 {
+			order = sections[path.Dir(p.URL)]
+			i = navIndex(order, url)
+		}
+		if i < 0 {
+			continue
+		}
+		if i > 0 {
+			prev := order[i-1]
+			p.Prev = &prev
+		}
+		if i+1 < len(order) {
+			next := order[i+1]
+			p.Next = &next
+		}
+	}
+}
+
+func isIndex(url string) bool {
+	return url == "/" || path.Base(url) == "index"
+}
+
+func navIndex(items []NavItem, url string) int {
+	for i, item := range items {
+		if item.URL == url {
+			return i
+		}
+	}
+	return -1
+}
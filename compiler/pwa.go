@@ -0,0 +1,200 @@
+package compiler
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type manifestIcon struct {
+	Src   string `json:"src"`
+	Sizes string `json:"sizes"`
+	Type  string `json:"type"`
+}
+
+type manifest struct {
+	Name            string         `json:"name,omitempty"`
+	ShortName       string         `json:"short_name,omitempty"`
+	StartURL        string         `json:"start_url"`
+	Scope           string         `json:"scope,omitempty"`
+	Display         string         `json:"display"`
+	ThemeColor      string         `json:"theme_color,omitempty"`
+	BackgroundColor string         `json:"background_color,omitempty"`
+	Icons           []manifestIcon `json:"icons,omitempty"`
+}
+
+// The web app manifest: the favicon's Android icons, and how the
+// installed app looks with PWA on
+func webManifest(opts Options) manifest {
+	m := manifest{Name: opts.SiteName, StartURL: opts.BasePath + "/", Display: "browser"}
+	if pwa := opts.PWA; pwa.Enabled {
+		scope := WithBase(opts.BasePath, pwa.Scope)
+		if !strings.HasSuffix(scope, "/") {
+			scope += "/"
+		}
+		m.Name, m.ShortName, m.Display = pwa.Name, pwa.ShortName, pwa.Display
+		m.StartURL, m.Scope = scope, scope
+		m.ThemeColor, m.BackgroundColor = pwa.ThemeColor, pwa.BackgroundColor
+	}
+	if opts.Favicon != "" {
+		for _, icon := range faviconFiles {
+			if strings.HasPrefix(icon.name, "icon-") {
+				m.Icons = append(m.Icons, manifestIcon{Src: opts.BasePath + "/" + icon.name, Sizes: fmt.Sprintf("%dx%d", icon.size, icon.size), Type: "image/png"})
+			}
+		}
+	}
+	return m
+}
+
+// Write manifest.webmanifest when there are icons or PWA is on, and the
+// service worker when it is enabled
+func writePWA(opts Options, pages []*Page) error {
+	if opts.Favicon == "" && !opts.PWA.Enabled {
+		return nil
+	}
+	data, err := json.MarshalIndent(webManifest(opts), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(opts.BuildDir, "manifest.webmanifest"), data, 0644); err != nil {
+		return err
+	}
+	if !opts.PWA.Enabled || !opts.PWA.ServiceWorker {
+		return nil
+	}
+	return writeServiceWorker(opts, pages)
+}
+
+// Head tags for the manifest and the service worker
+func pwaHead(opts Options) template.HTML {
+	if opts.Favicon == "" && !opts.PWA.Enabled {
+		return ""
+	}
+	base := template.HTMLEscapeString(opts.BasePath)
+	head := `<link rel="manifest" href="` + base + "/manifest.webmanifest\">\n"
+	if opts.PWA.Enabled && opts.PWA.ThemeColor != "" {
+		head += `<meta name="theme-color" content="` + template.HTMLEscapeString(opts.PWA.ThemeColor) + "\">\n"
+	}
+	if opts.PWA.Enabled && opts.PWA.ServiceWorker {
+		sw, _ := json.Marshal(opts.BasePath + "/sw.js")
+		scope, _ := json.Marshal(swScope(opts))
+		head += `<script>if("serviceWorker"in navigator)navigator.serviceWorker.register(` + string(sw) + `,{scope:` + string(scope) + "})</script>\n"
+	}
+	return template.HTML(head)
+}
+
+func swScope(opts Options) string {
+	scope := WithBase(opts.BasePath, opts.PWA.Scope)
+	if !strings.HasSuffix(scope, "/") {
+		scope += "/"
+	}
+	return scope
+}
+
+// The service worker: it precaches every public page in scope and the
+// matching assets, keeps them fresh with the configured strategy, and
+// drops the caches of older builds
+const serviceWorker = `// Generated by GOMD, rebuilt with the site
+const CACHE = "gomd-%s";
+const PRECACHE = %s;
+const ASSETS = %s;
+const STRATEGY = %s;
+
+self.addEventListener("install", e => {
+  e.waitUntil(caches.open(CACHE)
+    .then(c => Promise.all(PRECACHE.map(u => c.add(u).catch(() => {}))))
+    .then(() => self.skipWaiting()));
+});
+
+self.addEventListener("activate", e => {
+  e.waitUntil(caches.keys()
+    .then(keys => Promise.all(keys.filter(k => k.startsWith("gomd-") && k !== CACHE).map(k => caches.delete(k))))
+    .then(() => self.clients.claim()));
+});
+
+function fromNetwork(req) {
+  return fetch(req).then(res => {
+    if (res.ok) {
+      const copy = res.clone();
+      caches.open(CACHE).then(c => c.put(req, copy));
+    }
+    return res;
+  });
+}
+
+function offline() {
+  return new Response("You are offline and this page isn't saved yet.", {status: 503, headers: {"Content-Type": "text/plain; charset=utf-8"}});
+}
+
+self.addEventListener("fetch", e => {
+  const req = e.request;
+  const url = new URL(req.url);
+  // Only the site's own pages and assets, never the admin, APIs or forms
+  if (req.method !== "GET" || url.origin !== location.origin) return;
+  if (!PRECACHE.includes(url.pathname) && !url.pathname.startsWith(ASSETS)) return;
+  const cached = caches.match(req, {ignoreSearch: true});
+  if (STRATEGY === "cache-first") {
+    e.respondWith(cached.then(res => res || fromNetwork(req)).catch(offline));
+  } else if (STRATEGY === "stale-while-revalidate") {
+    const fresh = fromNetwork(req);
+    e.respondWith(cached.then(res => res || fresh).catch(offline));
+    e.waitUntil(fresh.catch(() => {}));
+  } else {
+    e.respondWith(fromNetwork(req).catch(() => cached.then(res => res || offline())));
+  }
+});
+`
+
+func writeServiceWorker(opts Options, pages []*Page) error {
+	scope := swScope(opts)
+	h := sha256.New()
+	var urls []string
+	for _, p := range pages {
+		url := WithBase(opts.BasePath, canonicalPath(p.URL))
+		if len(p.Allow) > 0 || p.Password != "" || !strings.HasPrefix(url+"/", scope) {
+			continue
+		}
+		urls = append(urls, url)
+		h.Write([]byte(url))
+		h.Write([]byte(p.Content))
+	}
+	if len(opts.PWA.Precache) > 0 && opts.AssetsDir != "" {
+		err := filepath.WalkDir(opts.AssetsDir, func(file string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, _ := filepath.Rel(opts.AssetsDir, file)
+			rel = filepath.ToSlash(rel)
+			if strings.HasPrefix(d.Name(), ".") || !excluded(rel, opts.PWA.Precache) {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			urls = append(urls, WithBase(opts.BasePath, "/assets/"+rel))
+			fmt.Fprintf(h, "%s %d %d", rel, info.Size(), info.ModTime().UnixNano())
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if opts.Favicon != "" {
+		for _, icon := range faviconFiles {
+			urls = append(urls, opts.BasePath+"/"+icon.name)
+		}
+	}
+	sort.Strings(urls)
+	precache, _ := json.Marshal(urls)
+	assets, _ := json.Marshal(WithBase(opts.BasePath, "/assets/"))
+	strategy, _ := json.Marshal(opts.PWA.Strategy)
+	js := fmt.Sprintf(serviceWorker, fmt.Sprintf("%x", h.Sum(nil))[:12], precache, assets, strategy)
+	return os.WriteFile(filepath.Join(opts.BuildDir, "sw.js"), []byte(js), 0644)
+}
@@ -0,0 +1,100 @@
+package compiler
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	"github.com/core6quad/GOMD/plugin"
+	"rsc.io/qr"
+)
+
+// Error correction levels by name, higher ones survive more damage but
+// make denser codes
+var qrLevels = map[string]qr.Level{"L": qr.L, "M": qr.M, "Q": qr.Q, "H": qr.H}
+
+// White modules around the code, scanners need 4
+const qrQuietZone = 4
+
+// {{qr "https://example.com"}} renders a QR code of its argument as an
+// inline SVG, or a PNG with format=png. Options size (pixels, default
+// 200), level (L, M, Q or H, default M), alt and caption. Root-relative
+// URLs are made absolute with SiteURL, a phone has no page to resolve
+// them against
+func qrShortcode(opts Options) plugin.Shortcode {
+	return func(page *plugin.Page, args []string) (string, error) {
+		if len(args) == 0 || strings.Contains(args[0], "=") {
+			return "", errors.New("the first argument must be the text to encode")
+		}
+		text, o := args[0], mediaArgs(args[1:])
+		if strings.HasPrefix(text, "/") && !strings.HasPrefix(text, "//") && opts.SiteURL != "" {
+			text = opts.SiteURL + WithBase(opts.BasePath, text)
+		}
+		level := qr.M
+		if name := o["level"]; name != "" {
+			var ok bool
+			if level, ok = qrLevels[strings.ToUpper(name)]; !ok {
+				return "", fmt.Errorf("level %q is not L, M, Q or H", name)
+			}
+		}
+		size := 200
+		if s := o["size"]; s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n <= 0 {
+				return "", fmt.Errorf("size %q is not a number of pixels", s)
+			}
+			size = n
+		}
+		alt := o["alt"]
+		if alt == "" {
+			alt = "QR code for " + text
+		}
+		code, err := qr.Encode(text, level)
+		if err != nil {
+			return "", err
+		}
+
+		var img string
+		switch o["format"] {
+		case "", "svg":
+			img = qrSVG(code, size, alt)
+		case "png":
+			// Scaled up as a whole, so the modules stay sharp
+			code.Scale = max(1, size/(code.Size+2*qrQuietZone))
+			img = fmt.Sprintf(`<img class="qr" src="data:image/png;base64,%s" width="%d" height="%d" alt="%s" style="image-rendering:pixelated">`,
+				base64.StdEncoding.EncodeToString(code.PNG()), size, size, html.EscapeString(alt))
+		default:
+			return "", fmt.Errorf("format %q is not svg or png", o["format"])
+		}
+		if caption := o["caption"]; caption != "" {
+			return fmt.Sprintf(`<figure class="qr">%s<figcaption>%s</figcaption></figure>`, img, html.EscapeString(caption)), nil
+		}
+		return img, nil
+	}
+}
+
+// The code as an SVG drawn with one path, each row's runs of black
+// modules as rectangles
+func qrSVG(code *qr.Code, size int, alt string) string {
+	var d strings.Builder
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; {
+			if !code.Black(x, y) {
+				x++
+				continue
+			}
+			run := 1
+			for x+run < code.Size && code.Black(x+run, y) {
+				run++
+			}
+			fmt.Fprintf(&d, "M%d %dh%dv1h-%dz", x+qrQuietZone, y+qrQuietZone, run, run)
+			x += run
+		}
+	}
+	side := code.Size + 2*qrQuietZone
+	return fmt.Sprintf(`<svg class="qr" xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %[1]d %[1]d" width="%[2]d" height="%[2]d" role="img" aria-label="%[3]s" shape-rendering="crispEdges"><rect width="%[1]d" height="%[1]d" fill="#fff"/><path d="%[4]s" fill="#000"/></svg>`,
+		side, size, html.EscapeString(alt), d.String())
+}
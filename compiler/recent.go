@@ -0,0 +1,133 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"sort"
+	"time"
+)
+
+var recentList = template.Must(template.New("recent").Parse(`<h1>{{.Title}}</h1>
+<ul class="recent">
+{{range .Pages}}<li><a href="{{.Link}}">{{.Page.Title}}</a> <time datetime="{{.Page.LastModified.Format "2006-01-02T15:04:05Z07:00"}}">{{.Page.LastModified.Format "January 2, 2006"}}</time></li>
+{{end}}</ul>
+`))
+
+// Indexable pages with a known modification date, newest first
+func recentlyUpdated(opts Options, pages []*Page, limit int) []*Page {
+	var recent []*Page
+	for _, p := range pages {
+		if p.LastModified != nil && opts.Indexable(p) {
+			recent = append(recent, p)
+		}
+	}
+	sort.SliceStable(recent, func(i, j int) bool {
+		return recent[i].LastModified.After(*recent[j].LastModified)
+	})
+	if len(recent) > limit {
+		recent = recent[:limit]
+	}
+	return recent
+}
+
+// Generate the "Recently updated" page. It has no source file, and a page
+// of the same URL takes its place
+func recentPage(opts Options, pages []*Page) *Page {
+	cfg := opts.Recent
+	for _, p := range pages {
+		if p.URL == cfg.URL {
+			return nil
+		}
+	}
+	type item struct {
+		Page *Page
+		Link string
+	}
+	var items []item
+	for _, p := range recentlyUpdated(opts, pages, cfg.Limit) {
+		items = append(items, item{p, WithBase(opts.BasePath, canonicalPath(p.URL))})
+	}
+	var buf bytes.Buffer
+	recentList.Execute(&buf, map[string]interface{}{"Title": cfg.Title, "Pages": items})
+	return &Page{
+		URL:         cfg.URL,
+		Title:       cfg.Title,
+		Type:        "page",
+		WordCount:   wordCount(buf.Bytes()),
+		ReadingTime: readingTime(wordCount(buf.Bytes())),
+		Content:     template.HTML(buf.String()),
+	}
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Hubs        []jsonFeedHub  `json:"hubs,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	Title         string           `json:"title"`
+	Summary       string           `json:"summary,omitempty"`
+	DatePublished string           `json:"date_published,omitempty"`
+	DateModified  string           `json:"date_modified"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+	ContentHTML   string           `json:"content_html,omitempty"`
+}
+
+type jsonFeedHub struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+// Write the JSON Feed of recently updated pages next to the page
+func writeRecentFeed(opts Options, pages []*Page, hashes map[string][32]byte) error {
+	cfg := opts.Recent
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       cfg.Title,
+		HomePageURL: opts.AbsURL("/index"),
+		FeedURL:     opts.AbsURL(cfg.URL + ".json"),
+		Items:       []jsonFeedItem{},
+	}
+	for _, hub := range opts.Feeds.Hubs {
+		feed.Hubs = append(feed.Hubs, jsonFeedHub{Type: "WebSub", URL: hub})
+	}
+	for _, p := range recentlyUpdated(opts, pages, cfg.Limit) {
+		feed.Items = append(feed.Items, jsonItem(opts, p))
+	}
+	out, err := json.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFeedFile(opts, cfg.URL+".json", append(out, '\n'), hashes)
+}
+
+// A JSON Feed item for a page with a LastModified date
+func jsonItem(opts Options, p *Page) jsonFeedItem {
+	it := jsonFeedItem{
+		ID:           opts.AbsURL(p.URL),
+		URL:          opts.AbsURL(p.URL),
+		Title:        p.Title,
+		Summary:      p.Description,
+		DateModified: p.LastModified.Format(time.RFC3339),
+		Tags:         p.Tags,
+	}
+	if p.Date != nil {
+		it.DatePublished = p.Date.Format(time.RFC3339)
+	}
+	for _, a := range p.Authors {
+		it.Authors = append(it.Authors, jsonFeedAuthor{a})
+	}
+	return it
+}
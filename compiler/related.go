@@ -0,0 +1,107 @@
+package compiler
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// How many related pages each page gets
+const maxRelated = 5
+
+// Fill in Page.Related: pages sharing the most tags come first, ties
+// and untagged pages are ranked by TF-IDF similarity of their text.
+// Only searchable pages are suggested, so no link gives away a
+// restricted or noindex page
+func relatePages(pages []*Page) {
+	vectors := tfidf(pages)
+	for i, p := range pages {
+		type candidate struct {
+			page  *Page
+			tags  int
+			score float64
+		}
+		var cands []candidate
+		for j, q := range pages {
+			if i == j || !q.Searchable() {
+				continue
+			}
+			c := candidate{page: q, tags: sharedTags(p.Tags, q.Tags), score: cosine(vectors[i], vectors[j])}
+			if c.tags > 0 || c.score > 0 {
+				cands = append(cands, c)
+			}
+		}
+		sort.SliceStable(cands, func(a, b int) bool {
+			if cands[a].tags != cands[b].tags {
+				return cands[a].tags > cands[b].tags
+			}
+			return cands[a].score > cands[b].score
+		})
+		p.Related = nil
+		for k := 0; k < len(cands) && k < maxRelated; k++ {
+			p.Related = append(p.Related, cands[k].page)
+		}
+	}
+}
+
+func sharedTags(a, b []string) int {
+	n := 0
+	for _, x := range a {
+		for _, y := range b {
+			if strings.EqualFold(x, y) {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
+
+// Build normalized TF-IDF vectors from the text of each page
+func tfidf(pages []*Page) []map[string]float64 {
+	terms := make([]map[string]float64, len(pages))
+	docFreq := make(map[string]int)
+	for i, p := range pages {
+		text := tagRe.ReplaceAllString(string(p.Content), " ")
+		terms[i] = make(map[string]float64)
+		for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			// Short words are mostly noise
+			if len([]rune(w)) < 3 {
+				continue
+			}
+			if terms[i][w] == 0 {
+				docFreq[w]++
+			}
+			terms[i][w]++
+		}
+	}
+	n := float64(len(pages))
+	for _, v := range terms {
+		var norm float64
+		for w, tf := range v {
+			v[w] = tf * math.Log(n/float64(docFreq[w]))
+			norm += v[w] * v[w]
+		}
+		norm = math.Sqrt(norm)
+		for w := range v {
+			if norm > 0 {
+				v[w] /= norm
+			}
+		}
+	}
+	return terms
+}
+
+func cosine(a, b map[string]float64) float64 {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+	var dot float64
+	for w, x := range a {
+		dot += x * b[w]
+	}
+	return dot
+}
@@ -0,0 +1,28 @@
+package compiler
+
+import "testing"
+
+func TestRelatedSkipsHiddenPages(t *testing.T) {
+	page := func(url string, tags ...string) *Page {
+		return &Page{URL: url, Tags: tags, Content: "shared words about gardening tomatoes"}
+	}
+	public := page("/public", "garden")
+	team := page("/team", "garden")
+	team.Allow = []string{"role:editor"}
+	draft := page("/draft", "garden")
+	draft.Password = "hunter2"
+	hidden := page("/hidden", "garden")
+	hidden.NoIndex = true
+	other := page("/other", "garden")
+	relatePages([]*Page{public, team, draft, hidden, other})
+	for _, p := range []*Page{public, team, draft, hidden, other} {
+		for _, r := range p.Related {
+			if !r.Searchable() {
+				t.Errorf("%s lists the hidden page %s as related", p.URL, r.URL)
+			}
+		}
+	}
+	if len(public.Related) != 1 || public.Related[0] != other {
+		t.Errorf("/public has %d related pages, want only /other", len(public.Related))
+	}
+}
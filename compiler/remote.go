@@ -0,0 +1,182 @@
+package compiler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/core6quad/GOMD/plugin"
+)
+
+// The largest remote JSON document fetched
+const maxRemoteSize = 5 << 20
+
+// RemoteData fetches JSON for templates and the remote shortcode at build
+// time, cached in a directory for TTL. When a refresh fails the stale copy
+// is used. A nil RemoteData fetches nothing
+type RemoteData struct {
+	dir    string
+	ttl    time.Duration
+	client *http.Client
+
+	mu      sync.Mutex
+	fetched map[string]interface{}
+	// Documents read, for the build cache to leave pages using them out
+	reads int
+}
+
+// NewRemoteData caches documents in dir
+func NewRemoteData(dir string, ttl, timeout time.Duration) *RemoteData {
+	return &RemoteData{dir: dir, ttl: ttl, client: &http.Client{Timeout: timeout}, fetched: make(map[string]interface{})}
+}
+
+// Get returns the decoded JSON document at a URL
+func (d *RemoteData) Get(url string) (interface{}, error) {
+	if d == nil {
+		return nil, fmt.Errorf("remote data is off")
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.reads++
+	if v, ok := d.fetched[url]; ok {
+		return v, nil
+	}
+	sum := sha256.Sum256([]byte(url))
+	file := filepath.Join(d.dir, hex.EncodeToString(sum[:])+".json")
+	data, err := os.ReadFile(file)
+	fi, statErr := os.Stat(file)
+	if err != nil || statErr != nil || time.Since(fi.ModTime()) > d.ttl {
+		fresh, ferr := d.fetch(url)
+		switch {
+		case ferr == nil:
+			data = fresh
+			if err := os.MkdirAll(d.dir, 0755); err == nil {
+				os.WriteFile(file, data, 0644)
+			}
+		case err == nil:
+			slog.Warn("remote data: refresh failed, using the cached copy", "url", url, "err", ferr)
+		default:
+			return nil, ferr
+		}
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("%s: %w", url, err)
+	}
+	d.fetched[url] = v
+	return v, nil
+}
+
+func (d *RemoteData) fetch(url string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteSize))
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("%s: not JSON", url)
+	}
+	return data, nil
+}
+
+// How many documents were read so far
+func (d *RemoteData) readCount() int {
+	if d == nil {
+		return 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.reads
+}
+
+// Follow a dotted path like "assets.0.name" into a JSON document
+func jsonPath(v interface{}, path string) (interface{}, error) {
+	if path == "" {
+		return v, nil
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = t[key]; !ok {
+				return nil, fmt.Errorf("no %q in %s", key, path)
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(t) {
+				return nil, fmt.Errorf("no index %q in %s", key, path)
+			}
+			v = t[i]
+		default:
+			return nil, fmt.Errorf("%s: can't look up %q", path, key)
+		}
+	}
+	return v, nil
+}
+
+// {{remote "https://api.github.com/repos/owner/repo" "stargazers_count"}}
+// puts a value of a remote JSON document into the page
+func remoteShortcode(opts Options) plugin.Shortcode {
+	return func(page *plugin.Page, args []string) (string, error) {
+		if len(args) < 1 || len(args) > 2 {
+			return "", fmt.Errorf("want a URL and a path, e.g. {{remote \"https://...\" \"tag_name\"}}")
+		}
+		doc, err := opts.Remote.Get(args[0])
+		if err != nil {
+			return "", err
+		}
+		path := ""
+		if len(args) == 2 {
+			path = args[1]
+		}
+		v, err := jsonPath(doc, path)
+		if err != nil {
+			return "", err
+		}
+		switch t := v.(type) {
+		case string:
+			return markdownText(t), nil
+		case float64:
+			return strconv.FormatFloat(t, 'f', -1, 64), nil
+		case nil:
+			return "", nil
+		}
+		b, _ := json.Marshal(v)
+		return markdownText(string(b)), nil
+	}
+}
+
+// Backslash-escape text for markdown, so it shows as written instead of
+// turning into markup or HTML
+func markdownText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune("\\`*_{}[]()#+-.!:|&<>~", r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
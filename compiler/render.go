@@ -0,0 +1,144 @@
+package compiler
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+// Render markdown to HTML with the configured extensions
+func renderHTML(markdown []byte, opts Options) []byte {
+	md := opts.Markdown
+	ext := blackfriday.CommonExtensions
+	flags := blackfriday.UseXHTML
+	toggle := func(b *bool, def bool, e blackfriday.Extensions) {
+		if on(b, def) {
+			ext |= e
+		} else {
+			ext &^= e
+		}
+	}
+	toggle(md.Tables, true, blackfriday.Tables)
+	toggle(md.Strikethrough, true, blackfriday.Strikethrough)
+	toggle(md.Autolink, true, blackfriday.Autolink)
+	// Footnote styles need footnotes
+	toggle(md.Footnotes, md.FootnoteStyle != "", blackfriday.Footnotes)
+	toggle(md.HardLineBreaks, false, blackfriday.HardLineBreak)
+	if on(md.Smartypants, false) {
+		flags |= blackfriday.Smartypants | blackfriday.SmartypantsFractions |
+			blackfriday.SmartypantsDashes | blackfriday.SmartypantsLatexDashes
+	}
+	if on(md.Footnotes, false) && md.FootnoteStyle == "" {
+		flags |= blackfriday.FootnoteReturnLinks
+	}
+	r := &htmlRenderer{
+		HTMLRenderer: blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{
+			Flags: flags,
+		}),
+		base:      opts.BasePath,
+		taskLists: on(md.TaskLists, false),
+		footnotes: md.FootnoteStyle,
+	}
+	return blackfriday.Run(markdown, blackfriday.WithExtensions(ext), blackfriday.WithRenderer(r))
+}
+
+// Helper to read an optional config toggle
+func on(b *bool, def bool) bool {
+	if b == nil {
+		return def
+	}
+	return *b
+}
+
+// htmlRenderer adds the base path to root-relative URLs, so /page and
+// /assets/x.png become /base/page and /base/assets/x.png (protocol-relative
+// //host URLs are left alone), renders "- [ ] todo" items as checkboxes
+// and footnotes as popovers or sidenotes
+type htmlRenderer struct {
+	*blackfriday.HTMLRenderer
+	base      string
+	taskLists bool
+	// FootnotePopover, FootnoteSidenote or "" for the list at the end
+	footnotes string
+	// Notes rendered so far, for their ids
+	notes int
+}
+
+func (r *htmlRenderer) RenderNode(w io.Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	if entering && (node.Type == blackfriday.Link || node.Type == blackfriday.Image) {
+		node.LinkData.Destination = []byte(WithBase(r.base, string(node.LinkData.Destination)))
+	}
+	// Block-level HTML blackfriday doesn't know, like <details>, ends up
+	// in a paragraph, which browsers have to repair
+	if node.Type == blackfriday.Paragraph && startsWithBlockTag(node) {
+		io.WriteString(w, "\n")
+		return blackfriday.GoToNext
+	}
+	if r.footnotes != "" {
+		switch {
+		case node.Type == blackfriday.Link && node.NoteID != 0:
+			if entering {
+				r.renderNote(w, node)
+			}
+			return blackfriday.SkipChildren
+		case node.Type == blackfriday.List && node.IsFootnotesList:
+			// Every note is already next to its reference
+			return blackfriday.SkipChildren
+		}
+	}
+	if entering && r.taskLists && node.Type == blackfriday.Text && isFirstInItem(node) {
+		for prefix, box := range map[string]string{
+			"[ ] ": `<input type="checkbox" disabled> `,
+			"[x] ": `<input type="checkbox" checked disabled> `,
+			"[X] ": `<input type="checkbox" checked disabled> `,
+		} {
+			if bytes.HasPrefix(node.Literal, []byte(prefix)) {
+				io.WriteString(w, box)
+				node.Literal = node.Literal[len(prefix):]
+				break
+			}
+		}
+	}
+	return r.HTMLRenderer.RenderNode(w, node, entering)
+}
+
+var htmlTagNameRe = regexp.MustCompile(`^</?([a-zA-Z][a-zA-Z0-9]*)`)
+
+func startsWithBlockTag(p *blackfriday.Node) bool {
+	first := p.FirstChild
+	for first != nil && first.Type == blackfriday.Text && len(first.Literal) == 0 {
+		first = first.Next
+	}
+	if first == nil || first.Type != blackfriday.HTMLSpan {
+		return false
+	}
+	m := htmlTagNameRe.FindSubmatch(first.Literal)
+	return m != nil && (closesP[strings.ToLower(string(m[1]))] || strings.EqualFold(string(m[1]), "summary"))
+}
+
+// Report whether a text node starts a list item, directly for tight
+// lists or inside its first paragraph for loose ones
+func isFirstInItem(node *blackfriday.Node) bool {
+	p := node.Parent
+	if p == nil || p.FirstChild != node {
+		return false
+	}
+	if p.Type == blackfriday.Paragraph {
+		if p.Parent == nil || p.Parent.FirstChild != p {
+			return false
+		}
+		p = p.Parent
+	}
+	return p.Type == blackfriday.Item
+}
+
+// WithBase prefixes a root-relative URL with the base path
+func WithBase(base, url string) string {
+	if base == "" || !strings.HasPrefix(url, "/") || strings.HasPrefix(url, "//") {
+		return url
+	}
+	return base + url
+}
@@ -0,0 +1,55 @@
+package compiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/core6quad/GOMD/config"
+)
+
+// Rule is a user-defined regex rewrite applied to page markdown
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	// Replace is expanded like regexp.Expand, $1 or ${name} refer to groups
+	Replace string
+}
+
+// LoadRules compiles the rules from config, followed by those in the
+// rules file if one is set
+func LoadRules(cfg config.Config) ([]Rule, error) {
+	defs := append([]config.Rule(nil), cfg.Rules...)
+	if cfg.RulesFile != "" {
+		data, err := os.ReadFile(cfg.RulesFile)
+		if err != nil {
+			return nil, err
+		}
+		var fileRules []config.Rule
+		if err := json.Unmarshal(data, &fileRules); err != nil {
+			return nil, fmt.Errorf("%s: %w", cfg.RulesFile, err)
+		}
+		defs = append(defs, fileRules...)
+	}
+	rules := make([]Rule, 0, len(defs))
+	for i, d := range defs {
+		re, err := regexp.Compile(d.Pattern)
+		if err != nil {
+			name := d.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
+			}
+			return nil, fmt.Errorf("rule %s: %w", name, err)
+		}
+		rules = append(rules, Rule{Name: d.Name, Pattern: re, Replace: d.Replace})
+	}
+	return rules, nil
+}
+
+func applyRules(input []byte, rules []Rule) []byte {
+	for _, r := range rules {
+		input = r.Pattern.ReplaceAll(input, []byte(r.Replace))
+	}
+	return input
+}
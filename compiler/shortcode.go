@@ -0,0 +1,87 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/core6quad/GOMD/plugin"
+)
+
+// {{name "quoted arg" bare-arg key="quoted value"}}
+var shortcodeRe = regexp.MustCompile(`\{\{\s*([A-Za-z][\w-]*)((?:\s+(?:[\w-]+=)?(?:"(?:[^"\\]|\\.)*"|[^\s"}]+))*)\s*\}\}`)
+
+var shortcodeArgRe = regexp.MustCompile(`(?:[\w-]+=)?"(?:[^"\\]|\\.)*"|[^\s"]+`)
+
+// Expand {{name args}} shortcodes outside code blocks. Tags with unknown
+// names are left untouched, so literal {{ }} in content is safe.
+func expandShortcodes(page *plugin.Page, input []byte, codes map[string]plugin.Shortcode) ([]byte, error) {
+	if len(codes) == 0 {
+		return input, nil
+	}
+	var firstErr error
+	out := outsideCode(input, func(text []byte) []byte {
+		return shortcodeRe.ReplaceAllFunc(text, func(match []byte) []byte {
+			m := shortcodeRe.FindSubmatch(match)
+			fn, ok := codes[string(m[1])]
+			if !ok {
+				return match
+			}
+			html, err := fn(page, parseShortcodeArgs(string(m[2])))
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("shortcode %s: %w", m[1], err)
+				}
+				return match
+			}
+			return []byte(html)
+		})
+	})
+	return out, firstErr
+}
+
+func parseShortcodeArgs(s string) []string {
+	var args []string
+	for _, a := range shortcodeArgRe.FindAllString(s, -1) {
+		// key="value" arrives as key=value
+		key, quoted := "", a
+		if i := strings.Index(a, `="`); i > 0 && !strings.HasPrefix(a, `"`) {
+			key, quoted = a[:i+1], a[i+1:]
+		}
+		if strings.HasPrefix(quoted, `"`) {
+			if u, err := strconv.Unquote(quoted); err == nil {
+				a = key + u
+			}
+		}
+		args = append(args, a)
+	}
+	return args
+}
+
+// Apply fn to the parts of markdown that are not inside fenced code blocks
+func outsideCode(input []byte, fn func([]byte) []byte) []byte {
+	var out, chunk bytes.Buffer
+	fence := ""
+	for _, line := range bytes.SplitAfter(input, []byte("\n")) {
+		trimmed := strings.TrimSpace(string(line))
+		if fence == "" && (strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")) {
+			out.Write(fn(chunk.Bytes()))
+			chunk.Reset()
+			fence = trimmed[:3]
+			out.Write(line)
+			continue
+		}
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			out.Write(line)
+			continue
+		}
+		chunk.Write(line)
+	}
+	out.Write(fn(chunk.Bytes()))
+	return out.Bytes()
+}
@@ -0,0 +1,205 @@
+package compiler
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// NavItem is an entry of a section's sidebar. Items without a URL are
+// headings grouping their Items
+type NavItem struct {
+	Title  string    `json:"title"`
+	URL    string    `json:"url,omitempty"`
+	Active bool      `json:"active,omitempty"` // the page being rendered
+	Items  []NavItem `json:"items,omitempty"`
+}
+
+// Sidebar files, one per section directory
+const (
+	sidebarYAML     = "sidebar.yaml"
+	sidebarMarkdown = "_sidebar.gmd"
+)
+
+// Slash-separated directory of a source path, "." at the top
+func sectionDir(rel string) string {
+	return path.Dir(rel)
+}
+
+func isSidebar(rel string) bool {
+	base := path.Base(rel)
+	return base == sidebarYAML || base == sidebarMarkdown
+}
+
+// SidebarPartial defines the "sidebar" template, the page's sidebar as
+// nested lists:
+//
+//	{{template "sidebar" .}}
+const SidebarPartial = `{{define "sidebar"}}{{with .Page.Sidebar}}<nav class="sidebar">{{template "sidebar-items" .}}</nav>{{end}}{{end}}
+{{define "sidebar-items"}}<ul>
+{{range .}}<li>{{if .URL}}<a href="{{url .URL}}"{{if .Active}} aria-current="page"{{end}}>{{.Title}}</a>{{else}}<span>{{.Title}}</span>{{end}}{{with .Items}}{{template "sidebar-items" .}}{{end}}</li>
+{{end}}</ul>{{end}}`
+
+// An entry of sidebar.yaml: a page path, or a title with a page, URL
+// and/or nested items
+type sidebarEntry struct {
+	Title string
+	Page  string
+	URL   string
+	Items []sidebarEntry
+}
+
+func (e *sidebarEntry) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		e.Page = n.Value
+		return nil
+	}
+	var v struct {
+		Title string         `yaml:"title"`
+		Page  string         `yaml:"page"`
+		URL   string         `yaml:"url"`
+		Items []sidebarEntry `yaml:"items"`
+	}
+	if err := n.Decode(&v); err != nil {
+		return err
+	}
+	*e = sidebarEntry(v)
+	return nil
+}
+
+var sidebarLinkRe = regexp.MustCompile(`^(\s*)[-*+]\s+(?:\[([^\]]*)\]\(([^)\s]+)\)|(.+))$`)
+
+// Parse a docsify style _sidebar.gmd: a nested list of [Title](page)
+// links, plain items are headings
+func parseSidebarMarkdown(data []byte) ([]sidebarEntry, error) {
+	type level struct {
+		indent  int
+		entries *[]sidebarEntry
+	}
+	var root []sidebarEntry
+	stack := []level{{-1, &root}}
+	for i, line := range strings.Split(string(normalizeNewlines(data)), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		m := sidebarLinkRe.FindStringSubmatch(strings.ReplaceAll(line, "\t", "  "))
+		if m == nil {
+			return nil, fmt.Errorf("line %d: expected a list item", i+1)
+		}
+		indent := len(m[1])
+		for len(stack) > 1 && indent <= stack[len(stack)-1].indent {
+			stack = stack[:len(stack)-1]
+		}
+		e := sidebarEntry{Title: strings.TrimSpace(m[2]), Page: m[3]}
+		if m[4] != "" {
+			e.Title = strings.TrimSpace(m[4])
+		}
+		parent := stack[len(stack)-1].entries
+		*parent = append(*parent, e)
+		stack = append(stack, level{indent, &(*parent)[len(*parent)-1].Items})
+	}
+	return root, nil
+}
+
+// Read a sidebar file and resolve its pages, which are relative to the
+// section directory unless they start with a slash
+func loadSidebar(file, dir string, byURL map[string]*Page) ([]NavItem, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var entries []sidebarEntry
+	if strings.HasSuffix(file, ".gmd") {
+		entries, err = parseSidebarMarkdown(data)
+	} else {
+		err = yaml.Unmarshal(data, &entries)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resolveSidebar(entries, dir, byURL)
+}
+
+func resolveSidebar(entries []sidebarEntry, dir string, byURL map[string]*Page) ([]NavItem, error) {
+	var items []NavItem
+	for _, e := range entries {
+		item := NavItem{Title: e.Title, URL: e.URL}
+		if ref := e.Page; ref != "" && !strings.Contains(ref, "://") {
+			ref = strings.TrimSuffix(trimPageExt(ref), ".md")
+			url := path.Clean("/" + dir + "/" + ref)
+			if strings.HasPrefix(ref, "/") {
+				url = path.Clean(ref)
+			}
+			if strings.HasSuffix(ref, "/") || url == "/" {
+				url = strings.TrimSuffix(url, "/") + "/index"
+			}
+			p := byURL[url]
+			if p == nil {
+				return nil, fmt.Errorf("no page %s", url)
+			}
+			item.URL = canonicalPath(p.URL)
+			if item.Title == "" {
+				item.Title = p.Title
+			}
+		} else if ref != "" {
+			item.URL = ref
+		}
+		var err error
+		if item.Items, err = resolveSidebar(e.Items, dir, byURL); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// A copy of a sidebar with the entries of url marked active
+func activeSidebar(items []NavItem, url string) []NavItem {
+	if items == nil {
+		return nil
+	}
+	out := make([]NavItem, len(items))
+	for i, item := range items {
+		item.Active = item.URL == url
+		item.Items = activeSidebar(item.Items, url)
+		out[i] = item
+	}
+	return out
+}
+
+// Give every page the sidebar of its own section, or the closest one
+// above it. sidebars maps slash-separated directories, relative to
+// SrcDir, to their sidebar file
+func sidebarPages(pages []*Page, sidebars map[string]string) error {
+	if len(sidebars) == 0 {
+		return nil
+	}
+	byURL := make(map[string]*Page, len(pages))
+	for _, p := range pages {
+		byURL[p.URL] = p
+	}
+	loaded := make(map[string][]NavItem, len(sidebars))
+	for dir, file := range sidebars {
+		items, err := loadSidebar(file, dir, byURL)
+		if err != nil {
+			return &FileError{Path: file, Err: err}
+		}
+		loaded[dir] = items
+	}
+	for _, p := range pages {
+		for dir := sectionDir(p.Source); ; dir = path.Dir(dir) {
+			if items, ok := loaded[dir]; ok {
+				p.Sidebar = activeSidebar(items, canonicalPath(p.URL))
+				break
+			}
+			if dir == "." || dir == "/" {
+				break
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package compiler
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+)
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemap struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+// Write sitemap.xml into BuildDir, leaving out noindex, restricted and
+// password protected pages and pages whose canonical copy lives elsewhere
+func writeSitemap(opts Options, pages []*Page) error {
+	if opts.SiteURL == "" {
+		return nil
+	}
+	sm := sitemap{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	for _, p := range pages {
+		if !opts.Indexable(p) {
+			continue
+		}
+		u := sitemapURL{Loc: opts.AbsURL(p.URL)}
+		if p.LastModified != nil {
+			u.LastMod = p.LastModified.Format("2006-01-02")
+		}
+		sm.URLs = append(sm.URLs, u)
+	}
+	out, err := xml.MarshalIndent(sm, "", "  ")
+	if err != nil {
+		return err
+	}
+	out = append([]byte(xml.Header), out...)
+	return os.WriteFile(filepath.Join(opts.BuildDir, "sitemap.xml"), append(out, '\n'), 0644)
+}
+
+// Indexable reports whether a page belongs in the sitemap and feeds,
+// restricted and password protected pages never do
+func (opts Options) Indexable(p *Page) bool {
+	if p.NoIndex || len(p.Allow) > 0 || p.Password != "" {
+		return false
+	}
+	return p.Canonical == "" || p.Canonical == opts.AbsURL(p.URL)
+}
+
+// AbsURL turns a page URL into its public URL, absolute when SiteURL is set
+func (opts Options) AbsURL(url string) string {
+	return opts.SiteURL + WithBase(opts.BasePath, canonicalPath(url))
+}
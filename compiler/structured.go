@@ -0,0 +1,68 @@
+package compiler
+
+import (
+	"fmt"
+	"html/template"
+	"time"
+)
+
+// Article/WebPage JSON-LD for the page head, built from front matter
+func pageJSONLD(p *Page, opts Options) template.HTML {
+	schemaType, ok := opts.StructuredData[p.Type]
+	if !ok {
+		schemaType = "WebPage"
+	}
+	if schemaType == "" {
+		return ""
+	}
+	data := map[string]interface{}{
+		"@context": "https://schema.org",
+		"@type":    schemaType,
+		"url":      opts.AbsURL(p.URL),
+	}
+	if schemaType == "WebPage" {
+		data["name"] = p.Title
+	} else {
+		data["headline"] = p.Title
+	}
+	if p.Description != "" {
+		data["description"] = p.Description
+	}
+	if p.Author != "" {
+		data["author"] = map[string]string{"@type": "Person", "name": p.Author}
+	}
+	if p.Date != nil {
+		data["datePublished"] = p.Date.Format(time.RFC3339)
+	}
+	if len(p.Tags) > 0 {
+		data["keywords"] = p.Tags
+	}
+	return jsonLD(data)
+}
+
+// Everything added to the head of a page rendered into a layout
+func headTags(p *Page, opts Options) template.HTML {
+	var head template.HTML
+	canonical := p.Canonical
+	if canonical == "" && opts.SiteURL != "" {
+		canonical = opts.AbsURL(p.URL)
+	}
+	if canonical != "" {
+		head += template.HTML(`<link rel="canonical" href="` + template.HTMLEscapeString(canonical) + "\">\n")
+	}
+	if p.NoIndex {
+		head += "<meta name=\"robots\" content=\"noindex\">\n"
+	}
+	if opts.Feeds.Site {
+		head += template.HTML(fmt.Sprintf(siteFeedLinks, template.HTMLEscapeString(opts.BasePath)))
+	}
+	if opts.Favicon != "" {
+		head += template.HTML(fmt.Sprintf(faviconLinks, template.HTMLEscapeString(opts.BasePath)))
+	}
+	head += pwaHead(opts)
+	head += alternateLinks(p, opts)
+	head += openGraph(p, opts)
+	head += footnoteHead(opts)
+	head += template.HTML(opts.Head)
+	return head + pageJSONLD(p, opts) + breadcrumbJSONLD(p.Breadcrumbs, opts.SiteURL, opts.BasePath)
+}
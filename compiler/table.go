@@ -0,0 +1,244 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/core6quad/GOMD/plugin"
+)
+
+// @table(data/results.csv) on a line of its own, with optional flags and
+// options after the file: @table(data/results.json sortable class=wide)
+var tableRe = regexp.MustCompile(`(?m)^[ \t]*@table\(([^)\n]+)\)[ \t]*$`)
+
+// Replace @table directives outside code blocks with an HTML table of the
+// CSV or JSON file. Paths are relative to the page, or to the source dir
+// (or assets, as /assets/...) when they start with a /
+func expandTables(opts Options, page *plugin.Page, input []byte) ([]byte, error) {
+	if !tableRe.Match(input) {
+		return input, nil
+	}
+	var firstErr error
+	out := outsideCode(input, func(text []byte) []byte {
+		return tableRe.ReplaceAllFunc(text, func(match []byte) []byte {
+			args := parseShortcodeArgs(string(tableRe.FindSubmatch(match)[1]))
+			table, err := dataTable(opts, page, args)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("@table: %w", err)
+				}
+				return match
+			}
+			return []byte(table)
+		})
+	})
+	return out, firstErr
+}
+
+// Renders the table. sortable adds a sortable class to the table and a
+// sort-number or sort-text class to each header, for a sorting script to
+// pick up. class= adds classes of your own
+func dataTable(opts Options, page *plugin.Page, args []string) (string, error) {
+	if len(args) == 0 || strings.Contains(args[0], "=") {
+		return "", errors.New("the first argument must be the file")
+	}
+	file := mediaFile(opts, page, args[0])
+	if file == "" {
+		return "", fmt.Errorf("%s: only local files can be tables", args[0])
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	var header []string
+	var rows [][]string
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".csv":
+		header, rows, err = csvTable(data, ',')
+	case ".tsv":
+		header, rows, err = csvTable(data, '\t')
+	case ".json":
+		header, rows, err = jsonTable(data)
+	default:
+		return "", fmt.Errorf("%s: not a .csv, .tsv or .json file", args[0])
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", args[0], err)
+	}
+	var classes []string
+	sortable := false
+	for _, a := range args[1:] {
+		switch {
+		case a == "sortable":
+			sortable = true
+			classes = append(classes, "sortable")
+		case strings.HasPrefix(a, "class="):
+			classes = append(classes, strings.Fields(strings.TrimPrefix(a, "class="))...)
+		default:
+			return "", fmt.Errorf("unknown option %q", a)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("\n<table")
+	if len(classes) > 0 {
+		b.WriteString(` class="` + html.EscapeString(strings.Join(classes, " ")) + `"`)
+	}
+	b.WriteString(">\n<thead>\n<tr>")
+	for i, h := range header {
+		b.WriteString("<th")
+		if sortable {
+			kind := "text"
+			if numericColumn(rows, i) {
+				kind = "number"
+			}
+			b.WriteString(` class="sort-` + kind + `"`)
+		}
+		b.WriteString(">" + html.EscapeString(h) + "</th>")
+	}
+	b.WriteString("</tr>\n</thead>\n<tbody>\n")
+	for _, row := range rows {
+		b.WriteString("<tr>")
+		for i := range header {
+			cell := ""
+			if i < len(row) {
+				cell = row[i]
+			}
+			b.WriteString("<td>" + html.EscapeString(cell) + "</td>")
+		}
+		b.WriteString("</tr>\n")
+	}
+	b.WriteString("</tbody>\n</table>\n")
+	return b.String(), nil
+}
+
+// The first record is the header
+func csvTable(data []byte, comma rune) ([]string, [][]string, error) {
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	r.Comma = comma
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil, errors.New("empty file")
+	}
+	return records[0], records[1:], nil
+}
+
+// An array of objects, with a column for every key in the order they first
+// appear, or an array of arrays with the header first
+func jsonTable(data []byte) ([]string, [][]string, error) {
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, nil, errors.New("not a JSON array")
+	}
+	if len(items) == 0 {
+		return nil, nil, errors.New("empty array")
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(items[0]), []byte("[")) {
+		var records [][]interface{}
+		if err := json.Unmarshal(data, &records); err != nil {
+			return nil, nil, err
+		}
+		var rows [][]string
+		for _, rec := range records {
+			row := make([]string, len(rec))
+			for i, v := range rec {
+				row[i] = jsonCell(v)
+			}
+			rows = append(rows, row)
+		}
+		return rows[0], rows[1:], nil
+	}
+	var header []string
+	seen := make(map[string]int)
+	var objects []map[string]interface{}
+	for _, item := range items {
+		var obj map[string]interface{}
+		if err := json.Unmarshal(item, &obj); err != nil {
+			return nil, nil, errors.New("items must all be objects or all be arrays")
+		}
+		keys, err := objectKeys(item)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, k := range keys {
+			if _, ok := seen[k]; !ok {
+				seen[k] = len(header)
+				header = append(header, k)
+			}
+		}
+		objects = append(objects, obj)
+	}
+	rows := make([][]string, len(objects))
+	for n, obj := range objects {
+		row := make([]string, len(header))
+		for k, v := range obj {
+			row[seen[k]] = jsonCell(v)
+		}
+		rows[n] = row
+	}
+	return header, rows, nil
+}
+
+// The keys of a JSON object in document order, which a map loses
+func objectKeys(obj []byte) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(obj))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	var keys []string
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, t.(string))
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+func jsonCell(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// A column sorts as numbers when every non-empty cell is one
+func numericColumn(rows [][]string, col int) bool {
+	found := false
+	for _, row := range rows {
+		if col >= len(row) || strings.TrimSpace(row[col]) == "" {
+			continue
+		}
+		if _, err := strconv.ParseFloat(strings.TrimSpace(row[col]), 64); err != nil {
+			return false
+		}
+		found = true
+	}
+	return found
+}
@@ -0,0 +1,194 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Elements without content, never closed
+var voidElements = setOf("area", "base", "br", "col", "embed", "hr", "img", "input", "link", "meta", "source", "track", "wbr")
+
+// Elements whose end tag may be left out
+var optionalEnd = setOf("p", "li", "dt", "dd", "option", "optgroup", "rt", "rp", "tr", "td", "th", "thead", "tbody", "tfoot", "colgroup", "caption", "html", "head", "body")
+
+// Elements that end an open paragraph, so they can't be inside one
+var closesP = setOf("address", "article", "aside", "blockquote", "details", "dialog", "div", "dl", "fieldset", "figcaption", "figure",
+	"footer", "form", "h1", "h2", "h3", "h4", "h5", "h6", "header", "hgroup", "hr", "main", "menu", "nav", "ol", "p", "pre", "section", "table", "ul")
+
+// Where a paragraph can't be looked for past, as browsers do
+var pScope = setOf("html", "table", "td", "th", "caption", "marquee", "object", "applet", "template", "button")
+
+// Start tags that end an open element of the same kind, up to the
+// element listed, like a <li> ending the <li> before it
+var impliedEnd = map[string]struct {
+	ends  []string
+	until []string
+}{
+	"li":     {[]string{"li"}, []string{"ul", "ol", "menu"}},
+	"dt":     {[]string{"dt", "dd"}, []string{"dl"}},
+	"dd":     {[]string{"dt", "dd"}, []string{"dl"}},
+	"tr":     {[]string{"tr", "td", "th"}, []string{"table", "thead", "tbody", "tfoot"}},
+	"td":     {[]string{"td", "th"}, []string{"tr", "table"}},
+	"th":     {[]string{"td", "th"}, []string{"tr", "table"}},
+	"thead":  {[]string{"thead", "tbody", "tfoot", "tr", "td", "th"}, []string{"table"}},
+	"tbody":  {[]string{"thead", "tbody", "tfoot", "tr", "td", "th"}, []string{"table"}},
+	"tfoot":  {[]string{"thead", "tbody", "tfoot", "tr", "td", "th"}, []string{"table"}},
+	"option": {[]string{"option"}, []string{"select", "datalist", "optgroup"}},
+}
+
+// Elements markdown renders to, without attributes
+var markdownTags = setOf("p", "em", "strong", "del", "code", "pre", "blockquote", "ul", "ol", "li", "table", "thead", "tbody", "tr", "th", "td",
+	"h1", "h2", "h3", "h4", "h5", "h6", "hr", "br", "sup")
+
+// Elements that can't contain another one of their kind
+var noNesting = setOf("a", "button", "form", "label")
+
+func setOf(names ...string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, n := range names {
+		set[n] = true
+	}
+	return set
+}
+
+type openTag struct {
+	name string
+	raw  string
+	// In the source, 0 when the tag isn't in it as written
+	line int
+}
+
+// Check compiled HTML for what browsers silently repair into a different
+// page than the one written: elements never closed, end tags without a
+// start tag, closing in the wrong order and invalid nesting. Lines are
+// those of source when the tag can be found in it
+func validateHTML(fragment, source []byte) []string {
+	var problems []string
+	// Each tag is looked for after the last one written the same way
+	next := make(map[string]int)
+	locate := func(raw string) int {
+		i := bytes.Index(source[next[raw]:], []byte(raw))
+		if i < 0 {
+			return 0
+		}
+		i += next[raw]
+		next[raw] = i + len(raw)
+		return bytes.Count(source[:i], []byte("\n")) + 1
+	}
+	where := func(t openTag) string {
+		if t.line > 0 {
+			return fmt.Sprintf("%s on line %d", shortTag(t.raw), t.line)
+		}
+		return shortTag(t.raw)
+	}
+	var stack []openTag
+	// A block closed a paragraph and its </p> is still to come
+	var brokenP []openTag
+	find := func(name string, until map[string]bool) int {
+		for i := len(stack) - 1; i >= 0; i-- {
+			if stack[i].name == name {
+				return i
+			}
+			if until[stack[i].name] {
+				break
+			}
+		}
+		return -1
+	}
+	// Inside svg or math, where <x/> closes x
+	foreign := func() bool {
+		for _, t := range stack {
+			if t.name == "svg" || t.name == "math" {
+				return true
+			}
+		}
+		return false
+	}
+	z := html.NewTokenizer(bytes.NewReader(fragment))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		name, _ := z.TagName()
+		t := openTag{name: string(name), raw: string(z.Raw())}
+		// A plain <p> or </li> is more likely markdown's than the source's
+		if tt != html.TextToken && !(markdownTags[t.name] && strings.Trim(t.raw, "</>") == t.name) {
+			t.line = locate(t.raw)
+		}
+		switch tt {
+		case html.SelfClosingTagToken:
+			if !foreign() && !voidElements[t.name] && t.name != "svg" && t.name != "math" {
+				problems = append(problems, where(t)+" is not closed, /> doesn't close HTML elements")
+			}
+		case html.StartTagToken:
+			if voidElements[t.name] {
+				continue
+			}
+			if foreign() {
+				stack = append(stack, t)
+				continue
+			}
+			if noNesting[t.name] {
+				if i := find(t.name, nil); i >= 0 {
+					problems = append(problems, fmt.Sprintf("%s is inside %s", where(t), where(stack[i])))
+				}
+			}
+			if closesP[t.name] {
+				if i := find("p", pScope); i >= 0 {
+					if t.name != "p" {
+						brokenP = append(brokenP, stack[i], t)
+					}
+					stack = stack[:i]
+				}
+			}
+			if rule, ok := impliedEnd[t.name]; ok {
+				until := setOf(rule.until...)
+				for _, end := range rule.ends {
+					if i := find(end, until); i >= 0 {
+						stack = stack[:i]
+					}
+				}
+			}
+			stack = append(stack, t)
+		case html.EndTagToken:
+			i := find(t.name, nil)
+			if i < 0 {
+				if t.name == "p" && len(brokenP) > 0 {
+					problems = append(problems, fmt.Sprintf("%s can't be inside %s, it ends the paragraph", where(brokenP[1]), where(brokenP[0])))
+					brokenP = brokenP[2:]
+					continue
+				}
+				if voidElements[t.name] {
+					continue
+				}
+				problems = append(problems, fmt.Sprintf("%s has no start tag", where(t)))
+				continue
+			}
+			for _, inner := range stack[i+1:] {
+				if !optionalEnd[inner.name] {
+					problems = append(problems, fmt.Sprintf("%s is not closed before %s", where(inner), where(t)))
+				}
+			}
+			stack = stack[:i]
+		}
+	}
+	for _, t := range stack {
+		if !optionalEnd[t.name] {
+			problems = append(problems, where(t)+" is never closed")
+		}
+	}
+	return problems
+}
+
+// A tag short enough for a message
+func shortTag(raw string) string {
+	raw = strings.Join(strings.Fields(raw), " ")
+	if len(raw) > 60 {
+		return raw[:57] + "...>"
+	}
+	return raw
+}
@@ -0,0 +1,125 @@
+package compiler
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// VersionLink points at a page's counterpart in one version of the docs,
+// or that version's home page when it has none
+type VersionLink struct {
+	Name    string `json:"name"`
+	URL     string `json:"url"`
+	Latest  bool   `json:"latest,omitempty"`
+	Current bool   `json:"current,omitempty"`
+}
+
+// VersionsPartial defines the "versions" template, a switcher between the
+// versions of the current page:
+//
+//	{{template "versions" .}}
+const VersionsPartial = `{{define "versions"}}{{with .Page.Versions}}<select class="versions" aria-label="Version" onchange="location.href=this.value">
+{{range .}}<option value="{{url .URL}}"{{if .Current}} selected{{end}}>{{.Name}}{{if .Latest}} (latest){{end}}</option>
+{{end}}</select>{{end}}{{end}}`
+
+// The version directory a page URL is in, if any
+func pageVersion(opts Options, url string) (version, rest string) {
+	for _, v := range opts.Versions.Dirs {
+		if rest, ok := strings.CutPrefix(url, "/"+v+"/"); ok {
+			return v, rest
+		}
+	}
+	return "", ""
+}
+
+// Fill in Page.Version and Page.Versions, and point pages of older
+// versions at their counterpart in the latest one
+func versionPages(opts Options, pages []*Page) {
+	if len(opts.Versions.Dirs) == 0 {
+		return
+	}
+	byURL := make(map[string]*Page, len(pages))
+	for _, p := range pages {
+		byURL[p.URL] = p
+	}
+	for _, p := range pages {
+		version, rest := pageVersion(opts, p.URL)
+		if version == "" {
+			continue
+		}
+		p.Version = version
+		for _, v := range opts.Versions.Dirs {
+			link := VersionLink{Name: v, URL: "/" + v + "/index", Latest: v == opts.Versions.Latest, Current: v == version}
+			if other := byURL["/"+v+"/"+rest]; other != nil {
+				link.URL = other.URL
+			}
+			p.Versions = append(p.Versions, link)
+		}
+		if version == opts.Versions.Latest || p.Canonical != "" {
+			continue
+		}
+		if latest := byURL["/"+opts.Versions.Latest+"/"+rest]; latest != nil {
+			p.Canonical = opts.AbsURL(latest.URL)
+		}
+	}
+}
+
+// One entry of a search index
+type searchEntry struct {
+	URL         string   `json:"url"`
+	Title       string   `json:"title"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Text        string   `json:"text"`
+}
+
+// Text kept per page in search indexes
+const searchTextLimit = 5000
+
+// Write a search index of pages as JSON to a path relative to BuildDir
+func writeSearchIndex(opts Options, pages []*Page, rel string) error {
+	entries := []searchEntry{}
+	for _, p := range pages {
+		if !p.Searchable() {
+			continue
+		}
+		text := p.Text()
+		if len(text) > searchTextLimit {
+			text = strings.ToValidUTF8(text[:searchTextLimit], "")
+		}
+		entries = append(entries, searchEntry{
+			URL:         WithBase(opts.BasePath, canonicalPath(p.URL)),
+			Title:       p.Title,
+			Description: p.Description,
+			Tags:        p.Tags,
+			Text:        text,
+		})
+	}
+	out, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(opts.BuildDir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, out, 0644)
+}
+
+// Write <version>/search.json for every version, with only its own pages
+func writeVersionSearch(opts Options, pages []*Page) error {
+	for _, v := range opts.Versions.Dirs {
+		var own []*Page
+		for _, p := range pages {
+			if p.Version == v {
+				own = append(own, p)
+			}
+		}
+		if err := writeSearchIndex(opts, own, v+"/search.json"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// FileError is a problem with a single source file or directory
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	if errors.Is(e.Err, fs.ErrPermission) {
+		return fmt.Sprintf("%s: permission denied, check the file's permissions (on macOS, that the terminal has access to this folder)", e.Path)
+	}
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e *FileError) Unwrap() error { return e.Err }
+
+// walkFunc is called for every file and directory below the root, with its
+// slash-separated path relative to the root. Returning filepath.SkipDir
+// for a directory skips it.
+type walkFunc func(path, rel string, isDir bool) error
+
+// walkSource walks root in lexical order like filepath.WalkDir, but
+// follows symlinks when asked to (refusing to loop into an ancestor), and
+// keeps going past unreadable entries. Their errors are joined and
+// returned at the end, so every broken file is reported at once.
+func walkSource(root string, followSymlinks bool, fn walkFunc) error {
+	w := &walker{follow: followSymlinks, fn: fn}
+	real, err := realPath(root)
+	if err != nil {
+		return &FileError{Path: root, Err: err}
+	}
+	if err := w.walkDir(root, "", []string{real}); err != nil {
+		return err
+	}
+	return errors.Join(w.errs...)
+}
+
+type walker struct {
+	follow bool
+	fn     walkFunc
+	errs   []error
+}
+
+func (w *walker) walkDir(dir, rel string, ancestors []string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		w.errs = append(w.errs, &FileError{Path: dir, Err: err})
+		return nil
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		childRel := e.Name()
+		if rel != "" {
+			childRel = rel + "/" + e.Name()
+		}
+		isDir := e.IsDir()
+		childAncestors := ancestors
+		if e.Type()&fs.ModeSymlink != 0 {
+			if !w.follow {
+				slog.Warn("skipping symlink, run with --follow-symlinks to include it", "path", path)
+				continue
+			}
+			target, err := realPath(path)
+			if err != nil {
+				w.errs = append(w.errs, &FileError{Path: path, Err: err})
+				continue
+			}
+			fi, err := os.Stat(target)
+			if err != nil {
+				w.errs = append(w.errs, &FileError{Path: path, Err: err})
+				continue
+			}
+			isDir = fi.IsDir()
+			if isDir {
+				if contains(ancestors, target) {
+					slog.Warn("skipping symlink loop", "path", path, "target", target)
+					continue
+				}
+				childAncestors = append(append([]string(nil), ancestors...), target)
+			}
+		} else if isDir {
+			if real, err := realPath(path); err == nil {
+				childAncestors = append(append([]string(nil), ancestors...), real)
+			}
+		}
+
+		err := w.fn(path, childRel, isDir)
+		if isDir {
+			if err == filepath.SkipDir {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := w.walkDir(path, childRel, childAncestors); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			var fe *FileError
+			if errors.As(err, &fe) || errors.Is(err, fs.ErrPermission) {
+				w.errs = append(w.errs, &FileError{Path: path, Err: err})
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Absolute path with all symlinks resolved
+func realPath(path string) (string, error) {
+	p, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(p)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
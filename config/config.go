@@ -0,0 +1,716 @@
+// Package config loads GOMD's config.json.
+package config
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Config is the contents of config.json
+type Config struct {
+	Port          string    `json:"port"`
+	AnalyticsUser string    `json:"analytics_user"` // signs in as an admin account
+	AnalyticsPass string    `json:"analytics_pass"`
+	ResetDB       bool      `json:"resetdb"`
+	Beacon        bool      `json:"beacon"`
+	Webhooks      []Webhook `json:"webhooks"`
+	LogLevel      string    `json:"log_level"`  // debug, info (default), warn or error
+	LogFormat     string    `json:"log_format"` // text (default) or json
+	Quiet         bool      `json:"quiet"`      // only log errors
+	Compression   bool      `json:"compression"`
+	RateLimit     float64   `json:"rate_limit"` // requests per second per IP, 0 disables
+	RateBurst     int       `json:"rate_burst"`
+
+	// Public origin of the site, e.g. "https://example.com", for absolute
+	// URLs in structured data and sitemap.xml
+	SiteURL string `json:"site_url"`
+	// Name of the site, e.g. as the search engine browsers offer for it.
+	// Defaults to the host of SiteURL
+	SiteName string `json:"site_name"`
+	// schema.org type of the JSON-LD added to each page type (the "type"
+	// front matter key, "page" by default). Unknown types get WebPage, an
+	// empty string disables it
+	StructuredData map[string]string `json:"structured_data"`
+	// Tell search engines about changed pages after a rebuild, needs SiteURL
+	SearchPing SearchPingConfig `json:"search_ping"`
+	// CDN caches cleared after rebuilds
+	CDNPurge []CDNPurge `json:"cdn_purge"`
+	// Versioned docs kept side by side in the source dir
+	Versions VersionsConfig `json:"versions"`
+	// RSS, Atom and JSON feeds of the site, tags and sections, off by default
+	Feeds FeedsConfig `json:"feeds"`
+	// Generated "Recently updated" page and JSON Feed, off by default
+	Recent RecentConfig `json:"recent"`
+	// /llms.txt and /llms-full.txt for AI assistants, off by default
+	LLMs LLMsConfig `json:"llms"`
+	// Repository the source dir lives in, for "Edit this page" links, e.g.
+	// "https://github.com/you/site". RepoDir is the source dir's path in
+	// it, "." for the root
+	RepoURL    string `json:"repo_url"`
+	RepoBranch string `json:"repo_branch"` // default "main"
+	RepoDir    string `json:"repo_dir"`    // default SrcDir
+	// Serve a 503 page to visitors instead of the site. Can also be
+	// switched in the admin UI, or by adding maintenance.gmd to the source dir
+	Maintenance bool `json:"maintenance"`
+	// IPs and CIDR ranges that still see the site during maintenance
+	MaintenanceAllow []string `json:"maintenance_allow"`
+	// URL prefix the site is served under behind a proxy, e.g. "/docs".
+	// Applied to generated links and asset URLs
+	BasePath string `json:"base_path"`
+
+	// Extra extension to MIME type mappings for assets, e.g. ".avif": "image/avif"
+	MIMETypes map[string]string `json:"mime_types"`
+	// Charset added to text assets served without one, default "utf-8"
+	DefaultCharset string `json:"default_charset"`
+	// Extra response headers for paths matching a pattern, in order
+	Headers []HeaderRule `json:"headers"`
+	// Cross-origin access to the JSON APIs (/api/ and /analytics/api)
+	CORS CORSConfig `json:"cors"`
+	// Directory listings and dotfiles (.git, .env...) are hidden by default
+	AssetListing  bool `json:"asset_listing"`
+	ServeDotfiles bool `json:"serve_dotfiles"`
+	// Profiles and execution traces at /debug/pprof/, for admins only
+	Pprof bool `json:"pprof"`
+	// The source dir over WebDAV at /dav/, for editors, to mount it as a
+	// network drive
+	WebDAV bool `json:"webdav"`
+
+	// Memory limits for the in-memory analytics caches
+	Cache CacheConfig `json:"cache"`
+
+	// How long JSON fetched by getJSON and the remote shortcode is
+	// reused, and how long fetching it may take
+	RemoteData RemoteDataConfig `json:"remote_data"`
+	// Keep compiled pages in data_dir/build-cache, so restarts only
+	// recompile the pages that changed
+	BuildCache bool `json:"build_cache"`
+
+	// Glob patterns of files in the source dir that are not published, **
+	// matching any number of dirs. A .gomdignore in the source dir adds
+	// more in .gitignore syntax
+	Exclude []string `json:"exclude"`
+	// Include symlinked files and directories from the source dir
+	FollowSymlinks bool `json:"follow_symlinks"`
+
+	// Self-hosted comments, moderated in the admin UI
+	Comments bool `json:"comments"`
+	// How commenters sign in instead of posting under any name, anonymous
+	// comments unless a provider is set
+	CommentSignIn CommentSignInConfig `json:"comment_signin"`
+	// Checks comments and form submissions go through, dropping spam
+	Spam SpamConfig `json:"spam"`
+	// Form endpoints at /forms/<name>, e.g. for a contact form
+	Forms []Form `json:"forms"`
+	// Newsletter signups at /subscribe, confirmed by email
+	Newsletter bool `json:"newsletter"`
+	// Receive Webmentions at /webmention, moderated like comments, and
+	// send them for links in new and changed pages (needs SiteURL)
+	Webmention bool `json:"webmention"`
+	// A fediverse account posting new pages, off unless User is set
+	ActivityPub ActivityPubConfig `json:"activitypub"`
+	// Outgoing mail server for form submissions and newsletter confirmations
+	SMTP SMTPConfig `json:"smtp"`
+
+	// Convert :rocket: style emoji shortcodes to Unicode
+	Emoji bool `json:"emoji"`
+	// Other formats of every public page next to its HTML, "md" and
+	// "txt": /docs/intro.md and /docs/intro.txt, also served for
+	// Accept: text/markdown or text/plain
+	OutputFormats []string `json:"output_formats"`
+	// Image the favicon, touch icons and web app manifest are made from,
+	// e.g. "assets/logo.png". Square and at least 512px works best
+	Favicon string `json:"favicon"`
+	// Installable web app, with a service worker for offline reading
+	PWA PWAConfig `json:"pwa"`
+	// Social preview cards rendered for every public page, for og:image
+	OGImages OGImagesConfig `json:"og_images"`
+	// Formats the video and audio shortcodes create from embedded files
+	Media MediaConfig `json:"media"`
+	// Minify compiled pages and the CSS, JS and SVG served and published
+	Minify MinifyConfig `json:"minify"`
+	// Compile .scss stylesheets in the source and assets dirs to CSS
+	Sass SassConfig `json:"sass"`
+	// AsciiDoc and reStructuredText pages, "adoc" and "rst" mapped to the
+	// command converting them to HTML, "" for asciidoctor and pandoc
+	Formats map[string]string `json:"formats"`
+	// JS/TS entry points bundled into hashed files with esbuild
+	Bundle BundleConfig `json:"bundle"`
+	// Inline the CSS the top of each page needs, load the rest later
+	CriticalCSS CriticalCSSConfig `json:"critical_css"`
+	// Subresource integrity for scripts and stylesheets from other sites
+	SRI SRIConfig `json:"sri"`
+	// Markdown extensions, to match GitHub rendering or stay closer to
+	// plain CommonMark
+	Markdown MarkdownConfig `json:"markdown"`
+	// Heading levels of page content, and checks for them
+	Headings HeadingsConfig `json:"headings"`
+	// Fail the build for pages whose HTML browsers would have to repair,
+	// like an unclosed <div> from raw HTML in markdown
+	ValidateHTML bool `json:"validate_html"`
+	// Content checks of `gomd lint`
+	Lint LintConfig `json:"lint"`
+
+	// Regex rewrites applied to markdown after the built-in GMD syntax,
+	// in order: first Rules, then the JSON list in RulesFile
+	Rules     []Rule `json:"rules"`
+	RulesFile string `json:"rules_file"`
+
+	// External commands that transform pages during the build
+	ExecPlugins []ExecPlugin `json:"exec_plugins"`
+	// WebAssembly plugins, loaded from PluginsDir
+	WasmPlugins []WasmPlugin `json:"wasm_plugins"`
+
+	// Remote copy of SrcDir, synced at startup and on POST /hooks/content
+	Source SourceConfig `json:"source"`
+	// Poll the source dir this often, a Go duration like "2s", and rebuild
+	// once a change has settled, for content copied in with rsync or scp
+	// or a new dir renamed into place. Off by default
+	WatchSource string `json:"watch_source"`
+	// Where `gomd publish` uploads the static site
+	Publish []PublishTarget `json:"publish"`
+
+	// Directories and files, relative to the working directory
+	SrcDir      string `json:"src_dir"`      // default "web"
+	BuildDir    string `json:"build_dir"`    // default ".built"
+	AssetsDir   string `json:"assets_dir"`   // default "assets"
+	AnalyticsDB string `json:"analytics_db"` // default ".analytics.db"
+	PluginsDir  string `json:"plugins_dir"`  // default "plugins"
+	// Holds page.html, the layout pages are rendered into when present
+	TemplatesDir string `json:"templates_dir"` // default "templates"
+	// Comments, form submissions and other data written at runtime
+	DataDir string `json:"data_dir"` // default ".data"
+	// Admin accounts managed with `gomd user`, default data_dir/users.json
+	UsersFile string `json:"users_file"`
+	// How long an admin login lasts, Go duration, default "12h"
+	SessionLifetime string `json:"session_lifetime"`
+}
+
+// Webhook is a notification target fired on traffic and build events.
+// Type is "slack", "discord" or "json" (default). Events lists which of
+// "rebuild", "views_today" and "new_country" to send; empty means all.
+// Template, if set, is a text/template for the message (or the whole
+// body for "json" hooks).
+type Webhook struct {
+	URL       string   `json:"url"`
+	Type      string   `json:"type"`
+	Events    []string `json:"events"`
+	Threshold int      `json:"threshold"`
+	Template  string   `json:"template"`
+}
+
+// Form accepts POSTs at /forms/<name>. Submissions are saved to
+// data_dir/forms/<name>.jsonl when Store is set, and/or forwarded by email
+// and webhook
+type Form struct {
+	Name string `json:"name"`
+	// Fields to keep, all non-empty fields when left out
+	Fields  []string `json:"fields"`
+	Store   bool     `json:"store"`
+	Email   []string `json:"email"`
+	Webhook *Webhook `json:"webhook"`
+	// Where browsers are sent after submitting, the referring page by default
+	Redirect string `json:"redirect"`
+	// Hidden field that must stay empty, bots filling it are ignored.
+	// Default "_gotcha"
+	Honeypot string `json:"honeypot"`
+}
+
+// SMTPConfig is the mail server used to send email
+type SMTPConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"` // default 587, 465 uses implicit TLS
+	Username string `json:"username"`
+	Password string `json:"password"`
+	From     string `json:"from"`
+}
+
+// SourceConfig is where the source dir is synced from. Type is "git" (URL
+// and Branch), "s3" or "gcs" (Bucket, Prefix, Region, AccessKey,
+// SecretKey, and URL for S3-compatible endpoints) or "webdav" (URL,
+// Username, Password). The sync hook needs WebhookSecret, as a bearer
+// token or a GitHub/GitLab webhook secret
+type SourceConfig struct {
+	Type          string `json:"type"`
+	URL           string `json:"url"`
+	Branch        string `json:"branch"`
+	Bucket        string `json:"bucket"`
+	Prefix        string `json:"prefix"`
+	Region        string `json:"region"`
+	AccessKey     string `json:"access_key"`
+	SecretKey     string `json:"secret_key"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	WebhookSecret string `json:"webhook_secret"`
+}
+
+// PublishTarget is a static host for `gomd publish`. Type is "s3" or
+// "gcs" (Bucket, Prefix, Region, AccessKey, SecretKey, and URL for
+// S3-compatible endpoints), "sftp" or "rsync" (Destination, e.g.
+// "user@host:/var/www/site"). Delete removes remote files that are no
+// longer part of the site, except over sftp
+type PublishTarget struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	URL         string `json:"url"`
+	Bucket      string `json:"bucket"`
+	Prefix      string `json:"prefix"`
+	Region      string `json:"region"`
+	AccessKey   string `json:"access_key"`
+	SecretKey   string `json:"secret_key"`
+	Destination string `json:"destination"`
+	Delete      bool   `json:"delete"`
+	// Cache-Control sent with pages (default "no-cache") and with
+	// everything else (default "public, max-age=86400"), for S3 and GCS
+	HTMLCacheControl  string `json:"html_cache_control"`
+	AssetCacheControl string `json:"asset_cache_control"`
+}
+
+// SearchPingConfig lists the search engines notified of changed pages.
+// Sitemap endpoints get the sitemap URL appended, IndexNow gets the
+// changed URLs and verifies the key served at /<key>.txt
+type SearchPingConfig struct {
+	Sitemap          []string `json:"sitemap"`
+	IndexNowKey      string   `json:"indexnow_key"`
+	IndexNowEndpoint string   `json:"indexnow_endpoint"` // default api.indexnow.org
+}
+
+// VersionsConfig lists the top-level directories of the source dir that
+// each hold one version of the docs, e.g. ["v2", "v1"]. Pages of older
+// versions point their canonical link at the same page in Latest
+type VersionsConfig struct {
+	Dirs   []string `json:"dirs"`   // newest first
+	Latest string   `json:"latest"` // default the first of Dirs
+}
+
+// CommentSignInConfig turns on signing in with your own website
+// (IndieAuth) and with a GitHub OAuth app, whose callback URL is
+// <site_url>/commenter/callback
+type CommentSignInConfig struct {
+	IndieAuth          bool   `json:"indieauth"`
+	GitHubClientID     string `json:"github_client_id"`
+	GitHubClientSecret string `json:"github_client_secret"`
+}
+
+// SpamConfig turns on spam checks, run in this order: Blocklist regexps
+// matched case insensitively against every field, an Akismet-compatible
+// service when AkismetKey is set, and a naive Bayes filter learning from
+// the comments approved and marked as spam in the admin UI
+type SpamConfig struct {
+	Blocklist  []string `json:"blocklist"`
+	AkismetKey string   `json:"akismet_key"`
+	AkismetURL string   `json:"akismet_url"` // default https://rest.akismet.com
+	Bayes      bool     `json:"bayes"`
+}
+
+// PWAConfig makes the site an installable web app, named Name (default
+// SiteName), with its icons from Favicon. ServiceWorker adds /sw.js,
+// which caches every public page and the assets matching Precache (glob
+// patterns like "*.css") so the site can be read offline
+type PWAConfig struct {
+	Enabled         bool   `json:"enabled"`
+	Name            string `json:"name"`
+	ShortName       string `json:"short_name"`
+	ThemeColor      string `json:"theme_color"`
+	BackgroundColor string `json:"background_color"`
+	Display         string `json:"display"` // default "standalone"
+	// URL prefix the app and service worker cover, default the whole site
+	Scope         string   `json:"scope"`
+	ServiceWorker bool     `json:"service_worker"`
+	Precache      []string `json:"precache"`
+	// "network-first" (default) shows fresh pages when online,
+	// "cache-first" and "stale-while-revalidate" answer from the cache
+	Strategy string `json:"strategy"`
+}
+
+// OGImagesConfig renders a 1200x630 PNG card for every public page at
+// build time, /og/docs/intro.png, with the page's title and the site name
+// in Color (default "#ffffff") on Background (default "#1f2937") or on
+// Template, an image scaled to cover the card. Logo (default Favicon) goes
+// in the bottom right corner, Font is a TTF or OTF file for the text
+// (default Go Bold). The card is the page's og:image, unless its front
+// matter has an image
+type OGImagesConfig struct {
+	Enabled    bool   `json:"enabled"`
+	Background string `json:"background"`
+	Color      string `json:"color"`
+	Template   string `json:"template"`
+	Logo       string `json:"logo"`
+	Font       string `json:"font"`
+}
+
+// MediaConfig maps a format to the command creating it from a video or
+// audio file embedded with a shortcode, e.g.
+// {"webm": "ffmpeg -y -i {in} -c:v libvpx-vp9 {out}"}. Commands run at
+// build time, for files whose format is missing or older than the file
+type MediaConfig struct {
+	Transcode map[string]string `json:"transcode"`
+}
+
+// MinifyConfig turns on minification of pages, static files and assets.
+// Exclude are glob patterns of files left as they are, e.g. "vendor/*"
+type MinifyConfig struct {
+	Enabled bool     `json:"enabled"`
+	Exclude []string `json:"exclude"`
+}
+
+// SassConfig compiles .scss files to CSS with Command, by default
+// "sass --no-source-map {in} {out}" (dart-sass), {in} and {out} replaced
+// by the files. Watch recompiles assets when requested after a change
+type SassConfig struct {
+	Enabled bool   `json:"enabled"`
+	Command string `json:"command"`
+	Watch   bool   `json:"watch"`
+}
+
+// BundleConfig bundles Entries, e.g. "assets/widget.ts", and what they
+// import into bundles/ of the build, for layouts to link with
+// {{bundle "assets/widget.ts"}}. Target is the JS version the output
+// needs, "es2020" by default
+type BundleConfig struct {
+	Entries   []string `json:"entries"`
+	Minify    bool     `json:"minify"`
+	Target    string   `json:"target"`
+	Sourcemap bool     `json:"sourcemap"`
+}
+
+// CriticalCSSConfig inlines the rules of local stylesheets that apply to
+// the first Elements elements of a page (40 by default) and loads the
+// stylesheets without blocking rendering. Exclude are page URL patterns
+// left alone, e.g. "/app/*"; pages also opt out with critical_css: false
+type CriticalCSSConfig struct {
+	Enabled  bool     `json:"enabled"`
+	Elements int      `json:"elements"`
+	Exclude  []string `json:"exclude"`
+}
+
+// SRIConfig adds integrity and crossorigin attributes to external
+// scripts and stylesheets of pages and the analytics dashboard, hashed
+// once and pinned in the data dir. ForbidExternal fails builds of pages
+// loading them instead. ChartJS is where the dashboard gets Chart.js,
+// e.g. a copy in assets
+type SRIConfig struct {
+	Enabled        bool   `json:"enabled"`
+	ForbidExternal bool   `json:"forbid_external"`
+	ChartJS        string `json:"chart_js"`
+}
+
+// RemoteDataConfig caches remote JSON in data_dir/remote for TTL ("1h" by
+// default), fetches time out after Timeout ("10s")
+type RemoteDataConfig struct {
+	TTL     string `json:"ttl"`
+	Timeout string `json:"timeout"`
+}
+
+// ActivityPubConfig makes the site followable as @user@host, the host of
+// SiteURL. Pages with a date are sent to followers once they are
+// published, only those under Section when it is set, e.g. "/blog"
+type ActivityPubConfig struct {
+	User    string `json:"user"`
+	Name    string `json:"name"` // display name, default SiteName
+	Summary string `json:"summary"`
+	Section string `json:"section"`
+}
+
+// FeedsConfig turns on feed.xml (RSS), atom.xml and feed.json for the
+// whole site, every tag at /tags/<tag>/ and every section directory, e.g.
+// /docs/feed.xml. They list pages with a date or git history, newest first
+type FeedsConfig struct {
+	Site     bool `json:"site"`
+	Tags     bool `json:"tags"`
+	Sections bool `json:"sections"`
+	Limit    int  `json:"limit"` // entries per feed, default 20
+	// WebSub hubs advertised in every feed, including the recent page's,
+	// and told about feeds a rebuild changed. Needs SiteURL
+	Hubs []string `json:"hubs"`
+}
+
+// RecentConfig turns on a page listing the last changed pages, by git
+// history or front matter date, with a JSON Feed at <url>.json
+type RecentConfig struct {
+	Limit int    `json:"limit"` // pages listed, 0 turns it off
+	URL   string `json:"url"`   // default "/recent"
+	Title string `json:"title"` // default "Recently updated"
+}
+
+// LLMsConfig writes /llms.txt, an index of the site's pages in markdown
+// per llmstxt.org, and with Full /llms-full.txt, all of them in one file.
+// Include and Exclude are page URL patterns like "/docs/*", Include
+// defaulting to every public page
+type LLMsConfig struct {
+	Enabled     bool     `json:"enabled"`
+	Description string   `json:"description"` // the summary under the title
+	Full        bool     `json:"full"`
+	Include     []string `json:"include"`
+	Exclude     []string `json:"exclude"`
+}
+
+// CDNPurge clears a CDN's cache after rebuilds. Provider is "cloudflare",
+// "fastly" or "bunny"; Zone is the Cloudflare zone ID, Fastly service ID or
+// Bunny pull zone ID; Token the API token or key. Only changed pages are
+// purged, which needs SiteURL, unless Full is set
+type CDNPurge struct {
+	Provider string `json:"provider"`
+	Zone     string `json:"zone"`
+	Token    string `json:"token"`
+	Full     bool   `json:"full"`
+}
+
+// HeaderRule adds Values to responses for paths matching For, a glob
+// where * stops at slashes and ** doesn't, e.g. "/assets/**"
+type HeaderRule struct {
+	For    string            `json:"for"`
+	Values map[string]string `json:"values"`
+}
+
+// CORSConfig lets browser apps on other origins call the JSON APIs.
+// Origins lists them exactly ("https://app.example.com"), or "*" for any
+// when Credentials is off. Methods defaults to GET, HEAD and OPTIONS.
+// Credentials allows cookies and basic auth, e.g. for /analytics/api
+type CORSConfig struct {
+	Origins     []string `json:"origins"`
+	Methods     []string `json:"methods"`
+	Headers     []string `json:"headers"`
+	Credentials bool     `json:"credentials"`
+	MaxAge      int      `json:"max_age"` // seconds browsers cache a preflight, default 600
+}
+
+// CacheConfig caps the analytics caches. Recent views per IP+page are
+// kept for the view cooldown; country lookups for CountryTTL.
+type CacheConfig struct {
+	MaxViewEntries    int    `json:"max_view_entries"`    // default 100000
+	MaxCountryEntries int    `json:"max_country_entries"` // default 10000
+	CountryTTL        string `json:"country_ttl"`         // Go duration, default "24h"
+}
+
+// MarkdownConfig toggles markdown extensions. Tables, strikethrough and
+// autolinks are on unless set to false, the rest are off unless set to true
+type MarkdownConfig struct {
+	Tables         *bool `json:"tables,omitempty"`
+	Strikethrough  *bool `json:"strikethrough,omitempty"`
+	Autolink       *bool `json:"autolink,omitempty"`
+	TaskLists      *bool `json:"task_lists,omitempty"`
+	Footnotes      *bool `json:"footnotes,omitempty"`
+	HardLineBreaks *bool `json:"hard_line_breaks,omitempty"`
+	// "popover" shows each footnote in a popover opened from its number,
+	// "sidenote" in the margin next to it. Either turns footnotes on.
+	// Default is the list at the end of the page
+	FootnoteStyle string `json:"footnote_style,omitempty"`
+	// Curly quotes, en/em dashes, ellipses and fractions
+	Smartypants *bool `json:"smartypants,omitempty"`
+}
+
+// HeadingsConfig moves every heading of page content down Offset levels,
+// for layouts showing the title as the page's <h1>: with 1, # becomes
+// <h2>. Strict fails the build for pages that don't end up with exactly
+// one <h1>, layout included
+type HeadingsConfig struct {
+	Offset int  `json:"offset"`
+	Strict bool `json:"strict"`
+}
+
+// LintConfig sets up the checks of `gomd lint`. "spelling" looks up
+// every word of the prose in Dictionaries, word lists with one word per
+// line like /usr/share/dict/words or hunspell .dic files, and in the
+// site's own Words. It only runs with a dictionary. "forbidden" reports
+// the words and phrases of Forbidden, which map to a hint like "use main
+// instead" or "". "code-lines" reports lines of code blocks longer than
+// MaxCodeLine (default 100) and "todo" the Markers left in the text
+// (default TODO, FIXME and XXX). Disable turns checks off by name
+type LintConfig struct {
+	Dictionaries []string          `json:"dictionaries"`
+	Words        []string          `json:"words"`
+	Forbidden    map[string]string `json:"forbidden"`
+	MaxCodeLine  int               `json:"max_code_line"`
+	Markers      []string          `json:"markers"`
+	Disable      []string          `json:"disable"`
+}
+
+// Rule is a regex rewrite, Replace can refer to groups as $1 or ${name}
+type Rule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+	Replace string `json:"replace"`
+}
+
+// ExecPlugin runs a command over each page, see plugin.Exec.
+// Stage is "markdown" (default) or "html"; Timeout is a Go duration, default "10s".
+type ExecPlugin struct {
+	Name    string   `json:"name"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	Stage   string   `json:"stage"`
+	Timeout string   `json:"timeout"`
+}
+
+// WasmPlugin enables a module from the plugins directory, see plugin.Wasm.
+// Stage is "markdown" or "html" for page transforms; Shortcodes lists the
+// shortcode names the module renders; Options are passed to it as JSON.
+type WasmPlugin struct {
+	Name       string                 `json:"name"`
+	File       string                 `json:"file"`
+	Stage      string                 `json:"stage"`
+	Shortcodes []string               `json:"shortcodes"`
+	Options    map[string]interface{} `json:"options"`
+	Timeout    string                 `json:"timeout"`
+}
+
+// Default returns the config used when config.json is missing or invalid
+func Default() Config {
+	var cfg Config
+	cfg.applyDefaults()
+	return cfg
+}
+
+// Load reads a config file, falling back to defaults if it can't be read
+func Load(path string) Config {
+	f, err := os.Open(path)
+	if err != nil {
+		return Default()
+	}
+	defer f.Close()
+	var cfg Config
+	if err := json.NewDecoder(f).Decode(&cfg); err != nil {
+		return Default()
+	}
+	cfg.applyDefaults()
+	return cfg
+}
+
+// Save writes the config back to disk
+func (c Config) Save(path string) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+func (c *Config) applyDefaults() {
+	if c.Port == "" {
+		c.Port = "8080"
+	}
+	if c.SrcDir == "" {
+		c.SrcDir = "web"
+	}
+	if c.BuildDir == "" {
+		c.BuildDir = ".built"
+	}
+	if c.Versions.Latest == "" && len(c.Versions.Dirs) > 0 {
+		c.Versions.Latest = c.Versions.Dirs[0]
+	}
+	if c.Recent.URL == "" {
+		c.Recent.URL = "/recent"
+	}
+	c.Recent.URL = path.Clean("/" + c.Recent.URL)
+	if c.Feeds.Limit <= 0 {
+		c.Feeds.Limit = 20
+	}
+	if c.Recent.Title == "" {
+		c.Recent.Title = "Recently updated"
+	}
+	if c.RepoBranch == "" {
+		c.RepoBranch = "main"
+	}
+	if c.RepoDir == "" {
+		c.RepoDir = c.SrcDir
+	}
+	if c.AssetsDir == "" {
+		c.AssetsDir = "assets"
+	}
+	if c.AnalyticsDB == "" {
+		c.AnalyticsDB = ".analytics.db"
+	}
+	if c.PluginsDir == "" {
+		c.PluginsDir = "plugins"
+	}
+	if c.TemplatesDir == "" {
+		c.TemplatesDir = "templates"
+	}
+	if c.DataDir == "" {
+		c.DataDir = ".data"
+	}
+	if c.UsersFile == "" {
+		c.UsersFile = filepath.Join(c.DataDir, "users.json")
+	}
+	if c.SessionLifetime == "" {
+		c.SessionLifetime = "12h"
+	}
+	if c.SMTP.Port == 0 {
+		c.SMTP.Port = 587
+	}
+	for i := range c.Publish {
+		if c.Publish[i].HTMLCacheControl == "" {
+			c.Publish[i].HTMLCacheControl = "no-cache"
+		}
+		if c.Publish[i].AssetCacheControl == "" {
+			c.Publish[i].AssetCacheControl = "public, max-age=86400"
+		}
+	}
+	for i := range c.Forms {
+		if c.Forms[i].Honeypot == "" {
+			c.Forms[i].Honeypot = "_gotcha"
+		}
+	}
+	c.SiteURL = strings.TrimSuffix(c.SiteURL, "/")
+	if c.SiteName == "" {
+		if u, err := url.Parse(c.SiteURL); err == nil {
+			c.SiteName = u.Hostname()
+		}
+	}
+	if c.ActivityPub.Name == "" {
+		c.ActivityPub.Name = c.SiteName
+	}
+	c.ActivityPub.Section = strings.TrimSuffix(c.ActivityPub.Section, "/")
+	if c.PWA.Name == "" {
+		c.PWA.Name = c.SiteName
+	}
+	if c.PWA.Display == "" {
+		c.PWA.Display = "standalone"
+	}
+	if c.PWA.Strategy == "" {
+		c.PWA.Strategy = "network-first"
+	}
+	c.PWA.Scope = path.Clean("/" + c.PWA.Scope)
+	if c.Lint.MaxCodeLine == 0 {
+		c.Lint.MaxCodeLine = 100
+	}
+	if len(c.Lint.Markers) == 0 {
+		c.Lint.Markers = []string{"TODO", "FIXME", "XXX"}
+	}
+	if c.OGImages.Background == "" {
+		c.OGImages.Background = "#1f2937"
+	}
+	if c.OGImages.Color == "" {
+		c.OGImages.Color = "#ffffff"
+	}
+	if c.OGImages.Logo == "" {
+		c.OGImages.Logo = c.Favicon
+	}
+	if c.StructuredData == nil {
+		c.StructuredData = map[string]string{"page": "WebPage", "article": "Article", "post": "BlogPosting"}
+	}
+	// "docs/" and "/docs" both become "/docs", "/" becomes ""
+	c.BasePath = strings.TrimSuffix("/"+strings.Trim(c.BasePath, "/"), "/")
+	if len(c.CORS.Methods) == 0 {
+		c.CORS.Methods = []string{"GET", "HEAD", "OPTIONS"}
+	}
+	if c.CORS.MaxAge == 0 {
+		c.CORS.MaxAge = 600
+	}
+	if c.DefaultCharset == "" {
+		c.DefaultCharset = "utf-8"
+	}
+	if c.Cache.MaxViewEntries == 0 {
+		c.Cache.MaxViewEntries = 100000
+	}
+	if c.Cache.MaxCountryEntries == 0 {
+		c.Cache.MaxCountryEntries = 10000
+	}
+	if c.Cache.CountryTTL == "" {
+		c.Cache.CountryTTL = "24h"
+	}
+}
@@ -0,0 +1,93 @@
+package gomd
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SyncContent replaces the source dir with the configured remote copy, if
+// any. Builds wait until it is done
+func (s *Site) SyncContent(ctx context.Context) error {
+	if s.source == nil {
+		return nil
+	}
+	s.building.Lock()
+	defer s.building.Unlock()
+	start := time.Now()
+	if err := s.source.Sync(ctx, s.Config.SrcDir); err != nil {
+		return err
+	}
+	slog.Info("content synced", "source", s.Config.Source.Type, "duration", time.Since(start))
+	return nil
+}
+
+// Sync and rebuild in the background, hooks arriving meanwhile are folded
+// into one more run
+func (s *Site) syncLoop() {
+	for {
+		select {
+		case <-s.syncRequests:
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+			err := s.SyncContent(ctx)
+			cancel()
+			if err != nil {
+				slog.Error("content sync failed", "err", err)
+				continue
+			}
+			if err := s.Build(); err != nil {
+				slog.Error("rebuild failed", "reason", "content synced", "err", err)
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// POST /hooks/content asks for a sync, e.g. from a Git push webhook
+func (s *Site) serveContentHook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, _ := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if !validHookSecret(r, body, s.Config.Source.WebhookSecret) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	s.Audit.Record("webhook", "sync content", s.Config.Source.Type)
+	select {
+	case s.syncRequests <- struct{}{}:
+	default:
+	}
+	w.WriteHeader(http.StatusAccepted)
+	io.WriteString(w, "sync started\n")
+}
+
+// Accept a bearer token, GitLab's X-Gitlab-Token or GitHub's
+// X-Hub-Signature-256 body signature
+func validHookSecret(r *http.Request, body []byte, secret string) bool {
+	if secret == "" {
+		return false
+	}
+	equal := func(a, b string) bool { return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1 }
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return equal(token, secret)
+	}
+	if token := r.Header.Get("X-Gitlab-Token"); token != "" {
+		return equal(token, secret)
+	}
+	if sig, ok := strings.CutPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256="); ok {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		return equal(sig, hex.EncodeToString(mac.Sum(nil)))
+	}
+	return false
+}
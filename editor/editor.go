@@ -0,0 +1,317 @@
+// Package editor is the admin UI's content editor. Every save and rollback
+// snapshots the previous version of the file into the data dir, so live
+// content can be compared with and rolled back to any earlier version.
+package editor
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pmezard/go-difflib/difflib"
+
+	"github.com/core6quad/GOMD/admin"
+	"github.com/core6quad/GOMD/auth"
+)
+
+// Versions are named after the UTC time they were replaced
+const versionLayout = "20060102T150405.000000000Z"
+
+var versionRe = regexp.MustCompile(`^\d{8}T\d{6}\.\d{9}Z$`)
+
+// Editor edits the .gmd files of the source dir
+type Editor struct {
+	mu         sync.Mutex
+	srcDir     string
+	historyDir string
+	admin      *admin.Admin
+
+	// OnSave runs after a file changed, to rebuild the site
+	OnSave func()
+	// Audit records who changed which file
+	Audit func(r *http.Request, action, target string)
+}
+
+// Version is an earlier copy of a file
+type Version struct {
+	ID   string
+	Time time.Time
+	Size int64
+}
+
+// New creates an editor for srcDir keeping history in dataDir/history
+func New(a *admin.Admin, srcDir, dataDir string) *Editor {
+	return &Editor{srcDir: srcDir, historyDir: filepath.Join(dataDir, "history"), admin: a}
+}
+
+// Files lists the .gmd files of the source dir, slash-separated
+func (e *Editor) Files() ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(e.srcDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && path != e.srcDir {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && strings.HasSuffix(path, ".gmd") {
+			rel, _ := filepath.Rel(e.srcDir, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return files, err
+}
+
+// Only plain .gmd paths inside the source dir can be edited
+func (e *Editor) path(rel string) (string, error) {
+	local := filepath.FromSlash(rel)
+	if !strings.HasSuffix(rel, ".gmd") || !filepath.IsLocal(local) || strings.ContainsAny(rel, "\\:") {
+		return "", errors.New("invalid file name")
+	}
+	return filepath.Join(e.srcDir, local), nil
+}
+
+// Save writes new content to a file, snapshotting the current version
+func (e *Editor) Save(rel string, content []byte) error {
+	path, err := e.path(rel)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.snapshot(rel, path); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
+
+// Rollback restores an earlier version, the current one is kept in history
+func (e *Editor) Rollback(rel, version string) error {
+	old, err := e.Version(rel, version)
+	if err != nil {
+		return err
+	}
+	return e.Save(rel, old)
+}
+
+// Copy the current file into history, new files have nothing to keep
+func (e *Editor) snapshot(rel, path string) error {
+	current, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(e.historyDir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	name := time.Now().UTC().Format(versionLayout)
+	return os.WriteFile(filepath.Join(dir, name), current, 0644)
+}
+
+// History lists the earlier versions of a file, newest first
+func (e *Editor) History(rel string) ([]Version, error) {
+	if _, err := e.path(rel); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(filepath.Join(e.historyDir, filepath.FromSlash(rel)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var versions []Version
+	for _, entry := range entries {
+		t, err := time.Parse(versionLayout, entry.Name())
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		versions = append(versions, Version{ID: entry.Name(), Time: t, Size: info.Size()})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].ID > versions[j].ID })
+	return versions, nil
+}
+
+// Version returns the content of an earlier version
+func (e *Editor) Version(rel, version string) ([]byte, error) {
+	if _, err := e.path(rel); err != nil {
+		return nil, err
+	}
+	if !versionRe.MatchString(version) {
+		return nil, errors.New("invalid version")
+	}
+	return os.ReadFile(filepath.Join(e.historyDir, filepath.FromSlash(rel), version))
+}
+
+// Diff is a unified diff from an earlier version to the current file
+func (e *Editor) Diff(rel, version string) (string, error) {
+	old, err := e.Version(rel, version)
+	if err != nil {
+		return "", err
+	}
+	path, _ := e.path(rel)
+	current, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(old)),
+		B:        difflib.SplitLines(string(current)),
+		FromFile: rel + "@" + version,
+		ToFile:   rel,
+		Context:  3,
+	})
+}
+
+var pages = template.Must(template.New("list").Parse(`
+<form method="get" action="{{.Base}}/admin/content/edit"><input name="file" placeholder="new/page.gmd" required> <button>New page</button></form>
+<table>
+<tr><th>File</th></tr>
+{{range .Files}}<tr><td><a href="{{$.Base}}/admin/content/edit?file={{.}}">{{.}}</a></td></tr>
+{{end}}</table>
+`))
+
+var edit = template.Must(template.New("edit").Parse(`
+<form method="post">
+{{.CSRF}}
+<input type="hidden" name="file" value="{{.File}}">
+<textarea name="content" rows="24" style="width:100%; font-family: monospace">{{.Content}}</textarea>
+<p><button>Save</button></p>
+</form>
+<h2>History</h2>
+{{if .History}}<table>
+<tr><th>Replaced</th><th>Size</th><th></th></tr>
+{{range .History}}<tr>
+	<td>{{.Time.Local.Format "2006-01-02 15:04:05"}}</td>
+	<td>{{.Size}} bytes</td>
+	<td>
+		<a href="{{$.Base}}/admin/content/diff?file={{$.File}}&amp;version={{.ID}}">Diff</a>
+		<form class="inline" method="post" action="{{$.Base}}/admin/content/rollback">{{$.CSRF}}<input type="hidden" name="file" value="{{$.File}}"><input type="hidden" name="version" value="{{.ID}}"><button class="danger">Roll back</button></form>
+	</td>
+</tr>{{end}}
+</table>{{else}}<p class="empty">No earlier versions yet.</p>{{end}}
+`))
+
+var diff = template.Must(template.New("diff").Parse(`
+<p><a href="{{.Base}}/admin/content/edit?file={{.File}}">Back to {{.File}}</a></p>
+<pre style="background:#111; padding:16px; overflow:auto">{{range .Lines}}<span style="color:{{if eq .Kind '+'}}#7ee787{{else if eq .Kind '-'}}#ff7b72{{else}}#ccc{{end}}">{{.Text}}</span>
+{{end}}</pre>
+`))
+
+type diffLine struct {
+	Kind byte
+	Text string
+}
+
+// ServeHTTP serves the admin section at /admin/content
+func (e *Editor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	title := "Content"
+	file := r.FormValue("file")
+	switch r.URL.Path {
+	case "/admin/content":
+		files, err := e.Files()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		pages.Execute(&buf, map[string]interface{}{"Files": files, "Base": e.admin.BasePath})
+	case "/admin/content/edit":
+		path, err := e.path(file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.Method == http.MethodPost {
+			if err := e.Save(file, []byte(strings.ReplaceAll(r.PostFormValue("content"), "\r\n", "\n"))); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			e.changed()
+			e.audit(r, "edit page", file)
+			http.Redirect(w, r, e.admin.BasePath+"/admin/content/edit?file="+url.QueryEscape(file), http.StatusSeeOther)
+			return
+		}
+		content, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		history, err := e.History(file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		title = file
+		edit.Execute(&buf, map[string]interface{}{"File": file, "Content": string(content), "History": history, "CSRF": auth.CSRFField(r), "Base": e.admin.BasePath})
+	case "/admin/content/diff":
+		d, err := e.Diff(file, r.FormValue("version"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var lines []diffLine
+		for _, l := range strings.Split(strings.TrimSuffix(d, "\n"), "\n") {
+			kind := byte(' ')
+			if l != "" && !strings.HasPrefix(l, "+++") && !strings.HasPrefix(l, "---") {
+				kind = l[0]
+			}
+			lines = append(lines, diffLine{kind, l})
+		}
+		title = "Changes to " + file
+		diff.Execute(&buf, map[string]interface{}{"File": file, "Lines": lines, "Base": e.admin.BasePath})
+	case "/admin/content/rollback":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := e.Rollback(file, r.PostFormValue("version")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		e.changed()
+		e.audit(r, "roll back page", file+" to "+r.PostFormValue("version"))
+		http.Redirect(w, r, e.admin.BasePath+"/admin/content/edit?file="+url.QueryEscape(file), http.StatusSeeOther)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	e.admin.Render(w, r, title, template.HTML(buf.String()))
+}
+
+func (e *Editor) audit(r *http.Request, action, target string) {
+	if e.Audit != nil {
+		e.Audit(r, action, target)
+	}
+}
+
+func (e *Editor) changed() {
+	if e.OnSave != nil {
+		e.OnSave()
+	}
+}
@@ -0,0 +1,181 @@
+package editor
+
+import (
+	"context"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+// Saves over WebDAV come in bursts (temp files, renames, a whole folder
+// copied at once), the rebuild waits for them to settle
+const davSettle = time.Second
+
+// WebDAV serves the source dir over WebDAV at prefix, so it can be mounted
+// as a network drive. Hidden files and dirs, like .git, are left out.
+// Overwritten and deleted pages are snapshotted into history as with the
+// web editor
+func (e *Editor) WebDAV(prefix string) http.Handler {
+	var mu sync.Mutex
+	var timer *time.Timer
+	return &webdav.Handler{
+		Prefix:     prefix,
+		FileSystem: davFS{e},
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			action, ok := davActions[r.Method]
+			if !ok || err != nil {
+				return
+			}
+			target := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+			if dst := r.Header.Get("Destination"); dst != "" && (r.Method == "MOVE" || r.Method == "COPY") {
+				if u, err := url.Parse(dst); err == nil {
+					target += " to " + strings.TrimPrefix(strings.TrimPrefix(u.Path, prefix), "/")
+				}
+			}
+			e.audit(r, action, target)
+			mu.Lock()
+			defer mu.Unlock()
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.AfterFunc(davSettle, e.changed)
+		},
+	}
+}
+
+// Requests that change files, as audit log actions
+var davActions = map[string]string{
+	http.MethodPut:    "edit file over WebDAV",
+	http.MethodDelete: "delete file over WebDAV",
+	"MKCOL":           "create folder over WebDAV",
+	"COPY":            "copy file over WebDAV",
+	"MOVE":            "move file over WebDAV",
+}
+
+// davFS is the source dir as a webdav.FileSystem
+type davFS struct {
+	e *Editor
+}
+
+func hidden(name string) bool {
+	for _, seg := range strings.Split(name, "/") {
+		if strings.HasPrefix(seg, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+func (d davFS) dir(name string) (webdav.Dir, string, error) {
+	name = path.Clean("/" + name)
+	if hidden(name) {
+		return "", "", os.ErrNotExist
+	}
+	return webdav.Dir(d.e.srcDir), name, nil
+}
+
+func (d davFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	dir, name, err := d.dir(name)
+	if err != nil {
+		return os.ErrPermission
+	}
+	return dir.Mkdir(ctx, name, perm)
+}
+
+func (d davFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	dir, name, err := d.dir(name)
+	if err != nil {
+		if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE) != 0 {
+			return nil, os.ErrPermission
+		}
+		return nil, err
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		if err := d.snapshot(name); err != nil {
+			return nil, err
+		}
+	}
+	f, err := dir.OpenFile(ctx, name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return davFile{f}, nil
+}
+
+func (d davFS) RemoveAll(ctx context.Context, name string) error {
+	dir, name, err := d.dir(name)
+	if err != nil {
+		return os.ErrPermission
+	}
+	if name == "/" {
+		return os.ErrPermission
+	}
+	if err := d.snapshot(name); err != nil {
+		return err
+	}
+	return dir.RemoveAll(ctx, name)
+}
+
+func (d davFS) Rename(ctx context.Context, oldName, newName string) error {
+	dir, oldName, err := d.dir(oldName)
+	if err != nil {
+		return os.ErrPermission
+	}
+	if _, newName, err = d.dir(newName); err != nil {
+		return os.ErrPermission
+	}
+	return dir.Rename(ctx, oldName, newName)
+}
+
+func (d davFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	dir, name, err := d.dir(name)
+	if err != nil {
+		return nil, err
+	}
+	return dir.Stat(ctx, name)
+}
+
+// Keep the pages at or below name in history before they change
+func (d davFS) snapshot(name string) error {
+	root := filepath.Join(d.e.srcDir, filepath.FromSlash(name))
+	d.e.mu.Lock()
+	defer d.e.mu.Unlock()
+	return filepath.WalkDir(root, func(file string, de fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if de.IsDir() || !strings.HasSuffix(file, ".gmd") {
+			return nil
+		}
+		rel, _ := filepath.Rel(d.e.srcDir, file)
+		return d.e.snapshot(filepath.ToSlash(rel), file)
+	})
+}
+
+// davFile leaves hidden files out of listings
+type davFile struct {
+	webdav.File
+}
+
+func (f davFile) Readdir(count int) ([]fs.FileInfo, error) {
+	list, err := f.File.Readdir(count)
+	visible := list[:0]
+	for _, fi := range list {
+		if !strings.HasPrefix(fi.Name(), ".") {
+			visible = append(visible, fi)
+		}
+	}
+	return visible, err
+}
@@ -0,0 +1,259 @@
+// Package forms handles POSTs to /forms/<name>, so static sites can have
+// working contact forms. Submissions are stored in the data dir and/or
+// forwarded by email and webhook.
+package forms
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/core6quad/GOMD/config"
+	gomail "github.com/core6quad/GOMD/mail"
+	"github.com/core6quad/GOMD/spam"
+	"github.com/core6quad/GOMD/webhook"
+)
+
+// Limits for a single submission
+const (
+	maxBody  = 64 << 10
+	maxValue = 10000
+)
+
+// Submission is a single form post
+type Submission struct {
+	Form   string            `json:"form"`
+	Time   time.Time         `json:"time"`
+	Fields map[string]string `json:"fields"`
+}
+
+// Handler serves every configured form
+type Handler struct {
+	forms    map[string]config.Form
+	dataDir  string
+	smtp     config.SMTPConfig
+	notifier *webhook.Notifier
+	basePath string
+	mu       sync.Mutex // serializes writes to the submission files
+
+	// Spam drops submissions before they are delivered
+	Spam *spam.Filter
+}
+
+// New creates a handler for the forms in config
+func New(cfg config.Config, n *webhook.Notifier) *Handler {
+	h := &Handler{
+		forms:    make(map[string]config.Form),
+		dataDir:  cfg.DataDir,
+		smtp:     cfg.SMTP,
+		notifier: n,
+		basePath: cfg.BasePath,
+	}
+	for _, f := range cfg.Forms {
+		h.forms[f.Name] = f
+	}
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	form, ok := h.forms[strings.TrimPrefix(r.URL.Path, "/forms/")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+	values, err := readValues(r)
+	if err != nil {
+		http.Error(w, "invalid form data", http.StatusBadRequest)
+		return
+	}
+	// Bots fill in every field, pretend it worked so they move on
+	if values[form.Honeypot] != "" {
+		slog.Debug("form honeypot triggered", "form", form.Name)
+		h.respond(w, r, form)
+		return
+	}
+	sub := Submission{Form: form.Name, Time: time.Now().UTC(), Fields: pick(values, form)}
+	if len(sub.Fields) == 0 {
+		http.Error(w, "empty submission", http.StatusBadRequest)
+		return
+	}
+	if h.Spam.Check(r, submission(sub)) {
+		h.respond(w, r, form)
+		return
+	}
+	if err := h.deliver(form, sub); err != nil {
+		slog.Error("form submission failed", "form", form.Name, "err", err)
+		http.Error(w, "could not save submission", http.StatusInternalServerError)
+		return
+	}
+	h.respond(w, r, form)
+}
+
+// Read a JSON object or a url-encoded/multipart form
+func readValues(r *http.Request) (map[string]string, error) {
+	values := make(map[string]string)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var raw map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+			return nil, err
+		}
+		for k, v := range raw {
+			values[k] = fmt.Sprint(v)
+		}
+		return values, nil
+	}
+	if err := r.ParseMultipartForm(maxBody); err != nil && err != http.ErrNotMultipart {
+		return nil, err
+	}
+	for k, v := range r.PostForm {
+		values[k] = strings.Join(v, ", ")
+	}
+	return values, nil
+}
+
+// Keep the configured fields, or every non-internal one
+func pick(values map[string]string, form config.Form) map[string]string {
+	fields := make(map[string]string)
+	keep := func(k string) {
+		v := strings.TrimSpace(values[k])
+		if v == "" {
+			return
+		}
+		if len(v) > maxValue {
+			v = v[:maxValue]
+		}
+		fields[k] = v
+	}
+	if len(form.Fields) > 0 {
+		for _, k := range form.Fields {
+			keep(k)
+		}
+		return fields
+	}
+	for k := range values {
+		if k != form.Honeypot && !strings.HasPrefix(k, "_") {
+			keep(k)
+		}
+	}
+	return fields
+}
+
+// What the spam checks see of a submission: the usual contact form fields,
+// and every field as the text
+func submission(sub Submission) spam.Submission {
+	keys := make([]string, 0, len(sub.Fields))
+	for k := range sub.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var text strings.Builder
+	for _, k := range keys {
+		text.WriteString(sub.Fields[k] + "\n")
+	}
+	url := sub.Fields["url"]
+	if url == "" {
+		url = sub.Fields["website"]
+	}
+	return spam.Submission{Kind: "contact-form", Author: sub.Fields["name"], Email: sub.Fields["email"], URL: url, Text: text.String()}
+}
+
+// Store and forward a submission. Storing must work, forwarding is best
+// effort when the submission is also stored
+func (h *Handler) deliver(form config.Form, sub Submission) error {
+	if form.Store {
+		if err := h.store(sub); err != nil {
+			return err
+		}
+	}
+	if len(form.Email) > 0 {
+		if err := gomail.Send(h.smtp, message(form, sub)); err != nil {
+			if !form.Store {
+				return err
+			}
+			slog.Error("failed to email form submission", "form", form.Name, "err", err)
+		}
+	}
+	if form.Webhook != nil {
+		data := make(map[string]interface{}, len(sub.Fields)+1)
+		for k, v := range sub.Fields {
+			data[k] = v
+		}
+		data["form"] = form.Name
+		h.notifier.Send(*form.Webhook, "form_submission", "New "+form.Name+" form submission", data)
+	}
+	return nil
+}
+
+// Append a submission to data_dir/forms/<name>.jsonl
+func (h *Handler) store(sub Submission) error {
+	line, err := json.Marshal(sub)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(h.dataDir, "forms")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, filepath.Base(sub.Form)+".jsonl"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func message(form config.Form, sub Submission) gomail.Message {
+	keys := make([]string, 0, len(sub.Fields))
+	for k := range sub.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var body strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&body, "%s:\n%s\n\n", k, sub.Fields[k])
+	}
+	msg := gomail.Message{To: form.Email, Subject: "New " + form.Name + " form submission", Body: body.String()}
+	// Let the owner reply to the sender directly
+	if addr, err := mail.ParseAddress(sub.Fields["email"]); err == nil {
+		msg.ReplyTo = addr.Address
+	}
+	return msg
+}
+
+// JSON clients get 202, browsers are sent back to the site
+func (h *Handler) respond(w http.ResponseWriter, r *http.Request, form config.Form) {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") ||
+		strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"ok":true}` + "\n"))
+		return
+	}
+	target := form.Redirect
+	if target == "" {
+		target = r.Referer()
+	}
+	if target == "" {
+		target = h.basePath + "/"
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
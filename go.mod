@@ -1,10 +1,25 @@
-module gomd
+module github.com/core6quad/GOMD
 
-go 1.20
+go 1.21
 
-require github.com/russross/blackfriday/v2 v2.0.1
+require (
+	github.com/evanw/esbuild v0.24.2
+	github.com/kyokomi/emoji/v2 v2.2.13
+	github.com/pmezard/go-difflib v1.0.0
+	github.com/russross/blackfriday/v2 v2.0.1
+	github.com/tdewolff/minify/v2 v2.21.2
+	github.com/tetratelabs/wazero v1.8.2
+	golang.org/x/crypto v0.31.0
+	golang.org/x/image v0.23.0
+	golang.org/x/net v0.33.0
+	golang.org/x/term v0.27.0
+	gopkg.in/yaml.v3 v3.0.1
+	rsc.io/qr v0.2.0
+)
 
 require (
-	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/shurcooL/sanitized_anchor_name v1.0.0 // indirect
+	github.com/tdewolff/parse/v2 v2.7.19 // indirect
+	golang.org/x/sys v0.28.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
 )
@@ -0,0 +1,705 @@
+// Package gomd builds a directory of .gmd (glorified markdown) pages into
+// HTML and serves them, with built-in analytics.
+//
+//	site := gomd.New(config.Load("config.json"))
+//	defer site.Close()
+//	log.Fatal(site.ListenAndServe())
+package gomd
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/core6quad/GOMD/activitypub"
+	"github.com/core6quad/GOMD/admin"
+	"github.com/core6quad/GOMD/analytics"
+	"github.com/core6quad/GOMD/audit"
+	"github.com/core6quad/GOMD/auth"
+	"github.com/core6quad/GOMD/comments"
+	"github.com/core6quad/GOMD/compiler"
+	"github.com/core6quad/GOMD/config"
+	"github.com/core6quad/GOMD/editor"
+	"github.com/core6quad/GOMD/forms"
+	"github.com/core6quad/GOMD/minify"
+	"github.com/core6quad/GOMD/newsletter"
+	"github.com/core6quad/GOMD/ping"
+	"github.com/core6quad/GOMD/plugin"
+	"github.com/core6quad/GOMD/sass"
+	"github.com/core6quad/GOMD/search"
+	"github.com/core6quad/GOMD/server"
+	"github.com/core6quad/GOMD/share"
+	"github.com/core6quad/GOMD/source"
+	"github.com/core6quad/GOMD/spam"
+	"github.com/core6quad/GOMD/sri"
+	"github.com/core6quad/GOMD/webhook"
+	"github.com/core6quad/GOMD/webmention"
+)
+
+// Set at build time with -ldflags "-X github.com/core6quad/GOMD.Version=..."
+var (
+	Version = "dev"
+	Commit  = ""
+)
+
+// Site is a GOMD site: its sources, compiled output, analytics and server
+type Site struct {
+	Config    config.Config
+	Analytics *analytics.Analytics
+	Notifier  *webhook.Notifier
+	Server    *server.Server
+	Admin     *admin.Admin
+	// Users can sign in to the admin UI and analytics dashboard
+	Users *auth.Users
+	// Audit records changes made through the admin UI
+	Audit   *audit.Log
+	Plugins []plugin.Plugin
+	// Comments is nil unless enabled in config
+	Comments *comments.Store
+	// Webmentions is nil unless enabled in config
+	Webmentions *webmention.Store
+	// ActivityPub is nil unless enabled in config
+	ActivityPub *activitypub.Actor
+
+	startTime time.Time
+	done      chan struct{}
+	closeOnce sync.Once
+	// Analytics are only saved once loaded, so a failed start can't wipe them
+	analyticsLoaded atomic.Bool
+	// Build dirs Build wrote into, the only ones Close removes. A command
+	// like gomd lint never builds and leaves a running server's alone
+	built sync.Map
+
+	// Only one build runs at a time
+	building sync.Mutex
+
+	// Last build info, reported by /status
+	buildMu       sync.RWMutex
+	lastBuildTime time.Time
+	lastBuildTook time.Duration
+	pages         []*compiler.Page
+	// Content hash of every page and feed, to find what a rebuild changed
+	pageHashes map[string][32]byte
+	feedHashes map[string][32]byte
+	// Fingerprint of the source dir the last build started from, when
+	// watching it
+	sourcePrint string
+	// Restricted and password protected pages, by URL
+	protected map[string]protection
+	// Signs share links and unlocked page cookies
+	shares *share.Keys
+	// Full-text index of the public pages
+	search *search.Index
+	// Checks comments and form submissions, nil when none are configured
+	spam *spam.Filter
+	// Integrity of external scripts and stylesheets, nil when SRI is off
+	sri *sri.Pins
+
+	// Fires a rebuild when the next page with a publish_at is due
+	scheduleMu    sync.Mutex
+	scheduleTimer *time.Timer
+
+	// Remote copy of the source dir, nil when authoring locally
+	source       source.Source
+	syncRequests chan struct{}
+}
+
+// New creates a site from a config, nothing is built or served yet
+func New(cfg config.Config) *Site {
+	s := &Site{
+		Config:    cfg,
+		Analytics: analytics.New(cfg.Cache),
+		Notifier:  webhook.New(cfg.Webhooks),
+		Admin:     admin.New(),
+		Audit:     audit.Open(cfg.DataDir),
+		startTime: time.Now(),
+		done:      make(chan struct{}),
+	}
+	s.Analytics.Notifier = s.Notifier
+	users, err := auth.Load(cfg.UsersFile, cfg.AnalyticsUser, cfg.AnalyticsPass)
+	if err != nil {
+		slog.Error("failed to load users", "err", err)
+	}
+	if d, err := time.ParseDuration(cfg.SessionLifetime); err == nil {
+		users.SessionLifetime = d
+	} else {
+		slog.Error("invalid session_lifetime, using 12h", "err", err)
+	}
+	users.Audit = s.Audit.RecordRequest
+	users.BasePath = cfg.BasePath
+	s.Admin.BasePath = cfg.BasePath
+	s.Users = users
+	s.Server = server.New(cfg, s.Analytics, users)
+	s.Server.Status = s.status
+	s.Server.Variants = s.variants
+	s.Server.Access = s.pageAccess
+	s.Server.Password = s.pagePassword
+	if keys, err := share.Open(cfg.DataDir); err != nil {
+		slog.Error("failed to load share key, password protected pages stay locked", "err", err)
+	} else {
+		s.shares = keys
+		s.Server.Shares = keys
+	}
+	s.Server.Handle("/api/pages", http.HandlerFunc(s.servePages))
+	s.Server.Handle("/api/pages/", http.HandlerFunc(s.servePages))
+	s.Server.Handle("/api/search", http.HandlerFunc(s.serveSearch))
+	s.Server.Handle("/api/search.js", http.HandlerFunc(search.ServeScript))
+	s.Server.Handle("/search", http.HandlerFunc(s.serveSearchPage))
+	s.Server.Handle("/opensearch.xml", http.HandlerFunc(s.serveOpenSearch))
+	// A few attempts in a row, then one every 5 seconds per IP
+	s.Server.Handle("/admin/login", server.RateLimit(0.2, 5)(http.HandlerFunc(users.ServeLogin)))
+	s.Server.Handle("/admin/logout", http.HandlerFunc(users.ServeLogout))
+	s.Server.HandlePrivate("/admin", auth.Viewer, s.Admin)
+	s.Server.HandlePrivate("/admin/", auth.Viewer, s.Admin)
+	content := editor.New(s.Admin, cfg.SrcDir, cfg.DataDir)
+	content.OnSave = func() { s.rebuildAsync("content edited") }
+	content.Audit = s.Audit.RecordRequest
+	s.Admin.Add("Content", "/admin/content", auth.Editor, content)
+	if cfg.WebDAV {
+		// Hrefs in listings and Destination headers carry the base path
+		dav := content.WebDAV(cfg.BasePath + "/dav")
+		s.Server.HandlePrivate("/dav/", auth.Editor, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.URL.Path = cfg.BasePath + r.URL.Path
+			r.URL.RawPath = ""
+			dav.ServeHTTP(w, r)
+		}))
+	}
+	s.spam = newSpamFilter(cfg)
+	s.sri = newSRIPins(cfg)
+	if cfg.Comments {
+		s.enableComments()
+	}
+	if len(cfg.Forms) > 0 {
+		// A few submissions in a row, then one every 10 seconds per IP
+		h := forms.New(cfg, s.Notifier)
+		h.Spam = s.spam
+		s.Server.Handle("/forms/", server.RateLimit(0.1, 3)(h))
+	}
+	if cfg.Newsletter {
+		s.enableNewsletter()
+	}
+	if cfg.Webmention {
+		s.enableWebmention()
+	}
+	if cfg.ActivityPub.User != "" {
+		s.enableActivityPub()
+	}
+	s.Admin.Add("Share links", "/admin/share", auth.Editor, http.HandlerFunc(s.serveShare))
+	s.Admin.Add("Maintenance", "/admin/maintenance", auth.Admin, http.HandlerFunc(s.serveMaintenance))
+	s.Admin.Add("Audit log", "/admin/audit", auth.Admin, s.Audit.Admin(s.Admin))
+	s.Admin.Add("Account", "/admin/account", auth.Viewer, users.Account(s.Admin.Render))
+	if src, err := source.New(cfg.Source, cfg.DataDir); err != nil {
+		slog.Error("invalid content source", "err", err)
+	} else if src != nil {
+		s.source = src
+		s.syncRequests = make(chan struct{}, 1)
+		go s.syncLoop()
+		if cfg.Source.WebhookSecret != "" {
+			s.Server.Handle("/hooks/content", server.RateLimit(1, 5)(http.HandlerFunc(s.serveContentHook)))
+		}
+	}
+	if key := cfg.SearchPing.IndexNowKey; key != "" && !ping.ValidKey(key) {
+		slog.Error("invalid indexnow_key, use 8 to 128 letters, digits or dashes")
+		s.Config.SearchPing.IndexNowKey = ""
+	} else if key != "" {
+		s.Server.Handle("/"+key+".txt", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			io.WriteString(w, key)
+		}))
+	}
+	for _, p := range plugin.Registered() {
+		if err := s.Use(p); err != nil {
+			slog.Error("plugin failed to start", "plugin", p.Name(), "err", err)
+		}
+	}
+	for _, c := range cfg.ExecPlugins {
+		p, err := plugin.NewExec(c)
+		if err != nil {
+			slog.Error("invalid exec plugin", "err", err)
+			continue
+		}
+		s.Use(p)
+	}
+	for _, c := range cfg.WasmPlugins {
+		p, err := plugin.LoadWasm(cfg.PluginsDir, c)
+		if err != nil {
+			slog.Error("failed to load wasm plugin", "err", err)
+			continue
+		}
+		s.Use(p)
+	}
+	return s
+}
+
+// Use enables a plugin for this site only, in addition to the registered ones
+func (s *Site) Use(p plugin.Plugin) error {
+	s.Plugins = append(s.Plugins, p)
+	if h, ok := p.(plugin.ServeHook); ok {
+		return h.OnServe(s.Server)
+	}
+	return nil
+}
+
+// Check validates the source directory layout
+func (s *Site) Check() error {
+	// Check for index.gmd
+	if _, err := os.Stat(filepath.Join(s.Config.SrcDir, "index.gmd")); err != nil {
+		if errors.Is(err, fs.ErrPermission) {
+			return fmt.Errorf("can't read index.gmd in %s: permission denied (on macOS, check that the terminal has access to this folder)", s.Config.SrcDir)
+		}
+		return fmt.Errorf("index.gmd not found in %s, please create it", s.Config.SrcDir)
+	}
+	// Reserved top-level paths can't be used for pages
+	for _, dir := range []string{"assets", "analytics"} {
+		if fi, err := os.Stat(filepath.Join(s.Config.SrcDir, dir)); err == nil && fi.IsDir() {
+			return fmt.Errorf("do not create an '%s' directory inside %s", dir, s.Config.SrcDir)
+		}
+	}
+	return nil
+}
+
+// Build recompiles the site from scratch and fires the "rebuild" webhooks
+func (s *Site) Build() error {
+	s.building.Lock()
+	defer s.building.Unlock()
+	start := time.Now()
+	opts, err := s.compilerOptions()
+	if err != nil {
+		return err
+	}
+	// Build next to the pages being served, which stay up until the new
+	// build has fully succeeded
+	opts.BuildDir = s.Config.BuildDir
+	if s.Server.BuildDir() == opts.BuildDir {
+		opts.BuildDir += ".next"
+	}
+	if err := removeAll(opts.BuildDir); err != nil {
+		return err
+	}
+	s.built.Store(opts.BuildDir, true)
+	opts.Cache = s.buildCache()
+	// Taken before compiling, so changes made meanwhile get built next
+	var sourcePrint string
+	if s.watchInterval() > 0 {
+		sourcePrint, _ = sourceFingerprint(s.Config.SrcDir)
+	}
+	res, err := compiler.Compile(opts)
+	if err != nil {
+		removeAll(opts.BuildDir)
+		return err
+	}
+	index := search.New(res.Index)
+	took := time.Since(start)
+	hashes := make(map[string][32]byte, len(res.Index))
+	protected := make(map[string]protection)
+	for _, p := range res.Index {
+		hashes[p.URL] = sha256.Sum256([]byte(p.Content))
+		if len(p.Allow) == 0 && p.Password == "" {
+			continue
+		}
+		pr := protection{password: p.Password}
+		if len(p.Allow) > 0 {
+			// Checked when compiling
+			pr.access, _ = auth.ParseAccess(p.Allow)
+		}
+		protected[p.URL] = pr
+		// Variants can also be fetched by file name
+		for _, v := range p.Variants {
+			protected[p.URL+"."+v] = pr
+		}
+	}
+	s.buildMu.Lock()
+	s.lastBuildTime, s.lastBuildTook, s.pages = start, took, res.Index
+	prev, prevFeeds := s.pageHashes, s.feedHashes
+	s.pageHashes, s.feedHashes = hashes, res.Feeds
+	s.protected = protected
+	s.search = index
+	s.sourcePrint = sourcePrint
+	s.buildMu.Unlock()
+	// Only served once the new pages' protection is in place
+	s.Server.SetBuildDir(opts.BuildDir)
+	s.pinChartScript()
+	// The first build has nothing to compare against
+	if prev != nil {
+		go s.pingSearchEngines(opts, res.Index, prev, hashes)
+		go s.publishFeeds(opts, prevFeeds, res.Feeds)
+		if s.Webmentions != nil {
+			go s.sendWebmentions(opts, res.Index, prev, hashes)
+		}
+	}
+	go s.purgeCDN(opts, res.Index, prev, hashes)
+	if s.ActivityPub != nil {
+		s.publishPosts(opts, res.Index)
+	}
+	s.schedule(res.Scheduled)
+	slog.Info("site built", "pages", res.Pages, "files", res.Files, "duration", took)
+	s.Notifier.Notify("rebuild", fmt.Sprintf("Site rebuilt: %d pages in %s", res.Pages, took.Round(time.Millisecond)), map[string]interface{}{"pages": res.Pages, "duration_ms": took.Milliseconds()})
+	return nil
+}
+
+// Preprocess returns the markdown a source file turns into right before
+// rendering, after plugins, shortcodes and preprocessing rules
+func (s *Site) Preprocess(path string) ([]byte, error) {
+	opts, err := s.compilerOptions()
+	if err != nil {
+		return nil, err
+	}
+	return compiler.PreprocessFile(opts, path)
+}
+
+// Export writes every page as plain markdown, as it is right before
+// rendering, and the static files into dir
+func (s *Site) Export(dir string) (*compiler.ExportResult, error) {
+	opts, err := s.compilerOptions()
+	if err != nil {
+		return nil, err
+	}
+	return compiler.Export(opts, dir)
+}
+
+func (s *Site) compilerOptions() (compiler.Options, error) {
+	rules, err := compiler.LoadRules(s.Config)
+	if err != nil {
+		return compiler.Options{}, err
+	}
+	switch style := s.Config.Markdown.FootnoteStyle; style {
+	case "", compiler.FootnotePopover, compiler.FootnoteSidenote:
+	default:
+		return compiler.Options{}, fmt.Errorf("footnote_style %q is not popover or sidenote", style)
+	}
+	opts := compiler.Options{
+		SrcDir:         s.Config.SrcDir,
+		BuildDir:       s.Config.BuildDir,
+		TemplatesDir:   s.Config.TemplatesDir,
+		AssetsDir:      s.Config.AssetsDir,
+		Favicon:        s.Config.Favicon,
+		PWA:            s.Config.PWA,
+		OGImages:       s.Config.OGImages,
+		Media:          s.Config.Media,
+		Minify:         minify.New(s.Config.Minify),
+		Sass:           sass.New(s.Config.Sass),
+		Formats:        s.Config.Formats,
+		Bundle:         s.Config.Bundle,
+		CriticalCSS:    s.Config.CriticalCSS,
+		SRI:            s.sri,
+		Remote:         s.remoteData(),
+		Plugins:        s.Plugins,
+		Exclude:        s.Config.Exclude,
+		FollowSymlinks: s.Config.FollowSymlinks,
+		Rules:          rules,
+		Emoji:          s.Config.Emoji,
+		OutputFormats:  s.Config.OutputFormats,
+		Markdown:       s.Config.Markdown,
+		Headings:       s.Config.Headings,
+		ValidateHTML:   s.Config.ValidateHTML,
+		BasePath:       s.Config.BasePath,
+		SiteURL:        s.Config.SiteURL,
+		StructuredData: s.Config.StructuredData,
+		EditURL:        editURL(s.Config),
+		GitDir:         s.gitDir(),
+		Recent:         s.Config.Recent,
+		LLMs:           s.Config.LLMs,
+		Feeds:          s.Config.Feeds,
+		SiteName:       s.Config.SiteName,
+		Versions:       s.Config.Versions,
+	}
+	opts.Funcs = template.FuncMap{
+		"comments":    func(string) []comments.Comment { return nil },
+		"webmentions": func(string) []webmention.Mention { return nil },
+	}
+	opts.Partials = []string{comments.DisabledPartial, webmention.DisabledPartial, search.Partial}
+	name := s.Config.SiteName
+	if name == "" {
+		name = "Search"
+	}
+	opts.Head = search.HeadLink(s.Config.BasePath, name)
+	if s.Comments != nil {
+		opts.Funcs["comments"] = s.Comments.Approved
+		opts.Partials[0] = comments.Partial
+		if signIn := s.Comments.SignIn; signIn.Enabled() {
+			opts.Partials[0] = comments.SignInPartial(signIn.IndieAuth, signIn.GitHubClientID != "")
+		}
+	}
+	if s.Webmentions != nil {
+		opts.Funcs["webmentions"] = s.Webmentions.Approved
+		opts.Partials[1] = webmention.Partial
+		opts.Head += `<link rel="webmention" href="` + template.HTMLEscapeString(s.Config.BasePath) + `/webmention">` + "\n"
+	}
+	if s.Config.Beacon {
+		opts.Inject = analytics.BeaconScript(s.Config.BasePath)
+	}
+	return opts, nil
+}
+
+// Repository synced into the source dir, if content comes from git
+func (s *Site) gitDir() string {
+	if g, ok := s.source.(*source.Git); ok {
+		return g.GitDir
+	}
+	return ""
+}
+
+// Base of the "Edit this page" links. GitLab has the editor under /-/edit,
+// GitHub and most others under /edit
+func editURL(cfg config.Config) string {
+	if cfg.RepoURL == "" {
+		return ""
+	}
+	repo := strings.TrimSuffix(strings.TrimSuffix(cfg.RepoURL, "/"), ".git")
+	edit := "/edit/"
+	if strings.Contains(repo, "gitlab") {
+		edit = "/-/edit/"
+	}
+	dir := strings.Trim(filepath.ToSlash(filepath.Clean(cfg.RepoDir)), "/")
+	if dir == "." || dir == "" {
+		return repo + edit + cfg.RepoBranch + "/"
+	}
+	return repo + edit + cfg.RepoBranch + "/" + dir + "/"
+}
+
+// Rebuild in the background after a change made at runtime
+func (s *Site) rebuildAsync(reason string) {
+	go func() {
+		if err := s.Build(); err != nil {
+			slog.Error("rebuild failed", "reason", reason, "err", err)
+		}
+	}()
+}
+
+func (s *Site) enableComments() {
+	store, err := comments.Open(s.Config.DataDir)
+	if err != nil {
+		slog.Error("failed to load comments", "err", err)
+		return
+	}
+	store.BasePath = s.Config.BasePath
+	store.PageExists = func(url string) bool {
+		for _, p := range s.Pages() {
+			if p.URL == url {
+				return true
+			}
+		}
+		return false
+	}
+	store.Visible = s.Server.Visible
+	// Threads are rendered into pages at build time
+	store.OnChange = func() { s.rebuildAsync("comment moderated") }
+	store.Audit = s.Audit.RecordRequest
+	store.Spam = s.spam
+	if cfg := s.Config.CommentSignIn; cfg.IndieAuth || cfg.GitHubClientID != "" {
+		signIn, err := comments.OpenSignIn(s.Config.DataDir)
+		if err != nil {
+			slog.Error("failed to set up commenter sign in", "err", err)
+			return
+		}
+		signIn.IndieAuth, signIn.GitHubClientID, signIn.GitHubClientSecret = cfg.IndieAuth, cfg.GitHubClientID, cfg.GitHubClientSecret
+		signIn.SiteURL, signIn.BasePath = s.Config.SiteURL, s.Config.BasePath
+		store.SignIn = signIn
+		// Signing in makes the server fetch the commenter's website
+		s.Server.Handle("/commenter/", server.RateLimit(1, 10)(signIn))
+	}
+	s.Comments = store
+	s.Server.Handle("/comments/", server.RateLimit(0.2, 5)(store))
+	s.Admin.Add("Comments", "/admin/comments", auth.Editor, store.Moderation(s.Admin))
+}
+
+func (s *Site) enableNewsletter() {
+	list, err := newsletter.Open(s.Config)
+	if err != nil {
+		slog.Error("failed to load newsletter subscribers", "err", err)
+		return
+	}
+	// Signups send email, so they are limited like forms. The links in
+	// those emails are not
+	s.Server.Handle("/subscribe", server.RateLimit(0.1, 3)(list))
+	s.Server.Handle("/subscribe/", list)
+	list.Audit = s.Audit.RecordRequest
+	s.Admin.Add("Subscribers", "/admin/subscribers", auth.Admin, list.Admin(s.Admin))
+}
+
+// Pages returns every page from the last build, sorted by URL
+func (s *Site) Pages() []*compiler.Page {
+	s.buildMu.RLock()
+	defer s.buildMu.RUnlock()
+	return s.pages
+}
+
+// The page at a URL from the last build, nil if there is none
+func (s *Site) page(url string) *compiler.Page {
+	pages := s.Pages()
+	i := sort.Search(len(pages), func(i int) bool { return pages[i].URL >= url })
+	if i < len(pages) && pages[i].URL == url {
+		return pages[i]
+	}
+	return nil
+}
+
+// A/B variants of a page from the last build
+func (s *Site) variants(url string) []string {
+	if p := s.page(url); p != nil {
+		return p.Variants
+	}
+	return nil
+}
+
+// Who may see a page, and the password asked for first
+type protection struct {
+	access   *auth.Access
+	password string
+}
+
+// Allow list of a page from the last build, nil for public pages
+func (s *Site) pageAccess(url string) *auth.Access {
+	s.buildMu.RLock()
+	defer s.buildMu.RUnlock()
+	return s.protected[url].access
+}
+
+func (s *Site) pagePassword(url string) string {
+	s.buildMu.RLock()
+	defer s.buildMu.RUnlock()
+	return s.protected[url].password
+}
+
+// BuildDir returns the directory of the last successful build, builds
+// alternate between build_dir and build_dir.next
+func (s *Site) BuildDir() string {
+	return s.Server.BuildDir()
+}
+
+// Handler returns the HTTP handler serving the site
+func (s *Site) Handler() http.Handler {
+	return s.Server.Handler()
+}
+
+// ListenAndServe checks and builds the site, then serves it on the
+// configured port, saving analytics periodically until Close
+func (s *Site) ListenAndServe() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	if err := s.SyncContent(ctx); err != nil {
+		slog.Error("content sync failed, serving the local copy", "err", err)
+	}
+	cancel()
+	if err := s.Check(); err != nil {
+		return err
+	}
+	if err := s.Analytics.Load(s.Config.AnalyticsDB); err != nil {
+		slog.Error("failed to load analytics db file, analytics won't be saved", "err", err)
+	} else {
+		s.analyticsLoaded.Store(true)
+	}
+	if err := s.Build(); err != nil {
+		return fmt.Errorf("compile error: %w", err)
+	}
+
+	if every := s.watchInterval(); every > 0 {
+		go s.watchSource(every)
+	}
+
+	// Save analytics periodically in the background
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.saveAnalytics()
+			case <-s.done:
+				return
+			}
+		}
+	}()
+
+	slog.Info("serving", "url", "http://localhost:"+s.Config.Port)
+	err := http.ListenAndServe(":"+s.Config.Port, s.Handler())
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Close saves analytics, if ListenAndServe loaded them, and removes the
+// build directories Build wrote
+func (s *Site) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.schedule(nil)
+		s.saveAnalytics()
+		for _, p := range s.Plugins {
+			if c, ok := p.(io.Closer); ok {
+				c.Close()
+			}
+		}
+		s.built.Range(func(dir, _ any) bool {
+			if err := removeAll(dir.(string)); err != nil {
+				slog.Warn("could not clean up build directory", "dir", dir, "err", err)
+			}
+			return true
+		})
+	})
+}
+
+// os.RemoveAll, retried for a while since on Windows files that are still
+// open (being served, or scanned by an antivirus) can't be deleted
+func removeAll(dir string) error {
+	var err error
+	for i := 0; i < 5; i++ {
+		if err = os.RemoveAll(dir); err == nil {
+			return nil
+		}
+		time.Sleep(time.Duration(i+1) * 100 * time.Millisecond)
+	}
+	return err
+}
+
+func (s *Site) saveAnalytics() {
+	if !s.analyticsLoaded.Load() {
+		return
+	}
+	if err := s.Analytics.Save(s.Config.AnalyticsDB); err != nil {
+		slog.Error("failed to write analytics db file", "err", err)
+	}
+}
+
+// Build and version info for /status
+func (s *Site) status() map[string]interface{} {
+	s.buildMu.RLock()
+	defer s.buildMu.RUnlock()
+	return map[string]interface{}{
+		"version":        Version,
+		"commit":         vcsCommit(),
+		"uptime_seconds": int(time.Since(s.startTime).Seconds()),
+		"last_build":     s.lastBuildTime,
+		"last_build_ms":  s.lastBuildTook.Milliseconds(),
+		"pages":          len(s.pages),
+	}
+}
+
+// Commit from -ldflags, falling back to the VCS info embedded by go build
+func vcsCommit() string {
+	if Commit != "" {
+		return Commit
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" {
+				return s.Value
+			}
+		}
+	}
+	return "unknown"
+}
@@ -0,0 +1,48 @@
+package gomd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/core6quad/GOMD/compiler"
+	"github.com/core6quad/GOMD/lint"
+	"github.com/core6quad/GOMD/plugin"
+)
+
+// Lint runs the content checks, the built-in ones and those of plugins,
+// on every .gmd page of the source dir, or only on files when given
+func (s *Site) Lint(files ...string) ([]lint.Problem, error) {
+	checks, err := lint.Checks(s.Config.Lint)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range s.Plugins {
+		if h, ok := p.(plugin.LintHook); ok {
+			for name, check := range h.LintChecks() {
+				checks[name] = check
+			}
+		}
+	}
+	for _, name := range s.Config.Lint.Disable {
+		delete(checks, name)
+	}
+	pages := make([]string, 0, len(files))
+	for _, f := range files {
+		rel, err := filepath.Rel(s.Config.SrcDir, f)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return nil, fmt.Errorf("%s is not in the source dir %s", f, s.Config.SrcDir)
+		}
+		pages = append(pages, filepath.ToSlash(rel))
+	}
+	if len(files) == 0 {
+		opts, err := s.compilerOptions()
+		if err != nil {
+			return nil, err
+		}
+		if pages, err = compiler.PageSources(opts); err != nil {
+			return nil, err
+		}
+	}
+	return lint.Run(s.Config.SrcDir, pages, checks)
+}
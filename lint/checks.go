@@ -0,0 +1,180 @@
+package lint
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/core6quad/GOMD/plugin"
+)
+
+// Parts of a prose line that aren't prose: inline code, HTML tags and
+// comments, shortcodes, URLs, link targets, fastlink paths, footnote
+// references and emoji shortcodes
+var notProseRe = regexp.MustCompile("`[^`]*`|<!--.*?-->|<[^>]*>|\\{\\{.*?\\}\\}|[a-z][a-z0-9+.-]*://\\S+|\\]\\([^)]*\\)|\\([^)\\s]+\\)\\[|\\[\\^[^\\]]*\\]|:[a-z0-9_+-]+:")
+
+func proseText(text string) string {
+	return notProseRe.ReplaceAllString(text, " ")
+}
+
+var wordRe = regexp.MustCompile(`\pL+(?:['’]\pL+)*`)
+
+// Words of every dictionary and the site's own, lower-cased
+type dictionary map[string]bool
+
+func loadDictionary(files, words []string) (dictionary, error) {
+	dict := make(dictionary)
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("lint dictionary: %w", err)
+		}
+		sc := bufio.NewScanner(f)
+		for first := true; sc.Scan(); first = false {
+			word := strings.TrimSpace(sc.Text())
+			// hunspell: a word count on the first line, affix flags
+			// after a slash
+			if first {
+				if _, err := strconv.Atoi(word); err == nil {
+					continue
+				}
+			}
+			word, _, _ = strings.Cut(word, "/")
+			if word != "" {
+				dict[strings.ToLower(word)] = true
+			}
+		}
+		f.Close()
+		if err := sc.Err(); err != nil {
+			return nil, fmt.Errorf("lint dictionary %s: %w", name, err)
+		}
+	}
+	for _, w := range words {
+		dict[strings.ToLower(w)] = true
+	}
+	return dict, nil
+}
+
+func (d dictionary) knows(word string) bool {
+	lower := strings.ToLower(strings.ReplaceAll(word, "’", "'"))
+	if d[lower] {
+		return true
+	}
+	base, ok := strings.CutSuffix(lower, "'s")
+	return ok && d[base]
+}
+
+// Acronyms, CamelCase names and the like aren't in dictionaries
+func skipWord(word string) bool {
+	if utf8.RuneCountInString(word) < 2 {
+		return true
+	}
+	for i, r := range word {
+		if i > 0 && unicode.IsUpper(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Words of the prose missing from the dictionary, each once a line
+func spelling(dict dictionary) plugin.LintCheck {
+	return func(page *plugin.Page, source []byte) []plugin.LintFinding {
+		var found []plugin.LintFinding
+		for i, l := range parseLines(source) {
+			if l.kind != prose {
+				continue
+			}
+			seen := make(map[string]bool)
+			for _, word := range wordRe.FindAllString(proseText(l.text), -1) {
+				if skipWord(word) || seen[word] || dict.knows(word) {
+					continue
+				}
+				seen[word] = true
+				found = append(found, plugin.LintFinding{Line: i + 1, Message: fmt.Sprintf("unknown word %q", word)})
+			}
+		}
+		return found
+	}
+}
+
+// Words and phrases that shouldn't be used, matched as whole words
+// whatever their case
+func forbidden(words map[string]string) plugin.LintCheck {
+	type rule struct {
+		re   *regexp.Regexp
+		word string
+		hint string
+	}
+	var rules []rule
+	for word, hint := range words {
+		re := regexp.MustCompile(`(?i)(^|[^\pL\pN])` + regexp.QuoteMeta(word) + `($|[^\pL\pN])`)
+		rules = append(rules, rule{re, word, hint})
+	}
+	return func(page *plugin.Page, source []byte) []plugin.LintFinding {
+		var found []plugin.LintFinding
+		for i, l := range parseLines(source) {
+			if l.kind != prose {
+				continue
+			}
+			text := proseText(l.text)
+			for _, r := range rules {
+				if !r.re.MatchString(text) {
+					continue
+				}
+				msg := fmt.Sprintf("%q", r.word)
+				if r.hint != "" {
+					msg += ", " + r.hint
+				}
+				found = append(found, plugin.LintFinding{Line: i + 1, Message: msg})
+			}
+		}
+		return found
+	}
+}
+
+// Lines of code blocks too long to read without scrolling
+func codeLines(max int) plugin.LintCheck {
+	return func(page *plugin.Page, source []byte) []plugin.LintFinding {
+		var found []plugin.LintFinding
+		for i, l := range parseLines(source) {
+			if n := utf8.RuneCountInString(l.text); l.kind == code && max > 0 && n > max {
+				found = append(found, plugin.LintFinding{Line: i + 1, Message: fmt.Sprintf("code line is %d characters, longer than %d", n, max)})
+			}
+		}
+		return found
+	}
+}
+
+// Markers of unfinished text, in the prose and its HTML comments
+func markers(names []string) plugin.LintCheck {
+	if len(names) == 0 {
+		return func(*plugin.Page, []byte) []plugin.LintFinding { return nil }
+	}
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = regexp.QuoteMeta(n)
+	}
+	re := regexp.MustCompile(`\b(?:` + strings.Join(quoted, "|") + `)\b.*`)
+	return func(page *plugin.Page, source []byte) []plugin.LintFinding {
+		var found []plugin.LintFinding
+		for i, l := range parseLines(source) {
+			if l.kind != prose {
+				continue
+			}
+			if m := re.FindString(l.text); m != "" {
+				m = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(m), "-->"))
+				if len(m) > 60 {
+					m = m[:57] + "..."
+				}
+				found = append(found, plugin.LintFinding{Line: i + 1, Message: m})
+			}
+		}
+		return found
+	}
+}
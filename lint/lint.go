@@ -0,0 +1,127 @@
+// Package lint checks the markdown sources of a site for `gomd lint`:
+// spelling, forbidden words, long lines in code blocks and TODO markers,
+// plus the checks of plugins
+package lint
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/core6quad/GOMD/config"
+	"github.com/core6quad/GOMD/plugin"
+)
+
+// Problem is what a check found, at a line of a source file
+type Problem struct {
+	File    string
+	Line    int
+	Check   string
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s", p.File, p.Line, p.Check, p.Message)
+}
+
+// Checks returns the built-in checks set up by c, by name. Spelling is
+// left out without a dictionary
+func Checks(c config.LintConfig) (map[string]plugin.LintCheck, error) {
+	checks := map[string]plugin.LintCheck{
+		"forbidden":  forbidden(c.Forbidden),
+		"code-lines": codeLines(c.MaxCodeLine),
+		"todo":       markers(c.Markers),
+	}
+	if len(c.Dictionaries) > 0 {
+		dict, err := loadDictionary(c.Dictionaries, c.Words)
+		if err != nil {
+			return nil, err
+		}
+		checks["spelling"] = spelling(dict)
+	}
+	return checks, nil
+}
+
+// Run every check on the pages, given by their path relative to srcDir.
+// Problems are sorted by file and line
+func Run(srcDir string, pages []string, checks map[string]plugin.LintCheck) ([]Problem, error) {
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var problems []Problem
+	for _, rel := range pages {
+		file := filepath.Join(srcDir, filepath.FromSlash(rel))
+		source, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		source = bytes.ReplaceAll(source, []byte("\r\n"), []byte("\n"))
+		url := "/" + strings.TrimSuffix(rel, filepath.Ext(rel))
+		page := &plugin.Page{Source: rel, URL: url}
+		for _, name := range names {
+			for _, f := range checks[name](page, source) {
+				problems = append(problems, Problem{file, f.Line, name, f.Message})
+			}
+		}
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].File != problems[j].File {
+			return problems[i].File < problems[j].File
+		}
+		return problems[i].Line < problems[j].Line
+	})
+	return problems, nil
+}
+
+// What a line of a page source is
+type lineKind int
+
+const (
+	prose lineKind = iota
+	frontMatter
+	// A ``` or ~~~ line
+	fence
+	code
+)
+
+type line struct {
+	kind lineKind
+	text string
+}
+
+// Split a page source into lines, marking the front matter and fenced
+// code blocks
+func parseLines(source []byte) []line {
+	var lines []line
+	sc := bufio.NewScanner(bytes.NewReader(source))
+	sc.Buffer(nil, 1<<20)
+	inFront := false
+	open := ""
+	for n := 0; sc.Scan(); n++ {
+		text := sc.Text()
+		trimmed := strings.TrimSpace(text)
+		kind := prose
+		switch {
+		case n == 0 && text == "---":
+			inFront, kind = true, frontMatter
+		case inFront:
+			kind = frontMatter
+			inFront = text != "---"
+		case open != "":
+			kind = code
+			if strings.HasPrefix(trimmed, open) {
+				kind, open = fence, ""
+			}
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			kind, open = fence, trimmed[:3]
+		}
+		lines = append(lines, line{kind, text})
+	}
+	return lines
+}
@@ -0,0 +1,39 @@
+package gomd
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+
+	"github.com/core6quad/GOMD/auth"
+)
+
+var maintenanceForm = template.Must(template.New("maintenance").Parse(`
+{{if .File}}<p>The source dir has a <code>maintenance.gmd</code>, so visitors get the maintenance page until it is removed.</p>
+{{else if .On}}<p>Maintenance mode is <strong>on</strong>: visitors get the maintenance page, admins and allowed IPs still see the site.</p>
+{{else}}<p>Maintenance mode is off.</p>{{end}}
+<form method="post">{{.CSRF}}{{if .On}}<button name="on" value="false">Switch off</button>{{else}}<button class="danger" name="on" value="true">Switch on</button>{{end}}</form>
+<p class="empty">The switch lasts until the next restart, set <code>"maintenance": true</code> in config.json to keep it on.</p>
+`))
+
+// Admin section switching maintenance mode
+func (s *Site) serveMaintenance(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		on := r.PostFormValue("on") == "true"
+		s.Server.SetMaintenance(on)
+		action := "maintenance off"
+		if on {
+			action = "maintenance on"
+		}
+		s.Audit.RecordRequest(r, action, "")
+		http.Redirect(w, r, s.Config.BasePath+r.URL.Path, http.StatusSeeOther)
+		return
+	}
+	var buf bytes.Buffer
+	maintenanceForm.Execute(&buf, map[string]interface{}{
+		"On":   s.Server.Maintenance(),
+		"File": s.Server.MaintenanceFile(),
+		"CSRF": auth.CSRFField(r),
+	})
+	s.Admin.Render(w, r, "Maintenance", template.HTML(buf.String()))
+}
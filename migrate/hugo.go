@@ -0,0 +1,317 @@
+package migrate
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Hugo's config files, newest name first
+var hugoConfigs = []string{"hugo.toml", "hugo.yaml", "hugo.yml", "hugo.json", "config.toml", "config.yaml", "config.yml", "config.json", "config/_default/hugo.toml", "config/_default/config.toml", "config/_default/hugo.yaml", "config/_default/config.yaml"}
+
+func (im *importer) hugoConfig() (map[string]interface{}, error) {
+	for _, name := range hugoConfigs {
+		data, err := os.ReadFile(filepath.Join(im.src, filepath.FromSlash(name)))
+		if err != nil {
+			continue
+		}
+		cfg := make(map[string]interface{})
+		switch path.Ext(name) {
+		case ".toml":
+			cfg, err = parseTOML(data)
+		case ".json":
+			err = json.Unmarshal(data, &cfg)
+		default:
+			err = yaml.Unmarshal(data, &cfg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return cfg, nil
+	}
+	return map[string]interface{}{}, nil
+}
+
+// A Hugo page found in the content dir
+type hugoPage struct {
+	page
+	rel string // in the content dir
+	// Leaf bundles (dir/index.md) take their dir's files along
+	bundle string
+}
+
+func (im *importer) hugo() error {
+	cfg, err := im.hugoConfig()
+	if err != nil {
+		return err
+	}
+	if title, ok := cfg["title"].(string); ok && title != "" {
+		im.report.Config["site_name"] = title
+	}
+	if base, ok := cfg["baseURL"].(string); ok && strings.Contains(base, "://") {
+		im.report.Config["site_url"] = strings.TrimSuffix(base, "/")
+	}
+	permalinks := make(map[string]string)
+	if p, ok := cfg["permalinks"].(map[string]interface{}); ok {
+		// Newer configs nest them under page
+		if page, ok := p["page"].(map[string]interface{}); ok {
+			p = page
+		}
+		for section, pattern := range p {
+			if s, ok := pattern.(string); ok {
+				permalinks[section] = s
+			}
+		}
+	}
+	contentDir := "content"
+	if dir, ok := cfg["contentDir"].(string); ok && dir != "" {
+		contentDir = dir
+	}
+	content := filepath.Join(im.src, contentDir)
+
+	// Every page is placed first, so refs between them can be resolved
+	var pages []*hugoPage
+	bundles := make(map[string]string)
+	var files []string
+	err = filepath.WalkDir(content, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(content, p)
+		rel = filepath.ToSlash(rel)
+		if strings.HasPrefix(d.Name(), ".") && rel != "." {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if ext := path.Ext(rel); ext != ".md" && ext != ".markdown" {
+			files = append(files, rel)
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		fm, body, err := splitFrontMatter(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		hp := &hugoPage{page: page{source: path.Join(contentDir, rel), fm: fm, body: body}, rel: rel}
+		hp.out = hugoOutput(rel, fm, permalinks)
+		if strings.TrimSuffix(path.Base(rel), path.Ext(rel)) == "index" {
+			hp.bundle = path.Dir(rel)
+			bundles[hp.bundle] = path.Dir(hp.out)
+		}
+		pages = append(pages, hp)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	byPath := make(map[string]string)
+	for _, p := range pages {
+		url := "/" + strings.TrimSuffix(p.out, ".gmd")
+		if url == "/index" {
+			url = "/"
+		}
+		byPath[p.rel] = url
+		byPath[strings.TrimSuffix(p.rel, path.Ext(p.rel))] = url
+		if p.bundle != "" {
+			byPath[p.bundle] = url
+		}
+	}
+	for _, p := range pages {
+		p.body = im.hugoContent(p.source, p.body, p.rel, byPath)
+		p.fm = im.frontMatter(p.source, p.fm)
+		if err := im.writePage(&p.page); err != nil {
+			return err
+		}
+	}
+	for _, rel := range files {
+		out := rel
+		// Bundle files move with their page
+		for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+			if to, ok := bundles[dir]; ok {
+				out = path.Join(to, strings.TrimPrefix(rel, dir+"/"))
+				break
+			}
+		}
+		if err := im.copy(filepath.Join(content, filepath.FromSlash(rel)), out); err != nil {
+			return err
+		}
+	}
+	if err := im.copyDir(filepath.Join(im.src, "static"), "", nil); err != nil {
+		return err
+	}
+	for _, dir := range []string{"layouts", "themes", "assets", "data", "i18n"} {
+		if _, err := os.Stat(filepath.Join(im.src, dir)); err == nil {
+			im.report.warn("%s/ isn't converted: layouts go in templates/page.html, assets in assets/", dir)
+		}
+	}
+	return nil
+}
+
+// Where a page goes: its url, its section's permalink pattern, or the
+// same place in the content dir (sections' _index.md becoming index.gmd)
+func hugoOutput(rel string, fm map[string]interface{}, permalinks map[string]string) string {
+	if url, ok := fm["url"].(string); ok && url != "" {
+		return urlPath(url)
+	}
+	dir, file := path.Split(rel)
+	name := strings.TrimSuffix(file, path.Ext(file))
+	if name == "_index" {
+		return path.Join(dir, "index.gmd")
+	}
+	bundle := name == "index"
+	if bundle {
+		dir, name = path.Split(strings.TrimSuffix(dir, "/"))
+	}
+	slug := name
+	if s, ok := fm["slug"].(string); ok && s != "" {
+		slug = s
+	}
+	section, _, _ := strings.Cut(rel, "/")
+	if pattern, ok := permalinks[section]; ok && strings.Contains(rel, "/") {
+		vars := map[string]string{"slug": slug, "filename": name, "section": section, "sections": strings.TrimSuffix(dir, "/")}
+		if title, ok := fm["title"].(string); ok {
+			vars["title"] = slugify(title)
+		} else {
+			vars["title"] = slugify(name)
+		}
+		vars["slugorfilename"] = slug
+		vars["contentbasename"] = name
+		if t, ok := parseDate(fm["date"]); ok {
+			dateVars(vars, t)
+		}
+		out := urlPath(expandPermalink(pattern, vars))
+		if bundle {
+			out = strings.TrimSuffix(out, ".gmd") + "/index.gmd"
+		}
+		return out
+	}
+	if bundle {
+		return path.Join(dir, slug, "index.gmd")
+	}
+	return path.Join(dir, slug+".gmd")
+}
+
+var (
+	hugoShortcodeRe = regexp.MustCompile(`\{\{[<%]\s*(/?)\s*([\w/-]+)((?:"(?:[^"\\]|\\.)*"|[^"])*?)\s*[>%]\}\}`)
+	hugoArgRe       = regexp.MustCompile(`(?:(\w+)=)?("(?:[^"\\]|\\.)*"|` + "`[^`]*`" + `|[^\s"]+)`)
+)
+
+// Turn Hugo's built-in shortcodes into markdown or HTML. Others are left
+// as they are, with a warning
+func (im *importer) hugoContent(source, body, rel string, byPath map[string]string) string {
+	unknown := make(map[string]bool)
+	body = hugoShortcodeRe.ReplaceAllStringFunc(body, func(m string) string {
+		sm := hugoShortcodeRe.FindStringSubmatch(m)
+		closing, name := sm[1] == "/", sm[2]
+		var pos []string
+		named := make(map[string]string)
+		for _, a := range hugoArgRe.FindAllStringSubmatch(sm[3], -1) {
+			v := a[2]
+			if len(v) >= 2 && (v[0] == '"' || v[0] == '`') {
+				v = strings.ReplaceAll(v[1:len(v)-1], `\"`, `"`)
+			}
+			if a[1] != "" {
+				named[a[1]] = v
+			} else {
+				pos = append(pos, v)
+			}
+		}
+		arg := func(key string, i int) string {
+			if v, ok := named[key]; ok {
+				return v
+			}
+			if i >= 0 && i < len(pos) {
+				return pos[i]
+			}
+			return ""
+		}
+		switch name {
+		case "highlight":
+			if closing {
+				return "```"
+			}
+			return "```" + arg("", 0)
+		case "figure":
+			img := fmt.Sprintf("![%s](%s", arg("alt", -1), arg("src", -1))
+			if t := arg("title", -1); t != "" {
+				img += fmt.Sprintf(" %q", t)
+			}
+			img += ")"
+			if link := arg("link", -1); link != "" {
+				img = "[" + img + "](" + link + ")"
+			}
+			if c := arg("caption", -1); c != "" {
+				img += "\n*" + c + "*"
+			}
+			return img
+		case "youtube":
+			return fmt.Sprintf(`<iframe src="https://www.youtube-nocookie.com/embed/%s" width="560" height="315" allowfullscreen loading="lazy"></iframe>`, html.EscapeString(arg("id", 0)))
+		case "vimeo":
+			return fmt.Sprintf(`<iframe src="https://player.vimeo.com/video/%s" width="560" height="315" allowfullscreen loading="lazy"></iframe>`, html.EscapeString(arg("id", 0)))
+		case "gist":
+			return fmt.Sprintf(`<script src="https://gist.github.com/%s/%s.js"></script>`, html.EscapeString(arg("", 0)), html.EscapeString(arg("", 1)))
+		case "ref", "relref":
+			target, anchor, _ := strings.Cut(arg("path", 0), "#")
+			target = strings.TrimPrefix(target, "/")
+			if url, ok := hugoRef(target, rel, byPath); ok {
+				if anchor != "" {
+					url += "#" + anchor
+				}
+				return url
+			}
+			im.report.warn("%s: can't find the page of %s", source, m)
+			return m
+		}
+		unknown[name] = true
+		return m
+	})
+	names := make([]string, 0, len(unknown))
+	for name := range unknown {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		im.report.warn("%s: shortcode %q needs converting by hand, e.g. to a plugin shortcode", source, name)
+	}
+	return body
+}
+
+// Find a ref'd page, relative to the page or to the content dir
+func hugoRef(target, rel string, byPath map[string]string) (string, bool) {
+	for _, p := range []string{path.Join(path.Dir(rel), target), target} {
+		if url, ok := byPath[p]; ok {
+			return url, true
+		}
+		if url, ok := byPath[strings.TrimSuffix(p, path.Ext(p))]; ok {
+			return url, true
+		}
+	}
+	// Just a file name, anywhere
+	paths := make([]string, 0, len(byPath))
+	for p := range byPath {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		if path.Base(p) == target {
+			return byPath[p], true
+		}
+	}
+	return "", false
+}
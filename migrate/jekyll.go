@@ -0,0 +1,285 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Jekyll's built-in permalink styles
+var jekyllStyles = map[string]string{
+	"date":    "/:categories/:year/:month/:day/:title:output_ext",
+	"pretty":  "/:categories/:year/:month/:day/:title/",
+	"ordinal": "/:categories/:year/:y_day/:title:output_ext",
+	"none":    "/:categories/:title:output_ext",
+}
+
+// Left out of every Jekyll site
+var jekyllExclude = []string{"Gemfile", "Gemfile.lock", "node_modules", "vendor", "package.json", "package-lock.json"}
+
+var postNameRe = regexp.MustCompile(`^(\d{4}-\d\d-\d\d)-(.+)\.(md|markdown)$`)
+
+type jekyllConfig struct {
+	Title     string   `yaml:"title"`
+	URL       string   `yaml:"url"`
+	BaseURL   string   `yaml:"baseurl"`
+	Permalink string   `yaml:"permalink"`
+	Exclude   []string `yaml:"exclude"`
+}
+
+func (im *importer) jekyll() error {
+	var cfg jekyllConfig
+	if data, err := os.ReadFile(filepath.Join(im.src, "_config.yml")); err == nil {
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return fmt.Errorf("_config.yml: %w", err)
+		}
+	}
+	if cfg.Title != "" {
+		im.report.Config["site_name"] = cfg.Title
+	}
+	if cfg.URL != "" {
+		im.report.Config["site_url"] = strings.TrimSuffix(cfg.URL+cfg.BaseURL, "/")
+	}
+	if cfg.BaseURL != "" {
+		im.report.Config["base_path"] = cfg.BaseURL
+	}
+	pattern := cfg.Permalink
+	if pattern == "" {
+		pattern = "date"
+	}
+	if style, ok := jekyllStyles[pattern]; ok {
+		pattern = style
+	}
+	exclude := append(jekyllExclude, cfg.Exclude...)
+
+	var pages []*page
+	urls := make(map[string]string)
+	err := filepath.WalkDir(im.src, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(im.src, p)
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+		name := d.Name()
+		if d.IsDir() {
+			switch {
+			case name == "_posts" || name == "_drafts":
+				return nil
+			case strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".") || jekyllExcluded(rel, exclude):
+				if strings.HasPrefix(name, "_") && name != "_site" && name != "_layouts" && name != "_includes" && name != "_sass" && name != "_data" {
+					im.report.warn("%s/ isn't converted, collections other than posts need moving by hand", rel)
+				}
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || jekyllExcluded(rel, exclude) {
+			return nil
+		}
+		dir := path.Dir(rel)
+		inPosts := strings.HasSuffix(dir, "_posts") || strings.Contains(dir, "_posts/")
+		inDrafts := strings.HasSuffix(dir, "_drafts") || strings.Contains(dir, "_drafts/")
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		ext := path.Ext(name)
+		if ext != ".md" && ext != ".markdown" {
+			return im.jekyllFile(p, rel, data)
+		}
+		fm, body, err := splitFrontMatter(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		pg := &page{source: rel, fm: fm, body: body}
+		switch {
+		case inPosts || inDrafts:
+			m := postNameRe.FindStringSubmatch(name)
+			slug := strings.TrimSuffix(name, ext)
+			if m != nil {
+				slug = m[2]
+				if _, ok := fm["date"]; !ok {
+					fm["date"] = m[1]
+				}
+			} else if inPosts {
+				im.report.warn("%s: post names start with their date, YYYY-MM-DD-", rel)
+			}
+			if inDrafts {
+				fm["draft"] = true
+				// Jekyll dates drafts by their modification time
+				if fi, err := d.Info(); err == nil && fm["date"] == nil {
+					fm["date"] = fi.ModTime().Format("2006-01-02")
+				}
+			}
+			pg.out = jekyllPostOutput(pattern, rel, slug, fm)
+			urls[strings.TrimSuffix(name, ext)] = pageURL(pg.out)
+		default:
+			pg.out = strings.TrimSuffix(rel, ext) + ".gmd"
+			if link, ok := fm["permalink"].(string); ok && link != "" {
+				pg.out = urlPath(link)
+			}
+		}
+		urls[rel] = pageURL(pg.out)
+		pages = append(pages, pg)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, pg := range pages {
+		pg.body = im.liquid(pg.source, pg.body, urls)
+		pg.fm = im.frontMatter(pg.source, pg.fm)
+		if err := im.writePage(pg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Static files are copied. Stylesheets lose their (empty) front matter,
+// other files with front matter are Liquid templates and are left out
+func (im *importer) jekyllFile(file, rel string, data []byte) error {
+	if !strings.HasPrefix(string(data), "---\n") && !strings.HasPrefix(string(data), "---\r\n") {
+		return im.copy(file, rel)
+	}
+	switch path.Ext(rel) {
+	case ".scss", ".sass", ".css":
+		_, body, err := splitFrontMatter(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		if err := im.write(rel, []byte(body)); err != nil {
+			return err
+		}
+		im.report.Files++
+		if body != "" && strings.Contains(body, "{{") {
+			im.report.warn("%s uses Liquid, which sass doesn't know", rel)
+		}
+		return nil
+	}
+	im.report.warn("%s is a Liquid template, make it a layout or a page by hand", rel)
+	return nil
+}
+
+func jekyllExcluded(rel string, exclude []string) bool {
+	for _, e := range exclude {
+		e = strings.Trim(e, "/")
+		if rel == e || strings.HasPrefix(rel, e+"/") {
+			return true
+		}
+		if ok, _ := path.Match(e, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Where a post goes: its permalink or the site's pattern, with categories
+// from its front matter and the directories above _posts
+func jekyllPostOutput(pattern, rel, slug string, fm map[string]interface{}) string {
+	if link, ok := fm["permalink"].(string); ok && link != "" {
+		pattern = link
+	}
+	var categories []string
+	if before, _, ok := strings.Cut(rel, "_posts/"); ok && before != "" {
+		categories = strings.Split(strings.Trim(before, "/"), "/")
+	}
+	categories = append(categories, stringList(fm["categories"])...)
+	categories = append(categories, stringList(fm["category"])...)
+	for i, c := range categories {
+		categories[i] = slugify(c)
+	}
+	vars := map[string]string{
+		"title":      slug,
+		"slug":       slug,
+		"categories": strings.Join(categories, "/"),
+		"output_ext": ".html",
+	}
+	if t, ok := parseDate(fm["date"]); ok {
+		dateVars(vars, t)
+		vars["y_day"] = t.Format("002")
+	}
+	return urlPath(expandPermalink(pattern, vars))
+}
+
+func pageURL(out string) string {
+	url := "/" + strings.TrimSuffix(out, ".gmd")
+	if url == "/index" {
+		return "/"
+	}
+	return url
+}
+
+var (
+	liquidTagRe = regexp.MustCompile(`\{%-?\s*(\w+)\s*(.*?)\s*-?%\}`)
+	liquidVarRe = regexp.MustCompile(`\{\{-?\s*(.*?)\s*-?\}\}`)
+	kramdownRe  = regexp.MustCompile(`(?m)^\{:[^}\n]*\}[ \t]*\n?`)
+)
+
+// Convert the Liquid tags that matter to content: highlight blocks, links
+// to posts and pages and the base URL. The rest is left with a warning
+func (im *importer) liquid(source, body string, urls map[string]string) string {
+	unknown := make(map[string]bool)
+	raw := false
+	body = liquidTagRe.ReplaceAllStringFunc(body, func(m string) string {
+		sm := liquidTagRe.FindStringSubmatch(m)
+		tag, args := sm[1], strings.Trim(sm[2], `"'`)
+		switch {
+		case tag == "raw":
+			raw = true
+			return ""
+		case tag == "endraw":
+			raw = false
+			return ""
+		case raw:
+			return m
+		case tag == "highlight":
+			lang, _, _ := strings.Cut(args, " ")
+			return "\n```" + lang
+		case tag == "endhighlight":
+			return "```"
+		case tag == "post_url", tag == "link":
+			if url, ok := urls[strings.TrimPrefix(args, "/")]; ok {
+				return url
+			}
+			im.report.warn("%s: can't find the page of %s", source, m)
+			return m
+		}
+		unknown[tag] = true
+		return m
+	})
+	body = liquidVarRe.ReplaceAllStringFunc(body, func(m string) string {
+		expr := liquidVarRe.FindStringSubmatch(m)[1]
+		switch {
+		case expr == "site.baseurl" || expr == "site.url":
+			return ""
+		case strings.HasSuffix(expr, "| relative_url") || strings.HasSuffix(expr, "| absolute_url"):
+			v, _, _ := strings.Cut(expr, "|")
+			return strings.Trim(strings.TrimSpace(v), `"'`)
+		}
+		unknown["{{ "+expr+" }}"] = true
+		return m
+	})
+	if kramdownRe.MatchString(body) {
+		body = kramdownRe.ReplaceAllString(body, "")
+		im.report.warn("%s: kramdown attribute lists like {: .class} were removed", source)
+	}
+	names := make([]string, 0, len(unknown))
+	for name := range unknown {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		im.report.warn("%s: Liquid %s needs converting by hand", source, name)
+	}
+	return body
+}
@@ -0,0 +1,367 @@
+// Package migrate converts Hugo and Jekyll sites into a GOMD source dir:
+// pages become .gmd files where their permalinks put them, front matter is
+// renamed to GOMD's keys and static files are copied along.
+package migrate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Report says what an import did
+type Report struct {
+	Pages int // .gmd files written
+	Files int // static files copied
+	// Warnings are things that need a look by hand, like unknown
+	// shortcodes or templates
+	Warnings []string
+	// Config has config.json settings taken from the site's config
+	Config map[string]interface{}
+}
+
+func (r *Report) warn(format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Import converts the site in src, "hugo" or "jekyll", into dst. Files
+// already in dst are only overwritten with force
+func Import(from, src, dst string, force bool) (*Report, error) {
+	if fi, err := os.Stat(src); err != nil {
+		return nil, err
+	} else if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", src)
+	}
+	im := &importer{src: src, dst: dst, force: force, report: &Report{Config: make(map[string]interface{})}}
+	var err error
+	switch from {
+	case "hugo":
+		err = im.hugo()
+	case "jekyll":
+		err = im.jekyll()
+	default:
+		return nil, fmt.Errorf("unknown site type %q, use hugo or jekyll", from)
+	}
+	sort.Strings(im.report.Warnings)
+	return im.report, err
+}
+
+type importer struct {
+	src, dst string
+	force    bool
+	report   *Report
+	// Pages by output path, to catch two pages ending up in one file
+	written map[string]string
+}
+
+// A page about to be written
+type page struct {
+	source string // path in the old site, for messages
+	out    string // slash-separated .gmd path in dst
+	fm     map[string]interface{}
+	body   string
+}
+
+// Write a page as front matter and body
+func (im *importer) writePage(p *page) error {
+	if im.written == nil {
+		im.written = make(map[string]string)
+	}
+	if other, ok := im.written[p.out]; ok {
+		im.report.warn("%s: skipped, %s is already written from %s", p.source, p.out, other)
+		return nil
+	}
+	im.written[p.out] = p.source
+	var b bytes.Buffer
+	if len(p.fm) > 0 {
+		fm, err := yaml.Marshal(p.fm)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.source, err)
+		}
+		b.WriteString("---\n")
+		b.Write(fm)
+		b.WriteString("---\n")
+	}
+	b.WriteString(strings.TrimLeft(p.body, "\n"))
+	if err := im.write(p.out, b.Bytes()); err != nil {
+		return err
+	}
+	im.report.Pages++
+	return nil
+}
+
+func (im *importer) write(rel string, data []byte) error {
+	file := filepath.Join(im.dst, filepath.FromSlash(rel))
+	if _, err := os.Stat(file); err == nil && !im.force {
+		return fmt.Errorf("%s already exists, use -force to overwrite it", file)
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
+
+// Copy a static file to rel in dst
+func (im *importer) copy(file, rel string) error {
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	if err := im.write(rel, data); err != nil {
+		return err
+	}
+	im.report.Files++
+	return nil
+}
+
+// Copy every file below dir into prefix of dst
+func (im *importer) copyDir(dir, prefix string, skip func(rel string) bool) error {
+	return filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == dir {
+				return nil
+			}
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if rel != "." && (strings.HasPrefix(d.Name(), ".") || skip != nil && skip(rel)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") || skip != nil && skip(rel) {
+			return nil
+		}
+		return im.copy(p, path.Join(prefix, rel))
+	})
+}
+
+// Split a page into its front matter, YAML between ---, TOML between +++
+// or a JSON object, and the rest
+func splitFrontMatter(data []byte) (map[string]interface{}, string, error) {
+	data = bytes.ReplaceAll(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), []byte("\r\n"), []byte("\n"))
+	fm := make(map[string]interface{})
+	for _, delim := range []string{"---", "+++"} {
+		if !bytes.HasPrefix(data, []byte(delim+"\n")) {
+			continue
+		}
+		rest := data[len(delim)+1:]
+		end := bytes.Index(rest, []byte("\n"+delim+"\n"))
+		block, body := []byte(nil), []byte(nil)
+		switch {
+		case bytes.HasPrefix(rest, []byte(delim+"\n")):
+			body = rest[len(delim)+1:]
+		case end >= 0:
+			block, body = rest[:end+1], rest[end+len(delim)+2:]
+		case bytes.HasSuffix(rest, []byte("\n"+delim)):
+			block = rest[:len(rest)-len(delim)]
+		default:
+			return fm, string(data), nil
+		}
+		var err error
+		if delim == "---" {
+			err = yaml.Unmarshal(block, &fm)
+		} else {
+			fm, err = parseTOML(block)
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("front matter: %w", err)
+		}
+		if fm == nil {
+			fm = make(map[string]interface{})
+		}
+		return fm, string(body), nil
+	}
+	if bytes.HasPrefix(data, []byte("{")) {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		if err := dec.Decode(&fm); err == nil {
+			return fm, string(data[dec.InputOffset():]), nil
+		}
+	}
+	return fm, string(data), nil
+}
+
+// Front matter keys renamed to GOMD's
+var renamedKeys = map[string]string{
+	"summary":     "description",
+	"excerpt":     "description",
+	"publishdate": "publish_at",
+	"publishDate": "publish_at",
+	"keywords":    "tags",
+}
+
+// Convert front matter to GOMD's conventions: dates in a format it reads,
+// drafts private, one author and tags as a list. Keys GOMD uses for
+// something else are kept under another name
+func (im *importer) frontMatter(source string, fm map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{})
+	for k, v := range fm {
+		if to, ok := renamedKeys[k]; ok {
+			if _, taken := fm[to]; !taken {
+				k = to
+			}
+		}
+		switch k {
+		case "date", "publish_at":
+			if d, ok := formatDate(v); ok {
+				out[k] = d
+			} else {
+				im.report.warn("%s: can't read the %s %v", source, k, v)
+			}
+		case "lastmod", "last_modified_at", "expirydate", "expiryDate":
+			if d, ok := formatDate(v); ok {
+				out[k] = d
+			}
+		case "draft", "published":
+			if draft, _ := v.(bool); draft == (k == "draft") {
+				out["private"] = true
+			}
+		case "tags", "categories":
+			out[k] = stringList(v)
+		case "author", "authors":
+			if list := stringList(v); len(list) > 0 {
+				out["author"] = list[0]
+			}
+		case "type", "layout":
+			// GOMD's type is the structured data type
+			out["old_"+k] = v
+		case "params":
+			// Hugo's page params are plain front matter in GOMD
+			if params, ok := v.(map[string]interface{}); ok {
+				for pk, pv := range params {
+					if _, taken := fm[pk]; !taken {
+						out[pk] = pv
+					}
+				}
+			}
+		case "aliases", "redirect_from":
+			im.report.warn("%s: the old URLs %v need redirects on the web server", source, v)
+		case "url", "slug", "permalink", "cascade", "outputs":
+			// Where the page went, or Hugo only
+		default:
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// Dates as YYYY-MM-DD, or RFC 3339 when they have a time
+func formatDate(v interface{}) (string, bool) {
+	var t time.Time
+	switch v := v.(type) {
+	case time.Time:
+		t = v
+	case string:
+		ok := false
+		for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05 -0700", "2006-01-02 15:04:05 -07:00", "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+			if parsed, err := time.Parse(layout, strings.TrimSpace(v)); err == nil {
+				t, ok = parsed, true
+				break
+			}
+		}
+		if !ok {
+			return "", false
+		}
+	default:
+		return "", false
+	}
+	if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 {
+		return t.Format("2006-01-02"), true
+	}
+	return t.Format(time.RFC3339), true
+}
+
+// A list of strings from a list or a space separated string
+func stringList(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		var out []string
+		for _, x := range v {
+			out = append(out, fmt.Sprint(x))
+		}
+		return out
+	case []string:
+		return v
+	}
+	return nil
+}
+
+// Where a page with a URL like /blog/hello/ or /about.html goes
+func urlPath(url string) string {
+	url = strings.TrimSuffix(strings.Trim(path.Clean("/"+url), "/"), ".html")
+	if url == "" || url == "." {
+		return "index.gmd"
+	}
+	return url + ".gmd"
+}
+
+var placeholderRe = regexp.MustCompile(`:(\w+)`)
+
+// Fill in a permalink pattern like /:year/:month/:title/
+func expandPermalink(pattern string, vars map[string]string) string {
+	return placeholderRe.ReplaceAllStringFunc(pattern, func(m string) string {
+		if v, ok := vars[m[1:]]; ok {
+			return v
+		}
+		return m
+	})
+}
+
+// Placeholders for a page's date
+func dateVars(vars map[string]string, t time.Time) {
+	vars["year"] = t.Format("2006")
+	vars["month"] = t.Format("01")
+	vars["i_month"] = t.Format("1")
+	vars["day"] = t.Format("02")
+	vars["i_day"] = t.Format("2")
+	vars["short_year"] = t.Format("06")
+}
+
+func parseDate(v interface{}) (time.Time, bool) {
+	s, ok := formatDate(v)
+	if !ok {
+		return time.Time{}, false
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, true
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	return t, err == nil
+}
+
+// Lower case words joined by dashes, like Jekyll and Hugo make slugs
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r > 127 {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
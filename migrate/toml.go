@@ -0,0 +1,218 @@
+package migrate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseTOML reads the TOML that front matter and site configs use: keys
+// with strings, numbers, booleans, dates and arrays, and [tables].
+// Arrays of tables ([[x]]) are skipped
+func parseTOML(data []byte) (map[string]interface{}, error) {
+	root := make(map[string]interface{})
+	cur := root
+	skipping := false
+	lines := strings.Split(string(data), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(stripComment(lines[i]))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[[") {
+			skipping = true
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			skipping = false
+			cur = root
+			for _, key := range splitKey(line[1 : len(line)-1]) {
+				next, ok := cur[key].(map[string]interface{})
+				if !ok {
+					next = make(map[string]interface{})
+					cur[key] = next
+				}
+				cur = next
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", i+1)
+		}
+		value = strings.TrimSpace(value)
+		// Arrays and multi-line strings can span lines
+		for (openBrackets(value) > 0 || strings.Count(value, `"""`) == 1) && i+1 < len(lines) {
+			i++
+			if strings.Count(value, `"""`) == 1 {
+				value += "\n" + lines[i]
+			} else {
+				value += " " + strings.TrimSpace(stripComment(lines[i]))
+			}
+		}
+		if skipping {
+			continue
+		}
+		v, rest, err := tomlValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		if strings.TrimSpace(rest) != "" {
+			return nil, fmt.Errorf("line %d: unexpected %q", i+1, rest)
+		}
+		keys := splitKey(key)
+		m := cur
+		for _, k := range keys[:len(keys)-1] {
+			next, ok := m[k].(map[string]interface{})
+			if !ok {
+				next = make(map[string]interface{})
+				m[k] = next
+			}
+			m = next
+		}
+		m[keys[len(keys)-1]] = v
+	}
+	return root, nil
+}
+
+// Dotted keys, each maybe quoted
+func splitKey(s string) []string {
+	var keys []string
+	for _, k := range strings.Split(s, ".") {
+		keys = append(keys, strings.Trim(strings.TrimSpace(k), `"'`))
+	}
+	return keys
+}
+
+// Drop a # comment that isn't inside a string
+func stripComment(line string) string {
+	quote := byte(0)
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// How many [ are still open, outside strings
+func openBrackets(s string) int {
+	n := 0
+	quote := byte(0)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			n++
+		case c == ']' || c == '}':
+			n--
+		}
+	}
+	return n
+}
+
+// Parse the value at the start of s, returning what follows it
+func tomlValue(s string) (interface{}, string, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(s, `"""`):
+		end := strings.Index(s[3:], `"""`)
+		if end < 0 {
+			return nil, "", fmt.Errorf("unterminated string")
+		}
+		return strings.TrimPrefix(s[3:3+end], "\n"), s[6+end:], nil
+	case strings.HasPrefix(s, `"`):
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+				continue
+			}
+			if s[i] == '"' {
+				v, err := strconv.Unquote(s[:i+1])
+				return v, s[i+1:], err
+			}
+		}
+		return nil, "", fmt.Errorf("unterminated string")
+	case strings.HasPrefix(s, "'"):
+		end := strings.Index(s[1:], "'")
+		if end < 0 {
+			return nil, "", fmt.Errorf("unterminated string")
+		}
+		return s[1 : 1+end], s[2+end:], nil
+	case strings.HasPrefix(s, "["):
+		var list []interface{}
+		rest := strings.TrimSpace(s[1:])
+		for !strings.HasPrefix(rest, "]") {
+			v, r, err := tomlValue(rest)
+			if err != nil {
+				return nil, "", err
+			}
+			list = append(list, v)
+			rest = strings.TrimSpace(r)
+			rest = strings.TrimSpace(strings.TrimPrefix(rest, ","))
+			if rest == "" {
+				return nil, "", fmt.Errorf("unterminated array")
+			}
+		}
+		return list, rest[1:], nil
+	case strings.HasPrefix(s, "{"):
+		m := make(map[string]interface{})
+		rest := strings.TrimSpace(s[1:])
+		for !strings.HasPrefix(rest, "}") {
+			key, r, ok := strings.Cut(rest, "=")
+			if !ok {
+				return nil, "", fmt.Errorf("bad inline table")
+			}
+			v, r, err := tomlValue(r)
+			if err != nil {
+				return nil, "", err
+			}
+			m[strings.Trim(strings.TrimSpace(key), `"'`)] = v
+			rest = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(r), ","))
+			if rest == "" {
+				return nil, "", fmt.Errorf("unterminated inline table")
+			}
+		}
+		return m, rest[1:], nil
+	}
+	end := strings.IndexAny(s, ",]}")
+	if end < 0 {
+		end = len(s)
+	}
+	word, rest := strings.TrimSpace(s[:end]), s[end:]
+	switch word {
+	case "true":
+		return true, rest, nil
+	case "false":
+		return false, rest, nil
+	}
+	if n, err := strconv.ParseInt(strings.ReplaceAll(word, "_", ""), 0, 64); err == nil {
+		return n, rest, nil
+	}
+	if f, err := strconv.ParseFloat(strings.ReplaceAll(word, "_", ""), 64); err == nil {
+		return f, rest, nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, word); err == nil {
+			return t, rest, nil
+		}
+	}
+	return nil, "", fmt.Errorf("can't read %q", word)
+}
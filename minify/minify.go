@@ -0,0 +1,145 @@
+// Package minify shrinks compiled pages and the CSS, JS, SVG, JSON and XML
+// the site serves, with tdewolff/minify. Files that fail to minify are
+// kept as they are.
+package minify
+
+import (
+	"bytes"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/core6quad/GOMD/config"
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/minify/v2/css"
+	"github.com/tdewolff/minify/v2/html"
+	"github.com/tdewolff/minify/v2/js"
+	"github.com/tdewolff/minify/v2/json"
+	"github.com/tdewolff/minify/v2/svg"
+	"github.com/tdewolff/minify/v2/xml"
+)
+
+// Media types by extension, anything else is left alone
+var types = map[string]string{
+	".html":        "text/html",
+	".htm":         "text/html",
+	".css":         "text/css",
+	".js":          "application/javascript",
+	".mjs":         "application/javascript",
+	".svg":         "image/svg+xml",
+	".json":        "application/json",
+	".webmanifest": "application/json",
+	".xml":         "text/xml",
+}
+
+// Minifier minifies files by name. A nil Minifier leaves everything as is
+type Minifier struct {
+	m *minify.M
+	// Exclude are glob patterns of files kept as they are, matched against
+	// the slash-separated path and the file name, e.g. "vendor/*" or "*.min.js"
+	Exclude []string
+
+	mu    sync.Mutex
+	cache map[string]cached
+}
+
+type cached struct {
+	modTime time.Time
+	size    int64
+	data    []byte
+}
+
+// New returns the minifier for the config, or nil when minification is off
+func New(cfg config.MinifyConfig) *Minifier {
+	if !cfg.Enabled {
+		return nil
+	}
+	m := minify.New()
+	// Keep the markup layouts, feeds and scripts may rely on
+	m.Add("text/html", &html.Minifier{KeepDocumentTags: true, KeepEndTags: true, KeepQuotes: true, KeepSpecialComments: true})
+	m.AddFunc("text/css", css.Minify)
+	m.AddFuncRegexp(regexp.MustCompile(`^(application|text)/(x-)?(java|ecma)script$`), js.Minify)
+	m.AddFunc("image/svg+xml", svg.Minify)
+	m.AddFunc("application/json", json.Minify)
+	m.AddFuncRegexp(regexp.MustCompile(`[/+]xml$`), xml.Minify)
+	return &Minifier{m: m, Exclude: cfg.Exclude, cache: make(map[string]cached)}
+}
+
+// Handles reports whether a file would be minified, name is its
+// slash-separated path
+func (m *Minifier) Handles(name string) bool {
+	if m == nil {
+		return false
+	}
+	if _, ok := types[strings.ToLower(path.Ext(name))]; !ok {
+		return false
+	}
+	base := path.Base(name)
+	for _, p := range m.Exclude {
+		if ok, _ := path.Match(p, name); ok {
+			return false
+		}
+		if ok, _ := path.Match(p, base); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Bytes minifies the content of a file, returning it unchanged when the
+// file isn't handled or doesn't minify
+func (m *Minifier) Bytes(name string, data []byte) []byte {
+	if !m.Handles(name) {
+		return data
+	}
+	out, err := m.m.Bytes(types[strings.ToLower(path.Ext(name))], data)
+	if err != nil || len(out) > len(data) {
+		return data
+	}
+	return out
+}
+
+// Handler serves the files of root minified, and passes everything else,
+// directories and errors to next. Minified files are kept in memory until
+// they change
+func (m *Minifier) Handler(root http.FileSystem, next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + r.URL.Path)
+		if !m.Handles(name) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		f, err := root.Open(name)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		defer f.Close()
+		st, err := f.Stat()
+		if err != nil || st.IsDir() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		m.mu.Lock()
+		c, ok := m.cache[name]
+		m.mu.Unlock()
+		if !ok || !c.modTime.Equal(st.ModTime()) || c.size != st.Size() {
+			var buf bytes.Buffer
+			if _, err := buf.ReadFrom(f); err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			c = cached{modTime: st.ModTime(), size: st.Size(), data: m.Bytes(name, buf.Bytes())}
+			m.mu.Lock()
+			m.cache[name] = c
+			m.mu.Unlock()
+		}
+		http.ServeContent(w, r, name, c.modTime, bytes.NewReader(c.data))
+	})
+}
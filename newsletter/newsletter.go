@@ -0,0 +1,279 @@
+// Package newsletter collects email subscribers with double opt-in:
+// /subscribe sends a confirmation link, and only confirmed addresses are
+// listed and exported in the admin UI.
+package newsletter
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/core6quad/GOMD/admin"
+	"github.com/core6quad/GOMD/config"
+	gomail "github.com/core6quad/GOMD/mail"
+)
+
+// Unconfirmed signups are dropped after a week
+const pendingTTL = 7 * 24 * time.Hour
+
+// Subscriber is one email address, confirmed once the link was followed
+type Subscriber struct {
+	Email       string     `json:"email"`
+	Token       string     `json:"token"`
+	Created     time.Time  `json:"created"`
+	ConfirmedAt *time.Time `json:"confirmed_at,omitempty"`
+}
+
+// List keeps all subscribers in memory and in a JSON file in the data dir
+type List struct {
+	mu          sync.Mutex
+	path        string
+	subscribers []Subscriber
+
+	smtp     config.SMTPConfig
+	siteURL  string
+	basePath string
+
+	// Audit records who exported the list
+	Audit func(r *http.Request, action, target string)
+}
+
+// Open loads the subscriber list from the data dir
+func Open(cfg config.Config) (*List, error) {
+	l := &List{
+		path:     filepath.Join(cfg.DataDir, "subscribers.json"),
+		smtp:     cfg.SMTP,
+		siteURL:  cfg.SiteURL,
+		basePath: cfg.BasePath,
+	}
+	data, err := os.ReadFile(l.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &l.subscribers); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Confirmed returns the confirmed subscribers, oldest first
+func (l *List) Confirmed() []Subscriber {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var out []Subscriber
+	for _, s := range l.subscribers {
+		if s.ConfirmedAt != nil {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Subscribe adds a pending subscriber and returns the token for its
+// confirmation link. Known addresses get a fresh link, without telling
+// anyone whether they were already subscribed
+func (l *List) Subscribe(email string) (Subscriber, error) {
+	addr, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil || strings.ContainsAny(addr.Address, "\r\n") {
+		return Subscriber{}, errors.New("invalid email address")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now().UTC()
+	kept := l.subscribers[:0]
+	for _, s := range l.subscribers {
+		if s.ConfirmedAt == nil && now.Sub(s.Created) > pendingTTL {
+			continue
+		}
+		kept = append(kept, s)
+	}
+	l.subscribers = kept
+	for _, s := range l.subscribers {
+		if strings.EqualFold(s.Email, addr.Address) {
+			return s, nil
+		}
+	}
+	s := Subscriber{Email: addr.Address, Token: newToken(), Created: now}
+	l.subscribers = append(l.subscribers, s)
+	return s, l.save()
+}
+
+// Confirm marks the subscriber with this token as confirmed
+func (l *List) Confirm(token string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, s := range l.subscribers {
+		if token != "" && s.Token == token {
+			if s.ConfirmedAt == nil {
+				now := time.Now().UTC()
+				l.subscribers[i].ConfirmedAt = &now
+			}
+			return l.save()
+		}
+	}
+	return errors.New("unknown or expired link")
+}
+
+// Unsubscribe removes the subscriber with this token
+func (l *List) Unsubscribe(token string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, s := range l.subscribers {
+		if token != "" && s.Token == token {
+			l.subscribers = append(l.subscribers[:i], l.subscribers[i+1:]...)
+			return l.save()
+		}
+	}
+	return errors.New("unknown link")
+}
+
+// Write the file atomically, the caller holds mu
+func (l *List) save() error {
+	data, err := json.MarshalIndent(l.subscribers, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return err
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
+
+func newToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Absolute URL of a route, from site_url or the request itself
+func (l *List) link(r *http.Request, path string) string {
+	origin := l.siteURL
+	if origin == "" {
+		scheme := "http"
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		origin = scheme + "://" + r.Host
+	}
+	return origin + l.basePath + path
+}
+
+// ServeHTTP handles POST /subscribe, and the confirmation and unsubscribe
+// links at /subscribe/confirm?token= and /subscribe/remove?token=
+func (l *List) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/subscribe":
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, 4<<10)
+		if r.PostFormValue("_gotcha") != "" {
+			l.done(w, r, "Check your inbox to confirm your subscription.")
+			return
+		}
+		s, err := l.Subscribe(r.PostFormValue("email"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if s.ConfirmedAt == nil {
+			err = gomail.Send(l.smtp, gomail.Message{
+				To:      []string{s.Email},
+				Subject: "Confirm your subscription",
+				Body: "Please confirm your subscription by opening this link:\n\n" +
+					l.link(r, "/subscribe/confirm?token="+s.Token) +
+					"\n\nIf you didn't sign up, ignore this email.\n",
+			})
+			if err != nil {
+				slog.Error("failed to send subscription confirmation", "err", err)
+				http.Error(w, "could not send the confirmation email", http.StatusInternalServerError)
+				return
+			}
+		}
+		l.done(w, r, "Check your inbox to confirm your subscription.")
+	case "/subscribe/confirm":
+		if err := l.Confirm(r.URL.Query().Get("token")); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		l.done(w, r, "Your subscription is confirmed, thank you!")
+	case "/subscribe/remove":
+		if err := l.Unsubscribe(r.URL.Query().Get("token")); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		l.done(w, r, "You have been unsubscribed.")
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+var donePage = template.Must(template.New("done").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Newsletter</title></head>
+<body><p>{{.Message}}</p><p><a href="{{.Home}}">Back to the site</a></p></body></html>
+`))
+
+func (l *List) done(w http.ResponseWriter, r *http.Request, msg string) {
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": msg})
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	donePage.Execute(w, map[string]string{"Message": msg, "Home": l.basePath + "/"})
+}
+
+var subscribersTable = template.Must(template.New("subscribers").Parse(`
+<p>{{len .Subscribers}} confirmed subscribers. <a href="{{.Base}}/admin/subscribers/export.csv">Export as CSV</a></p>
+{{if .Subscribers}}<table>
+<tr><th>Email</th><th>Confirmed</th></tr>
+{{range .Subscribers}}<tr><td>{{.Email}}</td><td>{{.ConfirmedAt.Format "2006-01-02 15:04"}}</td></tr>
+{{end}}</table>{{end}}
+`))
+
+// Admin is the admin section listing confirmed subscribers, with a CSV
+// export at /admin/subscribers/export.csv
+func (l *List) Admin(a *admin.Admin) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subs := l.Confirmed()
+		if strings.HasSuffix(r.URL.Path, "/export.csv") {
+			if l.Audit != nil {
+				l.Audit(r, "export subscribers", "")
+			}
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", `attachment; filename="subscribers.csv"`)
+			cw := csv.NewWriter(w)
+			cw.Write([]string{"email", "confirmed_at", "unsubscribe_url"})
+			for _, s := range subs {
+				cw.Write([]string{s.Email, s.ConfirmedAt.Format(time.RFC3339), l.link(r, "/subscribe/remove?token="+s.Token)})
+			}
+			cw.Flush()
+			return
+		}
+		var buf bytes.Buffer
+		subscribersTable.Execute(&buf, map[string]interface{}{"Subscribers": subs, "Base": l.basePath})
+		a.Render(w, r, "Subscribers", template.HTML(buf.String()))
+	})
+}
@@ -0,0 +1,87 @@
+package gomd
+
+import (
+	"log/slog"
+	"sort"
+
+	"github.com/core6quad/GOMD/compiler"
+	"github.com/core6quad/GOMD/ping"
+)
+
+// Notify search engines of pages added, changed or removed by a rebuild
+func (s *Site) pingSearchEngines(opts compiler.Options, pages []*compiler.Page, prev, cur map[string][32]byte) {
+	cfg := s.Config.SearchPing
+	if s.Config.SiteURL == "" || (len(cfg.Sitemap) == 0 && cfg.IndexNowKey == "") {
+		return
+	}
+	byURL := make(map[string]*compiler.Page, len(pages))
+	for _, p := range pages {
+		byURL[p.URL] = p
+	}
+	var changed []string
+	// Removed pages are submitted too, so their 404 is picked up quickly
+	for _, url := range changedURLs(pages, prev, cur) {
+		if p := byURL[url]; p == nil || opts.Indexable(p) {
+			changed = append(changed, opts.AbsURL(url))
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+	slog.Info("notifying search engines", "changed", len(changed))
+	ping.Sitemap(cfg.Sitemap, opts.AbsURL("/sitemap.xml"))
+	if cfg.IndexNowKey != "" {
+		endpoint := cfg.IndexNowEndpoint
+		if endpoint == "" {
+			endpoint = ping.DefaultIndexNowEndpoint
+		}
+		keyLocation := opts.AbsURL("/" + cfg.IndexNowKey + ".txt")
+		if err := ping.IndexNow(endpoint, cfg.IndexNowKey, keyLocation, changed); err != nil {
+			slog.Warn("indexnow submission failed", "err", err)
+		}
+	}
+}
+
+// URLs of the pages a rebuild added, changed or removed, sorted
+func changedURLs(pages []*compiler.Page, prev, cur map[string][32]byte) []string {
+	var changed []string
+	seen := make(map[string]bool, len(pages))
+	for _, p := range pages {
+		seen[p.URL] = true
+		if h, ok := prev[p.URL]; !ok || h != cur[p.URL] {
+			changed = append(changed, p.URL)
+		}
+	}
+	for url := range prev {
+		if !seen[url] {
+			changed = append(changed, url)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// Tell WebSub hubs about feeds added or changed by a rebuild
+func (s *Site) publishFeeds(opts compiler.Options, prev, cur map[string][32]byte) {
+	hubs := s.Config.Feeds.Hubs
+	if s.Config.SiteURL == "" || len(hubs) == 0 {
+		return
+	}
+	var changed []string
+	for url, h := range cur {
+		if old, ok := prev[url]; !ok || old != h {
+			changed = append(changed, opts.AbsURL(url))
+		}
+	}
+	sort.Strings(changed)
+	for _, hub := range hubs {
+		for _, topic := range changed {
+			if err := ping.WebSub(hub, topic); err != nil {
+				slog.Warn("websub publish failed", "hub", hub, "feed", topic, "err", err)
+			}
+		}
+	}
+	if len(changed) > 0 {
+		slog.Info("notified websub hubs", "feeds", len(changed))
+	}
+}
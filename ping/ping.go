@@ -0,0 +1,100 @@
+// Package ping tells search engines about new and changed pages after a
+// rebuild, through sitemap pings and the IndexNow API, and WebSub hubs
+// about changed feeds.
+package ping
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// IndexNow accepts up to 10000 URLs per request
+const maxIndexNowURLs = 10000
+
+// DefaultIndexNowEndpoint shares submissions with every participating
+// search engine
+const DefaultIndexNowEndpoint = "https://api.indexnow.org/indexnow"
+
+var keyRe = regexp.MustCompile(`^[A-Za-z0-9-]{8,128}$`)
+
+// ValidKey reports whether key is a valid IndexNow key
+func ValidKey(key string) bool {
+	return keyRe.MatchString(key)
+}
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// Sitemap requests endpoint+sitemapURL (query-escaped) for every endpoint,
+// e.g. "https://www.bing.com/ping?sitemap="
+func Sitemap(endpoints []string, sitemapURL string) {
+	for _, e := range endpoints {
+		resp, err := client.Get(e + url.QueryEscape(sitemapURL))
+		if err != nil {
+			slog.Warn("sitemap ping failed", "endpoint", e, "err", err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			slog.Warn("sitemap ping unexpected status", "endpoint", e, "status", resp.Status)
+			continue
+		}
+		slog.Debug("sitemap pinged", "endpoint", e)
+	}
+}
+
+// IndexNow submits changed URLs of the site. The key must be served at
+// keyLocation so the search engine can verify the site owns it
+func IndexNow(endpoint, key, keyLocation string, urls []string) error {
+	if len(urls) == 0 {
+		return nil
+	}
+	u, err := url.Parse(keyLocation)
+	if err != nil {
+		return err
+	}
+	for len(urls) > 0 {
+		n := len(urls)
+		if n > maxIndexNowURLs {
+			n = maxIndexNowURLs
+		}
+		body, err := json.Marshal(map[string]interface{}{
+			"host":        u.Host,
+			"key":         key,
+			"keyLocation": keyLocation,
+			"urlList":     urls[:n],
+		})
+		if err != nil {
+			return err
+		}
+		resp, err := client.Post(endpoint, "application/json; charset=utf-8", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("indexnow: %s", resp.Status)
+		}
+		urls = urls[n:]
+	}
+	return nil
+}
+
+// WebSub tells a hub that the feed at topic changed, so it fetches the
+// feed and pushes it to subscribers
+func WebSub(hub, topic string) error {
+	resp, err := client.PostForm(hub, url.Values{"hub.mode": {"publish"}, "hub.url": {topic}})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("websub: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/core6quad/GOMD/config"
+)
+
+// Exec output larger than this is treated as an error
+const maxExecOutput = 16 << 20
+
+// Exec is a plugin backed by an external command. The page is written to
+// the command's stdin and its stdout replaces it, either before rendering
+// (stage "markdown") or after (stage "html").
+//
+// Commands run with a timeout, an empty temporary working directory and a
+// minimal environment (PATH plus GOMD_PAGE_SOURCE and GOMD_PAGE_URL), so a
+// filter can't accidentally depend on, or write into, the site directory.
+type Exec struct {
+	name    string
+	command string
+	args    []string
+	stage   string
+	timeout time.Duration
+}
+
+// NewExec creates an exec plugin from its config entry
+func NewExec(c config.ExecPlugin) (*Exec, error) {
+	if c.Command == "" {
+		return nil, errors.New("exec plugin: command is required")
+	}
+	e := &Exec{name: c.Name, command: c.Command, args: c.Args, stage: c.Stage, timeout: 10 * time.Second}
+	if e.name == "" {
+		e.name = c.Command
+	}
+	switch e.stage {
+	case "":
+		e.stage = "markdown"
+	case "markdown", "html":
+	default:
+		return nil, fmt.Errorf("exec plugin %s: unknown stage %q, use \"markdown\" or \"html\"", e.name, c.Stage)
+	}
+	if c.Timeout != "" {
+		d, err := time.ParseDuration(c.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("exec plugin %s: %w", e.name, err)
+		}
+		e.timeout = d
+	}
+	return e, nil
+}
+
+func (e *Exec) Name() string { return e.name }
+
+func (e *Exec) PreProcess(page *Page, markdown []byte) ([]byte, error) {
+	if e.stage != "markdown" {
+		return markdown, nil
+	}
+	return e.run(page, markdown)
+}
+
+func (e *Exec) PostRender(page *Page, html []byte) ([]byte, error) {
+	if e.stage != "html" {
+		return html, nil
+	}
+	return e.run(page, html)
+}
+
+func (e *Exec) run(page *Page, input []byte) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "gomd-exec-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, e.command, e.args...)
+	cmd.Dir = dir
+	cmd.Env = []string{
+		"PATH=" + os.Getenv("PATH"),
+		"GOMD_PAGE_SOURCE=" + page.Source,
+		"GOMD_PAGE_URL=" + page.URL,
+	}
+	// Windows programs commonly fail to start without these
+	for _, key := range []string{"SYSTEMROOT", "PATHEXT", "TEMP", "TMP"} {
+		if v, ok := os.LookupEnv(key); ok {
+			cmd.Env = append(cmd.Env, key+"="+v)
+		}
+	}
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr limitedBuffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Don't wait forever on children that inherited the pipes
+	cmd.WaitDelay = time.Second
+
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("timed out after %s", e.timeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	if stdout.overflow {
+		return nil, fmt.Errorf("output larger than %d bytes", maxExecOutput)
+	}
+	return stdout.Bytes(), nil
+}
+
+// limitedBuffer stops collecting output after maxExecOutput bytes
+type limitedBuffer struct {
+	bytes.Buffer
+	overflow bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > maxExecOutput {
+		b.overflow = true
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
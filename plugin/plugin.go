@@ -0,0 +1,88 @@
+// Package plugin is GOMD's in-process hook registry. Extensions implement
+// Plugin plus any of the hook interfaces and register themselves, usually
+// from an init function:
+//
+//	func init() { plugin.Register(myPlugin{}) }
+//
+// and are enabled by importing them into a custom build of cmd/gomd.
+package plugin
+
+import (
+	"net/http"
+	"sync"
+)
+
+// Plugin is the base interface every extension implements
+type Plugin interface {
+	Name() string
+}
+
+// Page describes the page a compile hook runs on
+type Page struct {
+	Source string // path relative to the source dir, e.g. "docs/a.gmd"
+	URL    string // URL the page is served at, e.g. "/docs/a"
+}
+
+// PreProcessHook transforms page markdown before GMD syntax is applied
+type PreProcessHook interface {
+	PreProcess(page *Page, markdown []byte) ([]byte, error)
+}
+
+// PostRenderHook transforms the rendered HTML of a page
+type PostRenderHook interface {
+	PostRender(page *Page, html []byte) ([]byte, error)
+}
+
+// Shortcode renders a {{name args...}} tag found in page markdown. The
+// returned markdown or HTML replaces the tag.
+type Shortcode func(page *Page, args []string) (string, error)
+
+// ShortcodeHook provides shortcodes by name
+type ShortcodeHook interface {
+	Shortcodes() map[string]Shortcode
+}
+
+// LintFinding is something a lint check found on a line of a page's
+// source, counting from 1 with the front matter
+type LintFinding struct {
+	Line    int
+	Message string
+}
+
+// LintCheck looks at the source of a page for `gomd lint`
+type LintCheck func(page *Page, source []byte) []LintFinding
+
+// LintHook provides lint checks by name, replacing built-in ones with
+// the same name
+type LintHook interface {
+	LintChecks() map[string]LintCheck
+}
+
+// Router is where ServeHook plugins add routes
+type Router interface {
+	Handle(pattern string, h http.Handler)
+}
+
+// ServeHook adds HTTP routes to the server
+type ServeHook interface {
+	OnServe(r Router) error
+}
+
+var (
+	mu         sync.Mutex
+	registered []Plugin
+)
+
+// Register adds a plugin to every site created afterwards
+func Register(p Plugin) {
+	mu.Lock()
+	defer mu.Unlock()
+	registered = append(registered, p)
+}
+
+// Registered returns all registered plugins in registration order
+func Registered() []Plugin {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]Plugin(nil), registered...)
+}
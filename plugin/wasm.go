@@ -0,0 +1,172 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+
+	"github.com/core6quad/GOMD/config"
+)
+
+// Wasm is a plugin compiled to WebAssembly and run in the wazero sandbox.
+// Modules get WASI without any filesystem, environment or network access,
+// and exchange data through their exported memory:
+//
+//	gomd_alloc(size i32) i32                 required, returns a buffer for input
+//	gomd_configure(ptr, len i32)             optional, receives the options as JSON
+//	gomd_transform(ptr, len i32) i64         optional, transforms the whole page
+//	gomd_shortcode(ptr, len i32) i64         optional, renders a shortcode
+//
+// Functions returning i64 pack the output as ptr<<32 | len. Shortcodes
+// receive {"name": ..., "args": [...], "page": "/url"} as JSON.
+type Wasm struct {
+	name       string
+	stage      string
+	shortcodes []string
+	timeout    time.Duration
+
+	mu      sync.Mutex
+	runtime wazero.Runtime
+	mod     api.Module
+}
+
+// LoadWasm compiles and instantiates a module from the plugins directory
+func LoadWasm(dir string, c config.WasmPlugin) (*Wasm, error) {
+	if c.File == "" {
+		return nil, errors.New("wasm plugin: file is required")
+	}
+	w := &Wasm{name: c.Name, stage: c.Stage, shortcodes: c.Shortcodes, timeout: 5 * time.Second}
+	if w.name == "" {
+		w.name = strings.TrimSuffix(c.File, ".wasm")
+	}
+	if c.Timeout != "" {
+		d, err := time.ParseDuration(c.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("wasm plugin %s: %w", w.name, err)
+		}
+		w.timeout = d
+	}
+	code, err := os.ReadFile(filepath.Join(dir, filepath.Clean("/"+c.File)))
+	if err != nil {
+		return nil, fmt.Errorf("wasm plugin %s: %w", w.name, err)
+	}
+
+	ctx := context.Background()
+	// Closing on context done lets a timeout stop runaway plugins
+	w.runtime = wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithCloseOnContextDone(true).
+		WithMemoryLimitPages(1024)) // 64 MiB
+	wasi_snapshot_preview1.MustInstantiate(ctx, w.runtime)
+	compiled, err := w.runtime.CompileModule(ctx, code)
+	if err != nil {
+		w.runtime.Close(ctx)
+		return nil, fmt.Errorf("wasm plugin %s: %w", w.name, err)
+	}
+	w.mod, err = w.runtime.InstantiateModule(ctx, compiled, wazero.NewModuleConfig().
+		WithName(w.name).
+		WithStderr(os.Stderr).
+		WithStartFunctions("_initialize"))
+	if err != nil {
+		w.runtime.Close(ctx)
+		return nil, fmt.Errorf("wasm plugin %s: %w", w.name, err)
+	}
+	if w.mod.ExportedFunction("gomd_alloc") == nil {
+		w.Close()
+		return nil, fmt.Errorf("wasm plugin %s: module must export gomd_alloc", w.name)
+	}
+	if w.stage == "" && w.mod.ExportedFunction("gomd_transform") != nil {
+		w.stage = "markdown"
+	}
+	if c.Options != nil && w.mod.ExportedFunction("gomd_configure") != nil {
+		opts, err := json.Marshal(c.Options)
+		if err == nil {
+			_, err = w.call("gomd_configure", opts)
+		}
+		if err != nil {
+			w.Close()
+			return nil, fmt.Errorf("wasm plugin %s: configure: %w", w.name, err)
+		}
+	}
+	return w, nil
+}
+
+func (w *Wasm) Name() string { return w.name }
+
+// Close frees the module and its runtime
+func (w *Wasm) Close() error {
+	return w.runtime.Close(context.Background())
+}
+
+func (w *Wasm) PreProcess(page *Page, markdown []byte) ([]byte, error) {
+	if w.stage != "markdown" {
+		return markdown, nil
+	}
+	return w.call("gomd_transform", markdown)
+}
+
+func (w *Wasm) PostRender(page *Page, html []byte) ([]byte, error) {
+	if w.stage != "html" {
+		return html, nil
+	}
+	return w.call("gomd_transform", html)
+}
+
+func (w *Wasm) Shortcodes() map[string]Shortcode {
+	codes := make(map[string]Shortcode)
+	for _, name := range w.shortcodes {
+		name := name
+		codes[name] = func(page *Page, args []string) (string, error) {
+			in, _ := json.Marshal(map[string]interface{}{"name": name, "args": args, "page": page.URL})
+			out, err := w.call("gomd_shortcode", in)
+			return string(out), err
+		}
+	}
+	return codes
+}
+
+// Copy input into module memory, call fn and copy its output back out
+func (w *Wasm) call(fn string, input []byte) ([]byte, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	f := w.mod.ExportedFunction(fn)
+	if f == nil {
+		return nil, fmt.Errorf("module does not export %s", fn)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+	defer cancel()
+
+	res, err := w.mod.ExportedFunction("gomd_alloc").Call(ctx, uint64(len(input)))
+	if err != nil {
+		return nil, err
+	}
+	ptr := uint32(res[0])
+	if !w.mod.Memory().Write(ptr, input) {
+		return nil, errors.New("gomd_alloc returned an out of range buffer")
+	}
+	res, err = f.Call(ctx, uint64(ptr), uint64(len(input)))
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%s timed out after %s", fn, w.timeout)
+		}
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, nil
+	}
+	outPtr, outLen := uint32(res[0]>>32), uint32(res[0])
+	out, ok := w.mod.Memory().Read(outPtr, outLen)
+	if !ok {
+		return nil, fmt.Errorf("%s returned an out of range buffer", fn)
+	}
+	return append([]byte(nil), out...), nil
+}
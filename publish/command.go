@@ -0,0 +1,90 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/core6quad/GOMD/config"
+)
+
+// Copy the files into one directory for the command line tools, pages
+// keep their .html for the web server to map /page to page.html
+func stage(files []File) (string, error) {
+	dir, err := os.MkdirTemp("", "gomd-publish-")
+	if err != nil {
+		return "", err
+	}
+	for _, f := range files {
+		data, err := f.Read()
+		if err == nil {
+			dst := filepath.Join(dir, filepath.FromSlash(f.Key))
+			if err = os.MkdirAll(filepath.Dir(dst), 0755); err == nil {
+				err = os.WriteFile(dst, data, 0644)
+			}
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+func run(ctx context.Context, stdin string, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w: %s", name, err, strings.TrimSpace(out.String()))
+	}
+	return nil
+}
+
+func toRsync(ctx context.Context, t config.PublishTarget, files []File) error {
+	if t.Destination == "" {
+		return fmt.Errorf("publish %s: needs a destination", t.Name)
+	}
+	dir, err := stage(files)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	args := []string{"-rtz", "--chmod=D755,F644"}
+	if t.Delete {
+		args = append(args, "--delete")
+	}
+	if err := run(ctx, "", "rsync", append(args, dir+"/", t.Destination)...); err != nil {
+		return err
+	}
+	slog.Info("published", "target", t.Name, "files", len(files))
+	return nil
+}
+
+// Upload with the sftp command in batch mode, so keys and host checking
+// come from the usual ssh config
+func toSFTP(ctx context.Context, t config.PublishTarget, files []File) error {
+	host, remote, ok := strings.Cut(t.Destination, ":")
+	if !ok || host == "" || remote == "" {
+		return fmt.Errorf("publish %s: destination should look like user@host:/var/www/site", t.Name)
+	}
+	dir, err := stage(files)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	// A leading - lets the batch go on when the directory already exists
+	batch := fmt.Sprintf("-mkdir %q\nlcd %q\nput -r * %q\n", remote, dir, remote)
+	if err := run(ctx, batch, "sftp", "-b", "-", host); err != nil {
+		return err
+	}
+	slog.Info("published", "target", t.Name, "files", len(files))
+	return nil
+}
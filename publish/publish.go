@@ -0,0 +1,99 @@
+// Package publish uploads the built site to static hosting, for sites
+// that don't run the GOMD server publicly.
+package publish
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/core6quad/GOMD/config"
+	"github.com/core6quad/GOMD/minify"
+)
+
+// File is one file of the static site
+type File struct {
+	// Key is the slash-separated path the file is served at, e.g.
+	// "docs/a.html" or "assets/style.css"
+	Key  string
+	Path string
+	// Page is set for compiled pages
+	Page bool
+
+	// Minifies assets, pages are minified when compiled
+	min *minify.Minifier
+}
+
+// Read returns the content to upload
+func (f File) Read() ([]byte, error) {
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	return f.min.Bytes(strings.TrimPrefix(f.Key, "assets/"), data), nil
+}
+
+// Collect lists the files of a built site: the build dir, the assets dir
+// under assets/ and favicon.ico. Dotfiles are left out, the server
+// doesn't serve them either
+func Collect(cfg config.Config) ([]File, error) {
+	var files []File
+	min := minify.New(cfg.Minify)
+	add := func(root, prefix string, pages bool) error {
+		return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && p == root {
+					return nil
+				}
+				return err
+			}
+			if strings.HasPrefix(d.Name(), ".") && p != root {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			key := path.Join(prefix, filepath.ToSlash(rel))
+			f := File{Key: key, Path: p, Page: pages && strings.HasSuffix(key, ".html")}
+			if !pages {
+				f.min = min
+			}
+			files = append(files, f)
+			return nil
+		})
+	}
+	if err := add(cfg.BuildDir, "", true); err != nil {
+		return nil, err
+	}
+	if err := add(cfg.AssetsDir, "assets", false); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat("favicon.ico"); err == nil {
+		files = append(files, File{Key: "favicon.ico", Path: "favicon.ico"})
+	}
+	return files, nil
+}
+
+// Run uploads files to a target
+func Run(ctx context.Context, cfg config.Config, t config.PublishTarget, files []File) error {
+	switch t.Type {
+	case "s3", "gcs":
+		return toS3(ctx, cfg, t, files)
+	case "rsync":
+		return toRsync(ctx, t, files)
+	case "sftp":
+		return toSFTP(ctx, t, files)
+	}
+	return fmt.Errorf("publish %s: unknown type %q, use s3, gcs, sftp or rsync", t.Name, t.Type)
+}
@@ -0,0 +1,105 @@
+package publish
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/core6quad/GOMD/config"
+	"github.com/core6quad/GOMD/s3"
+	"github.com/core6quad/GOMD/server"
+)
+
+// Object stores have no URL rewriting, so a page is stored without its
+// .html under the URL it is linked as. Index pages are also kept as
+// index.html, the index document of bucket websites
+func objectKeys(f File) []string {
+	if !f.Page {
+		return []string{f.Key}
+	}
+	keys := []string{strings.TrimSuffix(f.Key, ".html")}
+	if path.Base(f.Key) == "index.html" {
+		keys = append(keys, f.Key)
+	}
+	return keys
+}
+
+func toS3(ctx context.Context, cfg config.Config, t config.PublishTarget, files []File) error {
+	if t.Bucket == "" {
+		return fmt.Errorf("publish %s: needs a bucket", t.Name)
+	}
+	c := &s3.Client{Endpoint: t.URL, Region: t.Region, Bucket: t.Bucket, AccessKey: t.AccessKey, SecretKey: t.SecretKey}
+	if t.Type == "gcs" && c.Endpoint == "" {
+		c.Endpoint = "https://storage.googleapis.com"
+		if c.Region == "" {
+			c.Region = "auto"
+		}
+	}
+	prefix := strings.Trim(t.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	// Single part uploads have the MD5 of their content as ETag, unchanged
+	// files are skipped
+	existing, err := c.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	etags := make(map[string]string, len(existing))
+	for _, o := range existing {
+		etags[o.Key] = o.ETag
+	}
+	uploaded, skipped := 0, 0
+	keep := make(map[string]bool)
+	for _, f := range files {
+		body, err := f.Read()
+		if err != nil {
+			return err
+		}
+		sum := md5.Sum(body)
+		etag := hex.EncodeToString(sum[:])
+		h := http.Header{}
+		if f.Page {
+			h.Set("Content-Type", "text/html; charset=utf-8")
+			h.Set("Cache-Control", t.HTMLCacheControl)
+		} else {
+			ct := server.ContentType(f.Key, cfg.DefaultCharset)
+			if ct == "" {
+				ct = http.DetectContentType(body)
+			}
+			h.Set("Content-Type", ct)
+			h.Set("Cache-Control", t.AssetCacheControl)
+		}
+		for _, key := range objectKeys(f) {
+			key = prefix + key
+			keep[key] = true
+			if etags[key] == etag {
+				skipped++
+				continue
+			}
+			if err := c.Put(ctx, key, body, h); err != nil {
+				return err
+			}
+			uploaded++
+		}
+	}
+	deleted := 0
+	if t.Delete {
+		for _, o := range existing {
+			if keep[o.Key] {
+				continue
+			}
+			if err := c.Delete(ctx, o.Key); err != nil {
+				return err
+			}
+			deleted++
+		}
+	}
+	slog.Info("published", "target", t.Name, "uploaded", uploaded, "unchanged", skipped, "deleted", deleted)
+	return nil
+}
@@ -0,0 +1,43 @@
+package gomd
+
+import (
+	"log/slog"
+
+	"github.com/core6quad/GOMD/compiler"
+	"github.com/core6quad/GOMD/purge"
+)
+
+// Clear the CDN caches of pages changed by a rebuild. After the first build
+// everything is purged, pages may have changed while the server was down
+func (s *Site) purgeCDN(opts compiler.Options, pages []*compiler.Page, prev, cur map[string][32]byte) {
+	if len(s.Config.CDNPurge) == 0 {
+		return
+	}
+	var urls []string
+	for _, url := range changedURLs(pages, prev, cur) {
+		urls = append(urls, opts.AbsURL(url))
+		// The home page is served at /index too
+		if url == "/index" {
+			urls = append(urls, opts.SiteURL+compiler.WithBase(opts.BasePath, url))
+		}
+	}
+	for _, cdn := range s.Config.CDNPurge {
+		var err error
+		switch {
+		case cdn.Full || prev == nil:
+			slog.Info("purging cdn cache", "provider", cdn.Provider, "full", true)
+			err = purge.All(cdn)
+		case len(urls) == 0:
+			continue
+		case s.Config.SiteURL == "":
+			slog.Warn("set site_url to purge changed pages, or use a full purge", "provider", cdn.Provider)
+			continue
+		default:
+			slog.Info("purging cdn cache", "provider", cdn.Provider, "urls", len(urls))
+			err = purge.URLs(cdn, urls)
+		}
+		if err != nil {
+			slog.Warn("cdn purge failed", "provider", cdn.Provider, "err", err)
+		}
+	}
+}
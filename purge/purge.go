@@ -0,0 +1,106 @@
+// Package purge clears CDN caches after a rebuild, so visitors get the new
+// pages right away. Cloudflare, Fastly and Bunny are supported.
+package purge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/core6quad/GOMD/config"
+)
+
+// Cloudflare accepts up to 30 URLs per purge request on every plan
+const cloudflareBatch = 30
+
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// URLs purges the given absolute URLs from a CDN
+func URLs(cdn config.CDNPurge, urls []string) error {
+	switch cdn.Provider {
+	case "cloudflare":
+		for len(urls) > 0 {
+			n := len(urls)
+			if n > cloudflareBatch {
+				n = cloudflareBatch
+			}
+			if err := cloudflare(cdn, map[string]interface{}{"files": urls[:n]}); err != nil {
+				return err
+			}
+			urls = urls[n:]
+		}
+		return nil
+	case "fastly":
+		// Fastly purges a URL when it is requested with the PURGE method
+		for _, u := range urls {
+			if err := send(cdn, "PURGE", u, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "bunny":
+		for _, u := range urls {
+			if err := send(cdn, http.MethodPost, "https://api.bunny.net/purge?url="+url.QueryEscape(u), nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return unknown(cdn)
+}
+
+// All purges everything the CDN cached for the zone
+func All(cdn config.CDNPurge) error {
+	switch cdn.Provider {
+	case "cloudflare":
+		return cloudflare(cdn, map[string]interface{}{"purge_everything": true})
+	case "fastly":
+		return send(cdn, http.MethodPost, "https://api.fastly.com/service/"+url.PathEscape(cdn.Zone)+"/purge_all", nil)
+	case "bunny":
+		return send(cdn, http.MethodPost, "https://api.bunny.net/pullzone/"+url.PathEscape(cdn.Zone)+"/purgeCache", nil)
+	}
+	return unknown(cdn)
+}
+
+func unknown(cdn config.CDNPurge) error {
+	return fmt.Errorf("purge: unknown provider %q, use cloudflare, fastly or bunny", cdn.Provider)
+}
+
+func cloudflare(cdn config.CDNPurge, body interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return send(cdn, http.MethodPost, "https://api.cloudflare.com/client/v4/zones/"+url.PathEscape(cdn.Zone)+"/purge_cache", b)
+}
+
+// Send an authenticated request to the provider's API
+func send(cdn config.CDNPurge, method, u string, body []byte) error {
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	switch cdn.Provider {
+	case "cloudflare":
+		req.Header.Set("Authorization", "Bearer "+cdn.Token)
+		req.Header.Set("Content-Type", "application/json")
+	case "fastly":
+		req.Header.Set("Fastly-Key", cdn.Token)
+	case "bunny":
+		req.Header.Set("AccessKey", cdn.Token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("purge %s: %s: %s", cdn.Provider, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package gomd
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/core6quad/GOMD/compiler"
+)
+
+// The cache of JSON fetched during builds
+func (s *Site) remoteData() *compiler.RemoteData {
+	ttl, err := time.ParseDuration(s.Config.RemoteData.TTL)
+	if err != nil {
+		ttl = time.Hour
+	}
+	timeout, err := time.ParseDuration(s.Config.RemoteData.Timeout)
+	if err != nil {
+		timeout = 10 * time.Second
+	}
+	return compiler.NewRemoteData(filepath.Join(s.Config.DataDir, "remote"), ttl, timeout)
+}
@@ -0,0 +1,155 @@
+// Package sass compiles .scss stylesheets to CSS with the sass command
+// (dart-sass), when the site is built and, in watch mode, when a
+// stylesheet is requested after its sources changed.
+package sass
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/core6quad/GOMD/config"
+)
+
+// DefaultCommand is run without a command in the config
+const DefaultCommand = "sass --no-source-map {in} {out}"
+
+// Compiler runs the sass command. A nil Compiler compiles nothing
+type Compiler struct {
+	// Command with {in} and {out} replaced by the .scss and .css files
+	Command string
+	// Watch recompiles assets when they're requested, see Handler
+	Watch bool
+
+	mu sync.Mutex
+}
+
+// New returns the compiler for the config, or nil when sass is off
+func New(cfg config.SassConfig) *Compiler {
+	if !cfg.Enabled {
+		return nil
+	}
+	c := &Compiler{Command: cfg.Command, Watch: cfg.Watch}
+	if c.Command == "" {
+		c.Command = DefaultCommand
+	}
+	return c
+}
+
+// Partial reports whether a file is a partial like _mixins.scss, only
+// used through imports
+func Partial(name string) bool {
+	return strings.HasPrefix(path.Base(filepath.ToSlash(name)), "_")
+}
+
+// File compiles src into dst unless dst is newer than changed, the time
+// the stylesheets it may import last changed
+func (c *Compiler) File(src, dst string, changed time.Time) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if fi, err := os.Stat(dst); err == nil && fi.ModTime().After(changed) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	// Written under another name first, pages never get half a stylesheet
+	tmp := strings.TrimSuffix(dst, ".css") + ".compiling.css"
+	args := strings.Fields(c.Command)
+	for i, a := range args {
+		a = strings.ReplaceAll(a, "{in}", src)
+		args[i] = strings.ReplaceAll(a, "{out}", tmp)
+	}
+	slog.Info("compiling sass", "file", src)
+	if output, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("sass %s: %w: %s", src, err, strings.TrimSpace(string(output)))
+	}
+	return os.Rename(tmp, dst)
+}
+
+// Dir compiles every stylesheet in dir into a .css file next to it, the
+// ones already up to date are skipped
+func (c *Compiler) Dir(dir string) error {
+	if c == nil {
+		return nil
+	}
+	changed := Changed(dir)
+	var errs []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == dir {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() && strings.HasPrefix(d.Name(), ".") && p != dir {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || filepath.Ext(p) != ".scss" || Partial(p) {
+			return nil
+		}
+		if err := c.File(p, strings.TrimSuffix(p, ".scss")+".css", changed); err != nil {
+			errs = append(errs, err.Error())
+		}
+		return nil
+	})
+	if err == nil && len(errs) > 0 {
+		err = fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return err
+}
+
+// Changed returns when a stylesheet in dir last changed. Imports can point
+// anywhere in it, so any change makes every stylesheet stale
+func Changed(dir string) time.Time {
+	var latest time.Time
+	filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() && strings.HasPrefix(d.Name(), ".") && p != dir {
+			return filepath.SkipDir
+		}
+		if filepath.Ext(p) == ".scss" {
+			if fi, err := d.Info(); err == nil && fi.ModTime().After(latest) {
+				latest = fi.ModTime()
+			}
+		}
+		return nil
+	})
+	return latest
+}
+
+// Handler recompiles a requested .css file of dir first if its .scss
+// changed since, when watching. Errors are logged and the old stylesheet
+// served
+func (c *Compiler) Handler(dir string, next http.Handler) http.Handler {
+	if c == nil || !c.Watch {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + r.URL.Path)
+		if strings.HasSuffix(name, ".css") && !strings.Contains(name, "/.") {
+			css := filepath.Join(dir, filepath.FromSlash(name))
+			src := strings.TrimSuffix(css, ".css") + ".scss"
+			if _, err := os.Stat(src); err == nil && !Partial(src) {
+				if err := c.File(src, css, Changed(dir)); err != nil {
+					slog.Error("sass failed", "err", err)
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
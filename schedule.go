@@ -0,0 +1,48 @@
+package gomd
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/core6quad/GOMD/compiler"
+)
+
+// Rebuild when the next scheduled page is due, replacing any earlier timer
+func (s *Site) schedule(pending []*compiler.Page) {
+	s.scheduleMu.Lock()
+	defer s.scheduleMu.Unlock()
+	if s.scheduleTimer != nil {
+		s.scheduleTimer.Stop()
+		s.scheduleTimer = nil
+	}
+	var next *compiler.Page
+	for _, p := range pending {
+		if next == nil || p.PublishAt.Before(*next.PublishAt) {
+			next = p
+		}
+	}
+	if next == nil {
+		return
+	}
+	slog.Info("next scheduled page", "page", next.URL, "publish_at", next.PublishAt.Format(time.RFC3339), "pending", len(pending))
+	s.scheduleTimer = time.AfterFunc(time.Until(*next.PublishAt), func() {
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+		if err := s.Build(); err != nil {
+			slog.Error("scheduled rebuild failed", "err", err)
+			return
+		}
+		live := make(map[string]bool)
+		for _, p := range s.Pages() {
+			live[p.URL] = true
+		}
+		for _, p := range pending {
+			if live[p.URL] {
+				slog.Info("scheduled page published", "page", p.URL)
+			}
+		}
+	})
+}
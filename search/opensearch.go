@@ -0,0 +1,112 @@
+package search
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// HeadLink lets browsers find the OpenSearch descriptor at
+// <base>/opensearch.xml, added to the head of every page
+func HeadLink(base, name string) string {
+	return fmt.Sprintf(`<link rel="search" type="application/opensearchdescription+xml" title="%s" href="%s/opensearch.xml">`+"\n",
+		template.HTMLEscapeString(name), template.HTMLEscapeString(base))
+}
+
+// WriteDescriptor writes the OpenSearch description of a site at root,
+// its absolute URL with the base path
+func WriteDescriptor(w io.Writer, name, root string) error {
+	short := []rune(name)
+	// Browsers cut ShortName at 16 characters
+	if len(short) > 16 {
+		short = short[:16]
+	}
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<OpenSearchDescription xmlns="http://a9.com/-/spec/opensearch/1.1/" xmlns:moz="http://www.mozilla.org/2006/browser/search/">` + "\n")
+	fmt.Fprintf(&b, "<ShortName>%s</ShortName>\n", escapeXML(string(short)))
+	fmt.Fprintf(&b, "<Description>Search %s</Description>\n", escapeXML(name))
+	b.WriteString("<InputEncoding>UTF-8</InputEncoding>\n")
+	fmt.Fprintf(&b, `<Url type="text/html" method="get" template="%s/search?q={searchTerms}"/>`+"\n", escapeXML(root))
+	fmt.Fprintf(&b, `<Url type="application/opensearchdescription+xml" rel="self" template="%s/opensearch.xml"/>`+"\n", escapeXML(root))
+	fmt.Fprintf(&b, "<moz:SearchForm>%s/search</moz:SearchForm>\n", escapeXML(root))
+	b.WriteString("</OpenSearchDescription>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func escapeXML(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// PageData is what the /search results page shows
+type PageData struct {
+	Name, Query, Version string
+	// Base path of the site, for links
+	Base    string
+	Results []Result
+}
+
+var resultsPage = template.Must(template.New("search").Funcs(template.FuncMap{"mark": mark}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{with .Query}}{{.}} - {{end}}Search {{.Name}}</title>
+<link rel="search" type="application/opensearchdescription+xml" title="{{.Name}}" href="{{.Base}}/opensearch.xml">
+<style>
+	body { font-family: sans-serif; max-width: 720px; margin: 0 auto; padding: 24px 16px; line-height: 1.5; color: #222; }
+	form { display: flex; gap: 8px; margin-bottom: 24px; }
+	input { flex: 1; padding: 8px; font: inherit; }
+	button { padding: 8px 16px; font: inherit; }
+	ol { padding: 0; list-style: none; }
+	li { margin-bottom: 20px; }
+	li a { font-size: 1.15em; }
+	li p { margin: 4px 0 0; color: #555; }
+	mark { background: #ffe58a; }
+</style>
+</head>
+<body>
+<form action="{{.Base}}/search" role="search">
+	<input type="search" name="q" value="{{.Query}}" aria-label="Search {{.Name}}" autofocus>
+	{{with .Version}}<input type="hidden" name="version" value="{{.}}">{{end}}
+	<button>Search</button>
+</form>
+{{if .Query}}{{if .Results}}<ol>
+{{range .Results}}<li><a href="{{$.Base}}{{.URL}}">{{mark (or .Title .URL) $.Query}}</a>{{with or .Excerpt .Description}}<p>{{mark . $.Query}}</p>{{end}}</li>
+{{end}}</ol>{{else}}<p>No pages match <strong>{{.Query}}</strong>.</p>{{end}}{{end}}
+</body>
+</html>
+`))
+
+// WritePage renders the results page
+func WritePage(w io.Writer, data PageData) error {
+	return resultsPage.Execute(w, data)
+}
+
+// Text with the words of a query wrapped in <mark>
+func mark(text, query string) template.HTML {
+	var quoted []string
+	for _, t := range strings.Fields(query) {
+		quoted = append(quoted, regexp.QuoteMeta(t))
+	}
+	if len(quoted) == 0 {
+		return template.HTML(template.HTMLEscapeString(text))
+	}
+	re := regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+	var b strings.Builder
+	last := 0
+	for _, m := range re.FindAllStringIndex(text, -1) {
+		b.WriteString(template.HTMLEscapeString(text[last:m[0]]))
+		b.WriteString("<mark>" + template.HTMLEscapeString(text[m[0]:m[1]]) + "</mark>")
+		last = m[1]
+	}
+	b.WriteString(template.HTMLEscapeString(text[last:]))
+	return template.HTML(b.String())
+}
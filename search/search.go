@@ -0,0 +1,157 @@
+// Package search answers full-text queries over the pages of a build, and
+// ships a search overlay layouts can include with {{template "search" .}}
+package search
+
+import (
+	_ "embed"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/core6quad/GOMD/compiler"
+)
+
+// Partial defines the "search" template: the overlay script, opened with
+// Ctrl+K or / and by clicking any element with a data-search attribute.
+// On versioned docs it searches the version being read
+const Partial = `{{define "search"}}<script src="{{url "/api/search.js"}}" data-endpoint="{{url "/api/search"}}"{{with .Page.Version}} data-version="{{.}}"{{end}} defer></script>{{end}}`
+
+//go:embed search.js
+var script []byte
+
+// ServeScript serves the overlay script
+func ServeScript(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(script)
+}
+
+// Result is a page matching a query
+type Result struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	// Text around the first match in the page
+	Excerpt string `json:"excerpt,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+type doc struct {
+	Result
+	text string
+	// Lower-cased copies to match against
+	title, description, tags, lower string
+	// Page of a version other than the latest
+	old bool
+}
+
+// Index holds the searchable pages of one build
+type Index struct {
+	docs []doc
+}
+
+// New indexes the pages anyone may see
+func New(pages []*compiler.Page) *Index {
+	ix := &Index{}
+	for _, p := range pages {
+		if !p.Searchable() {
+			continue
+		}
+		d := doc{
+			Result:      Result{URL: p.URL, Title: p.Title, Description: p.Description, Version: p.Version},
+			text:        p.Text(),
+			title:       strings.ToLower(p.Title),
+			description: strings.ToLower(p.Description),
+			tags:        strings.ToLower(strings.Join(p.Tags, " ")),
+		}
+		d.lower = strings.ToLower(d.text)
+		for _, v := range p.Versions {
+			if v.Current && !v.Latest {
+				d.old = true
+			}
+		}
+		ix.docs = append(ix.docs, d)
+	}
+	return ix
+}
+
+// Search returns up to limit pages containing every word of the query,
+// best matches first. Title matches count the most, then tags, the
+// description and the text. Without a version only the latest docs are
+// searched, pages outside versioned directories always are
+func (ix *Index) Search(query, version string, limit int) []Result {
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) > 10 {
+		terms = terms[:10]
+	}
+	if ix == nil || len(terms) == 0 {
+		return nil
+	}
+	type hit struct {
+		d     *doc
+		score int
+	}
+	var hits []hit
+	for i := range ix.docs {
+		d := &ix.docs[i]
+		if d.Version != "" && (version != "" && d.Version != version || version == "" && d.old) {
+			continue
+		}
+		score := 0
+		for _, t := range terms {
+			n := 10*strings.Count(d.title, t) + 5*strings.Count(d.tags, t) + 3*strings.Count(d.description, t) + min(strings.Count(d.lower, t), 10)
+			if n == 0 {
+				score = 0
+				break
+			}
+			score += n
+		}
+		if score > 0 {
+			hits = append(hits, hit{d, score})
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].score > hits[j].score })
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	results := make([]Result, len(hits))
+	for i, h := range hits {
+		results[i] = h.d.Result
+		results[i].Excerpt = h.d.excerpt(terms)
+	}
+	return results
+}
+
+// About this many bytes of text around the first match
+const excerptLen = 160
+
+func (d *doc) excerpt(terms []string) string {
+	at := -1
+	for _, t := range terms {
+		if i := strings.Index(d.lower, t); i >= 0 && (at < 0 || i < at) {
+			at = i
+		}
+	}
+	// Lower-casing can change the length of some characters, then the
+	// offsets don't line up with the text
+	if at < 0 || len(d.lower) != len(d.text) {
+		at = 0
+	}
+	start := max(at-excerptLen/3, 0)
+	end := min(start+excerptLen, len(d.text))
+	for start > 0 && !utf8.RuneStart(d.text[start]) {
+		start--
+	}
+	for end < len(d.text) && !utf8.RuneStart(d.text[end]) {
+		end++
+	}
+	s := d.text[start:end]
+	if start > 0 {
+		s = "…" + s
+	}
+	if end < len(d.text) {
+		s += "…"
+	}
+	return s
+}
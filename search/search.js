@@ -0,0 +1,159 @@
+// GOMD search overlay: Ctrl+K (or /) opens it, arrow keys pick a result,
+// Enter opens it, Escape closes the overlay
+(function () {
+	var tag = document.currentScript;
+	var endpoint = tag.getAttribute("data-endpoint") || "/api/search";
+	var version = tag.getAttribute("data-version") || "";
+
+	var css = document.createElement("style");
+	css.textContent =
+		".gomd-search{position:fixed;inset:0;z-index:1000;background:rgba(0,0,0,.5);display:flex;justify-content:center;align-items:flex-start;padding-top:10vh}" +
+		".gomd-search[hidden]{display:none}" +
+		".gomd-search-box{background:#fff;color:#222;width:min(600px,92vw);max-height:75vh;display:flex;flex-direction:column;border-radius:8px;box-shadow:0 8px 32px rgba(0,0,0,.3);overflow:hidden;font:16px/1.4 sans-serif}" +
+		".gomd-search input{border:0;border-bottom:1px solid #ddd;padding:14px 16px;font:inherit;outline:none}" +
+		".gomd-search ul{list-style:none;margin:0;padding:0;overflow-y:auto}" +
+		".gomd-search li a{display:block;padding:10px 16px;color:inherit;text-decoration:none;border-bottom:1px solid #eee}" +
+		".gomd-search li[aria-selected=true] a{background:#eef3fd}" +
+		".gomd-search li small{display:block;color:#666;font-size:13px}" +
+		".gomd-search mark{background:#ffe58a;color:inherit}" +
+		".gomd-search p{margin:0;padding:12px 16px;color:#666}";
+	document.head.appendChild(css);
+
+	var overlay = document.createElement("div");
+	overlay.className = "gomd-search";
+	overlay.hidden = true;
+	overlay.innerHTML = '<div class="gomd-search-box" role="dialog" aria-label="Search"><input type="search" placeholder="Search" autocomplete="off" role="combobox" aria-expanded="true" aria-controls="gomd-search-results"><ul id="gomd-search-results" role="listbox"></ul><p hidden></p></div>';
+	var input = overlay.querySelector("input");
+	var list = overlay.querySelector("ul");
+	var status = overlay.querySelector("p");
+	var selected = -1, timer, last = "", seq = 0;
+
+	function escapeRe(s) {
+		return s.replace(/[.*+?^${}()|[\]\\]/g, "\\$&");
+	}
+
+	// Text with the query's words wrapped in <mark>, built as nodes so
+	// nothing in a page title can inject markup
+	function highlight(el, text, terms) {
+		if (!terms.length) {
+			el.textContent = text;
+			return;
+		}
+		var re = new RegExp("(" + terms.map(escapeRe).join("|") + ")", "gi");
+		text.split(re).forEach(function (part, i) {
+			if (i % 2) {
+				var m = document.createElement("mark");
+				m.textContent = part;
+				el.appendChild(m);
+			} else if (part) {
+				el.appendChild(document.createTextNode(part));
+			}
+		});
+	}
+
+	function select(i) {
+		var items = list.children;
+		if (!items.length) return;
+		selected = (i + items.length) % items.length;
+		for (var j = 0; j < items.length; j++) {
+			items[j].setAttribute("aria-selected", j === selected ? "true" : "false");
+		}
+		items[selected].scrollIntoView({ block: "nearest" });
+	}
+
+	function show(results, terms) {
+		list.textContent = "";
+		selected = -1;
+		results.forEach(function (r) {
+			var li = document.createElement("li");
+			li.setAttribute("role", "option");
+			var a = document.createElement("a");
+			a.href = r.url;
+			var title = document.createElement("strong");
+			highlight(title, r.title || r.url, terms);
+			a.appendChild(title);
+			if (r.excerpt || r.description) {
+				var small = document.createElement("small");
+				highlight(small, r.excerpt || r.description, terms);
+				a.appendChild(small);
+			}
+			li.appendChild(a);
+			list.appendChild(li);
+		});
+		status.hidden = results.length > 0 || !input.value.trim();
+		status.textContent = "No results";
+		if (results.length) select(0);
+	}
+
+	function search() {
+		var q = input.value.trim();
+		if (q === last) return;
+		last = q;
+		if (!q) {
+			show([], []);
+			return;
+		}
+		var n = ++seq;
+		var url = endpoint + "?q=" + encodeURIComponent(q) + (version ? "&version=" + encodeURIComponent(version) : "");
+		fetch(url, { headers: { Accept: "application/json" } })
+			.then(function (res) { return res.json(); })
+			.then(function (results) {
+				// An older, slower response mustn't replace a newer one
+				if (n === seq) show(results || [], q.split(/\s+/));
+			})
+			.catch(function () {
+				if (n === seq) {
+					list.textContent = "";
+					status.hidden = false;
+					status.textContent = "Search is unavailable";
+				}
+			});
+	}
+
+	function open() {
+		if (!overlay.parentNode) document.body.appendChild(overlay);
+		overlay.hidden = false;
+		input.focus();
+		input.select();
+	}
+
+	function close() {
+		overlay.hidden = true;
+	}
+
+	input.addEventListener("input", function () {
+		clearTimeout(timer);
+		timer = setTimeout(search, 150);
+	});
+	input.addEventListener("keydown", function (e) {
+		if (e.key === "ArrowDown") {
+			select(selected + 1);
+		} else if (e.key === "ArrowUp") {
+			select(selected - 1);
+		} else if (e.key === "Enter" && selected >= 0) {
+			location.href = list.children[selected].firstChild.href;
+		} else {
+			return;
+		}
+		e.preventDefault();
+	});
+	overlay.addEventListener("click", function (e) {
+		if (e.target === overlay) close();
+	});
+	document.addEventListener("keydown", function (e) {
+		var typing = /^(INPUT|TEXTAREA|SELECT)$/.test(e.target.tagName) || e.target.isContentEditable;
+		if ((e.ctrlKey || e.metaKey) && e.key.toLowerCase() === "k" || e.key === "/" && !typing) {
+			e.preventDefault();
+			overlay.hidden ? open() : close();
+		} else if (e.key === "Escape" && !overlay.hidden) {
+			close();
+		}
+	});
+	document.addEventListener("click", function (e) {
+		var el = e.target.closest && e.target.closest("[data-search]");
+		if (el) {
+			e.preventDefault();
+			open();
+		}
+	});
+})();
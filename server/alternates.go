@@ -0,0 +1,65 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Media types of the page output formats
+var outputFormatTypes = map[string]string{
+	"md":  "text/markdown",
+	"txt": "text/plain",
+}
+
+// The page's file in another output format when the request's Accept
+// header prefers it to HTML, e.g. curl -H 'Accept: text/markdown'
+func (s *Server) alternate(w http.ResponseWriter, r *http.Request, page string) string {
+	if len(s.cfg.OutputFormats) == 0 {
+		return ""
+	}
+	w.Header().Add("Vary", "Accept")
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return ""
+	}
+	best, bestQ := "", acceptQ(accept, "text/html", true)
+	for _, ext := range s.cfg.OutputFormats {
+		typ, ok := outputFormatTypes[ext]
+		if !ok {
+			continue
+		}
+		if q := acceptQ(accept, typ, false); q > bestQ {
+			if _, err := os.Stat(page + "." + ext); err == nil {
+				best, bestQ = page+"."+ext, q
+			}
+		}
+	}
+	return best
+}
+
+// The quality an Accept header gives a media type. Wildcards only count
+// when asked to, so */* still means HTML
+func acceptQ(accept, typ string, wildcards bool) float64 {
+	q := 0.0
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		t := strings.ToLower(strings.TrimSpace(params[0]))
+		if t != typ && !(wildcards && (t == "*/*" || t == strings.SplitN(typ, "/", 2)[0]+"/*")) {
+			continue
+		}
+		v := 1.0
+		for _, p := range params[1:] {
+			if k, val, ok := strings.Cut(strings.TrimSpace(p), "="); ok && k == "q" {
+				if f, err := strconv.ParseFloat(val, 64); err == nil {
+					v = f
+				}
+			}
+		}
+		if v > q {
+			q = v
+		}
+	}
+	return q
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// safeFS wraps an http.FileSystem to hide dotfiles (.git, .env, ...) and
+// directory listings unless they're enabled. Hidden paths look like they
+// don't exist, so the file server answers 404.
+type safeFS struct {
+	fs       http.FileSystem
+	listing  bool
+	dotfiles bool
+}
+
+func (s safeFS) Open(name string) (http.File, error) {
+	if !s.dotfiles && hasDotSegment(name) {
+		return nil, fs.ErrNotExist
+	}
+	f, err := s.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return f, nil
+	}
+	if !s.listing {
+		// Directories are only reachable through their index.html
+		index, err := s.fs.Open(path.Join(name, "index.html"))
+		if err != nil {
+			f.Close()
+			return nil, fs.ErrNotExist
+		}
+		index.Close()
+	}
+	return safeDir{File: f, dotfiles: s.dotfiles}, nil
+}
+
+// safeDir filters dotfiles out of directory listings
+type safeDir struct {
+	http.File
+	dotfiles bool
+}
+
+func (d safeDir) Readdir(count int) ([]fs.FileInfo, error) {
+	entries, err := d.File.Readdir(count)
+	if d.dotfiles {
+		return entries, err
+	}
+	visible := entries[:0]
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), ".") {
+			visible = append(visible, e)
+		}
+	}
+	return visible, err
+}
+
+// Report whether any segment of a slash-separated path starts with a dot
+func hasDotSegment(name string) bool {
+	for _, seg := range strings.Split(name, "/") {
+		if strings.HasPrefix(seg, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+var errUnsafePath = errors.New("unsafe path")
+
+// safeJoin maps a request's URL path onto a file below root. Anything that
+// could escape root is rejected rather than cleaned: ".." segments (also
+// percent-encoded in the raw path), backslashes, NUL bytes and colons,
+// which on Windows mean drive letters or alternate data streams.
+func safeJoin(root string, r *http.Request) (string, error) {
+	urlPath := r.URL.Path
+	raw := strings.ToLower(r.URL.EscapedPath())
+	if strings.ContainsAny(urlPath, "\\\x00:") ||
+		strings.Contains(raw, "%2e%2e") || strings.Contains(raw, "%5c") || strings.Contains(raw, "%2f") {
+		return "", errUnsafePath
+	}
+	for _, seg := range strings.Split(urlPath, "/") {
+		if seg == ".." {
+			return "", errUnsafePath
+		}
+	}
+	rel := strings.TrimPrefix(path.Clean("/"+urlPath), "/")
+	if rel == "" {
+		return root, nil
+	}
+	if !filepath.IsLocal(filepath.FromSlash(rel)) {
+		return "", errUnsafePath
+	}
+	full := filepath.Join(root, filepath.FromSlash(rel))
+	// Belt and braces: the result must still be inside root
+	if r, err := filepath.Rel(root, full); err != nil || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+		return "", errUnsafePath
+	}
+	return full, nil
+}
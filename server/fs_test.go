@@ -0,0 +1,181 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/core6quad/GOMD/analytics"
+	"github.com/core6quad/GOMD/auth"
+	"github.com/core6quad/GOMD/config"
+)
+
+func request(t *testing.T, target string) *http.Request {
+	t.Helper()
+	u, err := url.ParseRequestURI(target)
+	if err != nil {
+		t.Fatalf("%s: %v", target, err)
+	}
+	return &http.Request{Method: http.MethodGet, URL: u}
+}
+
+func TestSafeJoinRejects(t *testing.T) {
+	root := t.TempDir()
+	for _, target := range []string{
+		// .. segments
+		"/../config.json",
+		"/docs/../../config.json",
+		"/docs/..",
+		// Percent-encoded dots and slashes
+		"/%2e%2e/config.json",
+		"/docs/%2E%2E/%2e%2e/config.json",
+		"/.%2e/config.json",
+		"/..%2fconfig.json",
+		"/docs%2f..%2f..%2fconfig.json",
+		"/%2fetc%2fpasswd",
+		// Backslashes, raw and encoded
+		`/..\config.json`,
+		`/docs\..\..\config.json`,
+		"/..%5cconfig.json",
+		"/docs%5C..%5Cconfig.json",
+		`/\\server\share\file`,
+		// NUL bytes
+		"/config.json%00.html",
+		"/%00",
+		// Drive letters and alternate data streams
+		"/C:/Windows/win.ini",
+		"/c:%5cwindows%5cwin.ini",
+		"/C:",
+		"/page.html::$DATA",
+		"/docs/file.txt:stream",
+	} {
+		if got, err := safeJoin(root, request(t, target)); err == nil {
+			t.Errorf("safeJoin(%q) = %q, want it rejected", target, got)
+		}
+	}
+}
+
+func TestSafeJoinStaysInRoot(t *testing.T) {
+	root := t.TempDir()
+	for target, want := range map[string]string{
+		"/":              root,
+		"/docs/intro":    filepath.Join(root, "docs", "intro"),
+		"/a/./b":         filepath.Join(root, "a", "b"),
+		"//etc/passwd":   filepath.Join(root, "etc", "passwd"),
+		"/docs//guide":   filepath.Join(root, "docs", "guide"),
+		"/caf%C3%A9.png": filepath.Join(root, "café.png"),
+	} {
+		got, err := safeJoin(root, request(t, target))
+		if err != nil || got != want {
+			t.Errorf("safeJoin(%q) = %q, %v, want %q", target, got, err, want)
+		}
+	}
+}
+
+// A server for a project in a temporary dir, with a secret config.json
+// next to its assets
+func assetServer(t *testing.T, listing, dotfiles bool) *httptest.Server {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"config.json":           `{"secret": "hunter2"}`,
+		"assets/style.css":      "body{}",
+		"assets/.env":           "TOKEN=hunter2",
+		"assets/.git/config":    "[core]",
+		"assets/img/logo.png":   "png",
+		"assets/img/.draft.png": "png",
+		"build/index.html":      "<p>home</p>",
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := config.Default()
+	cfg.Quiet = true
+	cfg.AssetsDir = filepath.Join(dir, "assets")
+	cfg.BuildDir = filepath.Join(dir, "build")
+	cfg.AssetListing = listing
+	cfg.ServeDotfiles = dotfiles
+	users, err := auth.Load(filepath.Join(dir, "users.json"), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(New(cfg, analytics.New(cfg.Cache), users).Handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func get(t *testing.T, srv *httptest.Server, path string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Sent as written, not cleaned by the client
+	req.URL.Opaque = path
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestAssetsTraversal(t *testing.T) {
+	srv := assetServer(t, true, true)
+	for _, path := range []string{
+		"/assets/../config.json",
+		"/assets/%2e%2e/config.json",
+		"/assets/..%2fconfig.json",
+		"/assets/..%5cconfig.json",
+		"/assets/img/../../config.json",
+	} {
+		code, body := get(t, srv, path)
+		if code != http.StatusNotFound || strings.Contains(body, "hunter2") {
+			t.Errorf("GET %s = %d %q, want 404", path, code, body)
+		}
+	}
+}
+
+func TestAssetsListingAndDotfiles(t *testing.T) {
+	for _, tc := range []struct {
+		listing, dotfiles bool
+		path              string
+		want              int
+	}{
+		{false, false, "/assets/style.css", http.StatusOK},
+		{false, false, "/assets/img/", http.StatusNotFound},
+		{true, false, "/assets/img/", http.StatusOK},
+		{false, false, "/assets/.env", http.StatusNotFound},
+		{false, false, "/assets/.git/config", http.StatusNotFound},
+		{false, false, "/assets/img/.draft.png", http.StatusNotFound},
+		{false, true, "/assets/.env", http.StatusOK},
+		{false, true, "/assets/.git/config", http.StatusOK},
+	} {
+		srv := assetServer(t, tc.listing, tc.dotfiles)
+		if code, _ := get(t, srv, tc.path); code != tc.want {
+			t.Errorf("listing=%v dotfiles=%v: GET %s = %d, want %d", tc.listing, tc.dotfiles, tc.path, code, tc.want)
+		}
+	}
+}
+
+func TestAssetListingHidesDotfiles(t *testing.T) {
+	srv := assetServer(t, true, false)
+	code, body := get(t, srv, "/assets/img/")
+	if code != http.StatusOK || !strings.Contains(body, "logo.png") {
+		t.Fatalf("GET /assets/img/ = %d %q, want a listing", code, body)
+	}
+	if strings.Contains(body, ".draft.png") {
+		t.Errorf("listing shows a dotfile: %q", body)
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Paths that keep working during maintenance, so admins can still sign in,
+// switch it off and receive content hooks
+var maintenanceOpen = []string{"/admin", "/analytics", "/dav", "/assets", "/hooks", "/status", "/favicon.ico"}
+
+var maintenancePage = template.Must(template.New("maintenance").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Down for maintenance</title></head>
+<body style="font-family: sans-serif; text-align: center; padding-top: 15vh"><h1>Down for maintenance</h1><p>We'll be back shortly.</p></body></html>
+`))
+
+// SetMaintenance switches maintenance mode on or off until the next restart
+func (s *Server) SetMaintenance(on bool) {
+	s.maintenance.Store(on)
+}
+
+// Maintenance reports whether maintenance mode is switched on, in config or
+// with SetMaintenance
+func (s *Server) Maintenance() bool {
+	return s.maintenance.Load()
+}
+
+// MaintenanceFile reports whether the source dir has a maintenance.gmd,
+// which keeps maintenance mode on regardless of the switch
+func (s *Server) MaintenanceFile() bool {
+	_, err := os.Stat(filepath.Join(s.cfg.SrcDir, "maintenance.gmd"))
+	return err == nil
+}
+
+// Let a request see the site during maintenance: admin routes, allowed IPs
+// and signed in accounts
+func (s *Server) maintenanceBypass(r *http.Request) bool {
+	for _, p := range maintenanceOpen {
+		if r.URL.Path == p || strings.HasPrefix(r.URL.Path, p+"/") {
+			return true
+		}
+	}
+	if ok, _ := s.users.Permits(r, s.maintenanceAllow); ok {
+		return true
+	}
+	_, ok := s.users.SignedIn(r)
+	return ok
+}
+
+// Serve the maintenance page with a 503 while maintenance mode is on. The
+// page is maintenance.gmd when it has been built, a plain notice otherwise
+func (s *Server) withMaintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.Maintenance() && !s.MaintenanceFile() || s.maintenanceBypass(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		h.Set("Content-Type", "text/html; charset=utf-8")
+		h.Set("Cache-Control", "no-store")
+		h.Set("Retry-After", "300")
+		page, err := os.ReadFile(filepath.Join(s.BuildDir(), "maintenance.html"))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		if r.Method == http.MethodHead {
+			return
+		}
+		if err == nil {
+			w.Write(page)
+			return
+		}
+		maintenancePage.Execute(w, nil)
+	})
+}
@@ -0,0 +1,436 @@
+package server
+
+import (
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/core6quad/GOMD/analytics"
+	"github.com/core6quad/GOMD/config"
+)
+
+// Middleware wraps a handler with extra behaviour
+type Middleware func(http.Handler) http.Handler
+
+// Wrap h in the given middlewares, the first one being the outermost
+func chain(h http.Handler, mws ...Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// statusRecorder captures the response status for request logging
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// ReadFrom keeps the sendfile fast path of the underlying writer for
+// large files served by http.ServeFile
+func (r *statusRecorder) ReadFrom(src io.Reader) (int64, error) {
+	return io.Copy(r.ResponseWriter, src)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Assign every request an ID (or keep the proxy's X-Request-ID) and log it
+func withRequestLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+		level := slog.LevelInfo
+		if rec.status >= 500 {
+			level = slog.LevelError
+		}
+		slog.Log(r.Context(), level, "request",
+			"id", id,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration", time.Since(start),
+			"remote", r.RemoteAddr,
+		)
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Number of handler panics since startup, reported by /status
+var panicCount atomic.Int64
+
+const errorPage = `<!DOCTYPE html>
+<html>
+<head><title>Something went wrong</title></head>
+<body style="font-family: sans-serif; text-align: center; margin-top: 10%;">
+	<h1>500 &mdash; Something went wrong</h1>
+	<p>The server hit an unexpected error. Please try again later.</p>
+</body>
+</html>
+`
+
+// Turn handler panics into a logged stack trace and a friendly 500 page
+func withRecovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			panicCount.Add(1)
+			slog.Error("panic serving request",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"err", err,
+				"stack", string(debug.Stack()),
+			)
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Cache-Control", "no-store")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(errorPage))
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Count page views for successfully served GET requests of HTML pages,
+// static files served alongside them are not counted
+func withAnalytics(a *analytics.Analytics) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			r, variant := withVariantSlot(r)
+			next.ServeHTTP(rec, r)
+			if r.Method != http.MethodGet || rec.status != http.StatusOK ||
+				!strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+				return
+			}
+			path := r.URL.Path
+			if path == "/" {
+				path = "/index"
+			}
+			if *variant != "" {
+				a.RecordVariantView(r, path, *variant)
+				return
+			}
+			a.RecordView(r, path)
+		})
+	}
+}
+
+// RateLimit limits each IP to rps requests per second with bursts of up to
+// burst, for routes that need a tighter limit than the whole site
+func RateLimit(rps float64, burst int) Middleware {
+	return withRateLimit(rps, burst)
+}
+
+// Per-IP token bucket rate limiting, disabled when rps is 0
+func withRateLimit(rps float64, burst int) Middleware {
+	return func(next http.Handler) http.Handler {
+		if rps <= 0 {
+			return next
+		}
+		if burst < 1 {
+			burst = int(rps) + 1
+		}
+		type bucket struct {
+			tokens float64
+			last   time.Time
+		}
+		var mu sync.Mutex
+		buckets := make(map[string]*bucket)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+			now := time.Now()
+			mu.Lock()
+			b, ok := buckets[ip]
+			if !ok {
+				// Drop idle buckets now and then so the map doesn't grow forever
+				if len(buckets) > 10000 {
+					for k, v := range buckets {
+						if now.Sub(v.last) > time.Minute {
+							delete(buckets, k)
+						}
+					}
+				}
+				b = &bucket{tokens: float64(burst), last: now}
+				buckets[ip] = b
+			}
+			b.tokens += now.Sub(b.last).Seconds() * rps
+			if b.tokens > float64(burst) {
+				b.tokens = float64(burst)
+			}
+			b.last = now
+			allowed := b.tokens >= 1
+			if allowed {
+				b.tokens--
+			}
+			wait := math.Ceil((1 - b.tokens) / rps)
+			mu.Unlock()
+			if !allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(wait)))
+				http.Error(w, "too many requests", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Gzip responses for clients that accept it, when enabled
+func withCompression(enabled bool) Middleware {
+	return func(next http.Handler) http.Handler {
+		if !enabled {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Leave range requests alone, byte offsets refer to the uncompressed
+			// file. HEAD gets the uncompressed length rather than an empty gzip
+			// stream's.
+			if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") ||
+				r.Header.Get("Range") != "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Add("Vary", "Accept-Encoding")
+			gw := &gzipResponseWriter{ResponseWriter: w}
+			defer gw.Close()
+			next.ServeHTTP(gw, r)
+		})
+	}
+}
+
+// gzipResponseWriter compresses the body if the response turns out to be compressible
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+func (g *gzipResponseWriter) WriteHeader(code int) {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader = true
+	h := g.Header()
+	if code == http.StatusOK && h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")) {
+		// Ranges of the compressed body can't be served, so don't offer them
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		h.Set("Content-Encoding", "gzip")
+		g.gz = gzip.NewWriter(g.ResponseWriter)
+	}
+	g.ResponseWriter.WriteHeader(code)
+}
+
+func (g *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !g.wroteHeader {
+		if g.Header().Get("Content-Type") == "" {
+			g.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.gz != nil {
+		return g.gz.Write(b)
+	}
+	return g.ResponseWriter.Write(b)
+}
+
+func (g *gzipResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !g.wroteHeader {
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.gz != nil {
+		return io.Copy(g.gz, src)
+	}
+	return io.Copy(g.ResponseWriter, src)
+}
+
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+func (g *gzipResponseWriter) Close() {
+	if g.gz != nil {
+		g.gz.Close()
+	}
+}
+
+func compressible(contentType string) bool {
+	ct := strings.ToLower(contentType)
+	return strings.HasPrefix(ct, "text/") ||
+		strings.Contains(ct, "json") ||
+		strings.Contains(ct, "javascript") ||
+		strings.Contains(ct, "xml")
+}
+
+// Strip the base path from requests, so the site works both behind a proxy
+// that forwards /base/page as is and one that strips the prefix itself
+func withBasePath(base string) Middleware {
+	return func(next http.Handler) http.Handler {
+		if base == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := r.URL.Path
+			if p != base && !strings.HasPrefix(p, base+"/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			r2 := new(http.Request)
+			*r2 = *r
+			r2.URL = new(url.URL)
+			*r2.URL = *r.URL
+			r2.URL.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(p, base), "/")
+			if r.URL.RawPath != "" {
+				r2.URL.RawPath = "/" + strings.TrimPrefix(strings.TrimPrefix(r.URL.RawPath, base), "/")
+			}
+			next.ServeHTTP(w, r2)
+		})
+	}
+}
+
+// Add the configured headers for matching paths. Headers a handler sets
+// itself, like the admin UI's Cache-Control, take precedence
+func withHeaders(rules []config.HeaderRule) Middleware {
+	type rule struct {
+		re     *regexp.Regexp
+		values map[string]string
+	}
+	var compiled []rule
+	for _, r := range rules {
+		re, err := globRegexp(r.For)
+		if err != nil {
+			slog.Error("invalid headers pattern", "for", r.For, "err", err)
+			continue
+		}
+		compiled = append(compiled, rule{re, r.Values})
+	}
+	return func(next http.Handler) http.Handler {
+		if len(compiled) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			for _, rule := range compiled {
+				if rule.re.MatchString(r.URL.Path) {
+					for k, v := range rule.values {
+						h.Set(k, v)
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Answer CORS preflights and add CORS headers for allowed origins on the
+// JSON APIs. Preflights are answered before auth, browsers never send
+// credentials with them
+func withCORS(cfg config.CORSConfig) Middleware {
+	return func(next http.Handler) http.Handler {
+		if len(cfg.Origins) == 0 {
+			return next
+		}
+		allowed := make(map[string]bool, len(cfg.Origins))
+		for _, o := range cfg.Origins {
+			allowed[strings.TrimSuffix(o, "/")] = true
+		}
+		// Browsers refuse credentials with a wildcard, and echoing any origin
+		// back would hand the analytics to every site
+		anyOrigin := allowed["*"] && !cfg.Credentials
+		if allowed["*"] && cfg.Credentials {
+			slog.Warn("cors: \"*\" can't be used with credentials, list the origins instead")
+		}
+		methods := strings.Join(cfg.Methods, ", ")
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := r.URL.Path
+			origin := r.Header.Get("Origin")
+			if origin == "" || !(strings.HasPrefix(p, "/api/") || p == "/api" || strings.HasPrefix(p, "/analytics/api")) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			if !anyOrigin && !allowed[origin] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if anyOrigin {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+			if cfg.Credentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				h.Set("Access-Control-Allow-Methods", methods)
+				if len(cfg.Headers) > 0 {
+					h.Set("Access-Control-Allow-Headers", strings.Join(cfg.Headers, ", "))
+				} else if req := r.Header.Get("Access-Control-Request-Headers"); req != "" {
+					h.Set("Access-Control-Allow-Headers", req)
+				}
+				h.Set("Access-Control-Max-Age", strconv.Itoa(cfg.MaxAge))
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Turn a path glob into a regexp: * and ? stop at slashes, ** doesn't
+func globRegexp(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case c == '*' && i+1 < len(glob) && glob[i+1] == '*':
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
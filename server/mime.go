@@ -0,0 +1,71 @@
+package server
+
+import (
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Types the stock tables often get wrong or don't know at all
+var builtinMIMETypes = map[string]string{
+	".wasm":        "application/wasm",
+	".webmanifest": "application/manifest+json",
+	".avif":        "image/avif",
+	".webp":        "image/webp",
+	".mjs":         "text/javascript",
+	".md":          "text/markdown",
+	".gmd":         "text/markdown",
+	".woff2":       "font/woff2",
+}
+
+// Register the built-in and configured extension types. Configured ones
+// win, so any guess can be overridden.
+func registerMIMETypes(extra map[string]string) {
+	for _, types := range []map[string]string{builtinMIMETypes, extra} {
+		for ext, typ := range types {
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			if err := mime.AddExtensionType(ext, typ); err != nil {
+				slog.Error("invalid mime type", "ext", ext, "type", typ, "err", err)
+			}
+		}
+	}
+}
+
+// ContentType guesses a file's type from its extension like the server
+// does, adding charset to text types that don't specify one. It's empty
+// for unknown extensions
+func ContentType(name, charset string) string {
+	ct := mime.TypeByExtension(path.Ext(name))
+	if ct != "" && charset != "" && !strings.Contains(ct, "charset=") && isText(ct) {
+		ct += "; charset=" + charset
+	}
+	return ct
+}
+
+// Set Content-Type from the file extension before serving a file
+func setContentType(w http.ResponseWriter, name, charset string) {
+	if ct := ContentType(name, charset); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+}
+
+func isText(ct string) bool {
+	return strings.HasPrefix(ct, "text/") ||
+		strings.HasSuffix(strings.SplitN(ct, ";", 2)[0], "+json") ||
+		strings.HasPrefix(ct, "application/json") ||
+		strings.HasPrefix(ct, "application/javascript") ||
+		strings.HasSuffix(strings.SplitN(ct, ";", 2)[0], "+xml") ||
+		strings.HasPrefix(ct, "image/svg+xml")
+}
+
+// Serve files with the configured content types
+func withContentType(charset string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		setContentType(w, r.URL.Path, charset)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Modern formats tried for an image, best first
+var imageVariants = []struct{ ext, mime string }{
+	{".avif", "image/avif"},
+	{".webp", "image/webp"},
+}
+
+// Formats variants can stand in for
+var negotiableImages = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true}
+
+// Report whether an Accept header names a type explicitly with a
+// non-zero quality. image/* doesn't count, browsers send it whatever they
+// can decode
+func accepts(accept, mime string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		typ, params, _ := strings.Cut(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(typ), mime) {
+			continue
+		}
+		for _, p := range strings.Split(params, ";") {
+			if k, v, ok := strings.Cut(strings.TrimSpace(p), "="); ok && k == "q" {
+				if q, err := strconv.ParseFloat(v, 64); err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Serve an AVIF or WebP copy of a JPEG, PNG or GIF asset to browsers that
+// take it, when one sits next to the original as photo.avif or
+// photo.jpg.avif. The URL stays the same, so pages need no changes
+func withImageVariants(files http.FileSystem, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/assets")
+		ext := strings.ToLower(path.Ext(name))
+		if !negotiableImages[ext] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		accept := r.Header.Get("Accept")
+		found := false
+		for _, v := range imageVariants {
+			for _, candidate := range []string{name + v.ext, strings.TrimSuffix(name, path.Ext(name)) + v.ext} {
+				f, err := files.Open(candidate)
+				if err != nil {
+					continue
+				}
+				fi, err := f.Stat()
+				f.Close()
+				if err != nil || fi.IsDir() {
+					continue
+				}
+				found = true
+				if accepts(accept, v.mime) {
+					w.Header().Add("Vary", "Accept")
+					r2 := r.Clone(r.Context())
+					r2.URL.Path = "/assets" + candidate
+					r2.URL.RawPath = ""
+					next.ServeHTTP(w, r2)
+					return
+				}
+			}
+		}
+		// Caches must not hand the original to browsers that get a variant
+		if found {
+			w.Header().Add("Vary", "Accept")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"hash/fnv"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/core6quad/GOMD/auth"
+)
+
+// Unlocked password protected pages stay open for a day
+const unlockLifetime = 24 * time.Hour
+
+var passwordPage = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Password required</title></head>
+<body style="font-family: sans-serif; text-align: center; padding-top: 15vh">
+<h1>Password required</h1>
+{{if .}}<p style="color: #c00">{{.}}</p>{{end}}
+<form method="post"><input type="password" name="password" autocomplete="off" required autofocus> <button>Open</button></form>
+</body></html>
+`))
+
+// Cookie names are per page, so each page keeps its own value
+func pageCookie(prefix, url string) string {
+	h := fnv.New32a()
+	h.Write([]byte(url))
+	return prefix + strconv.FormatUint(uint64(h.Sum32()), 16)
+}
+
+// A password protected page waiting to be unlocked
+type lockedPage struct {
+	cookie, msg, password string
+}
+
+type lockedKey struct{}
+
+// The page URL of a file in the build dir, "/docs/intro" for
+// docs/intro.html
+func pageURL(root, file string) string {
+	rel, err := filepath.Rel(root, file)
+	if err != nil {
+		return ""
+	}
+	return "/" + strings.TrimSuffix(filepath.ToSlash(rel), ".html")
+}
+
+// Who may see the page at url and its password, nil and "" when public
+func (s *Server) protection(url string) (*auth.Access, string) {
+	var access *auth.Access
+	if s.Access != nil {
+		access = s.Access(url)
+	}
+	var password string
+	if s.Password != nil {
+		password = s.Password(url)
+	}
+	return access, password
+}
+
+func (s *Server) shared(r *http.Request, url string) bool {
+	token := r.URL.Query().Get("share")
+	return token != "" && s.Shares != nil && s.Shares.Valid("share "+url, token)
+}
+
+func newLockedPage(url, password string) lockedPage {
+	return lockedPage{
+		cookie:   pageCookie("gomd_unlock_", url),
+		msg:      "unlock " + url + " " + password,
+		password: password,
+	}
+}
+
+func (s *Server) unlocked(r *http.Request, page lockedPage) bool {
+	c, err := r.Cookie(page.cookie)
+	return err == nil && s.Shares != nil && s.Shares.Valid(page.msg, c.Value)
+}
+
+// Check a request for the page at url against its allow list and password.
+// A valid share link skips both. Reports whether the page may be served,
+// otherwise the response is already written
+func (s *Server) protect(w http.ResponseWriter, r *http.Request, url string) bool {
+	access, password := s.protection(url)
+	if access == nil && password == "" {
+		return true
+	}
+	// Nothing restricted is left in shared caches
+	w.Header().Set("Cache-Control", "private")
+	if s.shared(r, url) {
+		return true
+	}
+	if access != nil {
+		if ok, login := s.users.Permits(r, access); !ok {
+			s.users.Deny(w, r, login)
+			return false
+		}
+	}
+	if password == "" {
+		return true
+	}
+	if s.Shares == nil {
+		http.Error(w, "this page is locked", http.StatusForbidden)
+		return false
+	}
+	page := newLockedPage(url, password)
+	if s.unlocked(r, page) {
+		return true
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusUnauthorized)
+		passwordPage.Execute(w, "")
+		return false
+	}
+	s.unlock.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), lockedKey{}, page)))
+	return false
+}
+
+// Visible reports whether a request may see the page at url, the same
+// checks as serving it but without writing a response or taking a
+// password. For things attached to a page, like its comments
+func (s *Server) Visible(r *http.Request, url string) bool {
+	access, password := s.protection(url)
+	if access == nil && password == "" || s.shared(r, url) {
+		return true
+	}
+	if access != nil {
+		if ok, _ := s.users.Permits(r, access); !ok {
+			return false
+		}
+	}
+	return password == "" || s.unlocked(r, newLockedPage(url, password))
+}
+
+// Check a posted page password, behind a rate limit, and remember the
+// unlocked page in a cookie
+func (s *Server) serveUnlock(w http.ResponseWriter, r *http.Request) {
+	page := r.Context().Value(lockedKey{}).(lockedPage)
+	r.Body = http.MaxBytesReader(w, r.Body, 4<<10)
+	if subtle.ConstantTimeCompare([]byte(r.PostFormValue("password")), []byte(page.password)) != 1 {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusUnauthorized)
+		passwordPage.Execute(w, "Wrong password, try again.")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     page.cookie,
+		Value:    s.Shares.Sign(page.msg, time.Now().Add(unlockLifetime)),
+		Path:     s.cfg.BasePath + "/",
+		MaxAge:   int(unlockLifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, s.cfg.BasePath+r.URL.RequestURI(), http.StatusSeeOther)
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/core6quad/GOMD/analytics"
+	"github.com/core6quad/GOMD/auth"
+	"github.com/core6quad/GOMD/config"
+	"github.com/core6quad/GOMD/share"
+)
+
+// A server with a restricted page at /team and /docs/index, and a password
+// protected page at /draft
+func protectServer(t *testing.T) (*httptest.Server, *share.Keys) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"build/index.html":      "<p>home</p>",
+		"build/team.html":       "<p>team secret</p>",
+		"build/docs/index.html": "<p>docs secret</p>",
+		"build/draft.html":      "<p>draft secret</p>",
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := config.Default()
+	cfg.Quiet = true
+	cfg.BuildDir = filepath.Join(dir, "build")
+	users, err := auth.Load(filepath.Join(dir, "users.json"), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Set("ed", "editor-password", auth.Editor); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := share.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	editors, err := auth.ParseAccess([]string{"role:editor"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(cfg, analytics.New(cfg.Cache), users)
+	s.Access = func(url string) *auth.Access {
+		if url == "/team" || url == "/docs/index" {
+			return editors
+		}
+		return nil
+	}
+	s.Password = func(url string) string {
+		if url == "/draft" {
+			return "hunter2"
+		}
+		return ""
+	}
+	s.Shares = keys
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(srv.Close)
+	return srv, keys
+}
+
+// Send a request for path as written, without following redirects
+func send(t *testing.T, srv *httptest.Server, method, path string, body io.Reader, edit func(*http.Request)) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.URL.Opaque = strings.SplitN(path, "?", 2)[0]
+	if edit != nil {
+		edit(req)
+	}
+	client := *srv.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp, string(b)
+}
+
+func TestRestrictedPageSpellings(t *testing.T) {
+	srv, _ := protectServer(t)
+	for _, path := range []string{
+		"/team", "/team/", "/team.html", "/team/index.html", "/team/.", "//team", "/x/../team",
+		"/docs/index", "/docs/index/", "/docs/index.html",
+	} {
+		resp, body := send(t, srv, http.MethodGet, path, nil, nil)
+		if resp.StatusCode == http.StatusOK || strings.Contains(body, "secret") {
+			t.Errorf("anonymous GET %s = %d %q, want it refused", path, resp.StatusCode, body)
+		}
+	}
+	for _, path := range []string{"/team", "/team/", "/team.html", "/docs/index/"} {
+		resp, body := send(t, srv, http.MethodGet, path, nil, func(r *http.Request) {
+			r.SetBasicAuth("ed", "editor-password")
+		})
+		if resp.StatusCode != http.StatusOK || !strings.Contains(body, "secret") {
+			t.Errorf("editor GET %s = %d %q, want the page", path, resp.StatusCode, body)
+		}
+	}
+	if resp, _ := send(t, srv, http.MethodGet, "/", nil, nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET / = %d, want the public home page", resp.StatusCode)
+	}
+}
+
+func TestPasswordPageSpellings(t *testing.T) {
+	srv, keys := protectServer(t)
+	spellings := []string{"/draft", "/draft/", "/draft.html", "//draft", "/x/../draft"}
+	for _, path := range spellings {
+		resp, body := send(t, srv, http.MethodGet, path, nil, nil)
+		if resp.StatusCode == http.StatusOK || strings.Contains(body, "secret") {
+			t.Errorf("locked GET %s = %d %q, want it refused", path, resp.StatusCode, body)
+		}
+	}
+
+	resp, _ := send(t, srv, http.MethodPost, "/draft/", strings.NewReader("password=hunter2"), func(r *http.Request) {
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	})
+	cookies := resp.Cookies()
+	if resp.StatusCode != http.StatusSeeOther || len(cookies) != 1 {
+		t.Fatalf("unlocking /draft/ = %d with %d cookies, want a redirect and a cookie", resp.StatusCode, len(cookies))
+	}
+	for _, path := range []string{"/draft", "/draft/", "/draft.html"} {
+		resp, body := send(t, srv, http.MethodGet, path, nil, func(r *http.Request) { r.AddCookie(cookies[0]) })
+		if resp.StatusCode != http.StatusOK || !strings.Contains(body, "secret") {
+			t.Errorf("unlocked GET %s = %d %q, want the page", path, resp.StatusCode, body)
+		}
+	}
+
+	token := strings.SplitN(keys.Link("/draft", time.Now().Add(time.Hour)), "?share=", 2)[1]
+	for _, path := range []string{"/draft", "/draft/", "/draft.html"} {
+		resp, body := send(t, srv, http.MethodGet, path+"?share="+token, nil, nil)
+		if resp.StatusCode != http.StatusOK || !strings.Contains(body, "secret") {
+			t.Errorf("shared GET %s = %d %q, want the page", path, resp.StatusCode, body)
+		}
+	}
+	// A share link is for one page only
+	if resp, body := send(t, srv, http.MethodGet, "/team/?share="+token, nil, nil); resp.StatusCode == http.StatusOK {
+		t.Errorf("share link for /draft opened /team/: %q", body)
+	}
+}
+
+func TestVisible(t *testing.T) {
+	cfg := config.Default()
+	users, err := auth.Load(filepath.Join(t.TempDir(), "users.json"), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Set("ed", "editor-password", auth.Editor); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := share.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	editors, _ := auth.ParseAccess([]string{"role:editor"})
+	s := New(cfg, analytics.New(cfg.Cache), users)
+	s.Access = func(url string) *auth.Access {
+		if url == "/team" {
+			return editors
+		}
+		return nil
+	}
+	s.Password = func(url string) string {
+		if url == "/draft" {
+			return "hunter2"
+		}
+		return ""
+	}
+	s.Shares = keys
+	page := newLockedPage("/draft", "hunter2")
+	unlock := &http.Cookie{Name: page.cookie, Value: keys.Sign(page.msg, time.Now().Add(time.Hour))}
+	for _, tc := range []struct {
+		url  string
+		edit func(*http.Request)
+		want bool
+	}{
+		{"/public", nil, true},
+		{"/team", nil, false},
+		{"/team", func(r *http.Request) { r.SetBasicAuth("ed", "editor-password") }, true},
+		{"/draft", nil, false},
+		{"/draft", func(r *http.Request) { r.AddCookie(unlock) }, true},
+		{"/team", func(r *http.Request) { r.AddCookie(unlock) }, false},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/comments"+tc.url, nil)
+		if tc.edit != nil {
+			tc.edit(r)
+		}
+		if got := s.Visible(r, tc.url); got != tc.want {
+			t.Errorf("Visible(%s) = %v, want %v", tc.url, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+// Package server serves compiled pages, assets and the analytics endpoints.
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+
+	"github.com/core6quad/GOMD/analytics"
+	"github.com/core6quad/GOMD/auth"
+	"github.com/core6quad/GOMD/config"
+	"github.com/core6quad/GOMD/minify"
+	"github.com/core6quad/GOMD/sass"
+	"github.com/core6quad/GOMD/share"
+)
+
+// Server routes requests to pages, assets and built-in endpoints
+type Server struct {
+	cfg       config.Config
+	analytics *analytics.Analytics
+	users     *auth.Users
+	mux       *http.ServeMux
+	unlock    http.Handler
+	routes    []Route
+
+	// The build being served, see SetBuildDir
+	buildDir atomic.Pointer[string]
+
+	// Maintenance mode, see maintenance.go
+	maintenance      atomic.Bool
+	maintenanceAllow *auth.Access
+
+	// Status returns extra fields for /status, such as build info
+	Status func() map[string]interface{}
+	// Access returns who may see a page URL, nil when it is public
+	Access func(url string) *auth.Access
+	// Password returns the password of a protected page URL, if any
+	Password func(url string) string
+	// Shares checks share links and unlocked pages, see protect.go
+	Shares *share.Keys
+	// Variants returns the A/B variants of a page URL, if it has any
+	Variants func(url string) []string
+}
+
+// Route is a registered route, see Routes
+type Route struct {
+	Pattern string
+	// The account role it needs, empty when it is public
+	Role auth.Role
+}
+
+// New sets up all built-in routes, private ones are checked against users
+func New(cfg config.Config, a *analytics.Analytics, users *auth.Users) *Server {
+	s := &Server{cfg: cfg, analytics: a, users: users, mux: http.NewServeMux()}
+	registerMIMETypes(cfg.MIMETypes)
+	// A few password attempts in a row, then one every 5 seconds per IP
+	s.unlock = withRateLimit(0.2, 5)(http.HandlerFunc(s.serveUnlock))
+	s.maintenance.Store(cfg.Maintenance)
+	allow, err := auth.ParseAccess(cfg.MaintenanceAllow)
+	if err != nil {
+		slog.Error("invalid maintenance_allow", "err", err)
+		allow = &auth.Access{}
+	}
+	s.maintenanceAllow = allow
+
+	// Serve /assets/* from the assets directory, without listings or dotfiles
+	// unless enabled
+	assets := safeFS{fs: http.Dir(cfg.AssetsDir), listing: cfg.AssetListing, dotfiles: cfg.ServeDotfiles}
+	s.handle("/assets/", "", withImageVariants(assets, withContentType(cfg.DefaultCharset,
+		http.StripPrefix("/assets/", sass.New(cfg.Sass).Handler(cfg.AssetsDir,
+			minify.New(cfg.Minify).Handler(assets, http.FileServer(assets)))))))
+
+	// /favicon.ico is the one generated from the favicon image or kept in
+	// the source dir, or else ./favicon.ico
+	s.handle("/favicon.ico", "", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, file := range []string{filepath.Join(s.BuildDir(), "favicon.ico"), "favicon.ico"} {
+			if _, err := os.Stat(file); err == nil {
+				w.Header().Set("Content-Type", "image/x-icon")
+				http.ServeFile(w, r, file)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+
+	// Beacon endpoint, only enabled when the beacon script is injected
+	if cfg.Beacon {
+		s.handle("/collect", "", http.HandlerFunc(a.ServeCollect))
+	}
+
+	// Self-monitoring endpoint
+	s.handle("/status", "", http.HandlerFunc(s.handleStatus))
+
+	// Analytics dashboard and data as JSON, for any account. Left open
+	// when there are no accounts at all
+	s.handleAnalytics("/analytics", http.HandlerFunc(a.ServeDashboard))
+	s.handleAnalytics("/analytics/api", http.HandlerFunc(a.ServeJSON))
+
+	if cfg.Pprof {
+		s.handleDebug()
+	}
+
+	// Compiled pages, counted by the analytics middleware. Only full GETs
+	// count as views, HEAD and Range requests (206) never do
+	s.handle("/", "", withAnalytics(a)(http.HandlerFunc(s.handlePage)))
+
+	return s
+}
+
+// SetBuildDir switches to serving the pages of another build directory,
+// so a finished build replaces the previous one at once
+func (s *Server) SetBuildDir(dir string) {
+	s.buildDir.Store(&dir)
+}
+
+// BuildDir returns the build directory being served
+func (s *Server) BuildDir() string {
+	if dir := s.buildDir.Load(); dir != nil {
+		return *dir
+	}
+	return s.cfg.BuildDir
+}
+
+// ServePage serves the compiled page at a request's URL, for routes that
+// give way to a page of the same name
+func (s *Server) ServePage(w http.ResponseWriter, r *http.Request) {
+	withAnalytics(s.analytics)(http.HandlerFunc(s.handlePage)).ServeHTTP(w, r)
+}
+
+// Handle registers an extra route
+func (s *Server) Handle(pattern string, h http.Handler) {
+	s.handle(pattern, "", h)
+}
+
+// HandlePrivate registers a route for accounts with at least the given
+// role. Unlike the analytics dashboard, it is never left open: without
+// accounts every request is refused
+func (s *Server) HandlePrivate(pattern string, role auth.Role, h http.Handler) {
+	s.handle(pattern, role, s.users.Require(role)(h))
+}
+
+func (s *Server) handle(pattern string, role auth.Role, h http.Handler) {
+	s.routes = append(s.routes, Route{pattern, role})
+	s.mux.Handle(pattern, h)
+}
+
+// Routes lists every route in the order they were registered. "/" is
+// the one serving the build's pages and files
+func (s *Server) Routes() []Route {
+	return s.routes
+}
+
+func (s *Server) handleAnalytics(pattern string, h http.Handler) {
+	if s.users.Empty() {
+		s.handle(pattern, "", h)
+		return
+	}
+	s.HandlePrivate(pattern, auth.Viewer, h)
+}
+
+// Handler returns the mux wrapped in the middleware chain
+func (s *Server) Handler() http.Handler {
+	return chain(s.mux,
+		withRequestLogging,
+		withRecovery,
+		withRateLimit(s.cfg.RateLimit, s.cfg.RateBurst),
+		withCompression(s.cfg.Compression),
+		withBasePath(s.cfg.BasePath),
+		s.withMaintenance,
+		withHeaders(s.cfg.Headers),
+		withCORS(s.cfg.CORS),
+	)
+}
+
+// Serve a compiled page, or a static file copied from the source dir,
+// from the build directory
+func (s *Server) handlePage(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.ServeDotfiles && hasDotSegment(r.URL.Path) {
+		http.NotFound(w, r)
+		return
+	}
+	root := s.BuildDir()
+	filePath, err := safeJoin(root, r)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.URL.Path == "/" {
+		filePath = filepath.Join(root, "index")
+	}
+	// Protection is checked against the file served, whichever way its
+	// URL was spelled
+	if fi, err := os.Stat(filePath); err == nil && !fi.IsDir() {
+		if !s.protect(w, r, pageURL(root, filePath)) {
+			return
+		}
+		setContentType(w, filePath, s.cfg.DefaultCharset)
+		http.ServeFile(w, r, filePath)
+		return
+	}
+	htmlPath := filePath + ".html"
+	if _, err := os.Stat(htmlPath); err == nil {
+		if !s.protect(w, r, pageURL(root, htmlPath)) {
+			return
+		}
+		if alt := s.alternate(w, r, filePath); alt != "" {
+			setContentType(w, alt, s.cfg.DefaultCharset)
+			http.ServeFile(w, r, alt)
+			return
+		}
+		http.ServeFile(w, r, htmlPath)
+		return
+	}
+	if s.Variants != nil {
+		url := pageURL(root, filePath)
+		if variants := s.Variants(url); len(variants) > 0 {
+			if !s.protect(w, r, url) {
+				return
+			}
+			s.serveVariant(w, r, filePath, url, variants)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// Version, build and runtime info as JSON
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	status := map[string]interface{}{
+		"go_version":      runtime.Version(),
+		"goroutines":      runtime.NumGoroutine(),
+		"cpu_count":       runtime.NumCPU(),
+		"memory_alloc_mb": float64(m.Alloc) / 1024.0 / 1024.0,
+		"memory_sys_mb":   float64(m.Sys) / 1024.0 / 1024.0,
+		"gc_runs":         m.NumGC,
+		"panics":          panicCount.Load(),
+		"caches":          s.analytics.CacheStats(),
+	}
+	if s.Status != nil {
+		for k, v := range s.Status() {
+			status[k] = v
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(status)
+}
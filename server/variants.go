@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// Visitors keep their A/B variant for this long
+const variantCookieAge = 30 * 24 * time.Hour
+
+type variantKey struct{}
+
+// Let withAnalytics find out which variant a page was served as
+func withVariantSlot(r *http.Request) (*http.Request, *string) {
+	v := new(string)
+	return r.WithContext(context.WithValue(r.Context(), variantKey{}, v)), v
+}
+
+// Serve one of a page's A/B variants, the same one for a visitor on every
+// visit. The choice is random at first and kept in a cookie per page
+func (s *Server) serveVariant(w http.ResponseWriter, r *http.Request, filePath, url string, variants []string) {
+	name := pageCookie("gomd_ab_", url)
+	variant := ""
+	if c, err := r.Cookie(name); err == nil {
+		for _, v := range variants {
+			if c.Value == v {
+				variant = v
+			}
+		}
+	}
+	if variant == "" {
+		variant = variants[rand.Intn(len(variants))]
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    variant,
+			Path:     s.cfg.BasePath + "/",
+			MaxAge:   int(variantCookieAge.Seconds()),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	if slot, ok := r.Context().Value(variantKey{}).(*string); ok {
+		*slot = variant
+	}
+	// Shared caches would hand everyone the same variant
+	w.Header().Set("Cache-Control", "private")
+	w.Header().Add("Vary", "Cookie")
+	http.ServeFile(w, r, filePath+"."+variant+".html")
+}
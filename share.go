@@ -0,0 +1,54 @@
+package gomd
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/core6quad/GOMD/auth"
+)
+
+var shareForm = template.Must(template.New("share").Parse(`
+<p>Share links open a page for anyone holding them until they expire, even when it is restricted or password protected.</p>
+<form method="post">{{.CSRF}}
+<input name="url" list="share-pages" placeholder="/drafts/launch" value="{{.URL}}" required>
+<datalist id="share-pages">{{range .Pages}}<option value="{{.URL}}">{{.Title}}</option>{{end}}</datalist>
+<select name="days"><option value="1">1 day</option><option value="7" selected>7 days</option><option value="30">30 days</option></select>
+<button>Create link</button>
+</form>
+{{if .Link}}<p>Valid until {{.Expires.Local.Format "2006-01-02 15:04"}}:</p><p><input readonly value="{{.Link}}" style="width:100%" onclick="this.select()"></p>{{end}}
+`))
+
+// Admin section creating share links
+func (s *Site) serveShare(w http.ResponseWriter, r *http.Request) {
+	data := map[string]interface{}{"Pages": s.Pages(), "CSRF": auth.CSRFField(r)}
+	if r.Method == http.MethodPost {
+		if s.shares == nil {
+			http.Error(w, "share links are unavailable, see the server log", http.StatusInternalServerError)
+			return
+		}
+		url := r.PostFormValue("url")
+		days, err := strconv.Atoi(r.PostFormValue("days"))
+		if err != nil || days < 1 || days > 365 || len(url) == 0 || url[0] != '/' {
+			http.Error(w, "invalid page or duration", http.StatusBadRequest)
+			return
+		}
+		expires := time.Now().Add(time.Duration(days) * 24 * time.Hour)
+		origin := s.Config.SiteURL
+		if origin == "" {
+			scheme := "http"
+			if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+				scheme = "https"
+			}
+			origin = scheme + "://" + r.Host
+		}
+		data["URL"], data["Expires"] = url, expires
+		data["Link"] = origin + s.Config.BasePath + s.shares.Link(url, expires)
+		s.Audit.RecordRequest(r, "share page", url+" until "+expires.UTC().Format(time.RFC3339))
+	}
+	var buf bytes.Buffer
+	shareForm.Execute(&buf, data)
+	s.Admin.Render(w, r, "Share links", template.HTML(buf.String()))
+}
@@ -0,0 +1,79 @@
+// Package share signs the time-limited links that let reviewers see a page
+// before it is public, and the cookies unlocking password protected pages.
+package share
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Keys signs and checks tokens with a secret kept in the data dir, so
+// links survive restarts
+type Keys struct {
+	key []byte
+}
+
+// Open loads data_dir/share.key, creating it the first time
+func Open(dataDir string) (*Keys, error) {
+	path := filepath.Join(dataDir, "share.key")
+	data, err := os.ReadFile(path)
+	if err == nil {
+		key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(key) < 32 {
+			return nil, errors.New("invalid " + path)
+		}
+		return &Keys{key: key}, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	key := make([]byte, 32)
+	rand.Read(key)
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		return nil, err
+	}
+	return &Keys{key: key}, nil
+}
+
+func (k *Keys) mac(msg string, expires int64) string {
+	h := hmac.New(sha256.New, k.key)
+	h.Write([]byte(strconv.FormatInt(expires, 10) + "|" + msg))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Sign returns a token for msg that is valid until expires
+func (k *Keys) Sign(msg string, expires time.Time) string {
+	exp := expires.Unix()
+	return strconv.FormatInt(exp, 10) + "." + k.mac(msg, exp)
+}
+
+// Valid checks a token made by Sign for the same msg, and that it hasn't
+// expired
+func (k *Keys) Valid(msg, token string) bool {
+	expStr, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	exp, err := strconv.ParseInt(expStr, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(k.mac(msg, exp)))
+}
+
+// Link signs a share link for a page URL
+func (k *Keys) Link(url string, expires time.Time) string {
+	return url + "?share=" + k.Sign("share "+url, expires)
+}
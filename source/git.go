@@ -0,0 +1,54 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Git syncs from a repository with the git command. The repository is kept
+// in GitDir, outside the source dir, which gets the checked out files:
+// every sync resets it to the remote branch, dropping local changes
+type Git struct {
+	URL    string
+	Branch string // default the remote's HEAD
+	GitDir string
+}
+
+func (g *Git) Sync(ctx context.Context, dir string) error {
+	if _, err := os.Stat(g.GitDir); err != nil {
+		if err := git(ctx, "--git-dir="+g.GitDir, "init", "-q"); err != nil {
+			return err
+		}
+	}
+	fetch := []string{"--git-dir=" + g.GitDir, "fetch", "-q", "--depth", "1", "--", g.URL}
+	if g.Branch != "" {
+		fetch = append(fetch, g.Branch)
+	}
+	if err := git(ctx, fetch...); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := git(ctx, "--git-dir="+g.GitDir, "--work-tree="+dir, "reset", "-q", "--hard", "FETCH_HEAD"); err != nil {
+		return err
+	}
+	return git(ctx, "--git-dir="+g.GitDir, "--work-tree="+dir, "clean", "-fdq")
+}
+
+func git(ctx context.Context, args ...string) error {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	// Never stop to ask for credentials, use a token in the URL or a
+	// credential helper
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package source
+
+import (
+	"context"
+	"strings"
+
+	"github.com/core6quad/GOMD/config"
+	"github.com/core6quad/GOMD/s3"
+)
+
+// S3 syncs every object below Prefix in a bucket. GCS works the same
+// through its S3-compatible API with HMAC keys
+type S3 struct {
+	Client *s3.Client
+	Prefix string
+}
+
+func newS3(cfg config.SourceConfig) *S3 {
+	c := &s3.Client{
+		Endpoint:  cfg.URL,
+		Region:    cfg.Region,
+		Bucket:    cfg.Bucket,
+		AccessKey: cfg.AccessKey,
+		SecretKey: cfg.SecretKey,
+	}
+	if cfg.Type == "gcs" && c.Endpoint == "" {
+		c.Endpoint = "https://storage.googleapis.com"
+		if c.Region == "" {
+			c.Region = "auto"
+		}
+	}
+	prefix := strings.Trim(cfg.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &S3{Client: c, Prefix: prefix}
+}
+
+func (s *S3) Sync(ctx context.Context, dir string) error {
+	objects, err := s.Client.List(ctx, s.Prefix)
+	if err != nil {
+		return err
+	}
+	return replaceDir(dir, func(staging string) error {
+		for _, o := range objects {
+			rel := strings.TrimPrefix(o.Key, s.Prefix)
+			// Folder placeholders created by some consoles
+			if rel == "" || strings.HasSuffix(rel, "/") {
+				continue
+			}
+			body, err := s.Client.Get(ctx, o.Key)
+			if err != nil {
+				return err
+			}
+			err = writeFile(staging, rel, body)
+			body.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
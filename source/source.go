@@ -0,0 +1,95 @@
+// Package source syncs the source dir from a remote copy (a Git
+// repository, an S3 or GCS bucket, or a WebDAV folder) for deployments
+// where nobody authors pages on the server itself.
+package source
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/core6quad/GOMD/config"
+)
+
+// Source replaces the contents of a directory with the remote copy
+type Source interface {
+	Sync(ctx context.Context, dir string) error
+}
+
+// New returns the source configured in cfg, nil when there is none. Git
+// keeps its repository in dataDir
+func New(cfg config.SourceConfig, dataDir string) (Source, error) {
+	switch cfg.Type {
+	case "":
+		return nil, nil
+	case "git":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("source: git needs a url")
+		}
+		return &Git{URL: cfg.URL, Branch: cfg.Branch, GitDir: filepath.Join(dataDir, "source.git")}, nil
+	case "s3", "gcs":
+		if cfg.Bucket == "" {
+			return nil, fmt.Errorf("source: %s needs a bucket", cfg.Type)
+		}
+		return newS3(cfg), nil
+	case "webdav":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("source: webdav needs a url")
+		}
+		return &WebDAV{URL: cfg.URL, Username: cfg.Username, Password: cfg.Password}, nil
+	}
+	return nil, fmt.Errorf("source: unknown type %q, use git, s3, gcs or webdav", cfg.Type)
+}
+
+// Download everything into a fresh directory next to dir with fetch, then
+// swap it in, so a failed sync leaves the old copy alone
+func replaceDir(dir string, fetch func(staging string) error) error {
+	parent := filepath.Dir(filepath.Clean(dir))
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return err
+	}
+	staging, err := os.MkdirTemp(parent, "."+filepath.Base(dir)+".sync-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+	if err := fetch(staging); err != nil {
+		return err
+	}
+	if err := os.Chmod(staging, 0755); err != nil {
+		return err
+	}
+	old := staging + ".old"
+	if err := os.Rename(dir, old); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(staging, dir); err != nil {
+		os.Rename(old, dir)
+		return err
+	}
+	return os.RemoveAll(old)
+}
+
+// Write a downloaded file below root, refusing keys that would escape it
+func writeFile(root, rel string, r io.Reader) error {
+	rel = filepath.FromSlash(strings.TrimPrefix(rel, "/"))
+	path := filepath.Join(root, rel)
+	if rel == "" || !strings.HasPrefix(path, filepath.Clean(root)+string(filepath.Separator)) {
+		return fmt.Errorf("source: refusing to write %q outside the source dir", rel)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,144 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// WebDAV syncs a folder (and its subfolders) from a WebDAV server such as
+// Nextcloud
+type WebDAV struct {
+	URL      string
+	Username string
+	Password string
+}
+
+var davClient = &http.Client{Timeout: 5 * time.Minute}
+
+type davEntry struct {
+	href string
+	dir  bool
+}
+
+func (d *WebDAV) Sync(ctx context.Context, dir string) error {
+	base, err := url.Parse(strings.TrimSuffix(d.URL, "/") + "/")
+	if err != nil {
+		return err
+	}
+	return replaceDir(dir, func(staging string) error {
+		return d.syncDir(ctx, base, base, staging)
+	})
+}
+
+// Download the files of one folder and recurse into its subfolders
+func (d *WebDAV) syncDir(ctx context.Context, base, folder *url.URL, staging string) error {
+	entries, err := d.list(ctx, folder)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		u, err := folder.Parse(e.href)
+		if err != nil {
+			return err
+		}
+		// The listing includes the folder itself
+		if strings.TrimSuffix(u.Path, "/") == strings.TrimSuffix(folder.Path, "/") {
+			continue
+		}
+		if !strings.HasPrefix(u.Path, base.Path) {
+			continue
+		}
+		if e.dir {
+			if !strings.HasSuffix(u.Path, "/") {
+				u.Path += "/"
+			}
+			if err := d.syncDir(ctx, base, u, staging); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := d.download(ctx, u, staging, strings.TrimPrefix(u.Path, base.Path)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const propfind = `<?xml version="1.0" encoding="utf-8"?><propfind xmlns="DAV:"><prop><resourcetype/></prop></propfind>`
+
+func (d *WebDAV) list(ctx context.Context, folder *url.URL) ([]davEntry, error) {
+	req, err := http.NewRequestWithContext(ctx, "PROPFIND", folder.String(), strings.NewReader(propfind))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Depth", "1")
+	req.Header.Set("Content-Type", "application/xml")
+	resp, err := d.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var ms struct {
+		Responses []struct {
+			Href     string `xml:"href"`
+			Propstat []struct {
+				Prop struct {
+					ResourceType struct {
+						Collection *struct{} `xml:"collection"`
+					} `xml:"resourcetype"`
+				} `xml:"prop"`
+			} `xml:"propstat"`
+		} `xml:"response"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("webdav: listing %s: %w", folder.Path, err)
+	}
+	var entries []davEntry
+	for _, r := range ms.Responses {
+		e := davEntry{href: r.Href}
+		for _, ps := range r.Propstat {
+			if ps.Prop.ResourceType.Collection != nil {
+				e.dir = true
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (d *WebDAV) download(ctx context.Context, u *url.URL, staging, rel string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := d.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return writeFile(staging, path.Clean("/"+rel), resp.Body)
+}
+
+func (d *WebDAV) do(req *http.Request) (*http.Response, error) {
+	if d.Username != "" {
+		req.SetBasicAuth(d.Username, d.Password)
+	}
+	resp, err := davClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("webdav: %s %s: %s: %s", req.Method, req.URL.Path, resp.Status, bytes.TrimSpace(msg))
+	}
+	return resp, nil
+}
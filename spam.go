@@ -0,0 +1,37 @@
+package gomd
+
+import (
+	"log/slog"
+
+	"github.com/core6quad/GOMD/config"
+	"github.com/core6quad/GOMD/spam"
+)
+
+// The spam checks in config, in order, or nil when there are none
+func newSpamFilter(cfg config.Config) *spam.Filter {
+	f := &spam.Filter{}
+	if len(cfg.Spam.Blocklist) > 0 {
+		b, err := spam.NewBlocklist(cfg.Spam.Blocklist)
+		if err != nil {
+			slog.Error("invalid spam blocklist", "err", err)
+		} else {
+			f.Checkers = append(f.Checkers, b)
+		}
+	}
+	if cfg.Spam.AkismetKey != "" {
+		f.Checkers = append(f.Checkers, &spam.Akismet{Key: cfg.Spam.AkismetKey, Endpoint: cfg.Spam.AkismetURL, Blog: cfg.SiteURL + cfg.BasePath + "/"})
+	}
+	if cfg.Spam.Bayes {
+		b, err := spam.OpenBayes(cfg.DataDir)
+		if err != nil {
+			slog.Error("failed to load spam filter", "err", err)
+		} else {
+			f.Bayes = b
+			f.Checkers = append(f.Checkers, b)
+		}
+	}
+	if len(f.Checkers) == 0 {
+		return nil
+	}
+	return f
+}
@@ -0,0 +1,60 @@
+package spam
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Akismet asks an Akismet-compatible service's comment-check API
+type Akismet struct {
+	Key string
+	// Default https://rest.akismet.com
+	Endpoint string
+	// The site's URL, as registered with the service
+	Blog string
+}
+
+func (a *Akismet) Spam(ctx context.Context, sub Submission) (bool, error) {
+	endpoint := a.Endpoint
+	if endpoint == "" {
+		endpoint = "https://rest.akismet.com"
+	}
+	form := url.Values{
+		"api_key":              {a.Key},
+		"blog":                 {a.Blog},
+		"user_ip":              {sub.IP},
+		"user_agent":           {sub.UserAgent},
+		"referrer":             {sub.Referrer},
+		"comment_type":         {sub.Kind},
+		"comment_author":       {sub.Author},
+		"comment_author_email": {sub.Email},
+		"comment_author_url":   {sub.URL},
+		"comment_content":      {sub.Text},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/1.1/comment-check", strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	switch strings.TrimSpace(string(body)) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	// "invalid" and errors explain themselves in a header
+	if msg := resp.Header.Get("X-akismet-debug-help"); msg != "" {
+		return false, errors.New(msg)
+	}
+	return false, errors.New("unexpected answer: " + resp.Status)
+}
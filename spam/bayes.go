@@ -0,0 +1,125 @@
+package spam
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// The filter stays quiet until it has seen this many of both spam and
+// non-spam, and then only acts when it is quite sure
+const (
+	minTraining = 10
+	threshold   = 0.95
+)
+
+var wordRe = regexp.MustCompile(`[\p{L}\p{N}$'_-]{3,30}`)
+
+// Bayes is a naive Bayes filter learning from moderation decisions. Its
+// word counts are kept in a JSON file in the data dir
+type Bayes struct {
+	mu   sync.Mutex
+	path string
+	// Documents seen of each class, and how many of them had each word
+	Docs  [2]int            `json:"docs"`
+	Words map[string][2]int `json:"words"`
+}
+
+// Class indexes
+const (
+	ham = iota
+	spam
+)
+
+// OpenBayes loads the filter's counts from the data dir
+func OpenBayes(dataDir string) (*Bayes, error) {
+	b := &Bayes{path: filepath.Join(dataDir, "spam.json"), Words: make(map[string][2]int)}
+	data, err := os.ReadFile(b.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, err
+	}
+	if b.Words == nil {
+		b.Words = make(map[string][2]int)
+	}
+	return b, nil
+}
+
+// Each word of a submission once, URLs and addresses included
+func tokens(sub Submission) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, w := range wordRe.FindAllString(strings.ToLower(strings.Join([]string{sub.Author, sub.Email, sub.URL, sub.Text}, " ")), -1) {
+		if !seen[w] {
+			seen[w] = true
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// Train counts a submission's words as spam or not, and saves the counts
+func (b *Bayes) Train(sub Submission, isSpam bool) error {
+	class := ham
+	if isSpam {
+		class = spam
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.Docs[class]++
+	for _, w := range tokens(sub) {
+		c := b.Words[w]
+		c[class]++
+		b.Words[w] = c
+	}
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(b.path), 0755); err != nil {
+		return err
+	}
+	tmp := b.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.path)
+}
+
+// Score is the probability a submission is spam, 0.5 while untrained
+func (b *Bayes) Score(sub Submission) float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.Docs[ham] < minTraining || b.Docs[spam] < minTraining {
+		return 0.5
+	}
+	logit := math.Log(float64(b.Docs[spam])) - math.Log(float64(b.Docs[ham]))
+	for _, w := range tokens(sub) {
+		c, ok := b.Words[w]
+		if !ok {
+			continue
+		}
+		// How often the word shows up in each class, smoothed so words
+		// seen in one class only don't decide alone
+		pSpam := (float64(c[spam]) + 1) / (float64(b.Docs[spam]) + 2)
+		pHam := (float64(c[ham]) + 1) / (float64(b.Docs[ham]) + 2)
+		logit += math.Log(pSpam) - math.Log(pHam)
+	}
+	return 1 / (1 + math.Exp(-logit))
+}
+
+func (b *Bayes) Spam(_ context.Context, sub Submission) (bool, error) {
+	return b.Score(sub) >= threshold, nil
+}
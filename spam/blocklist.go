@@ -0,0 +1,34 @@
+package spam
+
+import (
+	"context"
+	"regexp"
+)
+
+// Blocklist calls a submission spam when any pattern matches its author,
+// email, URL or text
+type Blocklist []*regexp.Regexp
+
+// NewBlocklist compiles patterns, matched case insensitively
+func NewBlocklist(patterns []string) (Blocklist, error) {
+	var b Blocklist
+	for _, p := range patterns {
+		re, err := regexp.Compile("(?i)" + p)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, re)
+	}
+	return b, nil
+}
+
+func (b Blocklist) Spam(_ context.Context, sub Submission) (bool, error) {
+	for _, re := range b {
+		for _, s := range []string{sub.Author, sub.Email, sub.URL, sub.Text} {
+			if re.MatchString(s) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
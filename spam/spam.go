@@ -0,0 +1,87 @@
+// Package spam checks comments and form submissions before they are
+// queued or delivered. Checks are pluggable, GOMD comes with regex
+// blocklists, Akismet-compatible services and a naive Bayes filter trained
+// from comment moderation.
+package spam
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Submission is what gets checked
+type Submission struct {
+	// "comment" or "contact-form", as Akismet calls them
+	Kind   string
+	Author string
+	Email  string
+	URL    string
+	Text   string
+	// Filled in from the request by Filter.Check
+	IP        string
+	UserAgent string
+	Referrer  string
+}
+
+// Checker is one spam check
+type Checker interface {
+	Spam(ctx context.Context, sub Submission) (bool, error)
+}
+
+// Filter runs its checks in order until one calls a submission spam. A
+// check that fails to run lets the submission through
+type Filter struct {
+	Checkers []Checker
+	// Learns from moderation when set, and is one of Checkers
+	Bayes *Bayes
+}
+
+// Check reports whether a submission made in r is spam. A nil Filter
+// lets everything through
+func (f *Filter) Check(r *http.Request, sub Submission) bool {
+	if f == nil {
+		return false
+	}
+	sub.IP, _, _ = net.SplitHostPort(r.RemoteAddr)
+	sub.UserAgent, sub.Referrer = r.UserAgent(), r.Referer()
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	for _, c := range f.Checkers {
+		spam, err := c.Spam(ctx, sub)
+		if err != nil {
+			slog.Warn("spam check failed", "check", name(c), "err", err)
+			continue
+		}
+		if spam {
+			slog.Info("spam dropped", "kind", sub.Kind, "check", name(c), "ip", sub.IP)
+			return true
+		}
+	}
+	return false
+}
+
+// Train teaches the Bayes filter, if any, that a moderated submission was
+// spam or not
+func (f *Filter) Train(sub Submission, spam bool) {
+	if f == nil || f.Bayes == nil {
+		return
+	}
+	if err := f.Bayes.Train(sub, spam); err != nil {
+		slog.Error("failed to save spam filter", "err", err)
+	}
+}
+
+func name(c Checker) string {
+	switch c.(type) {
+	case Blocklist:
+		return "blocklist"
+	case *Akismet:
+		return "akismet"
+	case *Bayes:
+		return "bayes"
+	}
+	return "custom"
+}
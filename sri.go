@@ -0,0 +1,39 @@
+package gomd
+
+import (
+	"log/slog"
+
+	"github.com/core6quad/GOMD/analytics"
+	"github.com/core6quad/GOMD/config"
+	"github.com/core6quad/GOMD/sri"
+)
+
+// The integrity pins of external resources, nil when SRI is off
+func newSRIPins(cfg config.Config) *sri.Pins {
+	if !cfg.SRI.Enabled && !cfg.SRI.ForbidExternal {
+		return nil
+	}
+	p, err := sri.Open(cfg.DataDir)
+	if err != nil {
+		slog.Error("failed to load integrity hashes", "err", err)
+		return nil
+	}
+	p.Forbid = cfg.SRI.ForbidExternal
+	return p
+}
+
+// Load Chart.js into the analytics dashboard, with its integrity when SRI
+// is on, or not at all from another site when external resources are
+// forbidden
+func (s *Site) pinChartScript() {
+	url := s.Config.SRI.ChartJS
+	if url == "" {
+		url = analytics.ChartJS
+	}
+	tag, err := s.sri.ScriptTag(url)
+	if err != nil {
+		slog.Error("analytics dashboard charts disabled, set sri.chart_js to a copy in assets", "err", err)
+		tag = ""
+	}
+	s.Analytics.SetChartScript(tag)
+}
@@ -0,0 +1,186 @@
+// Package sri adds subresource integrity to the external scripts and
+// stylesheets pages load. Each URL is fetched once and its hash pinned in
+// the data dir, so a CDN serving something else later is blocked by
+// browsers instead of run.
+package sri
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+var client = &http.Client{Timeout: 15 * time.Second}
+
+// The largest script or stylesheet hashed
+const maxSize = 10 << 20
+
+var resourceTag = regexp.MustCompile(`(?i)<(script|link)\b[^>]*>`)
+
+// Pins are the integrity hashes of external URLs, by URL
+type Pins struct {
+	mu     sync.Mutex
+	path   string
+	hashes map[string]string
+
+	// Forbid makes pages loading external resources an error instead
+	Forbid bool
+}
+
+// Open loads the pinned hashes from the data dir
+func Open(dataDir string) (*Pins, error) {
+	p := &Pins{path: filepath.Join(dataDir, "sri.json"), hashes: make(map[string]string)}
+	data, err := os.ReadFile(p.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &p.hashes); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// External reports whether a URL is on another site
+func External(url string) bool {
+	u := strings.ToLower(url)
+	return strings.HasPrefix(u, "https://") || strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "//")
+}
+
+// Integrity returns the integrity attribute value of a URL, fetching and
+// pinning it the first time
+func (p *Pins) Integrity(url string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if h, ok := p.hashes[url]; ok {
+		return h, nil
+	}
+	get := url
+	if strings.HasPrefix(get, "//") {
+		get = "https:" + get
+	}
+	resp, err := client.Get(get)
+	if err != nil {
+		return "", fmt.Errorf("integrity of %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("integrity of %s: %s", url, resp.Status)
+	}
+	h := sha512.New384()
+	if _, err := io.Copy(h, io.LimitReader(resp.Body, maxSize)); err != nil {
+		return "", fmt.Errorf("integrity of %s: %w", url, err)
+	}
+	integrity := "sha384-" + base64.StdEncoding.EncodeToString(h.Sum(nil))
+	p.hashes[url] = integrity
+	return integrity, p.save()
+}
+
+// Write the pins atomically, the caller holds mu
+func (p *Pins) save() error {
+	data, err := json.MarshalIndent(p.hashes, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p.path), 0755); err != nil {
+		return err
+	}
+	tmp := p.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.path)
+}
+
+// Rewrite adds integrity and crossorigin attributes to the external
+// scripts and stylesheets of a page. Tags that already have an integrity
+// are left as they are. With Forbid, any external resource is an error
+func (p *Pins) Rewrite(page []byte) ([]byte, error) {
+	if p == nil {
+		return page, nil
+	}
+	var errs []error
+	out := resourceTag.ReplaceAllFunc(page, func(tag []byte) []byte {
+		url, attrs := externalResource(tag)
+		if url == "" {
+			return tag
+		}
+		if p.Forbid {
+			errs = append(errs, fmt.Errorf("external resources are forbidden: %s", url))
+			return tag
+		}
+		if attrs["integrity"] {
+			return tag
+		}
+		integrity, err := p.Integrity(url)
+		if err != nil {
+			errs = append(errs, err)
+			return tag
+		}
+		add := ` integrity="` + integrity + `"`
+		if !attrs["crossorigin"] {
+			add += ` crossorigin="anonymous"`
+		}
+		end := len(tag) - 1
+		if bytes.HasSuffix(tag, []byte("/>")) {
+			end--
+		}
+		return append(append(append([]byte{}, bytes.TrimRight(tag[:end], " ")...), add...), tag[end:]...)
+	})
+	return out, errors.Join(errs...)
+}
+
+// The external URL a <script src> or stylesheet <link> loads, and which
+// attributes the tag has
+func externalResource(tag []byte) (string, map[string]bool) {
+	z := html.NewTokenizer(bytes.NewReader(tag))
+	z.Next()
+	t := z.Token()
+	attrs := make(map[string]bool)
+	var src, rel, as string
+	for _, a := range t.Attr {
+		attrs[a.Key] = true
+		switch a.Key {
+		case "src", "href":
+			src = a.Val
+		case "rel":
+			rel = strings.ToLower(a.Val)
+		case "as":
+			as = strings.ToLower(a.Val)
+		}
+	}
+	if !External(src) {
+		return "", nil
+	}
+	switch {
+	case t.Data == "script" && attrs["src"]:
+	case t.Data == "link" && (rel == "stylesheet" || rel == "modulepreload" || rel == "preload" && (as == "script" || as == "style")):
+	default:
+		return "", nil
+	}
+	return src, attrs
+}
+
+// ScriptTag returns a <script> for a URL, with its integrity when it is
+// external
+func (p *Pins) ScriptTag(url string) (string, error) {
+	tag := `<script src="` + html.EscapeString(url) + `"></script>`
+	out, err := p.Rewrite([]byte(tag))
+	return string(out), err
+}
@@ -0,0 +1,95 @@
+package gomd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// How often the source dir is polled for changes, 0 when it isn't
+func (s *Site) watchInterval() time.Duration {
+	d, err := time.ParseDuration(s.Config.WatchSource)
+	if err != nil || d <= 0 {
+		return 0
+	}
+	return d
+}
+
+// A hash of the source dir's file names, sizes and times. The dir is
+// resolved first, so pointing a symlink at a new release counts as a
+// change. Hidden files are left out, like rsync's temporary ones
+func sourceFingerprint(dir string) (string, error) {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", root)
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && p != root {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		// Symlinked files count as what they point to
+		fi, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, p)
+		fmt.Fprintf(h, "%s %d %d\n", filepath.ToSlash(rel), fi.Size(), fi.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Poll the source dir and rebuild when it differs from the last build and
+// has stayed the same for a whole interval, so a copy still going on or a
+// dir halfway through being swapped isn't built
+func (s *Site) watchSource(every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	// A broken change is tried once, not on every tick until it's fixed
+	var last, failed string
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.done:
+			return
+		}
+		current, err := sourceFingerprint(s.Config.SrcDir)
+		if err != nil {
+			// Gone for a moment while a new one is renamed in
+			last = ""
+			continue
+		}
+		s.buildMu.RLock()
+		built := s.sourcePrint
+		s.buildMu.RUnlock()
+		if current != last || current == built || current == failed {
+			last = current
+			continue
+		}
+		slog.Info("source dir changed, rebuilding")
+		if err := s.Build(); err != nil {
+			slog.Error("rebuild failed", "reason", "source dir changed", "err", err)
+			failed = current
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Package webhook sends notifications to Slack, Discord or generic JSON endpoints.
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/core6quad/GOMD/config"
+)
+
+// Event is the data available to webhook templates
+type Event struct {
+	Event   string
+	Message string
+	Time    time.Time
+	Data    map[string]interface{}
+}
+
+// Notifier fans events out to the configured webhooks
+type Notifier struct {
+	Hooks  []config.Webhook
+	Client *http.Client
+}
+
+// New returns a Notifier for the given hooks
+func New(hooks []config.Webhook) *Notifier {
+	return &Notifier{Hooks: hooks, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Notify sends an event to every webhook subscribed to it, in the background
+func (n *Notifier) Notify(event, message string, data map[string]interface{}) {
+	if n == nil {
+		return
+	}
+	for _, hook := range n.Hooks {
+		n.Send(hook, event, message, data)
+	}
+}
+
+// Send delivers an event to a single webhook if it's subscribed to it
+func (n *Notifier) Send(hook config.Webhook, event, message string, data map[string]interface{}) {
+	if n == nil || !wants(hook, event) {
+		return
+	}
+	ev := Event{Event: event, Message: message, Time: time.Now(), Data: data}
+	go func() {
+		body, err := payload(hook, ev)
+		if err != nil {
+			slog.Error("webhook payload failed", "url", hook.URL, "event", event, "err", err)
+			return
+		}
+		resp, err := n.Client.Post(hook.URL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			slog.Error("webhook failed", "url", hook.URL, "event", event, "err", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			slog.Warn("webhook unexpected status", "url", hook.URL, "event", event, "status", resp.Status)
+			return
+		}
+		slog.Debug("webhook sent", "url", hook.URL, "event", event)
+	}()
+}
+
+func wants(h config.Webhook, event string) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, e := range h.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Build the request body for the webhook type
+func payload(h config.Webhook, ev Event) ([]byte, error) {
+	msg := ev.Message
+	if h.Template != "" {
+		tmpl, err := template.New("webhook").Parse(h.Template)
+		if err != nil {
+			return nil, err
+		}
+		var sb strings.Builder
+		if err := tmpl.Execute(&sb, ev); err != nil {
+			return nil, err
+		}
+		msg = sb.String()
+	}
+	switch h.Type {
+	case "slack":
+		return json.Marshal(map[string]string{"text": msg})
+	case "discord":
+		return json.Marshal(map[string]string{"content": msg})
+	default:
+		if h.Template != "" {
+			return []byte(msg), nil
+		}
+		return json.Marshal(map[string]interface{}{
+			"event":   ev.Event,
+			"message": ev.Message,
+			"time":    ev.Time,
+			"data":    ev.Data,
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/core6quad/GOMD/config"
+)
+
+func TestNilNotifier(t *testing.T) {
+	var hits atomic.Int32
+	unwanted := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer unwanted.Close()
+	delivered := make(chan struct{}, 1)
+	wanted := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered <- struct{}{}
+	}))
+	defer wanted.Close()
+
+	var n *Notifier
+	n.Notify("new_country", "First view from NL", nil)
+	n.Send(config.Webhook{URL: unwanted.URL}, "new_country", "First view from NL", nil)
+	New(nil).Notify("new_country", "First view from NL", nil)
+	New([]config.Webhook{
+		{URL: unwanted.URL, Events: []string{"rebuild"}},
+		{URL: wanted.URL, Events: []string{"new_country"}},
+	}).Notify("new_country", "First view from NL", nil)
+
+	// Sends are in the background, the subscribed hook shows they ran
+	select {
+	case <-delivered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the subscribed webhook was never called")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := hits.Load(); n != 0 {
+		t.Errorf("webhooks not subscribed to the event were called %d times", n)
+	}
+}
@@ -0,0 +1,46 @@
+package gomd
+
+import (
+	"log/slog"
+	"net/url"
+
+	"github.com/core6quad/GOMD/auth"
+	"github.com/core6quad/GOMD/compiler"
+	"github.com/core6quad/GOMD/server"
+	"github.com/core6quad/GOMD/webmention"
+)
+
+func (s *Site) enableWebmention() {
+	store, err := webmention.Open(s.Config.DataDir)
+	if err != nil {
+		slog.Error("failed to load webmentions", "err", err)
+		return
+	}
+	store.SiteURL, store.BasePath = s.Config.SiteURL, s.Config.BasePath
+	store.PageExists = func(url string) bool { return s.page(url) != nil }
+	// Mentions are rendered into pages at build time
+	store.OnChange = func() { s.rebuildAsync("webmention moderated") }
+	store.Audit = s.Audit.RecordRequest
+	s.Webmentions = store
+	// Each mention makes the server fetch its source
+	s.Server.Handle("/webmention", server.RateLimit(0.2, 5)(store))
+	s.Admin.Add("Webmentions", "/admin/webmentions", auth.Editor, store.Moderation(s.Admin))
+}
+
+// Send Webmentions for the outbound links of pages a rebuild added or
+// changed
+func (s *Site) sendWebmentions(opts compiler.Options, pages []*compiler.Page, prev, cur map[string][32]byte) {
+	site, err := url.Parse(s.Config.SiteURL)
+	if err != nil || s.Config.SiteURL == "" {
+		return
+	}
+	byURL := make(map[string]*compiler.Page, len(pages))
+	for _, p := range pages {
+		byURL[p.URL] = p
+	}
+	for _, u := range changedURLs(pages, prev, cur) {
+		if p := byURL[u]; p != nil && opts.Indexable(p) {
+			webmention.Send(opts.AbsURL(u), webmention.Links(string(p.Content), site.Host))
+		}
+	}
+}
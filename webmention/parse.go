@@ -0,0 +1,255 @@
+package webmention
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// Anyone can make the server fetch a source URL, so private and loopback
+// addresses are off limits
+var client = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		// Never through a proxy, which would dial the target itself
+		// and skip the address check below
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, _ := net.SplitHostPort(address)
+				if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+					return errors.New("refusing to connect to " + host)
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+}
+
+// Replaced when testing against local servers
+var publicIP = func(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast())
+}
+
+// Longest mention text kept, in characters
+const maxText = 280
+
+// microformats2 classes marking what a link to the target is
+var linkTypes = map[string]string{
+	"u-like-of":     "like",
+	"u-repost-of":   "repost",
+	"u-in-reply-to": "reply",
+	"u-bookmark-of": "bookmark",
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, a := range n.Attr {
+		if a.Key == "class" {
+			for _, c := range strings.Fields(a.Val) {
+				if c == class {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func text(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			b.WriteByte(' ')
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "…"
+}
+
+// Same URL, ignoring a trailing slash and the fragment
+func sameURL(a, b *url.URL) bool {
+	a2, b2 := *a, *b
+	a2.Fragment, b2.Fragment = "", ""
+	return strings.TrimSuffix(a2.String(), "/") == strings.TrimSuffix(b2.String(), "/")
+}
+
+// Read the mention out of a source page: whether it links to the target,
+// how, and who wrote it. The author and text come from microformats2
+// (h-card, e-content) when the page has them
+func parseSource(resp *http.Response, source, target string) (Mention, bool) {
+	m := Mention{Source: source, Type: "mention"}
+	base, _ := url.Parse(source)
+	want, err := url.Parse(target)
+	if err != nil {
+		return m, false
+	}
+	doc, err := html.Parse(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return m, false
+	}
+	found := false
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch {
+			case n.Data == "a" || n.Data == "link" || n.Data == "img" || n.Data == "video" || n.Data == "audio":
+				ref := attr(n, "href")
+				if ref == "" {
+					ref = attr(n, "src")
+				}
+				if u, err := base.Parse(ref); err == nil && ref != "" && sameURL(u, want) {
+					found = true
+					for class, typ := range linkTypes {
+						if hasClass(n, class) {
+							m.Type = typ
+						}
+					}
+				}
+				if m.Author == "" && hasClass(n, "p-author") {
+					m.Author, m.AuthorURL = text(n), attr(n, "href")
+				}
+			case n.Data == "title" && m.Title == "":
+				m.Title = text(n)
+			case n.Data == "meta" && attr(n, "name") == "author" && m.Author == "":
+				m.Author = attr(n, "content")
+			case hasClass(n, "p-author") && m.Author == "":
+				// An h-card: the name, and its first link
+				if name := findClass(n, "p-name"); name != nil {
+					m.Author = text(name)
+				} else {
+					m.Author = text(n)
+				}
+				if u := findClass(n, "u-url"); u != nil {
+					m.AuthorURL = attr(u, "href")
+				}
+			case hasClass(n, "e-content") && m.Text == "":
+				m.Text = truncate(text(n), maxText)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	m.Title = truncate(m.Title, maxText)
+	m.Author = truncate(m.Author, 100)
+	if u, err := base.Parse(m.AuthorURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		m.AuthorURL = ""
+	} else {
+		m.AuthorURL = u.String()
+	}
+	return m, found
+}
+
+func findClass(n *html.Node, class string) *html.Node {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && hasClass(c, class) {
+			return c
+		}
+		if found := findClass(c, class); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// Discover a page's Webmention endpoint: a Link header or a <link> or
+// <a> with rel="webmention", resolved against the page URL
+func discover(ctx context.Context, target string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	base := resp.Request.URL
+	for _, link := range resp.Header.Values("Link") {
+		for _, part := range strings.Split(link, ",") {
+			ref, params, ok := strings.Cut(part, ";")
+			if !ok {
+				continue
+			}
+			for _, p := range strings.Split(params, ";") {
+				k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+				if k == "rel" && hasRel(strings.Trim(v, `"`)) {
+					if u, err := base.Parse(strings.Trim(strings.TrimSpace(ref), "<>")); err == nil {
+						return u.String(), nil
+					}
+				}
+			}
+		}
+	}
+	if !strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		return "", nil
+	}
+	doc, err := html.Parse(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	var endpoint string
+	var walk func(*html.Node) bool
+	walk = func(n *html.Node) bool {
+		if n.Type == html.ElementNode && (n.Data == "link" || n.Data == "a") && hasRel(attr(n, "rel")) {
+			for _, a := range n.Attr {
+				// An empty href is the page itself
+				if a.Key == "href" {
+					if u, err := base.Parse(a.Val); err == nil {
+						endpoint = u.String()
+						return true
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if walk(c) {
+				return true
+			}
+		}
+		return false
+	}
+	walk(doc)
+	return endpoint, nil
+}
+
+func hasRel(rel string) bool {
+	for _, r := range strings.Fields(rel) {
+		if r == "webmention" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package webmention
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var hrefRe = regexp.MustCompile(`href="(https?://[^"]+)"`)
+
+// Links returns the absolute links of a page's HTML that point elsewhere
+// than host, each once
+func Links(content, host string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, m := range hrefRe.FindAllStringSubmatch(content, -1) {
+		link := strings.ReplaceAll(m[1], "&amp;", "&")
+		u, err := url.Parse(link)
+		if err != nil || strings.EqualFold(u.Host, host) || seen[link] {
+			continue
+		}
+		seen[link] = true
+		out = append(out, link)
+	}
+	return out
+}
+
+// Send notifies every target that supports Webmention that source links
+// to it. Targets without an endpoint are skipped
+func Send(source string, targets []string) {
+	for _, target := range targets {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		err := send(ctx, source, target)
+		cancel()
+		if err != nil {
+			slog.Warn("webmention not sent", "source", source, "target", target, "err", err)
+		}
+	}
+}
+
+func send(ctx context.Context, source, target string) error {
+	endpoint, err := discover(ctx, target)
+	if err != nil || endpoint == "" {
+		return err
+	}
+	body := url.Values{"source": {source}, "target": {target}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return errors.New(resp.Status)
+	}
+	slog.Info("webmention sent", "source", source, "target", target)
+	return nil
+}
@@ -0,0 +1,353 @@
+// Package webmention receives Webmentions at /webmention, verifies them
+// and holds them for moderation in the admin UI, and sends them for the
+// links in new and changed pages. Mentions are stored as JSON in the data
+// dir.
+package webmention
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/core6quad/GOMD/admin"
+	"github.com/core6quad/GOMD/auth"
+)
+
+// Mention is a page elsewhere linking to one of ours. Type is what the
+// source marked the link as: "like", "repost", "reply", "bookmark" or a
+// plain "mention"
+type Mention struct {
+	ID     string `json:"id"`
+	Source string `json:"source"`
+	// Page URL of the target, e.g. /blog/post
+	Page      string    `json:"page"`
+	Type      string    `json:"type"`
+	Author    string    `json:"author,omitempty"`
+	AuthorURL string    `json:"author_url,omitempty"`
+	Title     string    `json:"title,omitempty"`
+	Text      string    `json:"text,omitempty"`
+	Time      time.Time `json:"time"`
+	Approved  bool      `json:"approved"`
+}
+
+// Store keeps all mentions in memory and in a JSON file
+type Store struct {
+	mu       sync.Mutex
+	path     string
+	mentions []Mention
+
+	// Where the site is served, to tell which targets are its pages.
+	// Without SiteURL, the host requests come in on
+	SiteURL  string
+	BasePath string
+	// PageExists reports whether a page URL can be mentioned
+	PageExists func(url string) bool
+	// OnChange runs after a mention is approved, updated or deleted, to
+	// rebuild pages showing them
+	OnChange func()
+	// Audit records who moderated which mention
+	Audit func(r *http.Request, action, target string)
+}
+
+// Open loads the mentions file from the data dir
+func Open(dataDir string) (*Store, error) {
+	s := &Store{path: filepath.Join(dataDir, "webmentions.json")}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.mentions); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Approved returns the published mentions of a page, oldest first
+func (s *Store) Approved(page string) []Mention {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Mention
+	for _, m := range s.mentions {
+		if m.Page == page && m.Approved {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// Pending returns verified mentions waiting for moderation, oldest first
+func (s *Store) Pending() []Mention {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Mention
+	for _, m := range s.mentions {
+		if !m.Approved {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// Record a verified mention. One the source already made of the page is
+// updated in place, and stays approved if it was
+func (s *Store) put(m Mention) error {
+	s.mu.Lock()
+	for i, old := range s.mentions {
+		if old.Source == m.Source && old.Page == m.Page {
+			m.ID, m.Approved = old.ID, old.Approved
+			s.mentions[i] = m
+			return s.saveAndNotify(m.Approved)
+		}
+	}
+	m.ID = newID()
+	s.mentions = append(s.mentions, m)
+	return s.saveAndNotify(false)
+}
+
+// Drop the mention of a page by a source that no longer links to it
+func (s *Store) remove(source, page string) error {
+	s.mu.Lock()
+	for i, m := range s.mentions {
+		if m.Source == source && m.Page == page {
+			s.mentions = append(s.mentions[:i], s.mentions[i+1:]...)
+			return s.saveAndNotify(m.Approved)
+		}
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// Approve publishes a pending mention
+func (s *Store) Approve(id string) error {
+	return s.update(id, func(i int) {
+		s.mentions[i].Approved = true
+	})
+}
+
+// Delete removes a mention, pending or published
+func (s *Store) Delete(id string) error {
+	return s.update(id, func(i int) {
+		s.mentions = append(s.mentions[:i], s.mentions[i+1:]...)
+	})
+}
+
+func (s *Store) update(id string, fn func(i int)) error {
+	s.mu.Lock()
+	i := 0
+	for i < len(s.mentions) && s.mentions[i].ID != id {
+		i++
+	}
+	if i == len(s.mentions) {
+		s.mu.Unlock()
+		return errors.New("no such mention")
+	}
+	fn(i)
+	return s.saveAndNotify(true)
+}
+
+// Save with mu held, then release it and rebuild if published mentions
+// changed
+func (s *Store) saveAndNotify(published bool) error {
+	err := s.save()
+	s.mu.Unlock()
+	if err == nil && published && s.OnChange != nil {
+		s.OnChange()
+	}
+	return err
+}
+
+// Write the mentions file atomically, the caller holds mu
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.mentions, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// The page URL of a target on this site, or "" when it points elsewhere
+func (s *Store) page(target string, r *http.Request) string {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	host := r.Host
+	if site, err := url.Parse(s.SiteURL); err == nil && s.SiteURL != "" {
+		host = site.Host
+	}
+	if !strings.EqualFold(u.Host, host) {
+		return ""
+	}
+	p := u.Path
+	if s.BasePath != "" {
+		var ok bool
+		if p, ok = strings.CutPrefix(p, s.BasePath); !ok {
+			return ""
+		}
+	}
+	if p == "" || p == "/" {
+		p = "/index"
+	}
+	p = strings.TrimSuffix(p, ".html")
+	if s.PageExists != nil && !s.PageExists(p) {
+		return ""
+	}
+	return p
+}
+
+// ServeHTTP is the Webmention endpoint: a POST with source and target
+// is accepted right away, and verified in the background
+func (s *Store) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 8<<10)
+	source, target := r.PostFormValue("source"), r.PostFormValue("target")
+	src, err := url.Parse(source)
+	if err != nil || (src.Scheme != "http" && src.Scheme != "https") || src.Host == "" {
+		http.Error(w, "source must be an http(s) URL", http.StatusBadRequest)
+		return
+	}
+	if source == target {
+		http.Error(w, "source and target are the same", http.StatusBadRequest)
+		return
+	}
+	page := s.page(target, r)
+	if page == "" {
+		http.Error(w, "target is not a page of this site", http.StatusBadRequest)
+		return
+	}
+	go func() {
+		if err := s.verify(source, target, page); err != nil {
+			slog.Info("webmention rejected", "source", source, "target", target, "err", err)
+		}
+	}()
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte("Accepted, the mention will be verified and moderated.\n"))
+}
+
+// Fetch the source and check it still links to the target
+func (s *Store) verify(source, target, page string) error {
+	resp, err := client.Get(source)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusGone || resp.StatusCode == http.StatusNotFound {
+		return s.remove(source, page)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+	m, ok := parseSource(resp, source, target)
+	if !ok {
+		s.remove(source, page)
+		return errors.New("source does not link to target")
+	}
+	m.Page, m.Time = page, time.Now().UTC()
+	return s.put(m)
+}
+
+var moderation = template.Must(template.New("moderation").Parse(`
+{{if .Mentions}}
+<table>
+<tr><th>Page</th><th>Type</th><th>From</th><th>Text</th><th>Received</th><th></th></tr>
+{{range .Mentions}}<tr>
+	<td><a href="{{.Page}}">{{.Page}}</a></td>
+	<td>{{.Type}}</td>
+	<td><a href="{{.Source}}" rel="nofollow noopener">{{or .Author .Source}}</a></td>
+	<td>{{or .Text .Title}}</td>
+	<td>{{.Time.Format "2006-01-02 15:04"}}</td>
+	<td>
+		<form class="inline" method="post">{{$.CSRF}}<input type="hidden" name="id" value="{{.ID}}"><button name="action" value="approve">Approve</button></form>
+		<form class="inline" method="post">{{$.CSRF}}<input type="hidden" name="id" value="{{.ID}}"><button class="danger" name="action" value="delete">Delete</button></form>
+	</td>
+</tr>{{end}}
+</table>
+{{else}}<p class="empty">No webmentions waiting for moderation.</p>{{end}}
+`))
+
+// Moderation is the admin section approving or deleting pending mentions
+func (s *Store) Moderation(a *admin.Admin) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var err error
+			id := r.PostFormValue("id")
+			action := r.PostFormValue("action")
+			target := id
+			for _, m := range s.Pending() {
+				if m.ID == id {
+					target = m.Page + " from " + m.Source
+				}
+			}
+			switch action {
+			case "approve":
+				err = s.Approve(id)
+			case "delete":
+				err = s.Delete(id)
+			default:
+				err = errors.New("unknown action")
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if s.Audit != nil {
+				s.Audit(r, action+" webmention", target)
+			}
+			http.Redirect(w, r, s.BasePath+r.URL.Path, http.StatusSeeOther)
+			return
+		}
+		var buf bytes.Buffer
+		moderation.Execute(&buf, map[string]interface{}{"Mentions": s.Pending(), "CSRF": auth.CSRFField(r)})
+		a.Render(w, r, "Webmentions", template.HTML(buf.String()))
+	})
+}
+
+// Partial defines the "webmentions" template for page layouts, listing
+// the approved mentions of the page:
+//
+//	{{template "webmentions" .}}
+const Partial = `{{define "webmentions"}}{{with webmentions .Page.URL}}<section class="webmentions" id="webmentions">
+<h2>Webmentions</h2>
+<ul>
+{{range .}}<li class="webmention {{.Type}}"><a href="{{or .AuthorURL .Source}}" rel="nofollow noopener">{{or .Author .Source}}</a>
+{{if eq .Type "like"}}liked{{else if eq .Type "repost"}}reposted{{else if eq .Type "bookmark"}}bookmarked{{else if eq .Type "reply"}}replied to{{else}}mentioned{{end}} this
+<a href="{{.Source}}" rel="nofollow noopener"><time datetime="{{.Time.Format "2006-01-02T15:04:05Z07:00"}}">{{.Time.Format "January 2, 2006"}}</time></a>
+{{if eq .Type "reply" "mention"}}<blockquote>{{or .Text .Title}}</blockquote>{{end}}</li>
+{{end}}</ul>
+</section>{{end}}{{end}}`
+
+// DisabledPartial keeps layouts using the partial working with webmentions
+// off
+const DisabledPartial = `{{define "webmentions"}}{{end}}`